@@ -16,11 +16,15 @@ replace go.uber.org/zap v1.27.0 => github.com/team-ide/zap v1.27.0
 
 require (
 	github.com/PuerkitoBio/goquery v1.8.1
+	github.com/Shopify/sarama v1.38.1
 	github.com/apache/thrift v0.17.0
+	github.com/bufbuild/protocompile v0.6.0
 	github.com/creack/pty v1.1.21
 	github.com/dop251/goja v0.0.0-20240516125602-ccbae20bcec2
 	github.com/gin-gonic/gin v1.10.0
+	github.com/go-redis/redis/v8 v8.11.5
 	github.com/go-zookeeper/zk v1.0.4
+	github.com/golang/snappy v0.0.4
 	github.com/google/uuid v1.6.0
 	github.com/gorilla/websocket v1.5.1
 	github.com/jacobsa/go-serial v0.0.0-20180131005756-15cf729a72d4
@@ -31,10 +35,12 @@ require (
 	github.com/team-ide/cron v1.0.1
 	github.com/team-ide/go-dialect v1.9.23
 	github.com/team-ide/go-tool v1.2.27
+	github.com/ugorji/go/codec v1.2.12
 	go.mongodb.org/mongo-driver v1.17.1
 	go.uber.org/zap v1.27.0
 	golang.org/x/crypto v0.28.0
 	golang.org/x/net v0.25.0
+	google.golang.org/protobuf v1.34.1
 	gopkg.in/natefinch/lumberjack.v2 v2.2.1
 	gopkg.in/yaml.v3 v3.0.1
 )
@@ -42,7 +48,6 @@ require (
 require (
 	filippo.io/edwards25519 v1.1.0 // indirect
 	gitee.com/opengauss/openGauss-connector-go-pq v1.0.4 // indirect
-	github.com/Shopify/sarama v1.38.1 // indirect
 	github.com/andybalholm/cascadia v1.3.1 // indirect
 	github.com/bytedance/sonic v1.11.6 // indirect
 	github.com/bytedance/sonic/loader v0.1.1 // indirect
@@ -64,13 +69,11 @@ require (
 	github.com/go-playground/locales v0.14.1 // indirect
 	github.com/go-playground/universal-translator v0.18.1 // indirect
 	github.com/go-playground/validator/v10 v10.20.0 // indirect
-	github.com/go-redis/redis/v8 v8.11.5 // indirect
 	github.com/go-sourcemap/sourcemap v2.1.3+incompatible // indirect
 	github.com/go-sql-driver/mysql v1.8.1 // indirect
 	github.com/goccy/go-json v0.10.2 // indirect
 	github.com/godror/godror v0.37.0 // indirect
 	github.com/godror/knownpb v0.1.0 // indirect
-	github.com/golang/snappy v0.0.4 // indirect
 	github.com/google/btree v1.0.0 // indirect
 	github.com/google/go-cmp v0.6.0 // indirect
 	github.com/google/pprof v0.0.0-20230207041349-798e818bf904 // indirect
@@ -116,7 +119,6 @@ require (
 	github.com/tklauser/go-sysconf v0.3.12 // indirect
 	github.com/tklauser/numcpus v0.6.1 // indirect
 	github.com/twitchyliquid64/golang-asm v0.15.1 // indirect
-	github.com/ugorji/go/codec v1.2.12 // indirect
 	github.com/xdg-go/pbkdf2 v1.0.0 // indirect
 	github.com/xdg-go/scram v1.1.2 // indirect
 	github.com/xdg-go/stringprep v1.0.4 // indirect
@@ -128,5 +130,4 @@ require (
 	golang.org/x/sys v0.26.0 // indirect
 	golang.org/x/text v0.19.0 // indirect
 	golang.org/x/xerrors v0.0.0-20220907171357-04be3eba64a2 // indirect
-	google.golang.org/protobuf v1.34.1 // indirect
 )
@@ -7,6 +7,7 @@ import (
 	"strings"
 	"teamide/internal/context"
 	"teamide/internal/install"
+	"teamide/internal/module/module_database"
 	"teamide/internal/module/module_id"
 	"teamide/internal/module/module_log"
 	"teamide/internal/module/module_login"
@@ -132,6 +133,11 @@ func (this_ *InstallService) Install() (err error) {
 		return
 	}
 
+	err = this_.InstallSteps(module_database.GetInstallStages())
+	if err != nil {
+		return
+	}
+
 	return
 }
 
@@ -0,0 +1,390 @@
+package module_database
+
+import (
+	"errors"
+	"github.com/team-ide/go-dialect/dialect"
+	"github.com/team-ide/go-tool/db"
+	"github.com/team-ide/go-tool/util"
+	"go.uber.org/zap"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ActivitySession 数据库 会话 / 进程
+type ActivitySession struct {
+	SessionId   string   `json:"sessionId"` // Oracle 为 sid,serial#
+	Username    string   `json:"username"`
+	Database    string   `json:"database"`
+	Host        string   `json:"host"`
+	Program     string   `json:"program"`
+	Command     string   `json:"command"`
+	State       string   `json:"state"`
+	WaitEvent   string   `json:"waitEvent"`
+	Sql         string   `json:"sql"`
+	Seconds     float64  `json:"seconds"` // 当前 语句 或 状态 持续 秒
+	Idle        bool     `json:"idle"`
+	BlockingIds []string `json:"blockingIds,omitempty"` // 阻塞 当前 会话 的 会话
+}
+
+// LockWait 锁 等待，waiting 等待 blocking 持有 的 锁
+type LockWait struct {
+	WaitingId   string  `json:"waitingId"`
+	WaitingSql  string  `json:"waitingSql"`
+	BlockingId  string  `json:"blockingId"`
+	BlockingSql string  `json:"blockingSql"`
+	ObjectName  string  `json:"objectName"`
+	LockType    string  `json:"lockType"`
+	LockMode    string  `json:"lockMode"`
+	WaitSeconds float64 `json:"waitSeconds"`
+}
+
+// BlockingChain 阻塞 链，从 未 被 阻塞 的 源头 会话 到 最终 等待 的 会话
+type BlockingChain struct {
+	RootId   string   `json:"rootId"`
+	Sessions []string `json:"sessions"`
+	Deadlock bool     `json:"deadlock,omitempty"` // 链 中 存在 循环
+}
+
+// ActivityParam 会话 查询 与 终止 参数
+type ActivityParam struct {
+	IncludeIdle bool   `json:"includeIdle"`
+	SessionId   string `json:"sessionId"`
+	OnlyQuery   bool   `json:"onlyQuery"` // 只 终止 当前 语句，保留 会话
+}
+
+type ActivityResult struct {
+	DatabaseType   string             `json:"databaseType"`
+	Sessions       []*ActivitySession `json:"sessions"`
+	LockWaits      []*LockWait        `json:"lockWaits"`
+	BlockingChains []*BlockingChain   `json:"blockingChains"`
+	Warnings       []string           `json:"warnings,omitempty"` // 部分 视图 无 权限 等
+}
+
+const (
+	mysqlSessionsSql = `SELECT ID AS SESSION_ID, USER AS USERNAME, DB AS DATABASE_NAME, HOST, COMMAND, STATE, INFO AS SQL_TEXT, TIME AS SECONDS
+FROM information_schema.PROCESSLIST WHERE ID <> CONNECTION_ID()`
+
+	// mysqlLockWaitsSql MySQL 8 performance_schema
+	mysqlLockWaitsSql = `SELECT wt.PROCESSLIST_ID AS WAITING_ID, wt.PROCESSLIST_INFO AS WAITING_SQL,
+ bt.PROCESSLIST_ID AS BLOCKING_ID, bt.PROCESSLIST_INFO AS BLOCKING_SQL,
+ CONCAT(wl.OBJECT_SCHEMA, '.', wl.OBJECT_NAME) AS OBJECT_NAME, wl.LOCK_TYPE, wl.LOCK_MODE, wt.PROCESSLIST_TIME AS WAIT_SECONDS
+FROM performance_schema.data_lock_waits w
+JOIN performance_schema.threads wt ON wt.THREAD_ID = w.REQUESTING_THREAD_ID
+JOIN performance_schema.threads bt ON bt.THREAD_ID = w.BLOCKING_THREAD_ID
+JOIN performance_schema.data_locks wl ON wl.ENGINE_LOCK_ID = w.REQUESTING_ENGINE_LOCK_ID`
+
+	// mysqlLockWaitsSql57 MySQL 5.7 没有 data_lock_waits，使用 information_schema
+	mysqlLockWaitsSql57 = `SELECT r.trx_mysql_thread_id AS WAITING_ID, r.trx_query AS WAITING_SQL,
+ b.trx_mysql_thread_id AS BLOCKING_ID, b.trx_query AS BLOCKING_SQL,
+ l.lock_table AS OBJECT_NAME, l.lock_type AS LOCK_TYPE, l.lock_mode AS LOCK_MODE,
+ TIMESTAMPDIFF(SECOND, r.trx_wait_started, NOW()) AS WAIT_SECONDS
+FROM information_schema.INNODB_LOCK_WAITS w
+JOIN information_schema.INNODB_TRX b ON b.trx_id = w.blocking_trx_id
+JOIN information_schema.INNODB_TRX r ON r.trx_id = w.requesting_trx_id
+JOIN information_schema.INNODB_LOCKS l ON l.lock_id = w.requested_lock_id`
+
+	postgresqlSessionsSql = `SELECT pid AS session_id, usename AS username, datname AS database_name, client_addr::text AS host,
+ application_name AS program, backend_type AS command, state, wait_event_type || ':' || wait_event AS wait_event, query AS sql_text,
+ EXTRACT(EPOCH FROM (now() - COALESCE(query_start, backend_start))) AS seconds,
+ array_to_string(pg_blocking_pids(pid), ',') AS blocking_ids
+FROM pg_stat_activity WHERE pid <> pg_backend_pid()`
+
+	postgresqlLockWaitsSql = `SELECT w.pid AS waiting_id, w.query AS waiting_sql, b.pid AS blocking_id, b.query AS blocking_sql,
+ l.relation::regclass::text AS object_name, l.locktype AS lock_type, l.mode AS lock_mode,
+ EXTRACT(EPOCH FROM (now() - w.query_start)) AS wait_seconds
+FROM pg_stat_activity w
+JOIN pg_locks l ON l.pid = w.pid AND NOT l.granted
+CROSS JOIN LATERAL unnest(pg_blocking_pids(w.pid)) AS bp(pid)
+JOIN pg_stat_activity b ON b.pid = bp.pid`
+
+	oracleSessionsSql = `SELECT s.SID || ',' || s.SERIAL# AS SESSION_ID, s.USERNAME, s.SCHEMANAME AS DATABASE_NAME, s.MACHINE AS HOST,
+ s.PROGRAM, s.COMMAND, s.STATUS AS STATE, s.EVENT AS WAIT_EVENT, q.SQL_TEXT, s.LAST_CALL_ET AS SECONDS,
+ b.SID || ',' || b.SERIAL# AS BLOCKING_IDS
+FROM V$SESSION s
+LEFT JOIN V$SQL q ON q.SQL_ID = s.SQL_ID AND q.CHILD_NUMBER = s.SQL_CHILD_NUMBER
+LEFT JOIN V$SESSION b ON b.SID = s.BLOCKING_SESSION
+WHERE s.TYPE = 'USER' AND s.SID <> SYS_CONTEXT('USERENV', 'SID')`
+
+	oracleLockWaitsSql = `SELECT w.SID || ',' || w.SERIAL# AS WAITING_ID, wq.SQL_TEXT AS WAITING_SQL,
+ b.SID || ',' || b.SERIAL# AS BLOCKING_ID, bq.SQL_TEXT AS BLOCKING_SQL,
+ o.OWNER || '.' || o.OBJECT_NAME AS OBJECT_NAME, w.EVENT AS LOCK_TYPE, w.WAIT_CLASS AS LOCK_MODE, w.SECONDS_IN_WAIT AS WAIT_SECONDS
+FROM V$SESSION w
+JOIN V$SESSION b ON b.SID = w.BLOCKING_SESSION
+LEFT JOIN V$SQL wq ON wq.SQL_ID = w.SQL_ID AND wq.CHILD_NUMBER = w.SQL_CHILD_NUMBER
+LEFT JOIN V$SQL bq ON bq.SQL_ID = b.PREV_SQL_ID AND bq.CHILD_NUMBER = b.PREV_CHILD_NUMBER
+LEFT JOIN ALL_OBJECTS o ON o.OBJECT_ID = w.ROW_WAIT_OBJ#
+WHERE w.BLOCKING_SESSION IS NOT NULL`
+)
+
+// rowValue 按 字段 名 不 区分 大小写 取值，PostgreSQL 别名 为 小写
+func rowValue(row map[string]interface{}, name string) interface{} {
+	if v, ok := row[name]; ok {
+		return v
+	}
+	for key, v := range row {
+		if strings.EqualFold(key, name) {
+			return v
+		}
+	}
+	return nil
+}
+
+func rowString(row map[string]interface{}, name string) string {
+	return strings.TrimSpace(planString(rowValue(row, name)))
+}
+
+func splitActivityIds(v string) (ids []string) {
+	for _, one := range strings.Split(v, ",") {
+		one = strings.TrimSpace(one)
+		if one != "" {
+			ids = append(ids, one)
+		}
+	}
+	return
+}
+
+func toActivitySession(dia dialect.Dialect, row map[string]interface{}) (session *ActivitySession) {
+	session = &ActivitySession{
+		SessionId: rowString(row, "SESSION_ID"),
+		Username:  rowString(row, "USERNAME"),
+		Database:  rowString(row, "DATABASE_NAME"),
+		Host:      rowString(row, "HOST"),
+		Program:   rowString(row, "PROGRAM"),
+		Command:   rowString(row, "COMMAND"),
+		State:     rowString(row, "STATE"),
+		WaitEvent: rowString(row, "WAIT_EVENT"),
+		Sql:       rowString(row, "SQL_TEXT"),
+		Seconds:   planFloat(rowValue(row, "SECONDS")),
+	}
+	blockingIds := rowString(row, "BLOCKING_IDS")
+	switch dia.DialectType() {
+	case dialect.TypeMysql:
+		session.Idle = strings.EqualFold(session.Command, "Sleep")
+	case dialect.TypeOracle:
+		session.Idle = !strings.EqualFold(session.State, "ACTIVE")
+		// 没有 阻塞 会话 时 拼接 结果 为 ","
+		if blockingIds == "," {
+			blockingIds = ""
+		}
+		if blockingIds != "" {
+			session.BlockingIds = []string{blockingIds}
+		}
+		return
+	default:
+		// 事务 中 的 空闲 会话 可能 持有 锁，不 作为 空闲
+		session.Idle = session.State == "" || session.State == "idle"
+	}
+	session.BlockingIds = splitActivityIds(blockingIds)
+	return
+}
+
+func toLockWait(row map[string]interface{}) *LockWait {
+	return &LockWait{
+		WaitingId:   rowString(row, "WAITING_ID"),
+		WaitingSql:  rowString(row, "WAITING_SQL"),
+		BlockingId:  rowString(row, "BLOCKING_ID"),
+		BlockingSql: rowString(row, "BLOCKING_SQL"),
+		ObjectName:  strings.Trim(rowString(row, "OBJECT_NAME"), "."),
+		LockType:    rowString(row, "LOCK_TYPE"),
+		LockMode:    rowString(row, "LOCK_MODE"),
+		WaitSeconds: planFloat(rowValue(row, "WAIT_SECONDS")),
+	}
+}
+
+func activitySql(dia dialect.Dialect) (sessionsSql string, lockWaitsSqlList []string, err error) {
+	switch dia.DialectType() {
+	case dialect.TypeMysql:
+		return mysqlSessionsSql, []string{mysqlLockWaitsSql, mysqlLockWaitsSql57}, nil
+	case dialect.TypePostgresql, dialect.TypeKingBase, dialect.TypeOpenGauss:
+		return postgresqlSessionsSql, []string{postgresqlLockWaitsSql}, nil
+	case dialect.TypeOracle:
+		return oracleSessionsSql, []string{oracleLockWaitsSql}, nil
+	}
+	err = errors.New("数据库类型[" + dia.DialectType().Name + "]暂不支持会话监控")
+	return
+}
+
+// activity 查询 会话 与 锁 等待，includeIdle 为 false 时 过滤 空闲 会话
+func activity(service db.IService, includeIdle bool) (result *ActivityResult, err error) {
+	dia := service.GetDialect()
+	sessionsSql, lockWaitsSqlList, err := activitySql(dia)
+	if err != nil {
+		return
+	}
+	result = &ActivityResult{
+		DatabaseType:   dia.DialectType().Name,
+		Sessions:       []*ActivitySession{},
+		LockWaits:      []*LockWait{},
+		BlockingChains: []*BlockingChain{},
+	}
+	rows, err := service.QueryMap(sessionsSql, nil)
+	if err != nil {
+		err = errors.New("会话查询失败:" + err.Error())
+		return
+	}
+	var sessions []*ActivitySession
+	for _, row := range rows {
+		sessions = append(sessions, toActivitySession(dia, row))
+	}
+
+	// 锁 视图 需要 额外 权限 或 版本 不 支持 时 只 提示，不 影响 会话 列表
+	var lockErr error
+	for _, lockWaitsSql := range lockWaitsSqlList {
+		rows, lockErr = service.QueryMap(lockWaitsSql, nil)
+		if lockErr == nil {
+			break
+		}
+	}
+	if lockErr != nil {
+		util.Logger.Warn("activity lock waits query error", zap.Error(lockErr))
+		result.Warnings = append(result.Warnings, "锁等待查询失败:"+lockErr.Error())
+	} else {
+		for _, row := range rows {
+			result.LockWaits = append(result.LockWaits, toLockWait(row))
+		}
+	}
+	result.BlockingChains = blockingChains(sessions, result.LockWaits)
+
+	// 空闲 的 会话 可能 持有 锁，在 阻塞 链 中 的 保留
+	inChain := map[string]bool{}
+	for _, chain := range result.BlockingChains {
+		for _, one := range chain.Sessions {
+			inChain[one] = true
+		}
+	}
+	for _, session := range sessions {
+		if session.Idle && !includeIdle && !inChain[session.SessionId] {
+			continue
+		}
+		result.Sessions = append(result.Sessions, session)
+	}
+	sort.Slice(result.Sessions, func(i, j int) bool {
+		return result.Sessions[i].Seconds > result.Sessions[j].Seconds
+	})
+	return
+}
+
+// blockingChains 按 等待 关系 生成 阻塞 链，源头 为 阻塞 其它 会话 且 自身 未 被 阻塞 的 会话
+func blockingChains(sessions []*ActivitySession, lockWaits []*LockWait) (chains []*BlockingChain) {
+	chains = []*BlockingChain{}
+	blockedBy := map[string][]string{} // blocking -> waiting
+	waiting := map[string]bool{}
+	add := func(waitingId string, blockingId string) {
+		if waitingId == "" || blockingId == "" || util.StringIndexOf(blockedBy[blockingId], waitingId) >= 0 {
+			return
+		}
+		blockedBy[blockingId] = append(blockedBy[blockingId], waitingId)
+		waiting[waitingId] = true
+	}
+	for _, one := range lockWaits {
+		add(one.WaitingId, one.BlockingId)
+	}
+	for _, session := range sessions {
+		for _, blockingId := range session.BlockingIds {
+			add(session.SessionId, blockingId)
+		}
+	}
+
+	var roots []string
+	for blockingId := range blockedBy {
+		if !waiting[blockingId] {
+			roots = append(roots, blockingId)
+		}
+	}
+	sort.Strings(roots)
+	var walk func(path []string)
+	walk = func(path []string) {
+		last := path[len(path)-1]
+		next := blockedBy[last]
+		if len(next) == 0 {
+			chains = append(chains, &BlockingChain{RootId: path[0], Sessions: path})
+			return
+		}
+		for _, one := range next {
+			if util.StringIndexOf(path, one) >= 0 {
+				chains = append(chains, &BlockingChain{RootId: path[0], Sessions: append(append([]string{}, path...), one), Deadlock: true})
+				continue
+			}
+			walk(append(append([]string{}, path...), one))
+		}
+	}
+	for _, root := range roots {
+		walk([]string{root})
+	}
+	// 所有 会话 都 在 等待 时 为 死锁 循环，没有 源头
+	visited := map[string]bool{}
+	for _, chain := range chains {
+		for _, one := range chain.Sessions {
+			visited[one] = true
+		}
+	}
+	var cycles []string
+	for blockingId := range blockedBy {
+		if !visited[blockingId] {
+			cycles = append(cycles, blockingId)
+		}
+	}
+	sort.Strings(cycles)
+	for _, one := range cycles {
+		if visited[one] {
+			continue
+		}
+		path := []string{one}
+		visited[one] = true
+		for {
+			next := blockedBy[path[len(path)-1]]
+			if len(next) == 0 {
+				break
+			}
+			path = append(path, next[0])
+			if visited[next[0]] {
+				break
+			}
+			visited[next[0]] = true
+		}
+		chains = append(chains, &BlockingChain{RootId: one, Sessions: path, Deadlock: true})
+	}
+	return
+}
+
+var (
+	numberSessionIdRegexp = regexp.MustCompile(`^\d+$`)
+	oracleSessionIdRegexp = regexp.MustCompile(`^\d+,\d+$`)
+)
+
+// getKillSessionSql 终止 会话，onlyQuery 为 true 时 只 终止 当前 语句
+func getKillSessionSql(dia dialect.Dialect, sessionId string, onlyQuery bool) (sqlInfo string, err error) {
+	sessionId = strings.TrimSpace(sessionId)
+	switch dia.DialectType() {
+	case dialect.TypeMysql:
+		if !numberSessionIdRegexp.MatchString(sessionId) {
+			break
+		}
+		if onlyQuery {
+			return "KILL QUERY " + sessionId, nil
+		}
+		return "KILL " + sessionId, nil
+	case dialect.TypePostgresql, dialect.TypeKingBase, dialect.TypeOpenGauss:
+		if !numberSessionIdRegexp.MatchString(sessionId) {
+			break
+		}
+		if onlyQuery {
+			return "SELECT pg_cancel_backend(" + sessionId + ")", nil
+		}
+		return "SELECT pg_terminate_backend(" + sessionId + ")", nil
+	case dialect.TypeOracle:
+		if !oracleSessionIdRegexp.MatchString(sessionId) {
+			break
+		}
+		if onlyQuery {
+			return "ALTER SYSTEM CANCEL SQL '" + sessionId + "'", nil
+		}
+		return "ALTER SYSTEM KILL SESSION '" + sessionId + "' IMMEDIATE", nil
+	default:
+		err = errors.New("数据库类型[" + dia.DialectType().Name + "]暂不支持终止会话")
+		return
+	}
+	err = errors.New("会话ID[" + sessionId + "]格式错误")
+	return
+}
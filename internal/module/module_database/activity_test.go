@@ -0,0 +1,75 @@
+package module_database
+
+import (
+	"github.com/team-ide/go-dialect/dialect"
+	"strings"
+	"testing"
+)
+
+// formatChains 阻塞 链 格式 为 root:a>b>c，死锁 加 !
+func formatChains(chains []*BlockingChain) string {
+	var list []string
+	for _, chain := range chains {
+		str := chain.RootId + ":" + strings.Join(chain.Sessions, ">")
+		if chain.Deadlock {
+			str += "!"
+		}
+		list = append(list, str)
+	}
+	return strings.Join(list, " ")
+}
+
+func TestBlockingChains(t *testing.T) {
+	list := []struct {
+		name      string
+		sessions  []*ActivitySession
+		lockWaits []*LockWait
+		want      string
+	}{
+		{"empty", nil, nil, ""},
+		{"chain", nil, []*LockWait{{WaitingId: "2", BlockingId: "1"}, {WaitingId: "3", BlockingId: "2"}}, "1:1>2>3"},
+		{"branch", nil, []*LockWait{{WaitingId: "3", BlockingId: "1"}, {WaitingId: "2", BlockingId: "1"}}, "1:1>3 1:1>2"},
+		{"merge sessions", []*ActivitySession{{SessionId: "2", BlockingIds: []string{"1"}}}, []*LockWait{{WaitingId: "2", BlockingId: "1"}}, "1:1>2"},
+		{"empty id", []*ActivitySession{{SessionId: "2", BlockingIds: []string{""}}}, []*LockWait{{WaitingId: "", BlockingId: "1"}}, ""},
+		{"deadlock", nil, []*LockWait{{WaitingId: "1", BlockingId: "2"}, {WaitingId: "2", BlockingId: "1"}}, "1:1>2>1!"},
+		{"root with deadlock", nil, []*LockWait{{WaitingId: "2", BlockingId: "1"}, {WaitingId: "3", BlockingId: "2"}, {WaitingId: "2", BlockingId: "3"}}, "1:1>2>3>2!"},
+	}
+	for _, one := range list {
+		got := formatChains(blockingChains(one.sessions, one.lockWaits))
+		if got != one.want {
+			t.Errorf("blockingChains %s = %q, want %q", one.name, got, one.want)
+		}
+	}
+}
+
+func TestGetKillSessionSql(t *testing.T) {
+	list := []struct {
+		dialectType string
+		sessionId   string
+		onlyQuery   bool
+		want        string
+		wantErr     bool
+	}{
+		{"mysql", "12", false, "KILL 12", false},
+		{"mysql", " 12 ", true, "KILL QUERY 12", false},
+		{"mysql", "12; DROP TABLE t", false, "", true},
+		{"postgresql", "12", false, "SELECT pg_terminate_backend(12)", false},
+		{"postgresql", "12", true, "SELECT pg_cancel_backend(12)", false},
+		{"postgresql", "12)", false, "", true},
+		{"oracle", "12,34", false, "ALTER SYSTEM KILL SESSION '12,34' IMMEDIATE", false},
+		{"oracle", "12,34", true, "ALTER SYSTEM CANCEL SQL '12,34'", false},
+		{"oracle", "12", false, "", true},
+		{"oracle", "12,34' --", false, "", true},
+		{"sqlite", "12", false, "", true},
+	}
+	for _, one := range list {
+		dia, err := dialect.NewDialect(one.dialectType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := getKillSessionSql(dia, one.sessionId, one.onlyQuery)
+		if got != one.want || (err != nil) != one.wantErr {
+			t.Errorf("getKillSessionSql(%s, %q, %v) = %q, %v, want %q, error %v", one.dialectType, one.sessionId, one.onlyQuery, got, err, one.want, one.wantErr)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package module_database
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
@@ -23,19 +24,24 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"strings"
 	"sync"
 	"teamide/internal/module/module_toolbox"
+	"teamide/pkg/background"
 	"teamide/pkg/base"
 	"teamide/pkg/ssh"
+	"time"
 )
 
 type api struct {
 	toolboxService *module_toolbox.ToolboxService
+	sqlService     *SqlService
 }
 
 func NewApi(toolboxService *module_toolbox.ToolboxService) *api {
 	return &api{
 		toolboxService: toolboxService,
+		sqlService:     NewSqlService(toolboxService.ServerContext),
 	}
 }
 
@@ -62,6 +68,8 @@ var (
 	dataListSqlPower    = base.AppendPower(&base.PowerAction{Action: "dataListSql", Text: "数据库数据转换SQL", ShouldLogin: true, StandAlone: true, Parent: Power})
 	dataListExecPower   = base.AppendPower(&base.PowerAction{Action: "dataListExec", Text: "数据库数据执行", ShouldLogin: true, StandAlone: true, Parent: Power})
 	executeSQLPower     = base.AppendPower(&base.PowerAction{Action: "executeSQL", Text: "数据库SQL执行", ShouldLogin: true, StandAlone: true, Parent: Power})
+	executeCancelPower  = base.AppendPower(&base.PowerAction{Action: "executeCancel", Text: "数据库SQL执行取消", ShouldLogin: true, StandAlone: true, Parent: Power})
+	explainPower        = base.AppendPower(&base.PowerAction{Action: "explain", Text: "数据库执行计划", ShouldLogin: true, StandAlone: true, Parent: Power})
 	importPower         = base.AppendPower(&base.PowerAction{Action: "import", Text: "数据库导入", ShouldLogin: true, StandAlone: true, Parent: Power})
 	exportPower         = base.AppendPower(&base.PowerAction{Action: "export", Text: "数据库导出", ShouldLogin: true, StandAlone: true, Parent: Power})
 	exportDownloadPower = base.AppendPower(&base.PowerAction{Action: "exportDownload", Text: "数据库导出下载", ShouldLogin: true, StandAlone: true, Parent: Power})
@@ -71,6 +79,36 @@ var (
 	taskCleanPower      = base.AppendPower(&base.PowerAction{Action: "taskClean", Text: "数据库任务清理", ShouldLogin: true, StandAlone: true, Parent: Power})
 	closePower          = base.AppendPower(&base.PowerAction{Action: "close", Text: "数据库关闭", ShouldLogin: true, StandAlone: true, Parent: Power})
 
+	historyPower        = base.AppendPower(&base.PowerAction{Action: "history", Text: "数据库SQL历史", ShouldLogin: true, StandAlone: true, Parent: Power})
+	historyQueryPower   = base.AppendPower(&base.PowerAction{Action: "query", Text: "数据库SQL历史查询", ShouldLogin: true, StandAlone: true, Parent: historyPower})
+	historyCleanPower   = base.AppendPower(&base.PowerAction{Action: "clean", Text: "数据库SQL历史清理", ShouldLogin: true, StandAlone: true, Parent: historyPower})
+	sqlQueryPower       = base.AppendPower(&base.PowerAction{Action: "sqlQuery", Text: "数据库保存的SQL", ShouldLogin: true, StandAlone: true, Parent: Power})
+	sqlQueryListPower   = base.AppendPower(&base.PowerAction{Action: "list", Text: "数据库保存的SQL查询", ShouldLogin: true, StandAlone: true, Parent: sqlQueryPower})
+	sqlQuerySavePower   = base.AppendPower(&base.PowerAction{Action: "save", Text: "数据库SQL保存", ShouldLogin: true, StandAlone: true, Parent: sqlQueryPower})
+	sqlQueryDeletePower = base.AppendPower(&base.PowerAction{Action: "delete", Text: "数据库保存的SQL删除", ShouldLogin: true, StandAlone: true, Parent: sqlQueryPower})
+
+	foreignKeyGraphPower = base.AppendPower(&base.PowerAction{Action: "foreignKeyGraph", Text: "数据库外键关系", ShouldLogin: true, StandAlone: true, Parent: Power})
+	schemaComparePower   = base.AppendPower(&base.PowerAction{Action: "schemaCompare", Text: "数据库结构对比", ShouldLogin: true, StandAlone: true, Parent: Power})
+	dataComparePower     = base.AppendPower(&base.PowerAction{Action: "dataCompare", Text: "数据库数据对比", ShouldLogin: true, StandAlone: true, Parent: Power})
+	mockDataPower        = base.AppendPower(&base.PowerAction{Action: "mockData", Text: "数据库模拟数据", ShouldLogin: true, StandAlone: true, Parent: Power})
+
+	transactionBeginPower    = base.AppendPower(&base.PowerAction{Action: "transactionBegin", Text: "数据库事务开启", ShouldLogin: true, StandAlone: true, Parent: Power})
+	transactionCommitPower   = base.AppendPower(&base.PowerAction{Action: "transactionCommit", Text: "数据库事务提交", ShouldLogin: true, StandAlone: true, Parent: Power})
+	transactionRollbackPower = base.AppendPower(&base.PowerAction{Action: "transactionRollback", Text: "数据库事务回滚", ShouldLogin: true, StandAlone: true, Parent: Power})
+	transactionStatusPower   = base.AppendPower(&base.PowerAction{Action: "transactionStatus", Text: "数据库事务状态", ShouldLogin: true, StandAlone: true, Parent: Power})
+
+	activityPower    = base.AppendPower(&base.PowerAction{Action: "activity", Text: "数据库会话监控", ShouldLogin: true, StandAlone: true, Parent: Power})
+	killSessionPower = base.AppendPower(&base.PowerAction{Action: "killSession", Text: "数据库终止会话", ShouldLogin: true, StandAlone: true, Parent: Power})
+
+	objectListPower       = base.AppendPower(&base.PowerAction{Action: "objectList", Text: "数据库对象列表", ShouldLogin: true, StandAlone: true, Parent: Power})
+	objectDetailPower     = base.AppendPower(&base.PowerAction{Action: "objectDetail", Text: "数据库对象详情", ShouldLogin: true, StandAlone: true, Parent: Power})
+	objectDdlPower        = base.AppendPower(&base.PowerAction{Action: "objectDdl", Text: "数据库对象DDL", ShouldLogin: true, StandAlone: true, Parent: Power})
+	procedureExecutePower = base.AppendPower(&base.PowerAction{Action: "procedureExecute", Text: "数据库存储过程执行", ShouldLogin: true, StandAlone: true, Parent: Power})
+
+	backupPower         = base.AppendPower(&base.PowerAction{Action: "backup", Text: "数据库备份", ShouldLogin: true, StandAlone: true, Parent: Power})
+	backupDownloadPower = base.AppendPower(&base.PowerAction{Action: "backupDownload", Text: "数据库备份下载", ShouldLogin: true, StandAlone: true, Parent: Power})
+	restorePower        = base.AppendPower(&base.PowerAction{Action: "restore", Text: "数据库恢复", ShouldLogin: true, StandAlone: true, Parent: Power})
+
 	testStart  = base.AppendPower(&base.PowerAction{Action: "test/start", Text: "测试开始", ShouldLogin: true, StandAlone: true, Parent: Power})
 	testInfo   = base.AppendPower(&base.PowerAction{Action: "test/info", Text: "测试任务信息", ShouldLogin: true, StandAlone: true, Parent: Power})
 	testStop   = base.AppendPower(&base.PowerAction{Action: "test/stop", Text: "测试停止", ShouldLogin: true, StandAlone: true, Parent: Power})
@@ -90,6 +128,7 @@ func (this_ *api) GetApis() (apis []*base.ApiWorker) {
 	apis = append(apis, &base.ApiWorker{Power: modelPower, Do: this_.model})
 	apis = append(apis, &base.ApiWorker{Power: tablesPower, Do: this_.tables})
 	apis = append(apis, &base.ApiWorker{Power: tableDetailPower, Do: this_.tableDetail})
+	apis = append(apis, &base.ApiWorker{Power: foreignKeyGraphPower, Do: this_.foreignKeyGraph})
 	apis = append(apis, &base.ApiWorker{Power: tableCreatePower, Do: this_.tableCreate})
 	apis = append(apis, &base.ApiWorker{Power: tableCreateSqlPower, Do: this_.tableCreateSql})
 	apis = append(apis, &base.ApiWorker{Power: tableUpdatePower, Do: this_.tableUpdate})
@@ -100,6 +139,8 @@ func (this_ *api) GetApis() (apis []*base.ApiWorker) {
 	apis = append(apis, &base.ApiWorker{Power: dataListSqlPower, Do: this_.dataListSql})
 	apis = append(apis, &base.ApiWorker{Power: dataListExecPower, Do: this_.dataListExec})
 	apis = append(apis, &base.ApiWorker{Power: executeSQLPower, Do: this_.executeSQL})
+	apis = append(apis, &base.ApiWorker{Power: executeCancelPower, Do: this_.executeCancel})
+	apis = append(apis, &base.ApiWorker{Power: explainPower, Do: this_.explain})
 	apis = append(apis, &base.ApiWorker{Power: importPower, Do: this_._import})
 	apis = append(apis, &base.ApiWorker{Power: exportPower, Do: this_.export})
 	apis = append(apis, &base.ApiWorker{Power: exportDownloadPower, Do: this_.exportDownload})
@@ -116,6 +157,29 @@ func (this_ *api) GetApis() (apis []*base.ApiWorker) {
 
 	apis = append(apis, &base.ApiWorker{Power: closePower, Do: this_.close})
 
+	apis = append(apis, &base.ApiWorker{Power: historyQueryPower, Do: this_.historyQuery, NotRecodeLog: true})
+	apis = append(apis, &base.ApiWorker{Power: historyCleanPower, Do: this_.historyClean})
+	apis = append(apis, &base.ApiWorker{Power: sqlQueryListPower, Do: this_.sqlQueryList, NotRecodeLog: true})
+	apis = append(apis, &base.ApiWorker{Power: sqlQuerySavePower, Do: this_.sqlQuerySave})
+	apis = append(apis, &base.ApiWorker{Power: sqlQueryDeletePower, Do: this_.sqlQueryDelete})
+
+	apis = append(apis, &base.ApiWorker{Power: schemaComparePower, Do: this_.schemaCompare})
+	apis = append(apis, &base.ApiWorker{Power: dataComparePower, Do: this_.dataCompare})
+	apis = append(apis, &base.ApiWorker{Power: mockDataPower, Do: this_.mockData})
+	apis = append(apis, &base.ApiWorker{Power: transactionBeginPower, Do: this_.transactionBegin})
+	apis = append(apis, &base.ApiWorker{Power: transactionCommitPower, Do: this_.transactionCommit})
+	apis = append(apis, &base.ApiWorker{Power: transactionRollbackPower, Do: this_.transactionRollback})
+	apis = append(apis, &base.ApiWorker{Power: transactionStatusPower, Do: this_.transactionStatus})
+	apis = append(apis, &base.ApiWorker{Power: activityPower, Do: this_.activity})
+	apis = append(apis, &base.ApiWorker{Power: killSessionPower, Do: this_.killSession})
+	apis = append(apis, &base.ApiWorker{Power: objectListPower, Do: this_.objectList})
+	apis = append(apis, &base.ApiWorker{Power: objectDetailPower, Do: this_.objectDetail})
+	apis = append(apis, &base.ApiWorker{Power: objectDdlPower, Do: this_.objectDdl})
+	apis = append(apis, &base.ApiWorker{Power: procedureExecutePower, Do: this_.procedureExecute})
+	apis = append(apis, &base.ApiWorker{Power: backupPower, Do: this_.backup})
+	apis = append(apis, &base.ApiWorker{Power: backupDownloadPower, Do: this_.backupDownload})
+	apis = append(apis, &base.ApiWorker{Power: restorePower, Do: this_.restore})
+
 	return
 }
 
@@ -128,6 +192,32 @@ func (this_ *api) getConfig(requestBean *base.RequestBean, c *gin.Context) (conf
 	return
 }
 
+// getConfigById 按 工具 ID 获取 配置 并 校验 权限，用于 跨 工具 操作
+func (this_ *api) getConfigById(requestBean *base.RequestBean, toolboxId int64) (config *db.Config, sshConfig *ssh.Config, err error) {
+	find, err := this_.toolboxService.Get(toolboxId)
+	if err != nil {
+		return
+	}
+	if find == nil {
+		err = errors.New(fmt.Sprintf("toolbox[%d]不存在", toolboxId))
+		return
+	}
+	if find.ToolboxType != "database" {
+		err = errors.New(fmt.Sprintf("toolbox[%d]不是数据库工具", toolboxId))
+		return
+	}
+	err = this_.toolboxService.CheckToolboxPower(requestBean, find)
+	if err != nil {
+		return
+	}
+	config = &db.Config{}
+	sshConfig, err = this_.toolboxService.BindConfigByOption(find.Option, config, nil)
+	if err != nil {
+		return
+	}
+	return
+}
+
 func getService(config *db.Config, sshConfig *ssh.Config) (res db.IService, err error) {
 	key := fmt.Sprint("database-", config.Type, "-", config.Host, "-", config.Port)
 	if config.DatabasePath != "" {
@@ -206,6 +296,10 @@ type BaseRequest struct {
 	TableName    string                 `json:"tableName,omitempty"`
 	TaskId       string                 `json:"taskId,omitempty"`
 	ExecuteSQL   string                 `json:"executeSQL,omitempty"`
+	ExecuteId    string                 `json:"executeId,omitempty"`    // 由 页面 生成，用于 取消 执行
+	ConfirmToken string                 `json:"confirmToken,omitempty"` // 危险 操作 确认 码
+	Timeout      int                    `json:"timeout,omitempty"`      // 单条 语句 超时 秒
+	IdleTimeout  int                    `json:"idleTimeout,omitempty"`  // 事务 空闲 超时 秒
 	ColumnList   []*dialect.ColumnModel `json:"columnList,omitempty"`
 	Wheres       []*dialect.Where       `json:"wheres,omitempty"`
 	Orders       []*dialect.Order       `json:"orders,omitempty"`
@@ -350,6 +444,15 @@ func (this_ *api) ownerDelete(requestBean *base.RequestBean, c *gin.Context) (re
 	}
 
 	param := this_.getParam(requestBean, c)
+	operation := "DROP " + request.OwnerName
+	confirm, err := this_.checkSafety(requestBean, request.ConfirmToken, "ownerDelete", request.OwnerName, []string{operation}, []string{operation})
+	if err != nil {
+		return
+	}
+	if confirm != nil {
+		res = confirm
+		return
+	}
 	res, err = service.OwnerDelete(param, request.OwnerName)
 	if err != nil {
 		return
@@ -493,6 +596,15 @@ func (this_ *api) tableCreate(requestBean *base.RequestBean, c *gin.Context) (re
 		return
 	}
 
+	operation := "CREATE TABLE " + request.OwnerName + "." + table.TableName
+	confirm, err := this_.checkSafety(requestBean, request.ConfirmToken, "tableCreate", operation, []string{operation}, nil)
+	if err != nil {
+		return
+	}
+	if confirm != nil {
+		res = confirm
+		return
+	}
 	err = service.TableCreate(param, request.OwnerName, table)
 	if err != nil {
 		return
@@ -549,6 +661,14 @@ func (this_ *api) tableUpdate(requestBean *base.RequestBean, c *gin.Context) (re
 		return
 	}
 
+	confirm, err := this_.checkTableUpdateSafety(requestBean, request, updateTableParam)
+	if err != nil {
+		return
+	}
+	if confirm != nil {
+		res = confirm
+		return
+	}
 	err = service.TableUpdate(param, request.OwnerName, request.TableName, updateTableParam)
 	if err != nil {
 		return
@@ -600,6 +720,15 @@ func (this_ *api) tableDelete(requestBean *base.RequestBean, c *gin.Context) (re
 	}
 	param := this_.getParam(requestBean, c)
 
+	operation := "DROP TABLE " + request.OwnerName + "." + request.TableName
+	confirm, err := this_.checkSafety(requestBean, request.ConfirmToken, "tableDelete", operation, []string{operation}, []string{operation})
+	if err != nil {
+		return
+	}
+	if confirm != nil {
+		res = confirm
+		return
+	}
 	err = service.TableDelete(param, request.OwnerName, request.TableName)
 	if err != nil {
 		return
@@ -623,6 +752,15 @@ func (this_ *api) tableDataTrim(requestBean *base.RequestBean, c *gin.Context) (
 	}
 	param := this_.getParam(requestBean, c)
 
+	operation := "TRUNCATE " + request.OwnerName + "." + request.TableName
+	confirm, err := this_.checkSafety(requestBean, request.ConfirmToken, "tableDataTrim", operation, []string{operation}, []string{operation})
+	if err != nil {
+		return
+	}
+	if confirm != nil {
+		res = confirm
+		return
+	}
 	err = service.TableDataTrim(param, request.OwnerName, request.TableName)
 	if err != nil {
 		return
@@ -709,6 +847,14 @@ func (this_ *api) dataListExec(requestBean *base.RequestBean, c *gin.Context) (r
 	}
 	param := this_.getParam(requestBean, c)
 
+	confirm, err := this_.checkDataListSafety(requestBean, request)
+	if err != nil {
+		return
+	}
+	if confirm != nil {
+		res = confirm
+		return
+	}
 	err = service.DataListExec(param, request.OwnerName, request.TableName, request.ColumnList,
 		request.InsertList,
 		request.UpdateList, request.UpdateWhereList,
@@ -735,18 +881,225 @@ func (this_ *api) executeSQL(requestBean *base.RequestBean, c *gin.Context) (res
 		return
 	}
 	param := this_.getParam(requestBean, c)
-	data := make(map[string]interface{})
-	data["executeList"], data["error"], err = service.ExecuteSQL(param, request.OwnerName, request.ExecuteSQL, &db.ExecuteOptions{
-		SelectDataMax: request.ShowDataMaxSize,
-		OpenProfiling: request.OpenProfiling,
-	})
+
+	level := this_.getSafetyLevel(requestBean)
+	writes, dangers := checkSqlSafety(service.GetTargetDialect(param), request.ExecuteSQL)
+	confirm, err := checkSafetyLevel(level, requestBean, request.ConfirmToken, "executeSQL", request.ExecuteSQL, writes, dangers)
 	if err != nil {
 		return
 	}
+	if confirm != nil {
+		res = confirm
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	execution := &Execution{
+		ExecuteId: request.ExecuteId,
+		WorkerId:  request.WorkerId,
+		StartTime: util.GetNowMilli(),
+		dia:       service.GetTargetDialect(param),
+		userId:    getRequestUserId(requestBean),
+		service:   service,
+		cancel:    cancel,
+	}
+	if execution.ExecuteId == "" {
+		execution.ExecuteId = util.GetUUID()
+	}
+	err = addExecution(execution)
+	if err != nil {
+		return
+	}
+	defer removeExecution(execution.ExecuteId)
+
+	task := &executeTask{
+		Execution: execution,
+		Param:     param,
+		ExecuteOptions: &db.ExecuteOptions{
+			SelectDataMax: request.ShowDataMaxSize,
+			OpenProfiling: request.OpenProfiling,
+		},
+		ownerName: request.OwnerName,
+		timeout:   time.Duration(request.Timeout) * time.Second,
+		readOnly:  level == safetyReadonly && isReadOnlyTxSupported(service.GetDialect().DialectType()),
+	}
+	// 工作 窗口 开启 了 事务 时 在 事务 中 执行
+	transaction, err := getWorkerTransaction(requestBean, request.WorkerId)
+	if err != nil {
+		return
+	}
+	if transaction != nil {
+		var release func()
+		release, err = transaction.acquire()
+		if err != nil {
+			return
+		}
+		defer release()
+		task.transaction = transaction
+	}
+	executeList, errStr, err := task.run(ctx, request.ExecuteSQL)
+	this_.saveHistory(requestBean, request, executeList)
+	if err != nil {
+		return
+	}
+	data := make(map[string]interface{})
+	data["executeId"] = execution.ExecuteId
+	data["executeList"] = executeList
+	data["error"] = errStr
 	res = data
 	return
 }
 
+func (this_ *api) executeCancel(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+
+	var request = &BaseRequest{}
+	if !base.RequestJSON(request, c) {
+		return
+	}
+
+	// 未 指定 executeId 时 取消 工作 窗口 下 当前 用户 的 所有 执行
+	userId := getRequestUserId(requestBean)
+	var list []*Execution
+	if request.ExecuteId != "" {
+		if execution := getExecution(request.ExecuteId); execution != nil {
+			if execution.userId != userId {
+				err = errors.New("SQL执行[" + request.ExecuteId + "]不属于当前用户")
+				return
+			}
+			list = append(list, execution)
+		}
+	} else if request.WorkerId != "" {
+		for _, execution := range getWorkerExecutions(request.WorkerId) {
+			if execution.userId == userId {
+				list = append(list, execution)
+			}
+		}
+	}
+	for _, execution := range list {
+		_ = execution.Cancel()
+	}
+	res = len(list)
+	return
+}
+
+func (this_ *api) explain(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	config, sshConfig, err := this_.getConfig(requestBean, c)
+	if err != nil {
+		return
+	}
+	service, err := getService(config, sshConfig)
+	if err != nil {
+		return
+	}
+
+	var request = &BaseRequest{}
+	if !base.RequestJSON(request, c) {
+		return
+	}
+	param := this_.getParam(requestBean, c)
+
+	ctx := context.Background()
+	if request.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(request.Timeout)*time.Second)
+		defer cancel()
+	}
+	res, err = explain(ctx, service, param, request.OwnerName, request.ExecuteSQL)
+	if err != nil {
+		return
+	}
+	return
+}
+
+// foreignKeyGraph 查询 库 下 所有 表 的 外键 关系，可 按 字段 命名 推断，并 导出 为 ER 图 文本
+func (this_ *api) foreignKeyGraph(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	config, sshConfig, err := this_.getConfig(requestBean, c)
+	if err != nil {
+		return
+	}
+	service, err := getService(config, sshConfig)
+	if err != nil {
+		return
+	}
+
+	var request = &BaseRequest{}
+	if !base.RequestJSON(request, c) {
+		return
+	}
+	var graphParam = &GraphParam{}
+	if !base.RequestJSON(graphParam, c) {
+		return
+	}
+	param := this_.getParam(requestBean, c)
+
+	tables, err := service.TablesSelect(param, request.OwnerName)
+	if err != nil {
+		return
+	}
+	if len(graphParam.TableNames) > 0 {
+		var list []*dialect.TableModel
+		for _, table := range tables {
+			for _, tableName := range graphParam.TableNames {
+				if compareName(tableName) == compareName(table.TableName) {
+					list = append(list, table)
+					break
+				}
+			}
+		}
+		tables = list
+	}
+	foreignKeys, err := loadForeignKeys(context.Background(), service, param, request.OwnerName, tables)
+	if err != nil {
+		return
+	}
+
+	graph := &ForeignKeyGraph{
+		OwnerName: request.OwnerName,
+		TableList: []*GraphTable{},
+		Format:    graphParam.Format,
+	}
+	loadDetail := graphParam.Infer || graphParam.WithColumns || graphParam.Format != ""
+	for _, table := range tables {
+		graphTable := &GraphTable{
+			TableName:    table.TableName,
+			TableComment: table.TableComment,
+			ForeignKeys:  foreignKeys[table.TableName],
+		}
+		if graphTable.ForeignKeys == nil {
+			graphTable.ForeignKeys = []*ForeignKeyModel{}
+		}
+		if loadDetail {
+			var detail *dialect.TableModel
+			detail, err = service.TableDetail(param, request.OwnerName, table.TableName)
+			if err != nil {
+				return
+			}
+			if detail != nil {
+				graphTable.ColumnList = detail.ColumnList
+				graphTable.PrimaryKeys = detail.PrimaryKeys
+			}
+		}
+		graph.TableList = append(graph.TableList, graphTable)
+	}
+	if graphParam.Infer {
+		inferForeignKeys(graph.TableList)
+	}
+	if graphParam.Format != "" {
+		graph.Text, err = exportGraph(graph, graphParam.Format)
+		if err != nil {
+			return
+		}
+	}
+	if !graphParam.WithColumns {
+		for _, one := range graph.TableList {
+			one.ColumnList = nil
+		}
+	}
+	res = graph
+	return
+}
+
 func (this_ *api) _import(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
 	config, sshConfig, err := this_.getConfig(requestBean, c)
 	if err != nil {
@@ -768,6 +1121,24 @@ func (this_ *api) _import(requestBean *base.RequestBean, c *gin.Context) (res in
 		return
 	}
 
+	var owners []string
+	for _, one := range importParam.Owners {
+		owners = append(owners, one.Name)
+	}
+	operation := "导入数据到库[" + strings.Join(owners, ",") + "]"
+	content, err := util.ObjToJson(importParam)
+	if err != nil {
+		return
+	}
+	confirm, err := this_.checkSafety(requestBean, request.ConfirmToken, "import", content, []string{operation}, []string{operation})
+	if err != nil {
+		return
+	}
+	if confirm != nil {
+		res = confirm
+		return
+	}
+
 	var task *worker.Task
 	task, err = service.StartImport(param, importParam)
 	if err != nil {
@@ -781,6 +1152,245 @@ func (this_ *api) _import(requestBean *base.RequestBean, c *gin.Context) (res in
 	return
 }
 
+// activity 查询 数据库 会话、锁 等待 与 阻塞 链
+func (this_ *api) activity(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	config, sshConfig, err := this_.getConfig(requestBean, c)
+	if err != nil {
+		return
+	}
+	service, err := getService(config, sshConfig)
+	if err != nil {
+		return
+	}
+
+	var activityParam = &ActivityParam{}
+	if !base.RequestJSON(activityParam, c) {
+		return
+	}
+	res, err = activity(service, activityParam.IncludeIdle)
+	return
+}
+
+// killSession 终止 数据库 会话，需要 单独 授权
+func (this_ *api) killSession(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	config, sshConfig, err := this_.getConfig(requestBean, c)
+	if err != nil {
+		return
+	}
+	service, err := getService(config, sshConfig)
+	if err != nil {
+		return
+	}
+
+	var request = &BaseRequest{}
+	if !base.RequestJSON(request, c) {
+		return
+	}
+	var activityParam = &ActivityParam{}
+	if !base.RequestJSON(activityParam, c) {
+		return
+	}
+	killSql, err := getKillSessionSql(service.GetDialect(), activityParam.SessionId, activityParam.OnlyQuery)
+	if err != nil {
+		return
+	}
+	confirm, err := this_.checkSafety(requestBean, request.ConfirmToken, "killSession", killSql, []string{killSql}, []string{killSql})
+	if err != nil {
+		return
+	}
+	if confirm != nil {
+		res = confirm
+		return
+	}
+	_, err = service.Exec(killSql, nil)
+	if err != nil {
+		return
+	}
+	util.Logger.Info("database kill session", zap.Any("killSql", killSql), zap.Any("userId", requestBean.JWT.UserId))
+	return
+}
+
+func (this_ *api) objectList(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	config, sshConfig, err := this_.getConfig(requestBean, c)
+	if err != nil {
+		return
+	}
+	service, err := getService(config, sshConfig)
+	if err != nil {
+		return
+	}
+
+	var request = &BaseRequest{}
+	if !base.RequestJSON(request, c) {
+		return
+	}
+	var procedureParam = &ProcedureParam{}
+	if !base.RequestJSON(procedureParam, c) {
+		return
+	}
+	res, err = objectList(service, request.OwnerName, procedureParam.ObjectType, "")
+	return
+}
+
+// objectDetail 对象 信息，存储 过程、函数 包含 参数
+func (this_ *api) objectDetail(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	config, sshConfig, err := this_.getConfig(requestBean, c)
+	if err != nil {
+		return
+	}
+	service, err := getService(config, sshConfig)
+	if err != nil {
+		return
+	}
+
+	var request = &BaseRequest{}
+	if !base.RequestJSON(request, c) {
+		return
+	}
+	var procedureParam = &ProcedureParam{}
+	if !base.RequestJSON(procedureParam, c) {
+		return
+	}
+	param := this_.getParam(requestBean, c)
+	res, err = objectDetail(service, param, request.OwnerName, procedureParam.ObjectType, procedureParam.ObjectName)
+	return
+}
+
+func (this_ *api) objectDdl(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	config, sshConfig, err := this_.getConfig(requestBean, c)
+	if err != nil {
+		return
+	}
+	service, err := getService(config, sshConfig)
+	if err != nil {
+		return
+	}
+
+	var request = &BaseRequest{}
+	if !base.RequestJSON(request, c) {
+		return
+	}
+	var procedureParam = &ProcedureParam{}
+	if !base.RequestJSON(procedureParam, c) {
+		return
+	}
+	param := this_.getParam(requestBean, c)
+	object, err := getObject(service, request.OwnerName, procedureParam.ObjectType, procedureParam.ObjectName)
+	if err != nil {
+		return
+	}
+	res, err = objectDdl(service, param, object)
+	return
+}
+
+// procedureExecute 执行 存储 过程 或 函数，可能 修改 数据，按 写 操作 校验
+func (this_ *api) procedureExecute(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	config, sshConfig, err := this_.getConfig(requestBean, c)
+	if err != nil {
+		return
+	}
+	service, err := getService(config, sshConfig)
+	if err != nil {
+		return
+	}
+
+	var request = &BaseRequest{}
+	if !base.RequestJSON(request, c) {
+		return
+	}
+	var procedureParam = &ProcedureParam{}
+	if !base.RequestJSON(procedureParam, c) {
+		return
+	}
+	if procedureParam.ObjectType != objectProcedure && procedureParam.ObjectType != objectFunction {
+		err = errors.New("只支持执行存储过程和函数")
+		return
+	}
+	// 存储 过程 一般 修改 数据，需要 确认；函数 只 在 只读 模式 下 禁止
+	content := procedureParam.ObjectType + " " + procedureParam.ObjectName
+	var dangers []string
+	if procedureParam.ObjectType == objectProcedure {
+		dangers = []string{content}
+	}
+	confirm, err := this_.checkSafety(requestBean, request.ConfirmToken, "procedureExecute", content, []string{content}, dangers)
+	if err != nil {
+		return
+	}
+	if confirm != nil {
+		res = confirm
+		return
+	}
+
+	param := this_.getParam(requestBean, c)
+	ctx := context.Background()
+	if request.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(request.Timeout)*time.Second)
+		defer cancel()
+	}
+	res, err = procedureExecute(ctx, service, param, request.OwnerName, procedureParam)
+	return
+}
+
+// mockData 按 表 结构 生成 模拟 数据，preview 大于 0 时 只 返回 预览
+func (this_ *api) mockData(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	config, sshConfig, err := this_.getConfig(requestBean, c)
+	if err != nil {
+		return
+	}
+	service, err := getService(config, sshConfig)
+	if err != nil {
+		return
+	}
+
+	var request = &BaseRequest{}
+	if !base.RequestJSON(request, c) {
+		return
+	}
+	param := this_.getParam(requestBean, c)
+
+	var mockParam = &MockParam{}
+	if !base.RequestJSON(mockParam, c) {
+		return
+	}
+	if mockParam.Preview <= 0 {
+		var writes []string
+		for _, table := range mockParam.Tables {
+			writes = append(writes, fmt.Sprintf("INSERT %s %d条", table.TableName, table.RowCount))
+		}
+		_, err = this_.checkSafety(requestBean, request.ConfirmToken, "mockData", "", writes, nil)
+		if err != nil {
+			return
+		}
+	}
+
+	workDb, err := newWorkDb(*config, param, request.OwnerName)
+	if err != nil {
+		return
+	}
+	mock, err := newMockData(service, param, request.OwnerName, workDb, mockParam)
+	if err != nil {
+		_ = workDb.Close()
+		return
+	}
+	if mockParam.Preview > 0 {
+		defer func() { _ = workDb.Close() }()
+		res, err = mock.preview()
+		return
+	}
+
+	task, err := mock.start()
+	if err != nil {
+		return
+	}
+	res = task
+
+	if task != nil {
+		addWorkerTask(request.WorkerId, task.TaskId)
+	}
+	return
+}
+
 func (this_ *api) export(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
 	config, sshConfig, err := this_.getConfig(requestBean, c)
 	if err != nil {
@@ -928,6 +1538,25 @@ func (this_ *api) sync(requestBean *base.RequestBean, c *gin.Context) (res inter
 		return
 	}
 
+	var owners []string
+	for _, one := range syncParam.Owners {
+		owners = append(owners, one.TargetName)
+	}
+	operation := "同步到库[" + strings.Join(owners, ",") + "]"
+	// 确认 码 与 同步 参数、目标 库 绑定
+	content, err := util.ObjToJson([]interface{}{syncParam, param.TargetDatabaseConfig})
+	if err != nil {
+		return
+	}
+	confirm, err := this_.checkSafety(requestBean, request.ConfirmToken, "sync", content, []string{operation}, []string{operation})
+	if err != nil {
+		return
+	}
+	if confirm != nil {
+		res = confirm
+		return
+	}
+
 	var task *worker.Task
 	task, err = service.StartSync(param, syncParam)
 	if err != nil {
@@ -941,6 +1570,9 @@ func (this_ *api) sync(requestBean *base.RequestBean, c *gin.Context) (res inter
 	return
 }
 
+// taskTypes 模块 内 实现 的 后台 任务 类型，只 允许 创建 任务 的 用户 查看 与 操作
+var taskTypes = []string{"dataCompare", "backup", "restore"}
+
 func (this_ *api) taskStatus(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
 
 	var request = &BaseRequest{}
@@ -948,6 +1580,10 @@ func (this_ *api) taskStatus(requestBean *base.RequestBean, c *gin.Context) (res
 		return
 	}
 
+	if task := background.GetUserTask(request.TaskId, getRequestUserId(requestBean), taskTypes...); task != nil {
+		res = task.Info()
+		return
+	}
 	res = worker.GetTask(request.TaskId)
 	return
 }
@@ -959,6 +1595,10 @@ func (this_ *api) taskStop(requestBean *base.RequestBean, c *gin.Context) (res i
 		return
 	}
 
+	if task := background.GetUserTask(request.TaskId, getRequestUserId(requestBean), taskTypes...); task != nil {
+		task.Stop()
+		return
+	}
 	worker.StopTask(request.TaskId)
 	return
 }
@@ -981,6 +1621,9 @@ func (this_ *api) taskClean(requestBean *base.RequestBean, c *gin.Context) (res
 			}
 		}
 	}
+	if task := background.GetUserTask(request.TaskId, getRequestUserId(requestBean), taskTypes...); task != nil {
+		background.ClearTask(task.TaskId)
+	}
 	worker.ClearTask(request.TaskId)
 	return
 }
@@ -993,6 +1636,11 @@ func (this_ *api) close(requestBean *base.RequestBean, c *gin.Context) (res inte
 	}
 
 	removeWorkerTasks(request.WorkerId)
+	background.RemoveWorkerTasks(request.WorkerId)
+	for _, execution := range getWorkerExecutions(request.WorkerId) {
+		_ = execution.Cancel()
+	}
+	closeWorkerTransaction(request.WorkerId)
 	return
 }
 
@@ -0,0 +1,201 @@
+package module_database
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"teamide/internal/module/module_toolbox"
+	"teamide/pkg/background"
+	"teamide/pkg/base"
+	"time"
+)
+
+// backup 备份 整个 库 到 文件 目录 下 的 zip 包
+func (this_ *api) backup(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	config, sshConfig, err := this_.getConfig(requestBean, c)
+	if err != nil {
+		return
+	}
+	service, err := getService(config, sshConfig)
+	if err != nil {
+		return
+	}
+
+	var request = &BaseRequest{}
+	if !base.RequestJSON(request, c) {
+		return
+	}
+	var backupParam = &BackupParam{}
+	if !base.RequestJSON(backupParam, c) {
+		return
+	}
+	param := this_.getParam(requestBean, c)
+
+	ownerName := strings.NewReplacer("/", "_", "\\", "_").Replace(request.OwnerName)
+	if ownerName == "" {
+		ownerName = "default"
+	}
+	filePath := fmt.Sprintf("database-backup/toolbox-%d/%s-%s.zip", request.ToolboxId, ownerName, time.Now().Format("20060102150405"))
+
+	workDb, err := newWorkDb(*config, param, request.OwnerName)
+	if err != nil {
+		return
+	}
+	one := newBackup(service, param, request.OwnerName, workDb, backupParam, this_.toolboxService.GetFilesDir(), filePath)
+	one.result.ToolboxId = request.ToolboxId
+
+	task := background.NewTask("backup", one.do)
+	task.Result = one.result
+	task.UserId = getRequestUserId(requestBean)
+	// 备份 包 在 taskClean 前 可以 下载 与 恢复，窗口 关闭 时 保留
+	task.Keep = true
+	task.OnClear = func() {
+		_ = os.Remove(one.filePath)
+	}
+	background.StartTask(task)
+	background.AddWorkerTask(request.WorkerId, task.TaskId)
+	res = task.Info()
+	return
+}
+
+// getBackupResult 获取 当前 用户 已 完成 的 备份，并 校验 备份 来源 工具 的 权限
+func (this_ *api) getBackupResult(requestBean *base.RequestBean, taskId string) (result *BackupResult, err error) {
+	task := background.GetUserTask(taskId, getRequestUserId(requestBean), "backup")
+	if task == nil {
+		err = errors.New("任务不存在")
+		return
+	}
+	info := task.Info()
+	result, ok := info.Result.(*BackupResult)
+	if !ok || !info.IsEnd || info.Error != "" || info.IsStop {
+		err = errors.New("备份未完成")
+		return
+	}
+	if _, _, err = this_.getConfigById(requestBean, result.ToolboxId); err != nil {
+		return
+	}
+	return
+}
+
+// backupDownload 只 允许 创建 备份 的 用户 下载
+func (this_ *api) backupDownload(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+
+	data := map[string]string{}
+	err = c.Bind(&data)
+	if err != nil {
+		return
+	}
+
+	result, err := this_.getBackupResult(requestBean, data["taskId"])
+	if err != nil {
+		return
+	}
+	path := filepath.Join(this_.toolboxService.GetFilesDir(), result.Path)
+	ff, err := os.Lstat(path)
+	if err != nil {
+		err = errors.New("备份文件不存在")
+		return
+	}
+	fileInfo, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer func() {
+		_ = fileInfo.Close()
+	}()
+
+	c.Header("Content-Type", "application/octet-stream")
+	c.Header("Content-Disposition", "attachment; filename="+url.QueryEscape(ff.Name()))
+	c.Header("Content-Transfer-Encoding", "binary")
+	c.Header("Content-Length", fmt.Sprint(ff.Size()))
+	c.Header("download-file-name", ff.Name())
+
+	_, err = io.Copy(c.Writer, fileInfo)
+	if err != nil {
+		return
+	}
+
+	c.Status(http.StatusOK)
+	res = base.HttpNotResponse
+	return
+}
+
+// restore 恢复 当前 用户 的 备份 任务 生成 的 备份 包，目标 为 其它 工具 时 按 目标 工具 的 安全 级别 校验
+func (this_ *api) restore(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	config, sshConfig, err := this_.getConfig(requestBean, c)
+	if err != nil {
+		return
+	}
+	service, err := getService(config, sshConfig)
+	if err != nil {
+		return
+	}
+
+	var request = &BaseRequest{}
+	if !base.RequestJSON(request, c) {
+		return
+	}
+	var restoreParam = &RestoreParam{}
+	if !base.RequestJSON(restoreParam, c) {
+		return
+	}
+	if restoreParam.TargetOwnerName == "" {
+		restoreParam.TargetOwnerName = request.OwnerName
+	}
+	err = restoreParam.init()
+	if err != nil {
+		return
+	}
+	param := this_.getParam(requestBean, c)
+
+	backupResult, err := this_.getBackupResult(requestBean, restoreParam.BackupTaskId)
+	if err != nil {
+		return
+	}
+
+	targetService, targetConfig, level := service, config, this_.getSafetyLevel(requestBean)
+	if restoreParam.TargetToolboxId != 0 {
+		targetService, targetConfig, err = this_.getTargetService(requestBean, restoreParam.TargetToolboxId)
+		if err != nil {
+			return
+		}
+		var find *module_toolbox.ToolboxModel
+		find, err = this_.toolboxService.Get(restoreParam.TargetToolboxId)
+		if err != nil {
+			return
+		}
+		level = getSafetyLevelByOption(find.Option)
+	}
+	operation := "恢复备份[" + backupResult.Path + "]到库[" + restoreParam.TargetOwnerName + "]"
+	confirm, err := checkSafetyLevel(level, requestBean, request.ConfirmToken, "restore", fmt.Sprint(restoreParam.TargetToolboxId, "-", operation), []string{operation}, []string{operation})
+	if err != nil || confirm != nil {
+		res = confirm
+		return
+	}
+
+	filePath := filepath.Join(this_.toolboxService.GetFilesDir(), backupResult.Path)
+	if _, err = os.Stat(filePath); err != nil {
+		err = errors.New("备份文件不存在")
+		return
+	}
+	targetParam := getTargetParam(param, restoreParam.TargetToolboxId)
+	workDb, err := newWorkDb(*targetConfig, targetParam, restoreParam.TargetOwnerName)
+	if err != nil {
+		return
+	}
+	one := newRestore(targetService, targetParam, workDb, restoreParam, filePath)
+
+	task := background.NewTask("restore", one.do)
+	task.Result = one.result
+	task.UserId = getRequestUserId(requestBean)
+	background.StartTask(task)
+	background.AddWorkerTask(request.WorkerId, task.TaskId)
+	res = task.Info()
+	return
+}
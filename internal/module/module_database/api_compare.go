@@ -0,0 +1,233 @@
+package module_database
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/team-ide/go-tool/db"
+	"github.com/team-ide/go-tool/util"
+	"teamide/internal/module/module_toolbox"
+	"teamide/pkg/background"
+	"teamide/pkg/base"
+)
+
+// getTargetService 获取 目标 工具 的 服务，用于 跨 工具 对比、同步
+func (this_ *api) getTargetService(requestBean *base.RequestBean, targetToolboxId int64) (service db.IService, config *db.Config, err error) {
+	if targetToolboxId == 0 {
+		err = errors.New("目标数据库工具不能为空")
+		return
+	}
+	config, sshConfig, err := this_.getConfigById(requestBean, targetToolboxId)
+	if err != nil {
+		return
+	}
+	service, err = getService(config, sshConfig)
+	if err != nil {
+		return
+	}
+	return
+}
+
+// getTargetParam 目标 为 其它 工具 时 使用 目标 工具 配置 的 账号，不 使用 当前 请求 的 执行 账号
+func getTargetParam(param *db.Param, targetToolboxId int64) *db.Param {
+	if targetToolboxId == 0 {
+		return param
+	}
+	res := *param
+	res.ExecUsername = ""
+	res.ExecPassword = ""
+	return &res
+}
+
+// schemaCompare 对比 当前 工具 与 目标 工具 的 表 结构，生成 目标 迁移 到 与 源 一致 的 SQL
+func (this_ *api) schemaCompare(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	config, sshConfig, err := this_.getConfig(requestBean, c)
+	if err != nil {
+		return
+	}
+	service, err := getService(config, sshConfig)
+	if err != nil {
+		return
+	}
+
+	var request = &BaseRequest{}
+	if !base.RequestJSON(request, c) {
+		return
+	}
+	var compareParam = &SchemaCompareParam{}
+	if !base.RequestJSON(compareParam, c) {
+		return
+	}
+	param := this_.getParam(requestBean, c)
+	// 迁移 SQL 使用 目标 库 的 方言
+	param.TargetDatabaseType = ""
+
+	if compareParam.SourceOwnerName == "" {
+		compareParam.SourceOwnerName = request.OwnerName
+	}
+	if compareParam.TargetOwnerName == "" {
+		compareParam.TargetOwnerName = compareParam.SourceOwnerName
+	}
+
+	targetService, targetConfig, err := this_.getTargetService(requestBean, compareParam.TargetToolboxId)
+	if err != nil {
+		return
+	}
+
+	sources, err := loadCompareTables(service, param, compareParam.SourceOwnerName, compareParam.TableNames)
+	if err != nil {
+		err = errors.New("源库表信息加载失败:" + err.Error())
+		return
+	}
+	targets, err := loadCompareTables(targetService, param, compareParam.TargetOwnerName, compareParam.TableNames)
+	if err != nil {
+		err = errors.New("目标库表信息加载失败:" + err.Error())
+		return
+	}
+
+	result := &SchemaCompareResult{
+		SourceOwnerName: compareParam.SourceOwnerName,
+		TargetOwnerName: compareParam.TargetOwnerName,
+		SourceType:      config.Type,
+		TargetType:      targetConfig.Type,
+	}
+	compareParam.dia = targetService.GetTargetDialect(param)
+	result.TableList = diffTables(sources, targets, compareParam)
+
+	var ownerName string
+	if param.AppendOwnerName {
+		ownerName = compareParam.TargetOwnerName
+	}
+	result.SqlList, err = migrateSql(targetService, param, ownerName, result.TableList, compareParam)
+	if err != nil {
+		return
+	}
+	res = result
+	return
+}
+
+// dataCompare 按 主键 分批 对比 当前 工具 与 目标 工具 的 表 数据，可 生成 或 执行 同步 SQL
+func (this_ *api) dataCompare(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	config, sshConfig, err := this_.getConfig(requestBean, c)
+	if err != nil {
+		return
+	}
+	service, err := getService(config, sshConfig)
+	if err != nil {
+		return
+	}
+
+	var request = &BaseRequest{}
+	if !base.RequestJSON(request, c) {
+		return
+	}
+	var compareParam = &DataCompareParam{}
+	if !base.RequestJSON(compareParam, c) {
+		return
+	}
+	if compareParam.SourceOwnerName == "" {
+		compareParam.SourceOwnerName = request.OwnerName
+	}
+	if compareParam.SourceTableName == "" {
+		compareParam.SourceTableName = request.TableName
+	}
+	err = compareParam.init()
+	if err != nil {
+		return
+	}
+	param := this_.getParam(requestBean, c)
+	param.TargetDatabaseType = ""
+	targetParam := getTargetParam(param, compareParam.TargetToolboxId)
+
+	targetService, targetConfig, level := service, config, this_.getSafetyLevel(requestBean)
+	if compareParam.TargetToolboxId != 0 {
+		targetService, targetConfig, err = this_.getTargetService(requestBean, compareParam.TargetToolboxId)
+		if err != nil {
+			return
+		}
+		var find *module_toolbox.ToolboxModel
+		find, err = this_.toolboxService.Get(compareParam.TargetToolboxId)
+		if err != nil {
+			return
+		}
+		level = getSafetyLevelByOption(find.Option)
+	}
+	if compareParam.Mode == dataCompareModeApply {
+		operation := "同步数据到表[" + compareParam.TargetOwnerName + "." + compareParam.TargetTableName + "]"
+		// 确认 码 与 源 表、目标 表、主键、字段 等 全部 对比 参数 绑定
+		var content string
+		if content, err = util.ObjToJson(compareParam); err != nil {
+			return
+		}
+		var confirm *ConfirmResult
+		confirm, err = checkSafetyLevel(level, requestBean, request.ConfirmToken, "dataCompare", content, []string{operation}, []string{operation})
+		if err != nil || confirm != nil {
+			res = confirm
+			return
+		}
+	}
+
+	sourceTable, err := service.TableDetail(param, compareParam.SourceOwnerName, compareParam.SourceTableName)
+	if err != nil {
+		err = errors.New("源表信息加载失败:" + err.Error())
+		return
+	}
+	if sourceTable == nil {
+		err = errors.New("源表[" + compareParam.SourceTableName + "]不存在")
+		return
+	}
+	targetTable, err := targetService.TableDetail(targetParam, compareParam.TargetOwnerName, compareParam.TargetTableName)
+	if err != nil {
+		err = errors.New("目标表信息加载失败:" + err.Error())
+		return
+	}
+	if targetTable == nil {
+		err = errors.New("目标表[" + compareParam.TargetTableName + "]不存在")
+		return
+	}
+
+	compare := &dataCompare{
+		DataCompareParam: compareParam,
+		result:           &DataCompareResult{},
+	}
+	err = compare.initColumns(service.GetDialect(), sourceTable, targetService.GetDialect(), targetTable)
+	if err != nil {
+		return
+	}
+
+	var ownerName, targetOwnerName string
+	if param.AppendOwnerName {
+		ownerName = compareParam.SourceOwnerName
+		targetOwnerName = compareParam.TargetOwnerName
+	}
+	sourceDb, err := newWorkDb(*config, param, compareParam.SourceOwnerName)
+	if err != nil {
+		return
+	}
+	targetDb, err := newWorkDb(*targetConfig, targetParam, compareParam.TargetOwnerName)
+	if err != nil {
+		_ = sourceDb.Close()
+		return
+	}
+	compare.source = &dataCompareSide{
+		service: service,
+		param:   param,
+		db:      sourceDb,
+		owner:   ownerName,
+		table:   compareParam.SourceTableName,
+	}
+	compare.target = &dataCompareSide{
+		service: targetService,
+		param:   targetParam,
+		db:      targetDb,
+		owner:   targetOwnerName,
+		table:   compareParam.TargetTableName,
+	}
+
+	task := background.NewTask("dataCompare", compare.do)
+	task.Result = compare.result
+	task.UserId = getRequestUserId(requestBean)
+	background.StartTask(task)
+	background.AddWorkerTask(request.WorkerId, task.TaskId)
+	res = task.Info()
+	return
+}
@@ -0,0 +1,253 @@
+package module_database
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/team-ide/go-dialect/worker"
+	"github.com/team-ide/go-tool/util"
+	"go.uber.org/zap"
+	"teamide/internal/module/module_toolbox"
+	"teamide/pkg/base"
+	"time"
+)
+
+// visibilityOpen 工具开放，与 module_toolbox 一致
+const visibilityOpen = 1
+
+// getToolbox 获取 当前 工具，并 校验 权限
+func (this_ *api) getToolbox(requestBean *base.RequestBean, c *gin.Context) (toolbox *module_toolbox.ToolboxModel, err error) {
+	_, _, err = this_.getConfig(requestBean, c)
+	if err != nil {
+		return
+	}
+	v := requestBean.GetExtend("toolboxModel")
+	if v == nil {
+		err = errors.New("工具信息获取失败")
+		return
+	}
+	toolbox = v.(*module_toolbox.ToolboxModel)
+	return
+}
+
+// saveHistory 记录 每条 语句 的 执行 历史，失败 只 记录 日志
+func (this_ *api) saveHistory(requestBean *base.RequestBean, request *BaseRequest, executeList []map[string]interface{}) {
+	v := requestBean.GetExtend("toolboxModel")
+	if v == nil || requestBean.JWT == nil {
+		return
+	}
+	toolbox := v.(*module_toolbox.ToolboxModel)
+	if toolbox.ToolboxId == 0 {
+		// 测试 连接 时 没有 工具 ID
+		return
+	}
+	for _, executeData := range executeList {
+		if executeData == nil {
+			continue
+		}
+		history := &SqlHistoryModel{
+			ToolboxId:   toolbox.ToolboxId,
+			WorkerId:    request.WorkerId,
+			ExecuteId:   request.ExecuteId,
+			UserId:      requestBean.JWT.UserId,
+			UserName:    requestBean.JWT.Name,
+			UserAccount: requestBean.JWT.Account,
+			OwnerName:   request.OwnerName,
+			SqlContent:  util.GetStringValue(executeData["sql"]),
+		}
+		history.UseTime = util.StringToInt64(util.GetStringValue(executeData["useTime"]))
+		history.RowsAffected = util.StringToInt64(util.GetStringValue(executeData["rowsAffected"]))
+		history.DataSize = util.StringToInt64(util.GetStringValue(executeData["dataSize"]))
+		if executeData["error"] != nil {
+			history.ErrorMsg = util.GetStringValue(executeData["error"])
+		}
+		err := this_.sqlService.SaveHistory(history)
+		if err != nil {
+			util.Logger.Error("database sql history save error", zap.Any("toolboxId", toolbox.ToolboxId), zap.Error(err))
+			return
+		}
+	}
+}
+
+type HistoryQueryRequest struct {
+	*SqlHistoryPage
+	OwnerName string `json:"ownerName,omitempty"`
+	Keyword   string `json:"keyword,omitempty"`
+	OnlyError bool   `json:"onlyError,omitempty"`
+	StartTime int64  `json:"startTime,omitempty"`
+	EndTime   int64  `json:"endTime,omitempty"`
+}
+
+func (this_ *api) historyQuery(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	toolbox, err := this_.getToolbox(requestBean, c)
+	if err != nil {
+		return
+	}
+
+	request := &HistoryQueryRequest{}
+	if !base.RequestJSON(request, c) {
+		return
+	}
+	if request.SqlHistoryPage == nil {
+		request.SqlHistoryPage = &SqlHistoryPage{}
+	}
+	if request.Page == nil {
+		request.Page = worker.NewPage()
+	}
+	search := &SqlHistorySearch{
+		ToolboxId: toolbox.ToolboxId,
+		UserId:    requestBean.JWT.UserId,
+		OwnerName: request.OwnerName,
+		Keyword:   request.Keyword,
+		OnlyError: request.OnlyError,
+	}
+	if request.StartTime > 0 {
+		search.StartTime = time.Unix(request.StartTime, 0)
+	}
+	if request.EndTime > 0 {
+		search.EndTime = time.Unix(request.EndTime, 0)
+	}
+	err = this_.sqlService.QueryHistoryPage(search, request.SqlHistoryPage)
+	if err != nil {
+		return
+	}
+	res = request.SqlHistoryPage
+	return
+}
+
+func (this_ *api) historyClean(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	toolbox, err := this_.getToolbox(requestBean, c)
+	if err != nil {
+		return
+	}
+
+	err = this_.sqlService.CleanHistory(toolbox.ToolboxId, requestBean.JWT.UserId)
+	if err != nil {
+		return
+	}
+	return
+}
+
+type SqlQueryRequest struct {
+	SqlQueryId int64  `json:"sqlQueryId,omitempty"`
+	Name       string `json:"name,omitempty"`
+	OwnerName  string `json:"ownerName,omitempty"`
+	SqlContent string `json:"sqlContent,omitempty"`
+	Tags       string `json:"tags,omitempty"`
+	Comment    string `json:"comment,omitempty"`
+	Shared     int8   `json:"shared,omitempty"`
+	Keyword    string `json:"keyword,omitempty"`
+	Tag        string `json:"tag,omitempty"`
+}
+
+// sqlQueryList 查询 自己 保存 的 SQL，工具 开放 时 包含 其它 用户 共享 的
+func (this_ *api) sqlQueryList(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	toolbox, err := this_.getToolbox(requestBean, c)
+	if err != nil {
+		return
+	}
+
+	request := &SqlQueryRequest{}
+	if !base.RequestJSON(request, c) {
+		return
+	}
+	res, err = this_.sqlService.QueryQueries(&SqlQuerySearch{
+		ToolboxId:     toolbox.ToolboxId,
+		UserId:        requestBean.JWT.UserId,
+		IncludeShared: toolbox.Visibility == visibilityOpen,
+		Keyword:       request.Keyword,
+		Tag:           request.Tag,
+	})
+	if err != nil {
+		return
+	}
+	return
+}
+
+// getOwnQuery 查询 保存 的 SQL，只有 创建者 可以 修改、删除
+func (this_ *api) getOwnQuery(requestBean *base.RequestBean, toolbox *module_toolbox.ToolboxModel, sqlQueryId int64) (find *SqlQueryModel, err error) {
+	find, err = this_.sqlService.GetQuery(sqlQueryId)
+	if err != nil {
+		return
+	}
+	if find == nil || find.ToolboxId != toolbox.ToolboxId {
+		err = errors.New("保存的SQL不存在")
+		return
+	}
+	if find.UserId != requestBean.JWT.UserId {
+		err = errors.New("保存的SQL[" + find.Name + "]不属于当前用户，无法操作")
+		return
+	}
+	return
+}
+
+func (this_ *api) sqlQuerySave(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	toolbox, err := this_.getToolbox(requestBean, c)
+	if err != nil {
+		return
+	}
+
+	request := &SqlQueryRequest{}
+	if !base.RequestJSON(request, c) {
+		return
+	}
+	if request.Name == "" {
+		err = errors.New("SQL名称不能为空")
+		return
+	}
+	if request.SqlContent == "" {
+		err = errors.New("SQL不能为空")
+		return
+	}
+	if request.Shared == 1 && toolbox.Visibility != visibilityOpen {
+		err = errors.New("工具[" + toolbox.Name + "]未开放，无法共享SQL")
+		return
+	}
+
+	query := &SqlQueryModel{
+		ToolboxId:  toolbox.ToolboxId,
+		UserId:     requestBean.JWT.UserId,
+		UserName:   requestBean.JWT.Name,
+		Name:       request.Name,
+		OwnerName:  request.OwnerName,
+		SqlContent: request.SqlContent,
+		Tags:       request.Tags,
+		Comment:    request.Comment,
+		Shared:     request.Shared,
+	}
+	if request.SqlQueryId > 0 {
+		var find *SqlQueryModel
+		find, err = this_.getOwnQuery(requestBean, toolbox, request.SqlQueryId)
+		if err != nil {
+			return
+		}
+		query.SqlQueryId = find.SqlQueryId
+		query.CreateTime = find.CreateTime
+	}
+	err = this_.sqlService.SaveQuery(query)
+	if err != nil {
+		return
+	}
+	res = query
+	return
+}
+
+func (this_ *api) sqlQueryDelete(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	toolbox, err := this_.getToolbox(requestBean, c)
+	if err != nil {
+		return
+	}
+
+	request := &SqlQueryRequest{}
+	if !base.RequestJSON(request, c) {
+		return
+	}
+	_, err = this_.getOwnQuery(requestBean, toolbox, request.SqlQueryId)
+	if err != nil {
+		return
+	}
+	err = this_.sqlService.DeleteQuery(request.SqlQueryId)
+	if err != nil {
+		return
+	}
+	return
+}
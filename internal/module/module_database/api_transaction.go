@@ -0,0 +1,124 @@
+package module_database
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"teamide/internal/module/module_toolbox"
+	"teamide/pkg/base"
+	"time"
+)
+
+func getRequestToolboxId(requestBean *base.RequestBean) (toolboxId int64) {
+	if v := requestBean.GetExtend("toolboxModel"); v != nil {
+		toolboxId = v.(*module_toolbox.ToolboxModel).ToolboxId
+	}
+	return
+}
+
+// getRequestUserId 未 登录 时 为 0，与 登录 用户 的 资源 区分
+func getRequestUserId(requestBean *base.RequestBean) (userId int64) {
+	if requestBean.JWT != nil {
+		userId = requestBean.JWT.UserId
+	}
+	return
+}
+
+// getWorkerTransaction 获取 工作 窗口 的 事务，事务 必须 属于 当前 工具 与 当前 用户
+func getWorkerTransaction(requestBean *base.RequestBean, workerId string) (transaction *Transaction, err error) {
+	transaction = getTransaction(workerId)
+	if transaction == nil {
+		return
+	}
+	if transaction.ToolboxId != getRequestToolboxId(requestBean) {
+		transaction = nil
+		err = errors.New("当前窗口的事务不属于该数据库工具")
+		return
+	}
+	if transaction.UserId != getRequestUserId(requestBean) {
+		transaction = nil
+		err = errors.New("当前窗口的事务不属于当前用户")
+		return
+	}
+	return
+}
+
+// transactionBegin 开启 工作 窗口 的 事务，之后 的 executeSQL 在 该 事务 中 执行，直到 提交、回滚 或 空闲 超时
+func (this_ *api) transactionBegin(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	config, sshConfig, err := this_.getConfig(requestBean, c)
+	if err != nil {
+		return
+	}
+	service, err := getService(config, sshConfig)
+	if err != nil {
+		return
+	}
+
+	var request = &BaseRequest{}
+	if !base.RequestJSON(request, c) {
+		return
+	}
+	param := this_.getParam(requestBean, c)
+
+	readOnly := this_.getSafetyLevel(requestBean) == safetyReadonly && isReadOnlyTxSupported(service.GetDialect().DialectType())
+	transaction, err := beginTransaction(service, param, request.WorkerId, getRequestToolboxId(requestBean), getRequestUserId(requestBean), request.OwnerName, time.Duration(request.IdleTimeout)*time.Second, readOnly)
+	if err != nil {
+		return
+	}
+	res = transaction.info()
+	return
+}
+
+func (this_ *api) transactionCommit(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	err = this_.transactionEnd(requestBean, c, true)
+	return
+}
+
+func (this_ *api) transactionRollback(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	err = this_.transactionEnd(requestBean, c, false)
+	return
+}
+
+func (this_ *api) transactionEnd(requestBean *base.RequestBean, c *gin.Context, commit bool) (err error) {
+	// 校验 工具 权限 并 设置 toolboxModel，事务 按 工具 区分
+	_, _, err = this_.getConfig(requestBean, c)
+	if err != nil {
+		return
+	}
+
+	var request = &BaseRequest{}
+	if !base.RequestJSON(request, c) {
+		return
+	}
+	transaction, err := getWorkerTransaction(requestBean, request.WorkerId)
+	if err != nil {
+		return
+	}
+	if transaction == nil {
+		err = errors.New("当前窗口没有开启的事务")
+		return
+	}
+	err = transaction.end(commit)
+	return
+}
+
+// transactionStatus 查看 当前 用户 在 当前 工具 下 打开 的 事务，指定 workerId 时 只 查看 该 窗口
+func (this_ *api) transactionStatus(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	_, _, err = this_.getConfig(requestBean, c)
+	if err != nil {
+		return
+	}
+
+	var request = &BaseRequest{}
+	if !base.RequestJSON(request, c) {
+		return
+	}
+	var list = []*Transaction{}
+	for _, one := range getToolboxTransactions(getRequestToolboxId(requestBean), getRequestUserId(requestBean)) {
+		if request.WorkerId != "" && one.WorkerId != request.WorkerId {
+			continue
+		}
+		list = append(list, one.info())
+	}
+	res = list
+	return
+}
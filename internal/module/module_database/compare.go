@@ -0,0 +1,542 @@
+package module_database
+
+import (
+	"github.com/team-ide/go-dialect/dialect"
+	"github.com/team-ide/go-tool/db"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	// compareMissing 源 有，目标 没有
+	compareMissing = "missing"
+	// compareExtra 目标 有，源 没有
+	compareExtra = "extra"
+	// compareDifferent 两边 都有，但 不 一致
+	compareDifferent = "different"
+)
+
+// SchemaCompareParam 结构 对比 参数，源 为 当前 工具
+type SchemaCompareParam struct {
+	TargetToolboxId int64    `json:"targetToolboxId"`
+	SourceOwnerName string   `json:"sourceOwnerName"`
+	TargetOwnerName string   `json:"targetOwnerName"`
+	TableNames      []string `json:"tableNames"`    // 为 空 对比 所有 表
+	IgnoreComment   bool     `json:"ignoreComment"` // 忽略 表、字段、索引 注释
+	NoDrop          bool     `json:"noDrop"`        // 不 生成 删除 目标 多余 表、字段、索引 的 SQL
+
+	// dia 目标 库 方言，字段 类型 按 目标 方言 映射 后 对比
+	dia dialect.Dialect
+}
+
+type SchemaCompareResult struct {
+	SourceOwnerName string       `json:"sourceOwnerName"`
+	TargetOwnerName string       `json:"targetOwnerName"`
+	SourceType      string       `json:"sourceType"`
+	TargetType      string       `json:"targetType"`
+	TableList       []*TableDiff `json:"tableList"`
+	SqlList         []string     `json:"sqlList"`
+}
+
+type TableDiff struct {
+	TableName         string        `json:"tableName"`
+	TargetTableName   string        `json:"targetTableName,omitempty"`
+	Status            string        `json:"status"`
+	Changes           []string      `json:"changes,omitempty"`
+	SourceComment     string        `json:"sourceComment,omitempty"`
+	TargetComment     string        `json:"targetComment,omitempty"`
+	SourcePrimaryKeys []string      `json:"sourcePrimaryKeys,omitempty"`
+	TargetPrimaryKeys []string      `json:"targetPrimaryKeys,omitempty"`
+	ColumnList        []*ColumnDiff `json:"columnList,omitempty"`
+	IndexList         []*IndexDiff  `json:"indexList,omitempty"`
+	SqlList           []string      `json:"sqlList,omitempty"`
+	Error             string        `json:"error,omitempty"`
+	source            *dialect.TableModel
+	target            *dialect.TableModel
+}
+
+type ColumnDiff struct {
+	ColumnName string               `json:"columnName"`
+	Status     string               `json:"status"`
+	Changes    []string             `json:"changes,omitempty"`
+	Source     *dialect.ColumnModel `json:"source,omitempty"`
+	Target     *dialect.ColumnModel `json:"target,omitempty"`
+}
+
+type IndexDiff struct {
+	IndexName string              `json:"indexName"`
+	Status    string              `json:"status"`
+	Changes   []string            `json:"changes,omitempty"`
+	Source    *dialect.IndexModel `json:"source,omitempty"`
+	Target    *dialect.IndexModel `json:"target,omitempty"`
+}
+
+// compareName 名称 比较 不 区分 大小写，不同 数据库 默认 大小写 不同
+func compareName(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+var defaultCastRegexp = regexp.MustCompile(`::[a-z ]+(\[\])?$`)
+
+// compareDefault 去除 默认值 的 引号、类型 转换，如 'a'::character varying
+func compareDefault(v string) string {
+	v = strings.ToLower(strings.TrimSpace(v))
+	v = defaultCastRegexp.ReplaceAllString(v, "")
+	v = strings.Trim(v, "()")
+	v = strings.Trim(v, "'\"")
+	if v == "null" {
+		v = ""
+	}
+	return v
+}
+
+// loadCompareTables 加载 表 详情，tableNames 为 空 加载 所有 表
+func loadCompareTables(service db.IService, param *db.Param, ownerName string, tableNames []string) (tables map[string]*dialect.TableModel, err error) {
+	list, err := service.TablesSelect(param, ownerName)
+	if err != nil {
+		return
+	}
+	var filter map[string]bool
+	if len(tableNames) > 0 {
+		filter = map[string]bool{}
+		for _, one := range tableNames {
+			filter[compareName(one)] = true
+		}
+	}
+	tables = map[string]*dialect.TableModel{}
+	for _, one := range list {
+		name := compareName(one.TableName)
+		if filter != nil && !filter[name] {
+			continue
+		}
+		var detail *dialect.TableModel
+		detail, err = service.TableDetail(param, ownerName, one.TableName)
+		if err != nil {
+			return
+		}
+		if detail == nil {
+			continue
+		}
+		markPrimaryKeys(detail)
+		tables[name] = detail
+	}
+	return
+}
+
+// markPrimaryKeys 按 表 主键 标记 字段，tableUpdateSql 按 字段 标记 判断 主键 变更
+func markPrimaryKeys(table *dialect.TableModel) {
+	for _, column := range table.ColumnList {
+		for _, key := range table.PrimaryKeys {
+			if compareName(key) == compareName(column.ColumnName) {
+				column.PrimaryKey = true
+			}
+		}
+	}
+}
+
+func sortedPrimaryKeys(table *dialect.TableModel) string {
+	var keys []string
+	for _, one := range table.PrimaryKeys {
+		keys = append(keys, compareName(one))
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ",")
+}
+
+// diffTables 对比 源、目标 表，结果 按 表名 排序
+func diffTables(sources map[string]*dialect.TableModel, targets map[string]*dialect.TableModel, compareParam *SchemaCompareParam) (diffList []*TableDiff) {
+	var names []string
+	for name := range sources {
+		names = append(names, name)
+	}
+	for name := range targets {
+		if sources[name] == nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		source := sources[name]
+		target := targets[name]
+		diff := &TableDiff{
+			source: source,
+			target: target,
+		}
+		switch {
+		case target == nil:
+			diff.TableName = source.TableName
+			diff.Status = compareMissing
+		case source == nil:
+			diff.TableName = target.TableName
+			diff.Status = compareExtra
+		default:
+			diff.TableName = source.TableName
+			diff.TargetTableName = target.TableName
+			diffTable(diff, compareParam)
+			if diff.Status == "" {
+				continue
+			}
+		}
+		diffList = append(diffList, diff)
+	}
+	return
+}
+
+func diffTable(diff *TableDiff, compareParam *SchemaCompareParam) {
+	source := diff.source
+	target := diff.target
+
+	if !compareParam.IgnoreComment && source.TableComment != target.TableComment {
+		diff.Changes = append(diff.Changes, "comment")
+		diff.SourceComment = source.TableComment
+		diff.TargetComment = target.TableComment
+	}
+	if sortedPrimaryKeys(source) != sortedPrimaryKeys(target) {
+		diff.Changes = append(diff.Changes, "primaryKey")
+		diff.SourcePrimaryKeys = source.PrimaryKeys
+		diff.TargetPrimaryKeys = target.PrimaryKeys
+	}
+
+	for _, column := range source.ColumnList {
+		targetColumn := findCompareColumn(target, column.ColumnName)
+		if targetColumn == nil {
+			diff.ColumnList = append(diff.ColumnList, &ColumnDiff{
+				ColumnName: column.ColumnName,
+				Status:     compareMissing,
+				Source:     column,
+			})
+			continue
+		}
+		changes := diffColumn(column, targetColumn, compareParam)
+		if len(changes) > 0 {
+			diff.ColumnList = append(diff.ColumnList, &ColumnDiff{
+				ColumnName: column.ColumnName,
+				Status:     compareDifferent,
+				Changes:    changes,
+				Source:     column,
+				Target:     targetColumn,
+			})
+		}
+	}
+	for _, column := range target.ColumnList {
+		if findCompareColumn(source, column.ColumnName) == nil {
+			diff.ColumnList = append(diff.ColumnList, &ColumnDiff{
+				ColumnName: column.ColumnName,
+				Status:     compareExtra,
+				Target:     column,
+			})
+		}
+	}
+	if len(diff.ColumnList) > 0 {
+		diff.Changes = append(diff.Changes, "column")
+	}
+
+	for _, index := range source.IndexList {
+		if isPrimaryIndex(index) {
+			continue
+		}
+		findIndex := findCompareIndex(target, index.IndexName)
+		if findIndex == nil {
+			diff.IndexList = append(diff.IndexList, &IndexDiff{
+				IndexName: index.IndexName,
+				Status:    compareMissing,
+				Source:    index,
+			})
+			continue
+		}
+		changes := diffIndex(index, findIndex, compareParam)
+		if len(changes) > 0 {
+			diff.IndexList = append(diff.IndexList, &IndexDiff{
+				IndexName: index.IndexName,
+				Status:    compareDifferent,
+				Changes:   changes,
+				Source:    index,
+				Target:    findIndex,
+			})
+		}
+	}
+	for _, index := range target.IndexList {
+		if isPrimaryIndex(index) {
+			continue
+		}
+		if findCompareIndex(source, index.IndexName) == nil {
+			diff.IndexList = append(diff.IndexList, &IndexDiff{
+				IndexName: index.IndexName,
+				Status:    compareExtra,
+				Target:    index,
+			})
+		}
+	}
+	if len(diff.IndexList) > 0 {
+		diff.Changes = append(diff.Changes, "index")
+	}
+
+	if len(diff.Changes) > 0 {
+		diff.Status = compareDifferent
+	}
+}
+
+func findCompareColumn(table *dialect.TableModel, columnName string) *dialect.ColumnModel {
+	for _, one := range table.ColumnList {
+		if compareName(one.ColumnName) == compareName(columnName) {
+			return one
+		}
+	}
+	return nil
+}
+
+func findCompareIndex(table *dialect.TableModel, indexName string) *dialect.IndexModel {
+	for _, one := range table.IndexList {
+		if compareName(one.IndexName) == compareName(indexName) {
+			return one
+		}
+	}
+	return nil
+}
+
+// isPrimaryIndex 主键 索引 由 主键 对比，不 作为 索引 对比
+func isPrimaryIndex(index *dialect.IndexModel) bool {
+	return compareName(index.IndexName) == "primary" || compareName(index.IndexType) == "primary"
+}
+
+// compareColumnType 按 方言 映射 字段 类型，不同 库 的 类型 写法 不同，如 VARCHAR2 与 VARCHAR
+func compareColumnType(dia dialect.Dialect, column *dialect.ColumnModel) string {
+	if dia != nil && column.ColumnDataType != "" {
+		// 映射 规则 可能 修改 长度，使用 副本
+		one := *column
+		info, err := dia.GetColumnTypeInfo(&one)
+		if err == nil && info != nil && info.Name != "" {
+			return compareName(info.Name)
+		}
+	}
+	return compareName(column.ColumnDataType)
+}
+
+func diffColumn(source *dialect.ColumnModel, target *dialect.ColumnModel, compareParam *SchemaCompareParam) (changes []string) {
+	if compareColumnType(compareParam.dia, source) != compareColumnType(compareParam.dia, target) {
+		changes = append(changes, "dataType")
+	}
+	if source.ColumnLength != target.ColumnLength {
+		changes = append(changes, "length")
+	}
+	if source.ColumnPrecision != target.ColumnPrecision {
+		changes = append(changes, "precision")
+	}
+	if source.ColumnScale != target.ColumnScale {
+		changes = append(changes, "scale")
+	}
+	if source.ColumnNotNull != target.ColumnNotNull {
+		changes = append(changes, "notNull")
+	}
+	if compareDefault(source.ColumnDefault) != compareDefault(target.ColumnDefault) {
+		changes = append(changes, "default")
+	}
+	if !compareParam.IgnoreComment && source.ColumnComment != target.ColumnComment {
+		changes = append(changes, "comment")
+	}
+	return
+}
+
+func indexColumnNames(index *dialect.IndexModel) string {
+	columnNames := index.ColumnNames
+	if len(columnNames) == 0 && index.ColumnName != "" {
+		columnNames = []string{index.ColumnName}
+	}
+	var names []string
+	for _, one := range columnNames {
+		names = append(names, compareName(one))
+	}
+	return strings.Join(names, ",")
+}
+
+func diffIndex(source *dialect.IndexModel, target *dialect.IndexModel, compareParam *SchemaCompareParam) (changes []string) {
+	if compareName(source.IndexType) != compareName(target.IndexType) {
+		changes = append(changes, "indexType")
+	}
+	if indexColumnNames(source) != indexColumnNames(target) {
+		changes = append(changes, "columnNames")
+	}
+	if !compareParam.IgnoreComment && source.IndexComment != target.IndexComment {
+		changes = append(changes, "comment")
+	}
+	return
+}
+
+// migrateSql 生成 目标 库 的 迁移 SQL，顺序：创建 表，修改 表（删除 索引、字段、主键、新增 索引、注释），删除 表
+func migrateSql(targetService db.IService, param *db.Param, ownerName string, diffList []*TableDiff, compareParam *SchemaCompareParam) (sqlList []string, err error) {
+	var dropList []*TableDiff
+	for _, diff := range diffList {
+		var tableSqlList []string
+		switch diff.Status {
+		case compareMissing:
+			table := copyTable(diff.source)
+			table.OwnerName = ownerName
+			tableSqlList, err = targetService.GetTargetDialect(param).TableCreateSql(param.ParamModel, ownerName, table)
+		case compareDifferent:
+			tableSqlList, err = tableMigrateSql(targetService, param, ownerName, diff, compareParam)
+		case compareExtra:
+			dropList = append(dropList, diff)
+			continue
+		}
+		if err != nil {
+			diff.Error = err.Error()
+			return
+		}
+		diff.SqlList = tableSqlList
+		sqlList = append(sqlList, tableSqlList...)
+	}
+	if compareParam.NoDrop {
+		return
+	}
+	for _, diff := range dropList {
+		diff.SqlList, err = targetService.GetTargetDialect(param).TableDeleteSql(param.ParamModel, ownerName, diff.TableName)
+		if err != nil {
+			diff.Error = err.Error()
+			return
+		}
+		sqlList = append(sqlList, diff.SqlList...)
+	}
+	return
+}
+
+func copyTable(table *dialect.TableModel) *dialect.TableModel {
+	res := *table
+	res.ColumnList = nil
+	for _, one := range table.ColumnList {
+		column := *one
+		res.ColumnList = append(res.ColumnList, &column)
+	}
+	res.IndexList = nil
+	for _, one := range table.IndexList {
+		if isPrimaryIndex(one) {
+			continue
+		}
+		index := *one
+		res.IndexList = append(res.IndexList, &index)
+	}
+	return &res
+}
+
+// tableMigrateSql 复用 tableUpdateSql 生成 修改 表 SQL，字段 名 使用 目标 的 名称，避免 大小写 不同 生成 重命名
+func tableMigrateSql(targetService db.IService, param *db.Param, ownerName string, diff *TableDiff, compareParam *SchemaCompareParam) (sqlList []string, err error) {
+	source := diff.source
+	target := diff.target
+	tableName := target.TableName
+
+	// 先 删除 索引，避免 删除 字段 后 索引 已 不存在
+	dropIndexParam := &db.UpdateTableParam{}
+	addIndexParam := &db.UpdateTableParam{}
+	for _, one := range diff.IndexList {
+		switch one.Status {
+		case compareMissing:
+			addIndexParam.IndexList = append(addIndexParam.IndexList, &db.UpdateTableIndex{
+				IndexModel: targetIndex(target, one.Source),
+			})
+		case compareDifferent:
+			addIndexParam.IndexList = append(addIndexParam.IndexList, &db.UpdateTableIndex{
+				IndexModel: targetIndex(target, one.Source),
+				OldIndex:   one.Target,
+			})
+		case compareExtra:
+			if compareParam.NoDrop {
+				continue
+			}
+			dropIndexParam.IndexList = append(dropIndexParam.IndexList, &db.UpdateTableIndex{
+				IndexModel: one.Target,
+				OldIndex:   one.Target,
+				Deleted:    true,
+			})
+		}
+	}
+	if len(dropIndexParam.IndexList) > 0 {
+		var sqlList_ []string
+		sqlList_, err = targetService.TableUpdateSql(param, ownerName, tableName, dropIndexParam)
+		if err != nil {
+			return
+		}
+		sqlList = append(sqlList, sqlList_...)
+	}
+
+	// 字段 按 源 顺序，旧 字段 的 位置 按 目标 顺序，位置 相同 不 生成 调整 SQL
+	var targetAfter = map[string]string{}
+	var last string
+	for _, one := range target.ColumnList {
+		targetAfter[compareName(one.ColumnName)] = last
+		last = one.ColumnName
+	}
+	updateParam := &db.UpdateTableParam{}
+	for _, one := range source.ColumnList {
+		column := *one
+		column.OwnerName = ownerName
+		column.TableName = tableName
+		oldColumn := findCompareColumn(target, one.ColumnName)
+		if oldColumn == nil {
+			updateParam.ColumnList = append(updateParam.ColumnList, &db.UpdateTableColumn{
+				ColumnModel: &column,
+			})
+			continue
+		}
+		old := *oldColumn
+		old.ColumnAfterColumn = targetAfter[compareName(old.ColumnName)]
+		if len(diffColumn(one, oldColumn, compareParam)) == 0 {
+			// 没有 差异 使用 目标 字段，避免 不同 库 类型 写法 不同 生成 修改 SQL
+			column = *oldColumn
+			column.PrimaryKey = one.PrimaryKey
+		} else if compareParam.IgnoreComment {
+			column.ColumnComment = oldColumn.ColumnComment
+		}
+		column.ColumnName = oldColumn.ColumnName
+		updateParam.ColumnList = append(updateParam.ColumnList, &db.UpdateTableColumn{
+			ColumnModel: &column,
+			OldColumn:   &old,
+		})
+	}
+	if !compareParam.NoDrop {
+		for _, one := range diff.ColumnList {
+			if one.Status == compareExtra {
+				column := *one.Target
+				updateParam.ColumnList = append(updateParam.ColumnList, &db.UpdateTableColumn{
+					ColumnModel: &column,
+					OldColumn:   one.Target,
+					Deleted:     true,
+				})
+			}
+		}
+	}
+	updateParam.IndexList = addIndexParam.IndexList
+	sqlList_, err := targetService.TableUpdateSql(param, ownerName, tableName, updateParam)
+	if err != nil {
+		return
+	}
+	sqlList = append(sqlList, sqlList_...)
+
+	if !compareParam.IgnoreComment && source.TableComment != target.TableComment {
+		sqlList_, err = targetService.GetTargetDialect(param).TableCommentSql(param.ParamModel, ownerName, tableName, source.TableComment)
+		if err != nil {
+			return
+		}
+		sqlList = append(sqlList, sqlList_...)
+	}
+	return
+}
+
+// targetIndex 索引 字段 名 使用 目标 表 的 字段 名
+func targetIndex(target *dialect.TableModel, index *dialect.IndexModel) *dialect.IndexModel {
+	res := *index
+	res.OwnerName = target.OwnerName
+	res.TableName = target.TableName
+	res.ColumnNames = nil
+	columnNames := index.ColumnNames
+	if len(columnNames) == 0 && index.ColumnName != "" {
+		columnNames = []string{index.ColumnName}
+	}
+	for _, one := range columnNames {
+		if column := findCompareColumn(target, one); column != nil {
+			one = column.ColumnName
+		}
+		res.ColumnNames = append(res.ColumnNames, one)
+	}
+	return &res
+}
@@ -0,0 +1,436 @@
+package module_database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"github.com/team-ide/go-dialect/dialect"
+	"github.com/team-ide/go-tool/db"
+	"github.com/team-ide/go-tool/util"
+	"go.uber.org/zap"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Execution 执行 中 的 SQL，可 通过 executeId 取消
+type Execution struct {
+	ExecuteId string `json:"executeId"`
+	WorkerId  string `json:"workerId"`
+	SessionId string `json:"sessionId"` // 数据库 会话 ID，用于 KILL QUERY 等
+	StartTime int64  `json:"startTime"`
+	IsCancel  bool   `json:"isCancel"`
+
+	userId  int64           // 只有 执行 的 用户 可以 取消
+	inTx    bool            // 在 工作 窗口 的 事务 中 执行，取消 时 保留 连接
+	dia     dialect.Dialect // 用于 拆分 SQL 的 目标 方言
+	service db.IService
+	cancel  context.CancelFunc
+	lock    sync.Mutex
+}
+
+var executionCache = map[string]*Execution{}
+var executionCacheLock = &sync.Mutex{}
+
+func addExecution(execution *Execution) (err error) {
+	executionCacheLock.Lock()
+	defer executionCacheLock.Unlock()
+	if executionCache[execution.ExecuteId] != nil {
+		err = errors.New("SQL执行[" + execution.ExecuteId + "]已存在")
+		return
+	}
+	executionCache[execution.ExecuteId] = execution
+	return
+}
+
+func removeExecution(executeId string) {
+	executionCacheLock.Lock()
+	defer executionCacheLock.Unlock()
+	delete(executionCache, executeId)
+}
+
+func getExecution(executeId string) *Execution {
+	executionCacheLock.Lock()
+	defer executionCacheLock.Unlock()
+	return executionCache[executeId]
+}
+
+// getWorkerExecutions 获取 工作 窗口 下 所有 执行 中 的 SQL
+func getWorkerExecutions(workerId string) (list []*Execution) {
+	executionCacheLock.Lock()
+	defer executionCacheLock.Unlock()
+	for _, one := range executionCache {
+		if one.WorkerId == workerId {
+			list = append(list, one)
+		}
+	}
+	return
+}
+
+func (this_ *Execution) setSessionId(sessionId string) {
+	this_.lock.Lock()
+	defer this_.lock.Unlock()
+	this_.SessionId = sessionId
+}
+
+func (this_ *Execution) setTransaction(sessionId string) {
+	this_.lock.Lock()
+	defer this_.lock.Unlock()
+	this_.SessionId = sessionId
+	this_.inTx = true
+}
+
+// Cancel 先 在 数据库 端 终止 正在 执行 的 语句，再 取消 上下文
+// 事务 中 终止 成功 时 不 取消 上下文，取消 上下文 会 关闭 事务 的 连接
+func (this_ *Execution) Cancel() (err error) {
+	this_.lock.Lock()
+	this_.IsCancel = true
+	sessionId := this_.SessionId
+	inTx := this_.inTx
+	this_.lock.Unlock()
+
+	if killSql := getKillQuerySql(this_.service.GetDialect(), sessionId); killSql != "" {
+		_, err = this_.service.Exec(killSql, nil)
+		if err != nil {
+			util.Logger.Warn("execute sql kill query error", zap.Any("executeId", this_.ExecuteId), zap.Any("killSql", killSql), zap.Error(err))
+		} else if inTx {
+			return
+		}
+	}
+	this_.cancel()
+	return
+}
+
+func (this_ *Execution) isCanceled() bool {
+	this_.lock.Lock()
+	defer this_.lock.Unlock()
+	return this_.IsCancel
+}
+
+// getSessionIdSql 查询 当前 会话 ID 的 SQL，不 支持 的 方言 只 使用 上下文 取消
+func getSessionIdSql(dia dialect.Dialect) string {
+	switch dia.DialectType() {
+	case dialect.TypeMysql:
+		return "SELECT CONNECTION_ID()"
+	case dialect.TypePostgresql, dialect.TypeKingBase, dialect.TypeOpenGauss:
+		return "SELECT pg_backend_pid()"
+	}
+	return ""
+}
+
+// getKillQuerySql 终止 会话 正在 执行 的 语句，保留 会话 本身
+func getKillQuerySql(dia dialect.Dialect, sessionId string) string {
+	if sessionId == "" || strings.Trim(sessionId, "0123456789") != "" {
+		return ""
+	}
+	switch dia.DialectType() {
+	case dialect.TypeMysql:
+		return "KILL QUERY " + sessionId
+	case dialect.TypePostgresql, dialect.TypeKingBase, dialect.TypeOpenGauss:
+		return "SELECT pg_cancel_backend(" + sessionId + ")"
+	}
+	return ""
+}
+
+// newWorkDb 按 执行 用户 与 库 新建 连接 池，与 go-tool 的 ExecuteSQL 保持 一致
+func newWorkDb(config db.Config, param *db.Param, ownerName string) (workDb *sql.DB, err error) {
+	databaseType := db.GetDatabaseType(config.Type)
+	if databaseType == nil {
+		err = errors.New("数据库类型[" + config.Type + "]暂不支持")
+		return
+	}
+	config.MaxIdleConn = 3
+	config.MaxOpenConn = 3
+	if param.ExecUsername != "" {
+		config.Username = param.ExecUsername
+	}
+	if param.ExecPassword != "" {
+		config.Password = param.ExecPassword
+	}
+	switch databaseType.GetDialect().DialectType() {
+	case dialect.TypeMysql:
+		config.Database = ownerName
+	case dialect.TypeGBase:
+		if ownerName != "" {
+			var keyL = len("db=")
+			index := strings.Index(strings.ToLower(config.OdbcDsn), "db=")
+			if index < 0 {
+				index = strings.Index(strings.ToLower(config.OdbcDsn), "database=")
+				keyL = len("database=")
+			}
+			if index >= 0 {
+				beforeStr := config.OdbcDsn[0 : index+keyL]
+				afterStr := ""
+				str := config.OdbcDsn[index+keyL:]
+				index = strings.Index(str, ";")
+				if index >= 0 {
+					afterStr = str[index:]
+				}
+				config.OdbcDsn = beforeStr + ownerName + afterStr
+			}
+		}
+	default:
+		config.Schema = ownerName
+	}
+	workDb, err = databaseType.NewDb(&config)
+	return
+}
+
+type prepareFunc func(ctx context.Context, query string) (*sql.Stmt, error)
+
+type executeTask struct {
+	*Execution
+	*db.Param
+	*db.ExecuteOptions
+	ownerName   string
+	timeout     time.Duration // 单条 语句 超时，0 为 不限制
+	transaction *Transaction  // 不 为 空 时 在 工作 窗口 的 事务 中 执行
+	readOnly    bool          // 只读 模式 在 只读 事务 中 执行
+	badConn     bool          // 语句 被 上下文 中断 或 连接 失效，事务 无法 继续
+}
+
+// run 与 go-tool 的 ExecuteSQL 相同，增加 取消 与 单条 语句 超时
+func (this_ *executeTask) run(ctx context.Context, sqlContent string) (executeList []map[string]interface{}, errStr string, err error) {
+	if this_.transaction != nil {
+		this_.setTransaction(this_.transaction.SessionId)
+		executeList, errStr, err = this_.runSqlList(ctx, sqlContent, this_.transaction.tx.PrepareContext)
+		// 连接 已 失效 时 回滚 并 移除 事务，调用 方 持有 execLock
+		if this_.badConn {
+			if e := this_.transaction.finish(false); e != nil {
+				util.Logger.Warn("ExecuteSQL transaction rollback error", zap.Any("workerId", this_.transaction.WorkerId), zap.Error(e))
+			}
+			errStr += "；连接已失效，事务已回滚"
+		}
+		return
+	}
+	workDb, err := newWorkDb(this_.service.GetConfig(), this_.Param, this_.ownerName)
+	if err != nil {
+		util.Logger.Error("ExecuteSQL new db pool error", zap.Error(err))
+		return
+	}
+	defer func() {
+		_ = workDb.Close()
+	}()
+	conn, err := workDb.Conn(ctx)
+	if err != nil {
+		util.Logger.Error("ExecuteSQL Conn error", zap.Error(err))
+		return
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	if sessionSql := getSessionIdSql(this_.service.GetDialect()); sessionSql != "" {
+		var sessionId interface{}
+		if e := conn.QueryRowContext(ctx, sessionSql).Scan(&sessionId); e == nil {
+			this_.setSessionId(util.GetStringValue(sessionId))
+		} else {
+			util.Logger.Warn("ExecuteSQL query session id error", zap.Error(e))
+		}
+	}
+
+	var prepare prepareFunc
+	var hasError bool
+	if this_.OpenTransaction || this_.readOnly {
+		var tx *sql.Tx
+		tx, err = conn.BeginTx(ctx, &sql.TxOptions{ReadOnly: this_.readOnly})
+		if err != nil {
+			util.Logger.Error("ExecuteSQL BeginTx error", zap.Error(err))
+			return
+		}
+		defer func() {
+			if hasError {
+				err = tx.Rollback()
+			} else {
+				err = tx.Commit()
+				if err != nil && strings.Contains(err.Error(), "Not in transaction") {
+					err = nil
+				}
+			}
+		}()
+		prepare = tx.PrepareContext
+	} else {
+		prepare = conn.PrepareContext
+	}
+	executeList, errStr, err = this_.runSqlList(ctx, sqlContent, prepare)
+	hasError = errStr != ""
+	return
+}
+
+// runSqlList 拆分 并 依次 执行 SQL，事务 由 调用 方 处理
+func (this_ *executeTask) runSqlList(ctx context.Context, sqlContent string, prepare prepareFunc) (executeList []map[string]interface{}, errStr string, err error) {
+	isMysqlProfiling := this_.dia.DialectType() == dialect.TypeMysql && this_.OpenProfiling
+	if isMysqlProfiling {
+		if stmt, e := prepare(ctx, "SET profiling = 1"); e == nil {
+			_, _ = stmt.Exec()
+			_ = stmt.Close()
+		}
+		defer func() {
+			if stmt, e := prepare(ctx, "SET profiling = 0"); e == nil {
+				_, _ = stmt.Exec()
+				_ = stmt.Close()
+			}
+		}()
+	}
+	sqlList := this_.dia.SqlSplit(sqlContent)
+	var lastQueryID int
+	for _, executeSql := range sqlList {
+		if this_.isCanceled() {
+			err = errors.New("SQL执行已取消")
+			errStr = err.Error()
+			return
+		}
+		var executeData map[string]interface{}
+		lastQueryID, executeData, err = this_.execExecuteSQL(ctx, lastQueryID, executeSql, prepare)
+		executeList = append(executeList, executeData)
+		if err != nil {
+			util.Logger.Error("ExecuteSQL execExecuteSQL error", zap.Any("executeSql", executeSql), zap.Error(err))
+			errStr = err.Error()
+			if !this_.ErrorContinue || this_.isCanceled() {
+				return
+			}
+			err = nil
+		}
+	}
+	return
+}
+
+func (this_ *executeTask) execExecuteSQL(ctx context.Context, lastQueryID int, executeSql string, prepare prepareFunc) (queryID int, executeData map[string]interface{}, err error) {
+	queryID = lastQueryID
+	executeData = map[string]interface{}{}
+	var startTime = util.GetNow()
+	executeData["sql"] = executeSql
+	executeData["startTime"] = util.GetFormatByTime(startTime)
+
+	stmtCtx := ctx
+	if this_.timeout > 0 {
+		var cancel context.CancelFunc
+		stmtCtx, cancel = context.WithTimeout(ctx, this_.timeout)
+		defer cancel()
+	}
+	defer func() {
+		var endTime = time.Now()
+		executeData["endTime"] = util.GetFormatByTime(endTime)
+		executeData["isEnd"] = true
+		executeData["useTime"] = util.GetMilliByTime(endTime) - util.GetMilliByTime(startTime)
+		if err != nil {
+			if errors.Is(err, driver.ErrBadConn) || stmtCtx.Err() != nil {
+				this_.badConn = true
+			}
+			if this_.isCanceled() {
+				err = errors.New("SQL执行已取消：" + err.Error())
+				executeData["isCancel"] = true
+			} else if errors.Is(stmtCtx.Err(), context.DeadlineExceeded) {
+				err = errors.New(fmt.Sprintf("SQL执行超时[%s]：%s", this_.timeout, err.Error()))
+				executeData["isTimeout"] = true
+			}
+			executeData["error"] = err.Error()
+		}
+		if this_.dia.DialectType() == dialect.TypeMysql && this_.OpenProfiling && ctx.Err() == nil {
+			queryID, executeData["profiling"], _ = queryProfiling(ctx, lastQueryID, prepare)
+		}
+	}()
+	stmt, err := prepare(stmtCtx, executeSql)
+	if err != nil {
+		return
+	}
+	defer func() { _ = stmt.Close() }()
+
+	str := strings.ToLower(executeSql)
+	if strings.HasPrefix(str, "select") ||
+		strings.HasPrefix(str, "show") ||
+		strings.HasPrefix(str, "desc") ||
+		strings.HasPrefix(str, "explain") {
+		executeData["isSelect"] = true
+		var rows *sql.Rows
+		rows, err = stmt.QueryContext(stmtCtx)
+		if err != nil {
+			return
+		}
+		defer func() {
+			_ = rows.Close()
+		}()
+		var columnList []map[string]interface{}
+		var dataList []map[string]interface{}
+		var dataSize int
+		dataSize, columnList, dataList, err = db.RowsToListMap(rows, this_.SelectDataMax)
+		if err != nil {
+			return
+		}
+		executeData["columnList"] = columnList
+		executeData["dataSize"] = dataSize
+		executeData["dataList"] = dataList
+		return
+	}
+	if strings.HasPrefix(str, "insert") {
+		executeData["isInsert"] = true
+	} else if strings.HasPrefix(str, "update") {
+		executeData["isUpdate"] = true
+	} else if strings.HasPrefix(str, "delete") {
+		executeData["isDelete"] = true
+	} else {
+		executeData["isExec"] = true
+	}
+	var result sql.Result
+	result, err = stmt.ExecContext(stmtCtx)
+	if err != nil {
+		return
+	}
+	executeData["rowsAffected"], _ = result.RowsAffected()
+	return
+}
+
+func queryProfiling(ctx context.Context, lastQueryID int, prepare prepareFunc) (queryID int, profiling map[string]interface{}, err error) {
+	queryID = lastQueryID
+	stmt1, err := prepare(ctx, "SHOW PROFILES")
+	if err != nil {
+		return
+	}
+	defer func() { _ = stmt1.Close() }()
+	rows1, err := stmt1.QueryContext(ctx)
+	if err != nil {
+		return
+	}
+	defer func() { _ = rows1.Close() }()
+	_, _, dataList, err := db.RowsToListMap(rows1, 0)
+	if err != nil {
+		return
+	}
+
+	var data map[string]interface{}
+	for _, one := range dataList {
+		if one["Query_ID"] == nil {
+			continue
+		}
+		id := util.StringToInt(util.GetStringValue(one["Query_ID"]))
+		if lastQueryID < id {
+			queryID = id
+			data = one
+			break
+		}
+	}
+	if data == nil {
+		return
+	}
+
+	stmt2, err := prepare(ctx, "SHOW PROFILE ALL FOR QUERY "+util.GetStringValue(data["Query_ID"]))
+	if err != nil {
+		return
+	}
+	defer func() { _ = stmt2.Close() }()
+	rows2, err := stmt2.QueryContext(ctx)
+	if err != nil {
+		return
+	}
+	defer func() { _ = rows2.Close() }()
+	_, columnList, dataList, err := db.RowsToListMap(rows2, 0)
+	if err != nil {
+		return
+	}
+	data["columnList"] = columnList
+	data["profileDataList"] = dataList
+
+	profiling = data
+	return
+}
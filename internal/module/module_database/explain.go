@@ -0,0 +1,424 @@
+package module_database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/team-ide/go-dialect/dialect"
+	"github.com/team-ide/go-tool/db"
+	"github.com/team-ide/go-tool/util"
+	"go.uber.org/zap"
+	"sort"
+	"strings"
+)
+
+// PlanNode 统一 的 执行 计划 节点，不同 数据库 的 字段 尽量 对应 到 相同 含义
+type PlanNode struct {
+	Operation    string      `json:"operation"`              // 操作，如 Seq Scan、TABLE ACCESS FULL、nested_loop
+	Object       string      `json:"object,omitempty"`       // 访问 的 表
+	AccessType   string      `json:"accessType,omitempty"`   // 访问 方式，如 ALL、ref、Index Scan
+	Index        string      `json:"index,omitempty"`        // 使用 的 索引
+	PossibleKeys []string    `json:"possibleKeys,omitempty"` // 可能 使用 的 索引
+	StartupCost  float64     `json:"startupCost,omitempty"`
+	Cost         float64     `json:"cost,omitempty"`
+	Rows         float64     `json:"rows,omitempty"` // 预估 行数
+	Condition    string      `json:"condition,omitempty"`
+	Filter       string      `json:"filter,omitempty"`
+	Extra        []string    `json:"extra,omitempty"`
+	Children     []*PlanNode `json:"children,omitempty"`
+}
+
+type ExplainResult struct {
+	DatabaseType string    `json:"databaseType"`
+	Sql          string    `json:"sql"`
+	ExplainSql   string    `json:"explainSql"`
+	Plan         *PlanNode `json:"plan,omitempty"` // 不 支持 结构化 的 数据库 为 空，只 返回 原始 结果
+	Raw          string    `json:"raw"`
+}
+
+// explain 按 方言 执行 EXPLAIN，只 解释 不 执行 语句
+func explain(ctx context.Context, service db.IService, param *db.Param, ownerName string, sqlContent string) (result *ExplainResult, err error) {
+	dia := service.GetDialect()
+	sqlList := dia.SqlSplit(sqlContent)
+	if len(sqlList) != 1 {
+		err = errors.New("执行计划只支持单条语句")
+		return
+	}
+	sqlContent = strings.TrimSpace(sqlList[0])
+	sqlContent = strings.TrimRight(sqlContent, ";")
+
+	workDb, err := newWorkDb(service.GetConfig(), param, ownerName)
+	if err != nil {
+		util.Logger.Error("explain new db pool error", zap.Error(err))
+		return
+	}
+	defer func() { _ = workDb.Close() }()
+	conn, err := workDb.Conn(ctx)
+	if err != nil {
+		return
+	}
+	defer func() { _ = conn.Close() }()
+
+	result = &ExplainResult{
+		DatabaseType: dia.DialectType().Name,
+		Sql:          sqlContent,
+	}
+	switch dia.DialectType() {
+	case dialect.TypeMysql:
+		result.ExplainSql = "EXPLAIN FORMAT=JSON " + sqlContent
+		result.Raw, err = queryFirstValue(ctx, conn, result.ExplainSql)
+		if err != nil {
+			return
+		}
+		result.Plan, err = parseMysqlPlan(result.Raw)
+	case dialect.TypePostgresql, dialect.TypeKingBase, dialect.TypeOpenGauss:
+		result.ExplainSql = "EXPLAIN (FORMAT JSON) " + sqlContent
+		result.Raw, err = queryFirstValue(ctx, conn, result.ExplainSql)
+		if err != nil {
+			return
+		}
+		result.Plan, err = parsePostgresqlPlan(result.Raw)
+	case dialect.TypeOracle:
+		err = explainOracle(ctx, conn, sqlContent, result)
+	case dialect.TypeSqlite:
+		err = explainSqlite(ctx, conn, sqlContent, result)
+	default:
+		result.ExplainSql = "EXPLAIN " + sqlContent
+		result.Raw, err = queryText(ctx, conn, result.ExplainSql)
+	}
+	return
+}
+
+func queryList(ctx context.Context, conn *sql.Conn, sqlInfo string) (columnList []map[string]interface{}, dataList []map[string]interface{}, err error) {
+	rows, err := conn.QueryContext(ctx, sqlInfo)
+	if err != nil {
+		return
+	}
+	defer func() { _ = rows.Close() }()
+	_, columnList, dataList, err = db.RowsToListMap(rows, 0)
+	return
+}
+
+func queryFirstValue(ctx context.Context, conn *sql.Conn, sqlInfo string) (value string, err error) {
+	columnList, dataList, err := queryList(ctx, conn, sqlInfo)
+	if err != nil {
+		return
+	}
+	if len(columnList) == 0 || len(dataList) == 0 {
+		err = errors.New("执行计划结果为空")
+		return
+	}
+	value = planString(dataList[0][util.GetStringValue(columnList[0]["name"])])
+	return
+}
+
+// queryText 按 行 拼接 查询 结果，用于 不 支持 结构化 的 数据库
+func queryText(ctx context.Context, conn *sql.Conn, sqlInfo string) (text string, err error) {
+	columnList, dataList, err := queryList(ctx, conn, sqlInfo)
+	if err != nil {
+		return
+	}
+	var lines []string
+	for _, data := range dataList {
+		var values []string
+		for _, column := range columnList {
+			values = append(values, planString(data[util.GetStringValue(column["name"])]))
+		}
+		lines = append(lines, strings.Join(values, "\t"))
+	}
+	text = strings.Join(lines, "\n")
+	return
+}
+
+func planString(v interface{}) string {
+	switch tV := v.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(tV)
+	}
+	return util.GetStringValue(v)
+}
+
+func planFloat(v interface{}) float64 {
+	switch tV := v.(type) {
+	case float64:
+		return tV
+	case json.Number:
+		f, _ := tV.Float64()
+		return f
+	case nil:
+		return 0
+	}
+	var f float64
+	_, _ = fmt.Sscan(planString(v), &f)
+	return f
+}
+
+func planStrings(v interface{}) (res []string) {
+	list, _ := v.([]interface{})
+	for _, one := range list {
+		res = append(res, planString(one))
+	}
+	return
+}
+
+// mysqlPlanSkipKeys 不 作为 子 节点 的 字段
+var mysqlPlanSkipKeys = map[string]bool{
+	"cost_info":          true,
+	"used_columns":       true,
+	"possible_keys":      true,
+	"used_key_parts":     true,
+	"ref":                true,
+	"key_length":         true,
+	"attached_condition": true,
+}
+
+// parseMysqlPlan 解析 EXPLAIN FORMAT=JSON 的 结果
+func parseMysqlPlan(raw string) (plan *PlanNode, err error) {
+	data := map[string]interface{}{}
+	err = json.Unmarshal([]byte(raw), &data)
+	if err != nil {
+		return
+	}
+	plan = mysqlPlanNode("query_block", data["query_block"])
+	return
+}
+
+func mysqlPlanNode(operation string, v interface{}) (node *PlanNode) {
+	data, ok := v.(map[string]interface{})
+	if !ok {
+		return
+	}
+	node = &PlanNode{
+		Operation: operation,
+	}
+	if data["table_name"] != nil {
+		node.Object = planString(data["table_name"])
+		node.AccessType = planString(data["access_type"])
+		node.Index = planString(data["key"])
+		node.PossibleKeys = planStrings(data["possible_keys"])
+		node.Rows = planFloat(data["rows_examined_per_scan"])
+		node.Filter = planString(data["attached_condition"])
+		if refs := planStrings(data["ref"]); len(refs) > 0 {
+			node.Condition = strings.Join(refs, ", ")
+		}
+	}
+	if costInfo, ok := data["cost_info"].(map[string]interface{}); ok {
+		if costInfo["query_cost"] != nil {
+			node.Cost = planFloat(costInfo["query_cost"])
+		} else if costInfo["prefix_cost"] != nil {
+			node.Cost = planFloat(costInfo["prefix_cost"])
+		} else {
+			node.Cost = planFloat(costInfo["read_cost"]) + planFloat(costInfo["eval_cost"])
+		}
+	}
+
+	var keys []string
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if mysqlPlanSkipKeys[key] {
+			continue
+		}
+		switch value := data[key].(type) {
+		case map[string]interface{}:
+			if child := mysqlPlanNode(key, value); child != nil {
+				node.Children = append(node.Children, child)
+			}
+		case []interface{}:
+			// nested_loop、query_specifications 等 列表 的 元素 为 单个 key 的 对象
+			group := &PlanNode{
+				Operation: key,
+			}
+			for _, one := range value {
+				item, ok := one.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				if len(item) == 1 {
+					for itemKey, itemValue := range item {
+						if child := mysqlPlanNode(itemKey, itemValue); child != nil {
+							group.Children = append(group.Children, child)
+						}
+					}
+				} else if child := mysqlPlanNode(key, item); child != nil {
+					group.Children = append(group.Children, child)
+				}
+			}
+			if len(group.Children) > 0 {
+				node.Children = append(node.Children, group)
+			}
+		case bool:
+			if value {
+				node.Extra = append(node.Extra, key)
+			}
+		case string:
+			if data["table_name"] == nil && key != "table_name" && key != "select_id" {
+				node.Extra = append(node.Extra, key+": "+value)
+			}
+		}
+	}
+	// 只有 一个 子 节点 的 query_block 直接 展开
+	if operation == "query_block" && node.Object == "" && len(node.Children) == 1 && node.Cost == 0 {
+		return node.Children[0]
+	}
+	return
+}
+
+// parsePostgresqlPlan 解析 EXPLAIN (FORMAT JSON) 的 结果
+func parsePostgresqlPlan(raw string) (plan *PlanNode, err error) {
+	var list []map[string]interface{}
+	err = json.Unmarshal([]byte(raw), &list)
+	if err != nil {
+		return
+	}
+	if len(list) == 0 {
+		err = errors.New("执行计划结果为空")
+		return
+	}
+	plan = postgresqlPlanNode(list[0]["Plan"])
+	return
+}
+
+var postgresqlConditionKeys = []string{"Index Cond", "Hash Cond", "Merge Cond", "Join Filter", "Recheck Cond"}
+
+func postgresqlPlanNode(v interface{}) (node *PlanNode) {
+	data, ok := v.(map[string]interface{})
+	if !ok {
+		return
+	}
+	node = &PlanNode{
+		Operation:   planString(data["Node Type"]),
+		Object:      planString(data["Relation Name"]),
+		Index:       planString(data["Index Name"]),
+		StartupCost: planFloat(data["Startup Cost"]),
+		Cost:        planFloat(data["Total Cost"]),
+		Rows:        planFloat(data["Plan Rows"]),
+		Filter:      planString(data["Filter"]),
+	}
+	if node.Object != "" || node.Index != "" {
+		node.AccessType = node.Operation
+	}
+	if joinType := planString(data["Join Type"]); joinType != "" {
+		node.Extra = append(node.Extra, "Join Type: "+joinType)
+	}
+	if strategy := planString(data["Strategy"]); strategy != "" {
+		node.Extra = append(node.Extra, "Strategy: "+strategy)
+	}
+	if sortKeys := planStrings(data["Sort Key"]); len(sortKeys) > 0 {
+		node.Extra = append(node.Extra, "Sort Key: "+strings.Join(sortKeys, ", "))
+	}
+	var conditions []string
+	for _, key := range postgresqlConditionKeys {
+		if s := planString(data[key]); s != "" {
+			conditions = append(conditions, s)
+		}
+	}
+	node.Condition = strings.Join(conditions, " AND ")
+	plans, _ := data["Plans"].([]interface{})
+	for _, one := range plans {
+		if child := postgresqlPlanNode(one); child != nil {
+			node.Children = append(node.Children, child)
+		}
+	}
+	return
+}
+
+// explainOracle 使用 EXPLAIN PLAN 写入 PLAN_TABLE，结构 从 PLAN_TABLE 读取，原始 结果 使用 DBMS_XPLAN
+func explainOracle(ctx context.Context, conn *sql.Conn, sqlContent string, result *ExplainResult) (err error) {
+	statementId := "TEAMIDE_" + strings.ToUpper(util.GetUUID()[:16])
+	result.ExplainSql = "EXPLAIN PLAN SET STATEMENT_ID = '" + statementId + "' FOR " + sqlContent
+	_, err = conn.ExecContext(ctx, result.ExplainSql)
+	if err != nil {
+		return
+	}
+	defer func() {
+		_, _ = conn.ExecContext(context.Background(), "DELETE FROM PLAN_TABLE WHERE STATEMENT_ID = '"+statementId+"'")
+	}()
+
+	result.Raw, err = queryText(ctx, conn, "SELECT PLAN_TABLE_OUTPUT FROM TABLE(DBMS_XPLAN.DISPLAY(NULL, '"+statementId+"', 'ALL'))")
+	if err != nil {
+		return
+	}
+	_, dataList, err := queryList(ctx, conn, `SELECT ID, PARENT_ID, OPERATION, OPTIONS, OBJECT_NAME, COST, CARDINALITY, ACCESS_PREDICATES, FILTER_PREDICATES
+FROM PLAN_TABLE WHERE STATEMENT_ID = '`+statementId+`' ORDER BY ID`)
+	if err != nil {
+		return
+	}
+	nodes := map[string]*PlanNode{}
+	for _, data := range dataList {
+		node := &PlanNode{
+			Operation: strings.TrimSpace(planString(data["OPERATION"]) + " " + planString(data["OPTIONS"])),
+			Cost:      planFloat(data["COST"]),
+			Rows:      planFloat(data["CARDINALITY"]),
+			Condition: planString(data["ACCESS_PREDICATES"]),
+			Filter:    planString(data["FILTER_PREDICATES"]),
+		}
+		objectName := planString(data["OBJECT_NAME"])
+		switch planString(data["OPERATION"]) {
+		case "INDEX":
+			node.Index = objectName
+			node.AccessType = planString(data["OPTIONS"])
+		case "TABLE ACCESS":
+			node.Object = objectName
+			node.AccessType = planString(data["OPTIONS"])
+		default:
+			node.Object = objectName
+		}
+		nodes[planString(data["ID"])] = node
+		parent := nodes[planString(data["PARENT_ID"])]
+		if parent == nil {
+			if result.Plan == nil {
+				result.Plan = node
+			}
+			continue
+		}
+		parent.Children = append(parent.Children, node)
+	}
+	return
+}
+
+// explainSqlite 使用 EXPLAIN QUERY PLAN，按 parent 组成 树
+func explainSqlite(ctx context.Context, conn *sql.Conn, sqlContent string, result *ExplainResult) (err error) {
+	result.ExplainSql = "EXPLAIN QUERY PLAN " + sqlContent
+	_, dataList, err := queryList(ctx, conn, result.ExplainSql)
+	if err != nil {
+		return
+	}
+	result.Plan = &PlanNode{
+		Operation: "QUERY PLAN",
+	}
+	nodes := map[string]*PlanNode{}
+	var lines []string
+	for _, data := range dataList {
+		detail := planString(data["detail"])
+		lines = append(lines, detail)
+		node := &PlanNode{
+			Operation: detail,
+		}
+		// 如 SEARCH user USING INDEX idx_name (name=?)、SCAN user
+		fields := strings.Fields(detail)
+		if len(fields) >= 2 && (fields[0] == "SCAN" || fields[0] == "SEARCH") {
+			node.AccessType = fields[0]
+			node.Object = fields[1]
+			if index := strings.Index(detail, "INDEX "); index >= 0 {
+				if names := strings.Fields(detail[index+len("INDEX "):]); len(names) > 0 {
+					node.Index = names[0]
+				}
+			}
+		}
+		nodes[planString(data["id"])] = node
+		parent := nodes[planString(data["parent"])]
+		if parent == nil {
+			parent = result.Plan
+		}
+		parent.Children = append(parent.Children, node)
+	}
+	result.Raw = strings.Join(lines, "\n")
+	return
+}
@@ -0,0 +1,468 @@
+package module_database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/team-ide/go-dialect/dialect"
+	"github.com/team-ide/go-tool/db"
+	"github.com/team-ide/go-tool/util"
+	"go.uber.org/zap"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	graphFormatMermaid  = "mermaid"
+	graphFormatPlantUML = "plantuml"
+	graphFormatDot      = "dot"
+)
+
+// ForeignKeyModel 外键，多 字段 外键 按 字段 顺序 对应
+type ForeignKeyModel struct {
+	ConstraintName        string   `json:"constraintName"`
+	TableName             string   `json:"tableName"`
+	ColumnNames           []string `json:"columnNames"`
+	ReferencedOwnerName   string   `json:"referencedOwnerName,omitempty"`
+	ReferencedTableName   string   `json:"referencedTableName"`
+	ReferencedColumnNames []string `json:"referencedColumnNames"`
+	OnDelete              string   `json:"onDelete,omitempty"`
+	OnUpdate              string   `json:"onUpdate,omitempty"`
+	Inferred              bool     `json:"inferred,omitempty"` // 按 字段 命名 推断，非 真实 外键
+}
+
+type GraphTable struct {
+	TableName    string                 `json:"tableName"`
+	TableComment string                 `json:"tableComment,omitempty"`
+	PrimaryKeys  []string               `json:"primaryKeys,omitempty"`
+	ColumnList   []*dialect.ColumnModel `json:"columnList,omitempty"`
+	ForeignKeys  []*ForeignKeyModel     `json:"foreignKeys"`
+}
+
+// GraphParam 外键 关系 图 参数
+type GraphParam struct {
+	TableNames  []string `json:"tableNames"`  // 为 空 查询 所有 表
+	Infer       bool     `json:"infer"`       // 按 字段 命名 推断 缺失 的 外键，如 user_id
+	WithColumns bool     `json:"withColumns"` // 返回 字段
+	Format      string   `json:"format"`      // 导出 格式：mermaid、plantuml、dot
+}
+
+type ForeignKeyGraph struct {
+	OwnerName string        `json:"ownerName"`
+	TableList []*GraphTable `json:"tableList"`
+	Format    string        `json:"format,omitempty"`
+	Text      string        `json:"text,omitempty"`
+}
+
+func sqlStringValue(v string) string {
+	return "'" + strings.ReplaceAll(v, "'", "''") + "'"
+}
+
+// foreignKeysSql 查询 库 下 所有 外键 的 SQL，不 支持 的 方言 返回 空
+func foreignKeysSql(dia dialect.Dialect, ownerName string) string {
+	switch dia.DialectType() {
+	case dialect.TypeMysql:
+		return `SELECT k.CONSTRAINT_NAME, k.TABLE_NAME, k.COLUMN_NAME, k.REFERENCED_TABLE_SCHEMA, k.REFERENCED_TABLE_NAME, k.REFERENCED_COLUMN_NAME, r.DELETE_RULE, r.UPDATE_RULE
+FROM information_schema.KEY_COLUMN_USAGE k
+JOIN information_schema.REFERENTIAL_CONSTRAINTS r ON r.CONSTRAINT_SCHEMA = k.CONSTRAINT_SCHEMA AND r.CONSTRAINT_NAME = k.CONSTRAINT_NAME AND r.TABLE_NAME = k.TABLE_NAME
+WHERE k.TABLE_SCHEMA = ` + sqlStringValue(ownerName) + ` AND k.REFERENCED_TABLE_NAME IS NOT NULL
+ORDER BY k.TABLE_NAME, k.CONSTRAINT_NAME, k.ORDINAL_POSITION`
+	case dialect.TypePostgresql, dialect.TypeKingBase, dialect.TypeOpenGauss:
+		return `SELECT con.conname AS "CONSTRAINT_NAME", cl.relname AS "TABLE_NAME", att.attname AS "COLUMN_NAME", fns.nspname AS "REFERENCED_TABLE_SCHEMA", fcl.relname AS "REFERENCED_TABLE_NAME", fatt.attname AS "REFERENCED_COLUMN_NAME",
+CAST(con.confdeltype AS VARCHAR) AS "DELETE_RULE", CAST(con.confupdtype AS VARCHAR) AS "UPDATE_RULE"
+FROM pg_constraint con
+JOIN pg_class cl ON cl.oid = con.conrelid
+JOIN pg_namespace ns ON ns.oid = cl.relnamespace
+JOIN pg_class fcl ON fcl.oid = con.confrelid
+JOIN pg_namespace fns ON fns.oid = fcl.relnamespace
+JOIN generate_series(1, 32) AS k(i) ON k.i <= array_length(con.conkey, 1)
+JOIN pg_attribute att ON att.attrelid = con.conrelid AND att.attnum = con.conkey[k.i]
+JOIN pg_attribute fatt ON fatt.attrelid = con.confrelid AND fatt.attnum = con.confkey[k.i]
+WHERE con.contype = 'f' AND ns.nspname = ` + sqlStringValue(ownerName) + `
+ORDER BY cl.relname, con.conname, k.i`
+	case dialect.TypeOracle, dialect.TypeDM:
+		return `SELECT c.CONSTRAINT_NAME, c.TABLE_NAME, cc.COLUMN_NAME, rc.OWNER AS REFERENCED_TABLE_SCHEMA, rc.TABLE_NAME AS REFERENCED_TABLE_NAME, rc.COLUMN_NAME AS REFERENCED_COLUMN_NAME, c.DELETE_RULE, 'NO ACTION' AS UPDATE_RULE
+FROM ALL_CONSTRAINTS c
+JOIN ALL_CONS_COLUMNS cc ON cc.OWNER = c.OWNER AND cc.CONSTRAINT_NAME = c.CONSTRAINT_NAME
+JOIN ALL_CONS_COLUMNS rc ON rc.OWNER = c.R_OWNER AND rc.CONSTRAINT_NAME = c.R_CONSTRAINT_NAME AND rc.POSITION = cc.POSITION
+WHERE c.CONSTRAINT_TYPE = 'R' AND c.OWNER = ` + sqlStringValue(ownerName) + `
+ORDER BY c.TABLE_NAME, c.CONSTRAINT_NAME, cc.POSITION`
+	}
+	return ""
+}
+
+// postgresqlRules pg_constraint 中 的 规则 代码
+var postgresqlRules = map[string]string{
+	"a": "NO ACTION",
+	"r": "RESTRICT",
+	"c": "CASCADE",
+	"n": "SET NULL",
+	"d": "SET DEFAULT",
+}
+
+// loadForeignKeys 查询 库 下 的 外键，按 表 分组
+func loadForeignKeys(ctx context.Context, service db.IService, param *db.Param, ownerName string, tables []*dialect.TableModel) (res map[string][]*ForeignKeyModel, err error) {
+	res = map[string][]*ForeignKeyModel{}
+	dia := service.GetDialect()
+	sqlInfo := foreignKeysSql(dia, ownerName)
+	if sqlInfo == "" && dia.DialectType() != dialect.TypeSqlite {
+		return
+	}
+
+	workDb, err := newWorkDb(service.GetConfig(), param, ownerName)
+	if err != nil {
+		util.Logger.Error("foreign keys new db pool error", zap.Error(err))
+		return
+	}
+	defer func() { _ = workDb.Close() }()
+	conn, err := workDb.Conn(ctx)
+	if err != nil {
+		return
+	}
+	defer func() { _ = conn.Close() }()
+
+	if dia.DialectType() == dialect.TypeSqlite {
+		err = loadSqliteForeignKeys(ctx, conn, tables, res)
+		return
+	}
+
+	_, dataList, err := queryList(ctx, conn, sqlInfo)
+	if err != nil {
+		return
+	}
+	var last *ForeignKeyModel
+	for _, data := range dataList {
+		tableName := planString(data["TABLE_NAME"])
+		constraintName := planString(data["CONSTRAINT_NAME"])
+		if last == nil || last.TableName != tableName || last.ConstraintName != constraintName {
+			last = &ForeignKeyModel{
+				ConstraintName:      constraintName,
+				TableName:           tableName,
+				ReferencedOwnerName: planString(data["REFERENCED_TABLE_SCHEMA"]),
+				ReferencedTableName: planString(data["REFERENCED_TABLE_NAME"]),
+				OnDelete:            planString(data["DELETE_RULE"]),
+				OnUpdate:            planString(data["UPDATE_RULE"]),
+			}
+			if rule, ok := postgresqlRules[last.OnDelete]; ok {
+				last.OnDelete = rule
+			}
+			if rule, ok := postgresqlRules[last.OnUpdate]; ok {
+				last.OnUpdate = rule
+			}
+			res[tableName] = append(res[tableName], last)
+		}
+		last.ColumnNames = append(last.ColumnNames, planString(data["COLUMN_NAME"]))
+		last.ReferencedColumnNames = append(last.ReferencedColumnNames, planString(data["REFERENCED_COLUMN_NAME"]))
+	}
+	return
+}
+
+// loadSqliteForeignKeys SQLite 需要 按 表 查询 PRAGMA foreign_key_list
+func loadSqliteForeignKeys(ctx context.Context, conn *sql.Conn, tables []*dialect.TableModel, res map[string][]*ForeignKeyModel) (err error) {
+	for _, table := range tables {
+		var dataList []map[string]interface{}
+		_, dataList, err = queryList(ctx, conn, "PRAGMA foreign_key_list("+sqlStringValue(table.TableName)+")")
+		if err != nil {
+			return
+		}
+		keys := map[string]*ForeignKeyModel{}
+		for _, data := range dataList {
+			id := planString(data["id"])
+			find := keys[id]
+			if find == nil {
+				find = &ForeignKeyModel{
+					ConstraintName:      fmt.Sprintf("fk_%s_%s", table.TableName, id),
+					TableName:           table.TableName,
+					ReferencedTableName: planString(data["table"]),
+					OnDelete:            planString(data["on_delete"]),
+					OnUpdate:            planString(data["on_update"]),
+				}
+				keys[id] = find
+				res[table.TableName] = append(res[table.TableName], find)
+			}
+			find.ColumnNames = append(find.ColumnNames, planString(data["from"]))
+			find.ReferencedColumnNames = append(find.ReferencedColumnNames, planString(data["to"]))
+		}
+	}
+	return
+}
+
+var inferColumnRegexp = regexp.MustCompile(`^(.+)_id$`)
+
+// snakeName 驼峰 转 下划线，全 大写 或 全 小写 的 名称 不 处理
+func snakeName(name string) string {
+	if name == strings.ToUpper(name) || name == strings.ToLower(name) {
+		return strings.ToLower(name)
+	}
+	var sb strings.Builder
+	for i, r := range name {
+		if r >= 'A' && r <= 'Z' {
+			if i > 0 {
+				sb.WriteRune('_')
+			}
+			r += 'a' - 'A'
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+// inferForeignKeys 按 字段 命名 推断 外键，如 user_id、userId 关联 user、users、tm_user 表 的 主键
+func inferForeignKeys(graphTables []*GraphTable) {
+	var tableByName = map[string]*GraphTable{}
+	for _, one := range graphTables {
+		tableByName[strings.ToLower(one.TableName)] = one
+	}
+	findTable := func(prefix string) *GraphTable {
+		for _, name := range []string{prefix, prefix + "s", prefix + "es"} {
+			if find := tableByName[name]; find != nil {
+				return find
+			}
+		}
+		// 带 前缀 的 表 名，如 tm_user，多个 匹配 时 不 推断
+		var find *GraphTable
+		for name, one := range tableByName {
+			if strings.HasSuffix(name, "_"+prefix) || strings.HasSuffix(name, "_"+prefix+"s") {
+				if find != nil {
+					return nil
+				}
+				find = one
+			}
+		}
+		return find
+	}
+
+	for _, table := range graphTables {
+		var existColumns = map[string]bool{}
+		for _, one := range table.ForeignKeys {
+			for _, columnName := range one.ColumnNames {
+				existColumns[strings.ToLower(columnName)] = true
+			}
+		}
+		for _, column := range table.ColumnList {
+			columnName := column.ColumnName
+			if existColumns[strings.ToLower(columnName)] {
+				continue
+			}
+			// 自己 的 单 主键 不 推断
+			if len(table.PrimaryKeys) == 1 && strings.EqualFold(table.PrimaryKeys[0], columnName) {
+				continue
+			}
+			match := inferColumnRegexp.FindStringSubmatch(snakeName(columnName))
+			if len(match) != 2 {
+				continue
+			}
+			prefix := strings.Trim(match[1], "_")
+			if prefix == "" {
+				continue
+			}
+			refTable := findTable(prefix)
+			if refTable == nil {
+				continue
+			}
+			var refColumn string
+			if len(refTable.PrimaryKeys) == 1 {
+				refColumn = refTable.PrimaryKeys[0]
+			} else {
+				for _, one := range refTable.ColumnList {
+					if strings.EqualFold(one.ColumnName, "id") {
+						refColumn = one.ColumnName
+						break
+					}
+				}
+			}
+			if refColumn == "" || (refTable == table && strings.EqualFold(refColumn, columnName)) {
+				continue
+			}
+			table.ForeignKeys = append(table.ForeignKeys, &ForeignKeyModel{
+				ConstraintName:        "inferred_" + table.TableName + "_" + columnName,
+				TableName:             table.TableName,
+				ColumnNames:           []string{columnName},
+				ReferencedTableName:   refTable.TableName,
+				ReferencedColumnNames: []string{refColumn},
+				Inferred:              true,
+			})
+		}
+	}
+}
+
+var graphNameRegexp = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// graphName mermaid、plantuml 的 实体 名 只 支持 字母、数字、下划线
+func graphName(name string) string {
+	return graphNameRegexp.ReplaceAllString(name, "_")
+}
+
+func graphColumnType(column *dialect.ColumnModel) string {
+	t := column.ColumnDataType
+	if t == "" {
+		t = "unknown"
+	}
+	return graphNameRegexp.ReplaceAllString(t, "_")
+}
+
+func isGraphPrimaryKey(table *GraphTable, columnName string) bool {
+	for _, one := range table.PrimaryKeys {
+		if strings.EqualFold(one, columnName) {
+			return true
+		}
+	}
+	return false
+}
+
+func isGraphForeignKey(table *GraphTable, columnName string) bool {
+	for _, one := range table.ForeignKeys {
+		for _, name := range one.ColumnNames {
+			if strings.EqualFold(name, columnName) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// exportGraph 导出 为 mermaid、plantuml、dot 文本，推断 的 关系 使用 虚线
+func exportGraph(graph *ForeignKeyGraph, format string) (text string, err error) {
+	var sb strings.Builder
+	sort.Slice(graph.TableList, func(i, j int) bool {
+		return graph.TableList[i].TableName < graph.TableList[j].TableName
+	})
+	switch format {
+	case graphFormatMermaid:
+		sb.WriteString("erDiagram\n")
+		for _, table := range graph.TableList {
+			if len(table.ColumnList) == 0 {
+				sb.WriteString("    " + graphName(table.TableName) + "\n")
+				continue
+			}
+			sb.WriteString("    " + graphName(table.TableName) + " {\n")
+			for _, column := range table.ColumnList {
+				sb.WriteString("        " + graphColumnType(column) + " " + graphName(column.ColumnName))
+				var keys []string
+				if isGraphPrimaryKey(table, column.ColumnName) {
+					keys = append(keys, "PK")
+				}
+				if isGraphForeignKey(table, column.ColumnName) {
+					keys = append(keys, "FK")
+				}
+				if len(keys) > 0 {
+					sb.WriteString(" " + strings.Join(keys, ","))
+				}
+				sb.WriteString("\n")
+			}
+			sb.WriteString("    }\n")
+		}
+		for _, table := range graph.TableList {
+			for _, fk := range table.ForeignKeys {
+				line := "--"
+				if fk.Inferred {
+					line = ".."
+				}
+				sb.WriteString(fmt.Sprintf("    %s }o%s|| %s : \"%s\"\n", graphName(fk.TableName), line, graphName(fk.ReferencedTableName), strings.Join(fk.ColumnNames, ",")))
+			}
+		}
+	case graphFormatPlantUML:
+		sb.WriteString("@startuml\n")
+		for _, table := range graph.TableList {
+			sb.WriteString(fmt.Sprintf("entity \"%s\" as %s {\n", table.TableName, graphName(table.TableName)))
+			for _, column := range table.ColumnList {
+				if isGraphPrimaryKey(table, column.ColumnName) {
+					sb.WriteString(fmt.Sprintf("  * %s : %s\n", column.ColumnName, column.ColumnDataType))
+				}
+			}
+			if len(table.PrimaryKeys) > 0 && len(table.ColumnList) > 0 {
+				sb.WriteString("  --\n")
+			}
+			for _, column := range table.ColumnList {
+				if !isGraphPrimaryKey(table, column.ColumnName) {
+					sb.WriteString(fmt.Sprintf("  %s : %s\n", column.ColumnName, column.ColumnDataType))
+				}
+			}
+			sb.WriteString("}\n")
+		}
+		for _, table := range graph.TableList {
+			for _, fk := range table.ForeignKeys {
+				line := "--"
+				if fk.Inferred {
+					line = ".."
+				}
+				sb.WriteString(fmt.Sprintf("%s }o%s|| %s : %s\n", graphName(fk.TableName), line, graphName(fk.ReferencedTableName), strings.Join(fk.ColumnNames, ",")))
+			}
+		}
+		sb.WriteString("@enduml\n")
+	case graphFormatDot:
+		escape := strings.NewReplacer(`"`, `\"`, "{", `\{`, "}", `\}`, "|", `\|`, "<", `\<`, ">", `\>`)
+		sb.WriteString("digraph er {\n")
+		sb.WriteString("  rankdir=LR;\n")
+		sb.WriteString("  node [shape=record];\n")
+		for _, table := range graph.TableList {
+			label := escape.Replace(table.TableName)
+			if len(table.ColumnList) > 0 {
+				label += "|"
+				for _, column := range table.ColumnList {
+					label += escape.Replace(column.ColumnName+" : "+column.ColumnDataType) + `\l`
+				}
+			}
+			sb.WriteString(fmt.Sprintf("  \"%s\" [label=\"{%s}\"];\n", table.TableName, label))
+		}
+		for _, table := range graph.TableList {
+			for _, fk := range table.ForeignKeys {
+				style := ""
+				if fk.Inferred {
+					style = ", style=dashed"
+				}
+				sb.WriteString(fmt.Sprintf("  \"%s\" -> \"%s\" [label=\"%s\"%s];\n", fk.TableName, fk.ReferencedTableName, escape.Replace(strings.Join(fk.ColumnNames, ",")), style))
+			}
+		}
+		sb.WriteString("}\n")
+	default:
+		err = errors.New("不支持的导出格式[" + format + "]")
+		return
+	}
+	text = sb.String()
+	return
+}
+
+// sortTableNames 按 外键 排序，父表 在 前，循环 依赖 的 保持 原 顺序
+func sortTableNames(tableNames []string, foreignKeys map[string][]*ForeignKeyModel) (res []string) {
+	done := map[string]bool{}
+	inSet := map[string]bool{}
+	for _, tableName := range tableNames {
+		inSet[compareName(tableName)] = true
+	}
+	for len(res) < len(tableNames) {
+		var added bool
+		for _, tableName := range tableNames {
+			name := compareName(tableName)
+			if done[name] {
+				continue
+			}
+			ready := true
+			for _, fk := range foreignKeys[tableName] {
+				parent := compareName(fk.ReferencedTableName)
+				if parent != name && inSet[parent] && !done[parent] {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				done[name] = true
+				res = append(res, tableName)
+				added = true
+			}
+		}
+		if added {
+			continue
+		}
+		for _, tableName := range tableNames {
+			if !done[compareName(tableName)] {
+				done[compareName(tableName)] = true
+				res = append(res, tableName)
+				break
+			}
+		}
+	}
+	return
+}
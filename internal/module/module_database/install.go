@@ -0,0 +1,119 @@
+package module_database
+
+import (
+	"teamide/internal/install"
+)
+
+func GetInstallStages() []*install.StageModel {
+
+	return []*install.StageModel{
+
+		// 创建 SQL执行历史 表 开始
+		{
+			Version: "1.4",
+			Module:  ModuleDatabaseSqlHistory,
+			Stage:   `创建表[` + TableDatabaseSqlHistory + `]`,
+			Sql: &install.StageSqlModel{
+				Mysql: []string{`
+CREATE TABLE ` + TableDatabaseSqlHistory + ` (
+	sqlHistoryId bigint(20) NOT NULL COMMENT '历史ID',
+	toolboxId bigint(20) NOT NULL COMMENT '工具ID',
+	workerId varchar(50) DEFAULT NULL COMMENT '工作ID',
+	executeId varchar(50) DEFAULT NULL COMMENT '执行ID',
+	userId bigint(20) DEFAULT NULL COMMENT '用户ID',
+	userName varchar(50) DEFAULT NULL COMMENT '用户名称',
+	userAccount varchar(50) DEFAULT NULL COMMENT '用户账号',
+	ownerName varchar(200) DEFAULT NULL COMMENT '库名',
+	sqlContent text DEFAULT NULL COMMENT 'SQL',
+	useTime bigint(20) DEFAULT NULL COMMENT '耗时（毫秒）',
+	rowsAffected bigint(20) DEFAULT NULL COMMENT '影响行数',
+	dataSize bigint(20) DEFAULT NULL COMMENT '查询行数',
+	errorMsg text DEFAULT NULL COMMENT '错误信息',
+	createTime datetime NOT NULL COMMENT '创建时间',
+	PRIMARY KEY (sqlHistoryId),
+	KEY index_toolboxId (toolboxId),
+	KEY index_userId (userId),
+	KEY index_ownerName (ownerName),
+	KEY index_createTime (createTime)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='` + TableDatabaseSqlHistoryComment + `';
+`},
+				Sqlite: []string{`
+CREATE TABLE ` + TableDatabaseSqlHistory + ` (
+	sqlHistoryId bigint(20) NOT NULL,
+	toolboxId bigint(20) NOT NULL,
+	workerId varchar(50) DEFAULT NULL,
+	executeId varchar(50) DEFAULT NULL,
+	userId bigint(20) DEFAULT NULL,
+	userName varchar(50) DEFAULT NULL,
+	userAccount varchar(50) DEFAULT NULL,
+	ownerName varchar(200) DEFAULT NULL,
+	sqlContent text DEFAULT NULL,
+	useTime bigint(20) DEFAULT NULL,
+	rowsAffected bigint(20) DEFAULT NULL,
+	dataSize bigint(20) DEFAULT NULL,
+	errorMsg text DEFAULT NULL,
+	createTime datetime NOT NULL,
+	PRIMARY KEY (sqlHistoryId)
+);
+`,
+					`CREATE INDEX ` + TableDatabaseSqlHistory + `_index_toolboxId on ` + TableDatabaseSqlHistory + ` (toolboxId);`,
+					`CREATE INDEX ` + TableDatabaseSqlHistory + `_index_userId on ` + TableDatabaseSqlHistory + ` (userId);`,
+					`CREATE INDEX ` + TableDatabaseSqlHistory + `_index_ownerName on ` + TableDatabaseSqlHistory + ` (ownerName);`,
+					`CREATE INDEX ` + TableDatabaseSqlHistory + `_index_createTime on ` + TableDatabaseSqlHistory + ` (createTime);`,
+				},
+			},
+		},
+		// 创建 SQL执行历史 表 结束
+
+		// 创建 保存的SQL 表 开始
+		{
+			Version: "1.4",
+			Module:  ModuleDatabaseSqlQuery,
+			Stage:   `创建表[` + TableDatabaseSqlQuery + `]`,
+			Sql: &install.StageSqlModel{
+				Mysql: []string{`
+CREATE TABLE ` + TableDatabaseSqlQuery + ` (
+	sqlQueryId bigint(20) NOT NULL COMMENT 'SQL ID',
+	toolboxId bigint(20) NOT NULL COMMENT '工具ID',
+	userId bigint(20) NOT NULL COMMENT '用户ID',
+	userName varchar(50) DEFAULT NULL COMMENT '用户名称',
+	name varchar(200) NOT NULL COMMENT '名称',
+	ownerName varchar(200) DEFAULT NULL COMMENT '库名',
+	sqlContent text DEFAULT NULL COMMENT 'SQL',
+	tags varchar(500) DEFAULT NULL COMMENT '标签',
+	comment varchar(500) DEFAULT NULL COMMENT '说明',
+	shared int(10) DEFAULT '0' COMMENT '是否共享',
+	createTime datetime NOT NULL COMMENT '创建时间',
+	updateTime datetime DEFAULT NULL COMMENT '修改时间',
+	PRIMARY KEY (sqlQueryId),
+	KEY index_toolboxId (toolboxId),
+	KEY index_userId (userId),
+	KEY index_shared (shared)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='` + TableDatabaseSqlQueryComment + `';
+`},
+				Sqlite: []string{`
+CREATE TABLE ` + TableDatabaseSqlQuery + ` (
+	sqlQueryId bigint(20) NOT NULL,
+	toolboxId bigint(20) NOT NULL,
+	userId bigint(20) NOT NULL,
+	userName varchar(50) DEFAULT NULL,
+	name varchar(200) NOT NULL,
+	ownerName varchar(200) DEFAULT NULL,
+	sqlContent text DEFAULT NULL,
+	tags varchar(500) DEFAULT NULL,
+	comment varchar(500) DEFAULT NULL,
+	shared int(10) DEFAULT '0',
+	createTime datetime NOT NULL,
+	updateTime datetime DEFAULT NULL,
+	PRIMARY KEY (sqlQueryId)
+);
+`,
+					`CREATE INDEX ` + TableDatabaseSqlQuery + `_index_toolboxId on ` + TableDatabaseSqlQuery + ` (toolboxId);`,
+					`CREATE INDEX ` + TableDatabaseSqlQuery + `_index_userId on ` + TableDatabaseSqlQuery + ` (userId);`,
+					`CREATE INDEX ` + TableDatabaseSqlQuery + `_index_shared on ` + TableDatabaseSqlQuery + ` (shared);`,
+				},
+			},
+		},
+		// 创建 保存的SQL 表 结束
+	}
+}
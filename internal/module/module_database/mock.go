@@ -0,0 +1,393 @@
+package module_database
+
+import (
+	"errors"
+	"fmt"
+	"github.com/team-ide/go-dialect/dialect"
+	"github.com/team-ide/go-tool/util"
+	"math"
+	"math/rand"
+	"regexp/syntax"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	mockSkip       = "skip"       // 不 生成，使用 数据库 默认值 或 自增
+	mockNull       = "null"       // 固定 NULL
+	mockFixed      = "fixed"      // 固定 值，取 values[0]
+	mockSequence   = "sequence"   // 序列，start 为 空 时 从 表 中 最大值 + 1 开始
+	mockRange      = "range"      // min ~ max 随机 数，scale 为 小数 位数
+	mockString     = "string"     // 随机 字符串
+	mockName       = "name"       // 姓名，format 为 en 时 生成 英文 名
+	mockEmail      = "email"      // 邮箱
+	mockPhone      = "phone"      // 手机号
+	mockDate       = "date"       // 日期，startTime ~ endTime
+	mockDatetime   = "datetime"   // 时间，startTime ~ endTime
+	mockEnum       = "enum"       // 从 values 中 随机 选取
+	mockRegex      = "regex"      // 按 正则 pattern 生成
+	mockScript     = "script"     // JavaScript 表达式，可 使用 index、row
+	mockForeignKey = "foreignKey" // 从 父表 已有 数据 中 随机 选取，外键 字段 默认 使用
+)
+
+// MockRule 字段 生成 规则，未 配置 的 字段 按 字段 类型、名称 推断
+type MockRule struct {
+	ColumnName string   `json:"columnName"`
+	Type       string   `json:"type"`
+	Start      *int64   `json:"start,omitempty"`
+	Step       int64    `json:"step,omitempty"`
+	Min        float64  `json:"min,omitempty"`
+	Max        float64  `json:"max,omitempty"`
+	Scale      int      `json:"scale,omitempty"`
+	Values     []string `json:"values,omitempty"`
+	Pattern    string   `json:"pattern,omitempty"`
+	Script     string   `json:"script,omitempty"`
+	StartTime  string   `json:"startTime,omitempty"`
+	EndTime    string   `json:"endTime,omitempty"`
+	Format     string   `json:"format,omitempty"`
+	NullRate   float64  `json:"nullRate,omitempty"` // 0 ~ 1，可 为 空 字段 生成 NULL 的 比例
+}
+
+var (
+	mockEnglishFirstNames = []string{
+		"James", "Mary", "John", "Patricia", "Robert", "Jennifer", "Michael", "Linda", "William", "Elizabeth",
+		"David", "Barbara", "Richard", "Susan", "Joseph", "Jessica", "Thomas", "Sarah", "Charles", "Karen",
+		"Daniel", "Nancy", "Matthew", "Lisa", "Anthony", "Betty", "Mark", "Emily", "Steven", "Olivia",
+	}
+	mockEnglishLastNames = []string{
+		"Smith", "Johnson", "Williams", "Brown", "Jones", "Garcia", "Miller", "Davis", "Rodriguez", "Martinez",
+		"Hernandez", "Lopez", "Wilson", "Anderson", "Thomas", "Taylor", "Moore", "Jackson", "Martin", "Lee",
+	}
+	mockEmailDomains = []string{"example.com", "example.org", "example.net", "test.com", "mail.test"}
+	mockLetters      = "abcdefghijklmnopqrstuvwxyz"
+	mockIntTypes     = []string{"int", "integer", "tinyint", "smallint", "mediumint", "bigint", "int2", "int4", "int8", "serial", "bigserial"}
+	mockFloatTypes   = []string{"decimal", "numeric", "number", "float", "double", "real", "money", "float4", "float8"}
+)
+
+func mockContains(list []string, v string) bool {
+	for _, one := range list {
+		if one == v {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultMockRule 按 字段 类型、名称 推断 生成 规则
+func defaultMockRule(column *dialect.ColumnModel) (rule *MockRule) {
+	rule = &MockRule{ColumnName: column.ColumnName}
+	dataType := strings.ToLower(column.ColumnDataType)
+	name := strings.ToLower(column.ColumnName)
+	if strings.Contains(strings.ToLower(column.ColumnExtra), "auto_increment") ||
+		strings.Contains(strings.ToLower(column.ColumnDefault), "nextval") ||
+		strings.Contains(dataType, "serial") || strings.Contains(strings.ToLower(column.ColumnExtra), "identity") {
+		rule.Type = mockSkip
+		return
+	}
+	if len(column.ColumnEnums) > 0 {
+		rule.Type = mockEnum
+		rule.Values = column.ColumnEnums
+		return
+	}
+	switch {
+	case dataType == "bit" || strings.HasPrefix(dataType, "bool"):
+		rule.Type = mockEnum
+		rule.Values = []string{"0", "1"}
+	case mockContains(mockIntTypes, dataType):
+		if column.PrimaryKey {
+			rule.Type = mockSequence
+			return
+		}
+		rule.Type = mockRange
+		rule.Max = 1000
+		if dataType == "tinyint" {
+			rule.Max = 100
+		}
+	case mockContains(mockFloatTypes, dataType):
+		if column.PrimaryKey && column.ColumnScale == 0 {
+			rule.Type = mockSequence
+			return
+		}
+		rule.Type = mockRange
+		rule.Max = 10000
+		rule.Scale = column.ColumnScale
+		if column.ColumnPrecision > column.ColumnScale && column.ColumnPrecision-column.ColumnScale < 5 {
+			rule.Max = math.Pow10(column.ColumnPrecision-column.ColumnScale) - 1
+		}
+	case dataType == "date":
+		rule.Type = mockDate
+	case strings.HasPrefix(dataType, "datetime") || strings.HasPrefix(dataType, "timestamp"):
+		rule.Type = mockDatetime
+	case dataType == "time":
+		rule.Type = mockDatetime
+		rule.Format = "15:04:05"
+	case strings.Contains(dataType, "blob") || strings.Contains(dataType, "binary") || dataType == "bytea":
+		if column.ColumnNotNull {
+			rule.Type = mockString
+		} else {
+			rule.Type = mockNull
+		}
+	case strings.Contains(name, "email") || strings.Contains(name, "mail"):
+		rule.Type = mockEmail
+	case strings.Contains(name, "phone") || strings.Contains(name, "mobile") || strings.HasSuffix(name, "tel"):
+		rule.Type = mockPhone
+	case strings.Contains(name, "name"):
+		rule.Type = mockName
+	default:
+		rule.Type = mockString
+	}
+	return
+}
+
+// mockColumn 单个 字段 的 生成 器
+type mockColumn struct {
+	column   *dialect.ColumnModel
+	rule     *MockRule
+	rand     *rand.Rand
+	sequence int64
+	regex    *syntax.Regexp
+	start    time.Time
+	end      time.Time
+}
+
+func parseMockTime(v string, def time.Time) (t time.Time, err error) {
+	if v == "" {
+		t = def
+		return
+	}
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02"} {
+		t, err = time.ParseInLocation(layout, v, time.Local)
+		if err == nil {
+			return
+		}
+	}
+	err = errors.New("时间[" + v + "]格式错误，支持 yyyy-MM-dd HH:mm:ss、yyyy-MM-dd")
+	return
+}
+
+func newMockColumn(column *dialect.ColumnModel, rule *MockRule) (res *mockColumn, err error) {
+	res = &mockColumn{column: column, rule: rule, rand: rand.New(rand.NewSource(time.Now().UnixNano()))}
+	switch rule.Type {
+	case mockSkip, mockNull, mockString, mockName, mockEmail, mockPhone, mockSequence, mockForeignKey:
+	case mockFixed, mockEnum:
+		if len(rule.Values) == 0 {
+			err = errors.New("字段[" + column.ColumnName + "]生成规则[" + rule.Type + "]需要配置 values")
+			return
+		}
+	case mockRange:
+		if rule.Max < rule.Min {
+			err = errors.New("字段[" + column.ColumnName + "]最大值不能小于最小值")
+			return
+		}
+	case mockDate, mockDatetime:
+		now := time.Now()
+		res.start, err = parseMockTime(rule.StartTime, now.AddDate(-1, 0, 0))
+		if err != nil {
+			return
+		}
+		res.end, err = parseMockTime(rule.EndTime, now)
+		if err != nil {
+			return
+		}
+		if res.end.Before(res.start) {
+			err = errors.New("字段[" + column.ColumnName + "]结束时间不能早于开始时间")
+			return
+		}
+	case mockRegex:
+		res.regex, err = syntax.Parse(rule.Pattern, syntax.Perl)
+		if err != nil {
+			err = errors.New("字段[" + column.ColumnName + "]正则错误:" + err.Error())
+			return
+		}
+		res.regex = res.regex.Simplify()
+	case mockScript:
+		if rule.Script == "" {
+			err = errors.New("字段[" + column.ColumnName + "]生成规则[script]需要配置 script")
+			return
+		}
+	default:
+		err = errors.New("字段[" + column.ColumnName + "]不支持的生成规则[" + rule.Type + "]")
+		return
+	}
+	if rule.Type == mockSequence && rule.Start != nil {
+		res.sequence = *rule.Start
+	}
+	return
+}
+
+// value 生成 一个 值，script 规则 由 调用 方 执行
+func (this_ *mockColumn) value() (v interface{}) {
+	rule := this_.rule
+	if rule.NullRate > 0 && !this_.column.ColumnNotNull && this_.rand.Float64() < rule.NullRate {
+		return nil
+	}
+	switch rule.Type {
+	case mockNull:
+		return nil
+	case mockFixed:
+		v = rule.Values[0]
+	case mockSequence:
+		v = this_.sequence
+		step := rule.Step
+		if step == 0 {
+			step = 1
+		}
+		this_.sequence += step
+	case mockRange:
+		f := rule.Min + this_.rand.Float64()*(rule.Max-rule.Min)
+		if rule.Scale <= 0 {
+			v = int64(math.Round(f))
+		} else {
+			v, _ = strconv.ParseFloat(strconv.FormatFloat(f, 'f', rule.Scale, 64), 64)
+		}
+	case mockName:
+		if rule.Format == "en" {
+			v = mockEnglishFirstNames[this_.rand.Intn(len(mockEnglishFirstNames))] + " " + mockEnglishLastNames[this_.rand.Intn(len(mockEnglishLastNames))]
+		} else {
+			v = util.RandomUserName(this_.rand.Intn(2) + 1)
+		}
+	case mockEmail:
+		var sb strings.Builder
+		size := this_.rand.Intn(6) + 5
+		for i := 0; i < size; i++ {
+			sb.WriteByte(mockLetters[this_.rand.Intn(len(mockLetters))])
+		}
+		if this_.rand.Intn(2) == 0 {
+			sb.WriteString(strconv.Itoa(this_.rand.Intn(1000)))
+		}
+		v = sb.String() + "@" + mockEmailDomains[this_.rand.Intn(len(mockEmailDomains))]
+	case mockPhone:
+		v = fmt.Sprintf("1%d%09d", this_.rand.Intn(7)+3, this_.rand.Intn(1000000000))
+	case mockDate, mockDatetime:
+		t := this_.start
+		if d := this_.end.Sub(this_.start); d > 0 {
+			t = t.Add(time.Duration(this_.rand.Int63n(int64(d))))
+		}
+		t = t.Truncate(time.Second)
+		if rule.Type == mockDate {
+			t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+		}
+		if rule.Format != "" {
+			v = t.Format(rule.Format)
+		} else {
+			v = t
+		}
+	case mockEnum:
+		v = rule.Values[this_.rand.Intn(len(rule.Values))]
+	case mockRegex:
+		var sb strings.Builder
+		writeRegexValue(this_.rand, &sb, this_.regex)
+		v = sb.String()
+	case mockString:
+		maxLen := 20
+		if this_.column.ColumnLength > 0 && this_.column.ColumnLength < maxLen {
+			maxLen = this_.column.ColumnLength
+		}
+		minLen := 1
+		if maxLen > 6 {
+			minLen = 6
+		}
+		v = util.RandomString(minLen, maxLen)
+	}
+	return this_.truncate(v)
+}
+
+// truncate 字符串 按 字段 长度 截断，避免 插入 失败
+func (this_ *mockColumn) truncate(v interface{}) interface{} {
+	s, ok := v.(string)
+	if !ok || this_.column.ColumnLength <= 0 {
+		return v
+	}
+	runes := []rune(s)
+	if len(runes) > this_.column.ColumnLength {
+		return string(runes[:this_.column.ColumnLength])
+	}
+	return s
+}
+
+// mockRepeatMax 正则 中 * + 等 无 上限 的 重复 最多 生成 次数
+const mockRepeatMax = 8
+
+// writeRegexValue 按 正则 语法 树 随机 生成 匹配 的 字符串
+func writeRegexValue(r *rand.Rand, sb *strings.Builder, re *syntax.Regexp) {
+	switch re.Op {
+	case syntax.OpLiteral:
+		for _, one := range re.Rune {
+			if re.Flags&syntax.FoldCase != 0 && r.Intn(2) == 0 {
+				one = unicode.SimpleFold(one)
+			}
+			sb.WriteRune(one)
+		}
+	case syntax.OpCharClass:
+		sb.WriteRune(randomClassRune(r, re.Rune))
+	case syntax.OpAnyCharNotNL, syntax.OpAnyChar:
+		sb.WriteByte(mockLetters[r.Intn(len(mockLetters))])
+	case syntax.OpCapture:
+		writeRegexValue(r, sb, re.Sub[0])
+	case syntax.OpConcat:
+		for _, sub := range re.Sub {
+			writeRegexValue(r, sb, sub)
+		}
+	case syntax.OpAlternate:
+		writeRegexValue(r, sb, re.Sub[r.Intn(len(re.Sub))])
+	case syntax.OpStar, syntax.OpPlus, syntax.OpQuest, syntax.OpRepeat:
+		min, max := re.Min, re.Max
+		switch re.Op {
+		case syntax.OpStar:
+			min, max = 0, mockRepeatMax
+		case syntax.OpPlus:
+			min, max = 1, mockRepeatMax
+		case syntax.OpQuest:
+			min, max = 0, 1
+		}
+		if max < 0 {
+			max = min + mockRepeatMax
+		}
+		count := min
+		if max > min {
+			count += r.Intn(max - min + 1)
+		}
+		for i := 0; i < count; i++ {
+			writeRegexValue(r, sb, re.Sub[0])
+		}
+	}
+}
+
+// randomClassRune 从 字符 集合 中 随机 取 一个，集合 为 [lo, hi] 成对 区间
+func randomClassRune(r *rand.Rand, ranges []rune) rune {
+	if len(ranges) == 0 {
+		return 'a'
+	}
+	// 取反 的 集合 范围 很 大，优先 使用 可 打印 的 ASCII 区间
+	var printable []rune
+	for i := 0; i+1 < len(ranges); i += 2 {
+		lo, hi := ranges[i], ranges[i+1]
+		if lo < 0x20 {
+			lo = 0x20
+		}
+		if hi > 0x7e && lo <= 0x7e {
+			hi = 0x7e
+		}
+		if lo <= hi && hi <= 0x7e {
+			printable = append(printable, lo, hi)
+		}
+	}
+	if len(printable) > 0 {
+		ranges = printable
+	}
+	var total int64
+	for i := 0; i+1 < len(ranges); i += 2 {
+		total += int64(ranges[i+1]-ranges[i]) + 1
+	}
+	n := r.Int63n(total)
+	for i := 0; i+1 < len(ranges); i += 2 {
+		size := int64(ranges[i+1]-ranges[i]) + 1
+		if n < size {
+			return ranges[i] + rune(n)
+		}
+		n -= size
+	}
+	return ranges[0]
+}
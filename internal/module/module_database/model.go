@@ -0,0 +1,51 @@
+package module_database
+
+import "time"
+
+const (
+	// ModuleDatabaseSqlHistory 数据库SQL历史模块
+	ModuleDatabaseSqlHistory = "database_sql_history"
+	// TableDatabaseSqlHistory 数据库SQL执行历史表
+	TableDatabaseSqlHistory        = "TM_DATABASE_SQL_HISTORY"
+	TableDatabaseSqlHistoryComment = "数据库SQL执行历史"
+
+	// ModuleDatabaseSqlQuery 数据库保存SQL模块
+	ModuleDatabaseSqlQuery = "database_sql_query"
+	// TableDatabaseSqlQuery 数据库保存的SQL表
+	TableDatabaseSqlQuery        = "TM_DATABASE_SQL_QUERY"
+	TableDatabaseSqlQueryComment = "数据库保存的SQL"
+)
+
+// SqlHistoryModel SQL执行历史，每条语句一条记录
+type SqlHistoryModel struct {
+	SqlHistoryId int64     `json:"sqlHistoryId,omitempty"`
+	ToolboxId    int64     `json:"toolboxId,omitempty"`
+	WorkerId     string    `json:"workerId,omitempty"`
+	ExecuteId    string    `json:"executeId,omitempty"`
+	UserId       int64     `json:"userId,omitempty"`
+	UserName     string    `json:"userName,omitempty"`
+	UserAccount  string    `json:"userAccount,omitempty"`
+	OwnerName    string    `json:"ownerName,omitempty"`
+	SqlContent   string    `json:"sqlContent,omitempty"`
+	UseTime      int64     `json:"useTime"`
+	RowsAffected int64     `json:"rowsAffected"`
+	DataSize     int64     `json:"dataSize"`
+	ErrorMsg     string    `json:"errorMsg,omitempty"`
+	CreateTime   time.Time `json:"createTime,omitempty"`
+}
+
+// SqlQueryModel 保存的SQL，共享后其它可以操作该工具的用户可见
+type SqlQueryModel struct {
+	SqlQueryId int64     `json:"sqlQueryId,omitempty"`
+	ToolboxId  int64     `json:"toolboxId,omitempty"`
+	UserId     int64     `json:"userId,omitempty"`
+	UserName   string    `json:"userName,omitempty"`
+	Name       string    `json:"name,omitempty"`
+	OwnerName  string    `json:"ownerName,omitempty"`
+	SqlContent string    `json:"sqlContent,omitempty"`
+	Tags       string    `json:"tags,omitempty"` // 多个标签使用“,”隔开
+	Comment    string    `json:"comment,omitempty"`
+	Shared     int8      `json:"shared,omitempty"` // 1：共享
+	CreateTime time.Time `json:"createTime,omitempty"`
+	UpdateTime time.Time `json:"updateTime,omitempty"`
+}
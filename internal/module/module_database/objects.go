@@ -0,0 +1,465 @@
+package module_database
+
+import (
+	"errors"
+	"github.com/team-ide/go-dialect/dialect"
+	"github.com/team-ide/go-tool/db"
+	"sort"
+	"strings"
+)
+
+const (
+	objectView      = "view"
+	objectProcedure = "procedure"
+	objectFunction  = "function"
+	objectTrigger   = "trigger"
+	objectSequence  = "sequence"
+	objectSynonym   = "synonym"
+	objectGrant     = "grant"
+)
+
+// DbObject 库 下 的 非 表 对象
+type DbObject struct {
+	OwnerName  string                 `json:"ownerName"`
+	ObjectName string                 `json:"objectName"`
+	ObjectType string                 `json:"objectType"`
+	TableName  string                 `json:"tableName,omitempty"` // 触发器、同义词 所属 表
+	Status     string                 `json:"status,omitempty"`
+	Comment    string                 `json:"comment,omitempty"`
+	CreateTime string                 `json:"createTime,omitempty"`
+	UpdateTime string                 `json:"updateTime,omitempty"`
+	Extend     map[string]interface{} `json:"extend,omitempty"`     // 各 数据库 特有 的 属性
+	Privileges []*ObjectPrivilege     `json:"privileges,omitempty"` // 授权 对象 的 权限 列表
+}
+
+type ObjectPrivilege struct {
+	TableName string `json:"tableName"` // 为 空 表示 库 级 权限
+	Privilege string `json:"privilege"`
+	Grantable bool   `json:"grantable"`
+}
+
+// RoutineParameter 存储 过程、函数 参数，函数 返回值 Mode 为 RETURN
+type RoutineParameter struct {
+	Name     string `json:"name"`
+	Mode     string `json:"mode"`
+	DataType string `json:"dataType"`
+	Position int    `json:"position"`
+}
+
+type ObjectDetail struct {
+	*DbObject
+	Parameters []*RoutineParameter `json:"parameters,omitempty"`
+	Ddl        string              `json:"ddl"`
+}
+
+// objectKnownColumns 映射 到 DbObject 字段 的 列，其它 列 放 入 Extend
+var objectKnownColumns = map[string]bool{
+	"NAME":         true,
+	"TABLE_NAME":   true,
+	"STATUS":       true,
+	"COMMENT_TEXT": true,
+	"CREATE_TIME":  true,
+	"UPDATE_TIME":  true,
+	"PRIVILEGE":    true,
+	"GRANTABLE":    true,
+}
+
+// objectOwnerSql 库 名 为 空 时 使用 当前 库
+func objectOwnerSql(dia dialect.Dialect, ownerName string) string {
+	if ownerName != "" {
+		return sqlStringValue(ownerName)
+	}
+	switch dia.DialectType() {
+	case dialect.TypeMysql:
+		return "DATABASE()"
+	case dialect.TypePostgresql, dialect.TypeKingBase, dialect.TypeOpenGauss:
+		return "current_schema()"
+	default:
+		return "SYS_CONTEXT('USERENV', 'CURRENT_SCHEMA')"
+	}
+}
+
+// objectListSql 查询 对象 列表 的 SQL，各 方言 统一 别名 NAME、TABLE_NAME 等
+func objectListSql(dia dialect.Dialect, ownerName string, objectType string) (sqlInfo string, err error) {
+	owner := objectOwnerSql(dia, ownerName)
+	switch dia.DialectType() {
+	case dialect.TypeMysql:
+		switch objectType {
+		case objectView:
+			sqlInfo = `SELECT TABLE_NAME AS NAME, CHECK_OPTION, IS_UPDATABLE, DEFINER, SECURITY_TYPE FROM information_schema.VIEWS WHERE TABLE_SCHEMA = ` + owner
+		case objectProcedure, objectFunction:
+			sqlInfo = `SELECT ROUTINE_NAME AS NAME, ROUTINE_COMMENT AS COMMENT_TEXT, CREATED AS CREATE_TIME, LAST_ALTERED AS UPDATE_TIME, DTD_IDENTIFIER AS RETURN_TYPE, DEFINER, SECURITY_TYPE
+FROM information_schema.ROUTINES WHERE ROUTINE_SCHEMA = ` + owner + ` AND ROUTINE_TYPE = ` + sqlStringValue(strings.ToUpper(objectType))
+		case objectTrigger:
+			sqlInfo = `SELECT TRIGGER_NAME AS NAME, EVENT_OBJECT_TABLE AS TABLE_NAME, ACTION_TIMING AS TIMING, EVENT_MANIPULATION AS EVENT, CREATED AS CREATE_TIME, DEFINER
+FROM information_schema.TRIGGERS WHERE TRIGGER_SCHEMA = ` + owner
+		case objectGrant:
+			sqlInfo = `SELECT GRANTEE AS NAME, TABLE_NAME, PRIVILEGE_TYPE AS PRIVILEGE, IS_GRANTABLE AS GRANTABLE FROM information_schema.TABLE_PRIVILEGES WHERE TABLE_SCHEMA = ` + owner + `
+UNION ALL SELECT GRANTEE AS NAME, '' AS TABLE_NAME, PRIVILEGE_TYPE AS PRIVILEGE, IS_GRANTABLE AS GRANTABLE FROM information_schema.SCHEMA_PRIVILEGES WHERE TABLE_SCHEMA = ` + owner
+		}
+	case dialect.TypePostgresql, dialect.TypeKingBase, dialect.TypeOpenGauss:
+		switch objectType {
+		case objectView:
+			sqlInfo = `SELECT table_name AS "NAME", check_option AS "CHECK_OPTION", is_updatable AS "IS_UPDATABLE" FROM information_schema.views WHERE table_schema = ` + owner
+		case objectProcedure, objectFunction:
+			sqlInfo = `SELECT p.proname AS "NAME", obj_description(p.oid, 'pg_proc') AS "COMMENT_TEXT", pg_get_function_result(p.oid) AS "RETURN_TYPE", pg_get_function_identity_arguments(p.oid) AS "ARGUMENTS"
+FROM pg_proc p JOIN pg_namespace n ON n.oid = p.pronamespace WHERE n.nspname = ` + owner
+			// PostgreSQL 11 之前 没有 存储 过程，按 是否 有 返回值 区分
+			if objectType == objectProcedure {
+				sqlInfo += ` AND pg_get_function_result(p.oid) IS NULL`
+			} else {
+				sqlInfo += ` AND pg_get_function_result(p.oid) IS NOT NULL AND pg_get_function_result(p.oid) <> 'trigger'`
+			}
+		case objectTrigger:
+			sqlInfo = `SELECT t.tgname AS "NAME", c.relname AS "TABLE_NAME", CASE WHEN t.tgenabled = 'D' THEN 'DISABLED' ELSE 'ENABLED' END AS "STATUS"
+FROM pg_trigger t JOIN pg_class c ON c.oid = t.tgrelid JOIN pg_namespace n ON n.oid = c.relnamespace WHERE NOT t.tgisinternal AND n.nspname = ` + owner
+		case objectSequence:
+			sqlInfo = `SELECT sequence_name AS "NAME", data_type AS "DATA_TYPE", start_value AS "START_VALUE", minimum_value AS "MIN_VALUE", maximum_value AS "MAX_VALUE", increment AS "INCREMENT", cycle_option AS "CYCLE"
+FROM information_schema.sequences WHERE sequence_schema = ` + owner
+		case objectGrant:
+			sqlInfo = `SELECT grantee AS "NAME", table_name AS "TABLE_NAME", privilege_type AS "PRIVILEGE", is_grantable AS "GRANTABLE" FROM information_schema.role_table_grants WHERE table_schema = ` + owner
+		}
+	case dialect.TypeOracle, dialect.TypeDM:
+		switch objectType {
+		case objectView, objectProcedure, objectFunction, objectSequence, objectSynonym:
+			sqlInfo = `SELECT OBJECT_NAME AS NAME, STATUS, CREATED AS CREATE_TIME, LAST_DDL_TIME AS UPDATE_TIME FROM ALL_OBJECTS WHERE OWNER = ` + owner + ` AND OBJECT_TYPE = ` + sqlStringValue(strings.ToUpper(objectType))
+			switch objectType {
+			case objectSequence:
+				sqlInfo = `SELECT o.OBJECT_NAME AS NAME, o.STATUS, o.CREATED AS CREATE_TIME, o.LAST_DDL_TIME AS UPDATE_TIME, s.MIN_VALUE, s.MAX_VALUE, s.INCREMENT_BY, s.CYCLE_FLAG, s.CACHE_SIZE, s.LAST_NUMBER
+FROM ALL_OBJECTS o JOIN ALL_SEQUENCES s ON s.SEQUENCE_OWNER = o.OWNER AND s.SEQUENCE_NAME = o.OBJECT_NAME
+WHERE o.OWNER = ` + owner + ` AND o.OBJECT_TYPE = 'SEQUENCE'`
+			case objectSynonym:
+				sqlInfo = `SELECT SYNONYM_NAME AS NAME, TABLE_NAME, TABLE_OWNER, DB_LINK FROM ALL_SYNONYMS WHERE OWNER = ` + owner
+			}
+		case objectTrigger:
+			sqlInfo = `SELECT TRIGGER_NAME AS NAME, TABLE_NAME, TRIGGER_TYPE AS TIMING, TRIGGERING_EVENT AS EVENT, STATUS FROM ALL_TRIGGERS WHERE OWNER = ` + owner
+		case objectGrant:
+			sqlInfo = `SELECT GRANTEE AS NAME, TABLE_NAME, PRIVILEGE, GRANTABLE FROM ALL_TAB_PRIVS WHERE TABLE_SCHEMA = ` + owner
+		}
+	case dialect.TypeSqlite:
+		switch objectType {
+		case objectView, objectTrigger:
+			sqlInfo = `SELECT name AS NAME, tbl_name AS TABLE_NAME FROM sqlite_master WHERE type = ` + sqlStringValue(objectType)
+		}
+	}
+	if sqlInfo == "" {
+		err = errors.New("数据库类型[" + dia.DialectType().Name + "]不支持对象类型[" + objectType + "]")
+	}
+	return
+}
+
+// objectList 查询 对象 列表，objectName 不 为 空 时 只 查询 该 对象
+func objectList(service db.IService, ownerName string, objectType string, objectName string) (list []*DbObject, err error) {
+	dia := service.GetDialect()
+	sqlInfo, err := objectListSql(dia, ownerName, objectType)
+	if err != nil {
+		return
+	}
+	// 子 查询 统一 过滤 名称，各 方言 别名 一致
+	if objectName != "" {
+		nameColumn := "NAME"
+		switch dia.DialectType() {
+		case dialect.TypePostgresql, dialect.TypeKingBase, dialect.TypeOpenGauss:
+			nameColumn = `"NAME"`
+		}
+		sqlInfo = "SELECT * FROM (" + sqlInfo + ") t WHERE " + nameColumn + " = " + sqlStringValue(objectName)
+	}
+	rows, err := service.QueryMap(sqlInfo, nil)
+	if err != nil {
+		err = errors.New("对象查询失败:" + err.Error())
+		return
+	}
+
+	var grantCache = map[string]*DbObject{}
+	for _, row := range rows {
+		name := rowString(row, "NAME")
+		if objectType == objectGrant {
+			// 授权 按 被 授权 人 合并
+			one := grantCache[name]
+			if one == nil {
+				one = &DbObject{
+					OwnerName:  ownerName,
+					ObjectName: name,
+					ObjectType: objectType,
+				}
+				grantCache[name] = one
+				list = append(list, one)
+			}
+			grantable := strings.ToUpper(rowString(row, "GRANTABLE"))
+			one.Privileges = append(one.Privileges, &ObjectPrivilege{
+				TableName: rowString(row, "TABLE_NAME"),
+				Privilege: rowString(row, "PRIVILEGE"),
+				Grantable: grantable == "YES" || grantable == "Y" || grantable == "TRUE",
+			})
+			continue
+		}
+		one := &DbObject{
+			OwnerName:  ownerName,
+			ObjectName: name,
+			ObjectType: objectType,
+			TableName:  rowString(row, "TABLE_NAME"),
+			Status:     rowString(row, "STATUS"),
+			Comment:    rowString(row, "COMMENT_TEXT"),
+			CreateTime: rowString(row, "CREATE_TIME"),
+			UpdateTime: rowString(row, "UPDATE_TIME"),
+		}
+		for key, value := range row {
+			if objectKnownColumns[strings.ToUpper(key)] || value == nil {
+				continue
+			}
+			if one.Extend == nil {
+				one.Extend = map[string]interface{}{}
+			}
+			one.Extend[strings.ToLower(key)] = planString(value)
+		}
+		list = append(list, one)
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].ObjectName < list[j].ObjectName
+	})
+	return
+}
+
+func getObject(service db.IService, ownerName string, objectType string, objectName string) (object *DbObject, err error) {
+	if objectName == "" {
+		err = errors.New("对象名称不能为空")
+		return
+	}
+	list, err := objectList(service, ownerName, objectType, objectName)
+	if err != nil {
+		return
+	}
+	if len(list) == 0 {
+		err = errors.New("对象[" + objectName + "]不存在")
+		return
+	}
+	object = list[0]
+	return
+}
+
+// routineParametersSql 查询 存储 过程、函数 参数，统一 别名 NAME、MODE_、DATA_TYPE、POSITION
+func routineParametersSql(dia dialect.Dialect, ownerName string, objectName string) (sqlInfo string, err error) {
+	owner := objectOwnerSql(dia, ownerName)
+	name := sqlStringValue(objectName)
+	switch dia.DialectType() {
+	case dialect.TypeMysql:
+		sqlInfo = `SELECT PARAMETER_NAME AS NAME, PARAMETER_MODE AS MODE_, DTD_IDENTIFIER AS DATA_TYPE, ORDINAL_POSITION AS POSITION
+FROM information_schema.PARAMETERS WHERE SPECIFIC_SCHEMA = ` + owner + ` AND SPECIFIC_NAME = ` + name + ` ORDER BY ORDINAL_POSITION`
+	case dialect.TypePostgresql, dialect.TypeKingBase, dialect.TypeOpenGauss:
+		// 重载 的 只 取 第一个
+		sqlInfo = `SELECT parameter_name AS "NAME", parameter_mode AS "MODE_", data_type AS "DATA_TYPE", ordinal_position AS "POSITION"
+FROM information_schema.parameters WHERE specific_schema = ` + owner + ` AND specific_name = (
+SELECT MIN(specific_name) FROM information_schema.routines WHERE routine_schema = ` + owner + ` AND routine_name = ` + name + `
+) ORDER BY ordinal_position`
+	case dialect.TypeOracle, dialect.TypeDM:
+		sqlInfo = `SELECT ARGUMENT_NAME AS NAME, IN_OUT AS MODE_, DATA_TYPE, POSITION FROM ALL_ARGUMENTS
+WHERE OWNER = ` + owner + ` AND OBJECT_NAME = ` + name + ` AND PACKAGE_NAME IS NULL AND DATA_LEVEL = 0 ORDER BY POSITION`
+	default:
+		err = errors.New("数据库类型[" + dia.DialectType().Name + "]不支持查询存储过程参数")
+	}
+	return
+}
+
+func routineParameters(service db.IService, ownerName string, object *DbObject) (parameters []*RoutineParameter, err error) {
+	sqlInfo, err := routineParametersSql(service.GetDialect(), ownerName, object.ObjectName)
+	if err != nil {
+		return
+	}
+	rows, err := service.QueryMap(sqlInfo, nil)
+	if err != nil {
+		err = errors.New("参数查询失败:" + err.Error())
+		return
+	}
+	for _, row := range rows {
+		one := &RoutineParameter{
+			Name:     rowString(row, "NAME"),
+			Mode:     strings.ToUpper(strings.ReplaceAll(rowString(row, "MODE_"), "/", "")),
+			DataType: rowString(row, "DATA_TYPE"),
+			Position: int(planFloat(rowValue(row, "POSITION"))),
+		}
+		// 位置 0 且 无 名称 的 为 函数 返回值
+		if one.Position == 0 && one.Name == "" {
+			one.Mode = "RETURN"
+		}
+		if one.Mode == "" {
+			one.Mode = "IN"
+		}
+		parameters = append(parameters, one)
+	}
+	// PostgreSQL 参数 中 没有 返回值
+	if object.ObjectType == objectFunction {
+		switch service.GetDialect().DialectType() {
+		case dialect.TypePostgresql, dialect.TypeKingBase, dialect.TypeOpenGauss:
+			if returnType := planString(object.Extend["return_type"]); returnType != "" && returnType != "void" {
+				parameters = append([]*RoutineParameter{{Mode: "RETURN", DataType: returnType}}, parameters...)
+			}
+		}
+	}
+	return
+}
+
+// objectDdlSql 查询 对象 DDL 的 SQL，返回 空 表示 需要 根据 对象 信息 拼接
+func objectDdlSql(dia dialect.Dialect, param *db.Param, ownerName string, objectType string, objectName string) (sqlInfo string) {
+	owner := objectOwnerSql(dia, ownerName)
+	name := sqlStringValue(objectName)
+	switch dia.DialectType() {
+	case dialect.TypeMysql:
+		switch objectType {
+		case objectView, objectProcedure, objectFunction, objectTrigger:
+			sqlInfo = "SHOW CREATE " + strings.ToUpper(objectType) + " " + dia.OwnerTablePack(param.ParamModel, ownerName, objectName)
+		case objectGrant:
+			sqlInfo = "SHOW GRANTS FOR " + objectName
+		}
+	case dialect.TypePostgresql, dialect.TypeKingBase, dialect.TypeOpenGauss:
+		switch objectType {
+		case objectView:
+			sqlInfo = `SELECT pg_get_viewdef(c.oid, true) AS "DDL" FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace WHERE n.nspname = ` + owner + ` AND c.relname = ` + name
+		case objectProcedure, objectFunction:
+			sqlInfo = `SELECT pg_get_functiondef(p.oid) AS "DDL" FROM pg_proc p JOIN pg_namespace n ON n.oid = p.pronamespace WHERE n.nspname = ` + owner + ` AND p.proname = ` + name
+		case objectTrigger:
+			sqlInfo = `SELECT pg_get_triggerdef(t.oid, true) AS "DDL" FROM pg_trigger t JOIN pg_class c ON c.oid = t.tgrelid JOIN pg_namespace n ON n.oid = c.relnamespace WHERE n.nspname = ` + owner + ` AND t.tgname = ` + name
+		}
+	case dialect.TypeOracle, dialect.TypeDM:
+		switch objectType {
+		case objectView, objectProcedure, objectFunction, objectTrigger, objectSequence, objectSynonym:
+			sqlInfo = `SELECT DBMS_METADATA.GET_DDL(` + sqlStringValue(strings.ToUpper(objectType)) + `, ` + name + `, ` + owner + `) AS DDL FROM DUAL`
+		}
+	}
+	return
+}
+
+// objectDdl 查询 对象 DDL，数据库 不 提供 的 根据 对象 信息 拼接
+func objectDdl(service db.IService, param *db.Param, object *DbObject) (ddl string, err error) {
+	dia := service.GetDialect()
+	if dia.DialectType() == dialect.TypeSqlite {
+		var rows []map[string]interface{}
+		rows, err = service.QueryMap(`SELECT sql AS DDL FROM sqlite_master WHERE type = `+sqlStringValue(object.ObjectType)+` AND name = `+sqlStringValue(object.ObjectName), nil)
+		if err != nil {
+			return
+		}
+		if len(rows) > 0 {
+			ddl = rowString(rows[0], "DDL") + ";"
+		}
+		return
+	}
+	sqlInfo := objectDdlSql(dia, param, object.OwnerName, object.ObjectType, object.ObjectName)
+	if sqlInfo == "" {
+		switch object.ObjectType {
+		case objectSequence:
+			ddl = sequenceDdl(dia, param, object)
+		case objectGrant:
+			ddl = grantDdl(dia, param, object)
+		default:
+			err = errors.New("数据库类型[" + dia.DialectType().Name + "]不支持查询对象[" + object.ObjectType + "]DDL")
+		}
+		return
+	}
+	rows, err := service.QueryMap(sqlInfo, nil)
+	if err != nil {
+		err = errors.New("DDL查询失败:" + err.Error())
+		return
+	}
+	var ddlList []string
+	for _, row := range rows {
+		var one string
+		switch dia.DialectType() {
+		case dialect.TypeMysql:
+			one = mysqlDdlValue(row, object.ObjectType)
+		case dialect.TypePostgresql, dialect.TypeKingBase, dialect.TypeOpenGauss:
+			one = rowString(row, "DDL")
+			if object.ObjectType == objectView {
+				one = "CREATE OR REPLACE VIEW " + dia.OwnerTablePack(param.ParamModel, object.OwnerName, object.ObjectName) + " AS\n" + one
+			}
+		default:
+			one = rowString(row, "DDL")
+		}
+		if one == "" {
+			continue
+		}
+		if !strings.HasSuffix(one, ";") && dia.DialectType() != dialect.TypeOracle && dia.DialectType() != dialect.TypeDM {
+			one += ";"
+		}
+		ddlList = append(ddlList, one)
+	}
+	ddl = strings.Join(ddlList, "\n\n")
+	return
+}
+
+// mysqlDdlValue SHOW CREATE 结果 列 名 各 不 相同
+func mysqlDdlValue(row map[string]interface{}, objectType string) string {
+	switch objectType {
+	case objectView:
+		return rowString(row, "Create View")
+	case objectProcedure:
+		return rowString(row, "Create Procedure")
+	case objectFunction:
+		return rowString(row, "Create Function")
+	case objectTrigger:
+		return rowString(row, "SQL Original Statement")
+	}
+	// SHOW GRANTS 只有 一列
+	for _, value := range row {
+		return strings.TrimSpace(planString(value))
+	}
+	return ""
+}
+
+func sequenceDdl(dia dialect.Dialect, param *db.Param, object *DbObject) string {
+	ddl := "CREATE SEQUENCE " + dia.OwnerTablePack(param.ParamModel, object.OwnerName, object.ObjectName)
+	if v := planString(object.Extend["data_type"]); v != "" {
+		ddl += " AS " + v
+	}
+	if v := planString(object.Extend["increment"]); v != "" {
+		ddl += " INCREMENT BY " + v
+	}
+	if v := planString(object.Extend["min_value"]); v != "" {
+		ddl += " MINVALUE " + v
+	}
+	if v := planString(object.Extend["max_value"]); v != "" {
+		ddl += " MAXVALUE " + v
+	}
+	if v := planString(object.Extend["start_value"]); v != "" {
+		ddl += " START WITH " + v
+	}
+	if strings.EqualFold(planString(object.Extend["cycle"]), "YES") {
+		ddl += " CYCLE"
+	} else {
+		ddl += " NO CYCLE"
+	}
+	return ddl + ";"
+}
+
+func grantDdl(dia dialect.Dialect, param *db.Param, object *DbObject) string {
+	var ddlList []string
+	for _, one := range object.Privileges {
+		target := dia.OwnerNamePack(param.ParamModel, object.OwnerName)
+		if one.TableName != "" {
+			target = dia.OwnerTablePack(param.ParamModel, object.OwnerName, one.TableName)
+		}
+		ddl := "GRANT " + one.Privilege + " ON " + target + " TO " + object.ObjectName
+		if one.Grantable {
+			ddl += " WITH GRANT OPTION"
+		}
+		ddlList = append(ddlList, ddl+";")
+	}
+	return strings.Join(ddlList, "\n")
+}
+
+// objectDetail 对象 信息、参数 和 DDL
+func objectDetail(service db.IService, param *db.Param, ownerName string, objectType string, objectName string) (detail *ObjectDetail, err error) {
+	object, err := getObject(service, ownerName, objectType, objectName)
+	if err != nil {
+		return
+	}
+	detail = &ObjectDetail{
+		DbObject: object,
+	}
+	if objectType == objectProcedure || objectType == objectFunction {
+		detail.Parameters, err = routineParameters(service, ownerName, object)
+		if err != nil {
+			return
+		}
+	}
+	detail.Ddl, err = objectDdl(service, param, object)
+	return
+}
@@ -0,0 +1,414 @@
+package module_database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"github.com/team-ide/go-dialect/dialect"
+	"github.com/team-ide/go-tool/db"
+	"github.com/team-ide/go-tool/util"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ProcedureParam 执行 存储 过程 或 函数，参数 类型、模式 未 填 的 从 元数据 补全
+type ProcedureParam struct {
+	ObjectType string          `json:"objectType"`
+	ObjectName string          `json:"objectName"`
+	Parameters []*ProcedureArg `json:"parameters"`
+}
+
+type ProcedureArg struct {
+	Name     string      `json:"name"`
+	Mode     string      `json:"mode"` // IN、OUT、INOUT
+	DataType string      `json:"dataType"`
+	Value    interface{} `json:"value"`
+}
+
+type ProcedureResultSet struct {
+	ColumnList []map[string]interface{} `json:"columnList"`
+	DataList   []map[string]interface{} `json:"dataList"`
+}
+
+type ProcedureResult struct {
+	Sql         string                 `json:"sql"`
+	Outputs     map[string]interface{} `json:"outputs,omitempty"`
+	ReturnValue interface{}            `json:"returnValue,omitempty"`
+	ResultSets  []*ProcedureResultSet  `json:"resultSets,omitempty"`
+	UseTime     int64                  `json:"useTime"`
+}
+
+func isNumberType(dataType string) bool {
+	dataType = strings.ToLower(dataType)
+	for _, one := range []string{"int", "number", "numeric", "decimal", "float", "double", "real", "serial"} {
+		if strings.Contains(dataType, one) {
+			return true
+		}
+	}
+	return false
+}
+
+func isIntegerType(dataType string) bool {
+	dataType = strings.ToLower(dataType)
+	return strings.Contains(dataType, "int") || strings.Contains(dataType, "serial")
+}
+
+// typedValue 按 参数 类型 转换 页面 传入 的 值
+func typedValue(dataType string, value interface{}) (res interface{}, err error) {
+	if value == nil {
+		return
+	}
+	lowerType := strings.ToLower(dataType)
+	str := strings.TrimSpace(planString(value))
+	switch {
+	case isNumberType(lowerType):
+		if str == "" {
+			return
+		}
+		if isIntegerType(lowerType) || strings.Trim(str, "-0123456789") == "" {
+			var v int64
+			if v, err = strconv.ParseInt(str, 10, 64); err == nil {
+				res = v
+				return
+			}
+		}
+		var v float64
+		if v, err = strconv.ParseFloat(str, 64); err != nil {
+			err = errors.New("参数值[" + str + "]不是有效的数字")
+			return
+		}
+		res = v
+	case strings.Contains(lowerType, "bool") || lowerType == "bit":
+		var v bool
+		if v, err = strconv.ParseBool(str); err != nil {
+			err = errors.New("参数值[" + str + "]不是有效的布尔值")
+			return
+		}
+		res = v
+	case strings.Contains(lowerType, "date") || strings.Contains(lowerType, "time"):
+		if str == "" {
+			return
+		}
+		for _, layout := range []string{"2006-01-02 15:04:05.999999999", "2006-01-02T15:04:05Z07:00", "2006-01-02", "15:04:05"} {
+			var v time.Time
+			if v, err = time.ParseInLocation(layout, str, time.Local); err == nil {
+				res = v
+				return
+			}
+		}
+		err = errors.New("参数值[" + str + "]不是有效的时间")
+	default:
+		res = str
+	}
+	return
+}
+
+// mergeProcedureArgs 以 元数据 参数 为准，按 名称 或 顺序 匹配 页面 传入 的 值
+func mergeProcedureArgs(parameters []*RoutineParameter, args []*ProcedureArg) (res []*ProcedureArg, returnType string) {
+	var index int
+	for _, parameter := range parameters {
+		if parameter.Mode == "RETURN" {
+			returnType = parameter.DataType
+			continue
+		}
+		one := &ProcedureArg{
+			Name:     parameter.Name,
+			Mode:     parameter.Mode,
+			DataType: parameter.DataType,
+		}
+		var find *ProcedureArg
+		for _, arg := range args {
+			if arg.Name != "" && strings.EqualFold(arg.Name, parameter.Name) {
+				find = arg
+				break
+			}
+		}
+		if find == nil && index < len(args) && args[index].Name == "" {
+			find = args[index]
+		}
+		if find != nil {
+			one.Value = find.Value
+			if find.DataType != "" {
+				one.DataType = find.DataType
+			}
+		}
+		index++
+		res = append(res, one)
+	}
+	if len(parameters) == 0 {
+		res = args
+	}
+	for _, one := range res {
+		one.Mode = strings.ToUpper(strings.ReplaceAll(one.Mode, "/", ""))
+		if one.Mode == "" {
+			one.Mode = "IN"
+		}
+	}
+	return
+}
+
+// procedureExecute 执行 存储 过程 或 函数，OUT 参数 与 返回值 按 类型 转换 后 返回
+func procedureExecute(ctx context.Context, service db.IService, param *db.Param, ownerName string, procedureParam *ProcedureParam) (result *ProcedureResult, err error) {
+	dia := service.GetDialect()
+	object, err := getObject(service, ownerName, procedureParam.ObjectType, procedureParam.ObjectName)
+	if err != nil {
+		return
+	}
+	parameters, err := routineParameters(service, ownerName, object)
+	if err != nil {
+		return
+	}
+	args, returnType := mergeProcedureArgs(parameters, procedureParam.Parameters)
+	var values = make([]interface{}, len(args))
+	for i, arg := range args {
+		if arg.Mode == "OUT" {
+			continue
+		}
+		if values[i], err = typedValue(arg.DataType, arg.Value); err != nil {
+			err = errors.New("参数[" + arg.Name + "]" + err.Error())
+			return
+		}
+	}
+
+	workDb, err := newWorkDb(service.GetConfig(), param, ownerName)
+	if err != nil {
+		return
+	}
+	defer func() { _ = workDb.Close() }()
+	conn, err := workDb.Conn(ctx)
+	if err != nil {
+		return
+	}
+	defer func() { _ = conn.Close() }()
+
+	result = &ProcedureResult{
+		Outputs: map[string]interface{}{},
+	}
+	startTime := util.GetNowMilli()
+	name := dia.OwnerTablePack(param.ParamModel, ownerName, object.ObjectName)
+	isFunction := object.ObjectType == objectFunction
+	switch dia.DialectType() {
+	case dialect.TypeMysql:
+		err = mysqlProcedureExecute(ctx, conn, name, isFunction, args, values, result)
+	case dialect.TypePostgresql, dialect.TypeKingBase, dialect.TypeOpenGauss:
+		err = postgresqlProcedureExecute(ctx, conn, dia, name, isFunction, args, values, result)
+	case dialect.TypeOracle, dialect.TypeDM:
+		err = oracleProcedureExecute(ctx, conn, dia, name, isFunction, args, values, result)
+	default:
+		err = errors.New("数据库类型[" + dia.DialectType().Name + "]不支持执行存储过程")
+	}
+	result.UseTime = util.GetNowMilli() - startTime
+	if err != nil {
+		return
+	}
+	for _, arg := range args {
+		if v, ok := result.Outputs[arg.Name]; ok {
+			result.Outputs[arg.Name] = outputValue(arg.DataType, v)
+		}
+	}
+	if result.ReturnValue != nil {
+		result.ReturnValue = outputValue(returnType, result.ReturnValue)
+	}
+	return
+}
+
+// outputValue 输出 值 转换 失败 的 保留 原 字符串
+func outputValue(dataType string, value interface{}) interface{} {
+	switch value.(type) {
+	case []byte, string:
+		if dataType == "" {
+			return planString(value)
+		}
+		if v, err := typedValue(dataType, value); err == nil {
+			if t, ok := v.(time.Time); ok {
+				return util.GetFormatByTime(t)
+			}
+			return v
+		}
+		return planString(value)
+	}
+	return value
+}
+
+func readResultSets(rows *sql.Rows, result *ProcedureResult) (err error) {
+	for {
+		var resultSet = &ProcedureResultSet{}
+		_, resultSet.ColumnList, resultSet.DataList, err = db.RowsToListMap(rows, 0)
+		if err != nil {
+			return
+		}
+		if len(resultSet.ColumnList) > 0 {
+			result.ResultSets = append(result.ResultSets, resultSet)
+		}
+		if !rows.NextResultSet() {
+			break
+		}
+	}
+	err = rows.Err()
+	return
+}
+
+// mysqlProcedureExecute OUT 参数 使用 会话 变量，同 一 连接 上 再 查询
+func mysqlProcedureExecute(ctx context.Context, conn *sql.Conn, name string, isFunction bool, args []*ProcedureArg, values []interface{}, result *ProcedureResult) (err error) {
+	if isFunction {
+		var placeholders []string
+		var callValues []interface{}
+		for i := range args {
+			placeholders = append(placeholders, "?")
+			callValues = append(callValues, values[i])
+		}
+		result.Sql = "SELECT " + name + "(" + strings.Join(placeholders, ", ") + ") AS RESULT_"
+		var value interface{}
+		if err = conn.QueryRowContext(ctx, result.Sql, callValues...).Scan(&value); err != nil {
+			return
+		}
+		result.ReturnValue = value
+		return
+	}
+
+	var placeholders []string
+	var callValues []interface{}
+	var outVars []string
+	var outNames []string
+	for i, arg := range args {
+		if arg.Mode == "IN" {
+			placeholders = append(placeholders, "?")
+			callValues = append(callValues, values[i])
+			continue
+		}
+		variable := "@p_" + strconv.Itoa(i)
+		if arg.Mode == "INOUT" {
+			if _, err = conn.ExecContext(ctx, "SET "+variable+" = ?", values[i]); err != nil {
+				return
+			}
+		}
+		placeholders = append(placeholders, variable)
+		outVars = append(outVars, variable)
+		outNames = append(outNames, arg.Name)
+	}
+	result.Sql = "CALL " + name + "(" + strings.Join(placeholders, ", ") + ")"
+	rows, err := conn.QueryContext(ctx, result.Sql, callValues...)
+	if err != nil {
+		return
+	}
+	err = readResultSets(rows, result)
+	_ = rows.Close()
+	if err != nil || len(outVars) == 0 {
+		return
+	}
+
+	var outValues = make([]interface{}, len(outVars))
+	var dest = make([]interface{}, len(outVars))
+	for i := range outValues {
+		dest[i] = &outValues[i]
+	}
+	if err = conn.QueryRowContext(ctx, "SELECT "+strings.Join(outVars, ", ")).Scan(dest...); err != nil {
+		return
+	}
+	for i, outName := range outNames {
+		result.Outputs[outName] = outValues[i]
+	}
+	return
+}
+
+// postgresqlProcedureExecute 存储 过程 OUT 参数 传 NULL，结果 行 即 输出 值；函数 只 传 输入 参数
+func postgresqlProcedureExecute(ctx context.Context, conn *sql.Conn, dia dialect.Dialect, name string, isFunction bool, args []*ProcedureArg, values []interface{}, result *ProcedureResult) (err error) {
+	var placeholders []string
+	var callValues []interface{}
+	for i, arg := range args {
+		if arg.Mode == "OUT" {
+			if !isFunction {
+				placeholders = append(placeholders, "NULL")
+			}
+			continue
+		}
+		placeholders = append(placeholders, "?")
+		callValues = append(callValues, values[i])
+	}
+	if isFunction {
+		result.Sql = "SELECT * FROM " + name + "(" + strings.Join(placeholders, ", ") + ")"
+	} else {
+		result.Sql = "CALL " + name + "(" + strings.Join(placeholders, ", ") + ")"
+	}
+	rows, err := conn.QueryContext(ctx, dia.ReplaceSqlVariable(result.Sql, callValues), callValues...)
+	if err != nil {
+		return
+	}
+	err = readResultSets(rows, result)
+	_ = rows.Close()
+	if err != nil || len(result.ResultSets) == 0 {
+		return
+	}
+
+	resultSet := result.ResultSets[0]
+	if isFunction {
+		// 单 值 函数 作为 返回值，返回 表 的 保留 结果 集
+		if len(resultSet.ColumnList) == 1 && len(resultSet.DataList) == 1 {
+			result.ReturnValue = resultSet.DataList[0][util.GetStringValue(resultSet.ColumnList[0]["name"])]
+			result.ResultSets = nil
+		}
+		return
+	}
+	if len(resultSet.DataList) > 0 {
+		for key, value := range resultSet.DataList[0] {
+			result.Outputs[key] = value
+		}
+		result.ResultSets = result.ResultSets[1:]
+	}
+	return
+}
+
+// oracleProcedureExecute 使用 匿名 块 调用，OUT 参数 按 字符串 接收 再 按 类型 转换
+func oracleProcedureExecute(ctx context.Context, conn *sql.Conn, dia dialect.Dialect, name string, isFunction bool, args []*ProcedureArg, values []interface{}, result *ProcedureResult) (err error) {
+	var placeholders []string
+	var callValues []interface{}
+	var outDest = map[string]*string{}
+	var returnValue string
+	for i, arg := range args {
+		placeholders = append(placeholders, "?")
+		if arg.Mode == "IN" {
+			callValues = append(callValues, values[i])
+			continue
+		}
+		dest := new(string)
+		if arg.Mode == "INOUT" {
+			*dest = outString(values[i])
+		}
+		outDest[arg.Name] = dest
+		callValues = append(callValues, sql.Out{Dest: dest, In: arg.Mode == "INOUT"})
+	}
+	call := name + "(" + strings.Join(placeholders, ", ") + ")"
+	if len(placeholders) == 0 {
+		call = name
+	}
+	if isFunction {
+		result.Sql = "BEGIN ? := " + call + "; END;"
+		callValues = append([]interface{}{sql.Out{Dest: &returnValue}}, callValues...)
+	} else {
+		result.Sql = "BEGIN " + call + "; END;"
+	}
+	if _, err = conn.ExecContext(ctx, dia.ReplaceSqlVariable(result.Sql, callValues), callValues...); err != nil {
+		return
+	}
+	for outName, dest := range outDest {
+		result.Outputs[outName] = *dest
+	}
+	if isFunction {
+		result.ReturnValue = returnValue
+	}
+	return
+}
+
+func outString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case time.Time:
+		return util.GetFormatByTime(v)
+	case json.Number:
+		return v.String()
+	}
+	return util.GetStringValue(value)
+}
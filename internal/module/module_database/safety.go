@@ -0,0 +1,236 @@
+package module_database
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/team-ide/go-dialect/dialect"
+	"github.com/team-ide/go-tool/db"
+	"github.com/team-ide/go-tool/util"
+	"go.uber.org/zap"
+	"strings"
+	"sync"
+	"teamide/internal/module/module_toolbox"
+	"teamide/pkg/base"
+	"time"
+)
+
+const (
+	// safetyReadonly 只读，拒绝 所有 写 操作
+	safetyReadonly = "readonly"
+	// safetyConfirm 危险 操作 需要 确认
+	safetyConfirm = "confirm"
+	// safetyUnrestricted 不 限制
+	safetyUnrestricted = "unrestricted"
+
+	confirmTokenExpire = 5 * time.Minute
+)
+
+// ConfirmResult 危险 操作 需要 确认，页面 确认 后 携带 confirmToken 重新 请求
+type ConfirmResult struct {
+	NeedConfirm  bool     `json:"needConfirm"`
+	ConfirmToken string   `json:"confirmToken"`
+	Message      string   `json:"message"`
+	Statements   []string `json:"statements,omitempty"`
+}
+
+type confirmInfo struct {
+	digest     string
+	expireTime time.Time
+}
+
+var confirmCache = map[string]*confirmInfo{}
+var confirmCacheLock = &sync.Mutex{}
+
+// getSafetyLevel 从 保存 的 工具 配置 中 读取 安全 级别，未 配置 为 不 限制
+// 测试 连接 时 工具 来自 请求 体，配置 不可 信任，与 保存 的 不 一致 时 按 只读 处理
+func (this_ *api) getSafetyLevel(requestBean *base.RequestBean) (level string) {
+	level = safetyUnrestricted
+	v := requestBean.GetExtend("toolboxModel")
+	if v == nil {
+		return
+	}
+	toolboxModel := v.(*module_toolbox.ToolboxModel)
+	find, err := this_.toolboxService.Get(toolboxModel.ToolboxId)
+	if err != nil {
+		util.Logger.Error("database get safety level error", zap.Any("toolboxId", toolboxModel.ToolboxId), zap.Error(err))
+		level = safetyReadonly
+		return
+	}
+	if find == nil {
+		find = this_.toolboxService.GetOtherToolbox(toolboxModel.ToolboxId)
+	}
+	if find == nil || find.Option != toolboxModel.Option {
+		level = safetyReadonly
+		return
+	}
+	level = getSafetyLevelByOption(find.Option)
+	return
+}
+
+// getSafetyLevelByOption 从 工具 配置 JSON 中 读取 安全 级别
+func getSafetyLevelByOption(toolboxOption string) (level string) {
+	level = safetyUnrestricted
+	if toolboxOption == "" {
+		return
+	}
+	option := &struct {
+		SafetyLevel string `json:"safetyLevel"`
+	}{}
+	_ = json.Unmarshal([]byte(toolboxOption), option)
+	switch option.SafetyLevel {
+	case safetyReadonly, safetyConfirm:
+		level = option.SafetyLevel
+	}
+	return
+}
+
+// getConfirmDigest 确认 码 与 用户、工具、操作 内容 绑定
+func getConfirmDigest(requestBean *base.RequestBean, action string, content string) string {
+	var toolboxId int64
+	if v := requestBean.GetExtend("toolboxModel"); v != nil {
+		toolboxId = v.(*module_toolbox.ToolboxModel).ToolboxId
+	}
+	var userId int64
+	if requestBean.JWT != nil {
+		userId = requestBean.JWT.UserId
+	}
+	return base.GetMd5String(fmt.Sprint(toolboxId, "-", userId, "-", action, "-", content))
+}
+
+func newConfirmToken(digest string) (token string) {
+	confirmCacheLock.Lock()
+	defer confirmCacheLock.Unlock()
+
+	now := time.Now()
+	for key, one := range confirmCache {
+		if now.After(one.expireTime) {
+			delete(confirmCache, key)
+		}
+	}
+	token = util.GetUUID()
+	confirmCache[token] = &confirmInfo{
+		digest:     digest,
+		expireTime: now.Add(confirmTokenExpire),
+	}
+	return
+}
+
+// useConfirmToken 校验 确认 码，只能 使用 一次
+func useConfirmToken(token string, digest string) bool {
+	if token == "" {
+		return false
+	}
+	confirmCacheLock.Lock()
+	defer confirmCacheLock.Unlock()
+
+	find := confirmCache[token]
+	if find == nil {
+		return false
+	}
+	delete(confirmCache, token)
+	return find.digest == digest && time.Now().Before(find.expireTime)
+}
+
+// checkSafety 按 安全 级别 校验 操作，dangers 为 空 表示 安全，需要 确认 时 返回 confirm
+func (this_ *api) checkSafety(requestBean *base.RequestBean, confirmToken string, action string, content string, writes []string, dangers []string) (confirm *ConfirmResult, err error) {
+	return checkSafetyLevel(this_.getSafetyLevel(requestBean), requestBean, confirmToken, action, content, writes, dangers)
+}
+
+// checkSafetyLevel 按 指定 安全 级别 校验，用于 写入 其它 工具 的 操作
+func checkSafetyLevel(level string, requestBean *base.RequestBean, confirmToken string, action string, content string, writes []string, dangers []string) (confirm *ConfirmResult, err error) {
+	switch level {
+	case safetyReadonly:
+		if len(writes) > 0 {
+			err = errors.New("当前数据库为只读模式，禁止执行：" + strings.Join(writes, "；"))
+			return
+		}
+	case safetyConfirm:
+		if len(dangers) == 0 {
+			return
+		}
+		digest := getConfirmDigest(requestBean, action, content)
+		if useConfirmToken(confirmToken, digest) {
+			return
+		}
+		confirm = &ConfirmResult{
+			NeedConfirm:  true,
+			ConfirmToken: newConfirmToken(digest),
+			Message:      "以下操作需要确认后执行",
+			Statements:   dangers,
+		}
+	}
+	return
+}
+
+// checkDataListSafety 表格 编辑 的 数据，条件 为 空 的 修改、删除 视为 危险 操作
+func (this_ *api) checkDataListSafety(requestBean *base.RequestBean, request *BaseRequest) (confirm *ConfirmResult, err error) {
+	var writes []string
+	var dangers []string
+	table := request.OwnerName + "." + request.TableName
+	if len(request.InsertList) > 0 {
+		writes = append(writes, fmt.Sprintf("INSERT %s %d条", table, len(request.InsertList)))
+	}
+	if len(request.UpdateList) > 0 {
+		writes = append(writes, fmt.Sprintf("UPDATE %s %d条", table, len(request.UpdateList)))
+		for i := range request.UpdateList {
+			if i >= len(request.UpdateWhereList) || len(request.UpdateWhereList[i]) == 0 {
+				dangers = append(dangers, "UPDATE "+table+" 无条件")
+				break
+			}
+		}
+	}
+	if len(request.DeleteList) > 0 {
+		writes = append(writes, fmt.Sprintf("DELETE %s %d条", table, len(request.DeleteList)))
+		for _, one := range request.DeleteList {
+			if len(one) == 0 {
+				dangers = append(dangers, "DELETE "+table+" 无条件")
+				break
+			}
+		}
+	}
+	content, err := util.ObjToJson([]interface{}{table, request.InsertList, request.UpdateList, request.UpdateWhereList, request.DeleteList})
+	if err != nil {
+		return
+	}
+	confirm, err = this_.checkSafety(requestBean, request.ConfirmToken, "dataListExec", content, writes, dangers)
+	return
+}
+
+// checkTableUpdateSafety 修改 表 结构，删除 字段 与 修改 已有 字段 的 名称、类型、长度、非空 视为 危险 操作
+func (this_ *api) checkTableUpdateSafety(requestBean *base.RequestBean, request *BaseRequest, updateTableParam *db.UpdateTableParam) (confirm *ConfirmResult, err error) {
+	table := request.OwnerName + "." + request.TableName
+	writes := []string{"ALTER TABLE " + table}
+	var dangers []string
+	for _, one := range updateTableParam.ColumnList {
+		if one.OldColumn == nil {
+			continue
+		}
+		if one.Deleted {
+			dangers = append(dangers, "ALTER TABLE "+table+" DROP COLUMN "+one.OldColumn.ColumnName)
+			continue
+		}
+		if isColumnAltered(one.OldColumn, one.ColumnModel) {
+			dangers = append(dangers, "ALTER TABLE "+table+" MODIFY COLUMN "+one.OldColumn.ColumnName)
+		}
+	}
+	content, err := util.ObjToJson([]interface{}{table, updateTableParam})
+	if err != nil {
+		return
+	}
+	confirm, err = this_.checkSafety(requestBean, request.ConfirmToken, "tableUpdate", content, writes, dangers)
+	return
+}
+
+// isColumnAltered 字段 名称、类型、长度、精度、非空 变化 可能 导致 数据 丢失，注释、默认值 变化 不 影响
+func isColumnAltered(oldColumn *dialect.ColumnModel, column *dialect.ColumnModel) bool {
+	if column == nil {
+		return false
+	}
+	return !strings.EqualFold(oldColumn.ColumnName, column.ColumnName) ||
+		!strings.EqualFold(oldColumn.ColumnDataType, column.ColumnDataType) ||
+		oldColumn.ColumnLength != column.ColumnLength ||
+		oldColumn.ColumnPrecision != column.ColumnPrecision ||
+		oldColumn.ColumnScale != column.ColumnScale ||
+		oldColumn.ColumnNotNull != column.ColumnNotNull
+}
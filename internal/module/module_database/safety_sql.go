@@ -0,0 +1,261 @@
+package module_database
+
+import (
+	"github.com/team-ide/go-dialect/dialect"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+var (
+	sqlWhereRegexp   = regexp.MustCompile(`\bwhere\b`)
+	sqlKeywordRegexp = regexp.MustCompile(`^[a-z]+`)
+	sqlWriteRegexp   = regexp.MustCompile(`\b(insert|update|delete|merge)\b`)
+	sqlModifyRegexp  = regexp.MustCompile(`\b(update|delete)\b`)
+	sqlIntoRegexp    = regexp.MustCompile(`\binto\b`)
+	// sqlWriteFuncRegexp 查询 中 调用 会 修改 数据 或 影响 其它 会话 的 函数
+	sqlWriteFuncRegexp = regexp.MustCompile(`\b(setval|nextval|lo_import|lo_export|lo_unlink|dblink_exec|pg_terminate_backend|pg_cancel_backend|pg_reload_conf|pg_rotate_logfile|pg_switch_wal|pg_promote|pg_create_restore_point|pg_drop_replication_slot)\s*\(`)
+	// sqlDangerFuncRegexp 终止 其它 会话，与 killSession 一致 视为 危险 操作
+	sqlDangerFuncRegexp = regexp.MustCompile(`\bpg_terminate_backend\s*\(`)
+	// sqlExplainOptionRegexp EXPLAIN 后 不 带 括号 的 选项，MySQL 的 FORMAT=xx，Oracle 的 PLAN FOR
+	sqlExplainOptionRegexp = regexp.MustCompile(`^(analyze|analyse|verbose|extended|partitions|format\s*=\s*\w+|plan\s+for)\b`)
+)
+
+func isPostgresqlLike(dialectType *dialect.Type) bool {
+	return dialectType == dialect.TypePostgresql || dialectType == dialect.TypeKingBase || dialectType == dialect.TypeOpenGauss
+}
+
+func isSqlIdentRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// sqlDollarTag PostgreSQL 的 $tag$ 字符串 开始 标记，$1 等 参数 不是
+func sqlDollarTag(runes []rune, i int) string {
+	j := i + 1
+	for j < len(runes) && isSqlIdentRune(runes[j]) {
+		j++
+	}
+	if j >= len(runes) || runes[j] != '$' || (j > i+1 && unicode.IsDigit(runes[i+1])) {
+		return ""
+	}
+	return string(runes[i : j+1])
+}
+
+// stripSql 去除 注释 与 字符串 内容，并 转为 小写，用于 判断 关键字
+// 注释 语法 按 方言 区分：# 注释、/*! */ 可 执行 注释、反斜杠 转义 只 在 MySQL 中 生效，PostgreSQL 有 $tag$ 字符串 与 E 前缀 的 转义 字符串
+// executable 表示 包含 MySQL 可 执行 注释，注释 内容 会 保留
+func stripSql(dialectType *dialect.Type, sql string) (str string, executable bool) {
+	isMysql := dialectType == dialect.TypeMysql
+	isPostgresql := isPostgresqlLike(dialectType)
+
+	var sb strings.Builder
+	var inExecutable bool
+	runes := []rune(sql)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == '-' && i+1 < len(runes) && runes[i+1] == '-', r == '#' && isMysql:
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+			sb.WriteRune(' ')
+		case r == '/' && i+1 < len(runes) && runes[i+1] == '*':
+			if isMysql && i+2 < len(runes) && runes[i+2] == '!' {
+				// 可 执行 注释 会 被 MySQL 执行，保留 内容，去掉 版本号
+				executable = true
+				inExecutable = true
+				i += 3
+				for i < len(runes) && unicode.IsDigit(runes[i]) {
+					i++
+				}
+				i--
+				sb.WriteRune(' ')
+				continue
+			}
+			i += 2
+			for i+1 < len(runes) && !(runes[i] == '*' && runes[i+1] == '/') {
+				i++
+			}
+			i++
+			sb.WriteRune(' ')
+		case inExecutable && r == '*' && i+1 < len(runes) && runes[i+1] == '/':
+			inExecutable = false
+			i++
+			sb.WriteRune(' ')
+		case r == '$' && isPostgresql && sqlDollarTag(runes, i) != "":
+			tag := []rune(sqlDollarTag(runes, i))
+			i += len(tag)
+			for i < len(runes) && !(runes[i] == '$' && strings.HasPrefix(string(runes[i:]), string(tag))) {
+				i++
+			}
+			i += len(tag) - 1
+			sb.WriteString(" '' ")
+		case r == '\'' || r == '"' || r == '`':
+			escape := r != '`' && isMysql
+			if isPostgresql && r == '\'' && i > 0 && (runes[i-1] == 'e' || runes[i-1] == 'E') && (i < 2 || !isSqlIdentRune(runes[i-2])) {
+				escape = true
+			}
+			i++
+			for i < len(runes) {
+				if escape && runes[i] == '\\' {
+					i += 2
+					continue
+				}
+				if runes[i] == r {
+					if i+1 < len(runes) && runes[i+1] == r {
+						i += 2
+						continue
+					}
+					break
+				}
+				i++
+			}
+			sb.WriteString(" '' ")
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	str = strings.ToLower(strings.TrimSpace(sb.String()))
+	return
+}
+
+// sqlTopLevel 去掉 括号 内 的 内容，子 查询 中 的 WHERE 不是 语句 本身 的 条件
+func sqlTopLevel(str string) string {
+	var sb strings.Builder
+	var depth int
+	for _, r := range str {
+		switch {
+		case r == '(':
+			depth++
+			sb.WriteRune(' ')
+		case r == ')':
+			if depth > 0 {
+				depth--
+			}
+			sb.WriteRune(' ')
+		case depth > 0:
+			sb.WriteRune(' ')
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
+
+// parseExplain 解析 EXPLAIN 的 选项，包括 PostgreSQL 的 (ANALYZE, FORMAT JSON) 列表，返回 是否 实际 执行 与 被 解释 的 语句
+func parseExplain(str string) (analyze bool, statement string) {
+	for {
+		str = strings.TrimSpace(str)
+		if strings.HasPrefix(str, "(") {
+			end := strings.Index(str, ")")
+			if end < 0 {
+				// 无法 解析 时 按 会 执行 处理
+				analyze = true
+				break
+			}
+			for _, option := range strings.Split(str[1:end], ",") {
+				fields := strings.Fields(option)
+				if len(fields) == 0 || (fields[0] != "analyze" && fields[0] != "analyse") {
+					continue
+				}
+				if len(fields) == 1 || (fields[1] != "false" && fields[1] != "off" && fields[1] != "0") {
+					analyze = true
+				}
+			}
+			str = str[end+1:]
+			continue
+		}
+		option := sqlExplainOptionRegexp.FindString(str)
+		if option == "" {
+			break
+		}
+		if option == "analyze" || option == "analyse" {
+			analyze = true
+		}
+		str = str[len(option):]
+	}
+	statement = str
+	return
+}
+
+// classifySql 判断 语句 是否 写 操作，以及 是否 危险：无 WHERE 的 UPDATE、DELETE，DROP，TRUNCATE
+func classifySql(dialectType *dialect.Type, sql string) (isWrite bool, isDanger bool) {
+	str, executable := stripSql(dialectType, sql)
+	isWrite, isDanger = classifyStripped(str)
+	// 可 执行 注释 可以 放在 任意 语句 中，按 写 操作 处理
+	if executable {
+		isWrite = true
+	}
+	return
+}
+
+func classifyStripped(str string) (isWrite bool, isDanger bool) {
+	str = strings.TrimLeft(str, "( \t\r\n")
+	keyword := sqlKeywordRegexp.FindString(str)
+	if keyword == "explain" {
+		// EXPLAIN ANALYZE 会 实际 执行 语句
+		analyze, statement := parseExplain(str[len(keyword):])
+		if analyze {
+			return classifyStripped(statement)
+		}
+		return
+	}
+	isWrite, isDanger = classifyKeyword(keyword, str)
+	// 查询 中 也 可以 调用 有 副作用 的 函数
+	if sqlWriteFuncRegexp.MatchString(str) {
+		isWrite = true
+	}
+	if sqlDangerFuncRegexp.MatchString(str) {
+		isDanger = true
+	}
+	return
+}
+
+// classifyKeyword 按 语句 关键字 判断
+func classifyKeyword(keyword string, str string) (isWrite bool, isDanger bool) {
+	switch keyword {
+	case "select":
+		// SELECT INTO 会 新建 表 或 写 文件
+		isWrite = sqlIntoRegexp.MatchString(sqlTopLevel(str))
+		return
+	case "show", "desc", "describe", "use", "":
+		return
+	case "with":
+		top := sqlTopLevel(str)
+		// WITH 中 可以 包含 写 操作
+		if !sqlWriteRegexp.MatchString(str) {
+			isWrite = sqlIntoRegexp.MatchString(top)
+			return
+		}
+		isWrite = true
+		isDanger = sqlModifyRegexp.MatchString(top) && !sqlWhereRegexp.MatchString(top)
+		return
+	}
+	isWrite = true
+	switch keyword {
+	case "update", "delete":
+		isDanger = !sqlWhereRegexp.MatchString(sqlTopLevel(str))
+	case "drop", "truncate":
+		isDanger = true
+	}
+	return
+}
+
+// isReadOnlyTxSupported 方言 的 驱动 是否 支持 只读 事务，只读 模式 下 在 只读 事务 中 执行，数据库 端 拒绝 未 识别 的 写 操作
+func isReadOnlyTxSupported(dialectType *dialect.Type) bool {
+	return dialectType == dialect.TypeMysql || isPostgresqlLike(dialectType)
+}
+
+// checkSqlSafety 拆分 SQL 并 按 语句 分类
+func checkSqlSafety(dia dialect.Dialect, sqlContent string) (writes []string, dangers []string) {
+	for _, one := range dia.SqlSplit(sqlContent) {
+		isWrite, isDanger := classifySql(dia.DialectType(), one)
+		if isWrite {
+			writes = append(writes, one)
+		}
+		if isDanger {
+			dangers = append(dangers, one)
+		}
+	}
+	return
+}
@@ -0,0 +1,91 @@
+package module_database
+
+import (
+	"github.com/team-ide/go-dialect/dialect"
+	"strings"
+	"testing"
+)
+
+func TestStripSql(t *testing.T) {
+	list := []struct {
+		dialectType *dialect.Type
+		sql         string
+		want        string
+		executable  bool
+	}{
+		{dialect.TypeMysql, "SELECT 1 -- DROP TABLE t", "select 1", false},
+		{dialect.TypeMysql, "SELECT 'a--b', \"c\" FROM t", "select '' , '' from t", false},
+		{dialect.TypeMysql, "# DROP TABLE t\nSELECT 1", "select 1", false},
+		{dialect.TypeMysql, "SELECT 'a\\'; DROP TABLE t' FROM t", "select '' from t", false},
+		{dialect.TypeMysql, "SELECT /* DROP */ 1", "select 1", false},
+		{dialect.TypeMysql, "/*!DROP TABLE t*/", "drop table t", true},
+		{dialect.TypeMysql, "SELECT 1 /*!50001 , SLEEP(1) */", "select 1 , sleep 1", true},
+		{dialect.TypePostgresql, "SELECT 1 # 2", "select 1 # 2", false},
+		{dialect.TypePostgresql, "/*!DROP TABLE t*/", "", false},
+		{dialect.TypePostgresql, "SELECT 'a\\', 1", "select '' , 1", false},
+		{dialect.TypePostgresql, "SELECT E'a\\'b', 1", "select e '' , 1", false},
+		{dialect.TypePostgresql, "SELECT $$ ' $$, $1, $tag$ DROP $tag$", "select '' , $1, ''", false},
+	}
+	for _, one := range list {
+		str, executable := stripSql(one.dialectType, one.sql)
+		// 只 比较 词，忽略 空白
+		str = strings.Join(strings.Fields(strings.NewReplacer("(", " ", ")", " ").Replace(str)), " ")
+		if str != one.want || executable != one.executable {
+			t.Errorf("stripSql(%s, %q) = %q, %v, want %q, %v", one.dialectType.Name, one.sql, str, executable, one.want, one.executable)
+		}
+	}
+}
+
+func TestClassifySql(t *testing.T) {
+	list := []struct {
+		dialectType *dialect.Type
+		sql         string
+		isWrite     bool
+		isDanger    bool
+	}{
+		{dialect.TypeMysql, "SELECT * FROM t WHERE a = 1", false, false},
+		{dialect.TypeMysql, "(SELECT 1)", false, false},
+		{dialect.TypeMysql, "INSERT INTO t VALUES (1)", true, false},
+		{dialect.TypeMysql, "TRUNCATE TABLE t", true, true},
+		{dialect.TypeMysql, "DROP TABLE t", true, true},
+		{dialect.TypeMysql, "DELETE FROM t WHERE id = 1", true, false},
+		{dialect.TypeMysql, "DELETE FROM t # WHERE id = 1", true, true},
+		{dialect.TypeMysql, "DELETE FROM t WHERE name = 'a # b'", true, false},
+		{dialect.TypeMysql, "UPDATE t SET a = (SELECT b FROM s WHERE s.id = 1)", true, true},
+		{dialect.TypeMysql, "UPDATE t SET a = 1 WHERE id IN (SELECT id FROM s)", true, false},
+		{dialect.TypeMysql, "/*!DROP TABLE t*/", true, true},
+		{dialect.TypeMysql, "SELECT 1 /*!, SLEEP(10) */", true, false},
+		{dialect.TypeMysql, "EXPLAIN SELECT * FROM t", false, false},
+		{dialect.TypeMysql, "EXPLAIN FORMAT=TREE DELETE FROM t", false, false},
+		{dialect.TypeMysql, "EXPLAIN ANALYZE SELECT * FROM t", false, false},
+		{dialect.TypeMysql, "EXPLAIN ANALYZE DELETE FROM t", true, true},
+		{dialect.TypePostgresql, "EXPLAIN (ANALYZE) DELETE FROM t", true, true},
+		{dialect.TypePostgresql, "EXPLAIN (FORMAT JSON, ANALYZE TRUE) UPDATE t SET a = 1", true, true},
+		{dialect.TypePostgresql, "EXPLAIN (ANALYZE FALSE) DELETE FROM t", false, false},
+		{dialect.TypePostgresql, "EXPLAIN ANALYSE VERBOSE DELETE FROM t WHERE id = 1", true, false},
+		{dialect.TypePostgresql, "EXPLAIN VERBOSE DELETE FROM t", false, false},
+		{dialect.TypePostgresql, "WITH x AS (SELECT 1 # 2) DELETE FROM t", true, true},
+		{dialect.TypePostgresql, "WITH x AS (SELECT id FROM s WHERE a = 1) DELETE FROM t WHERE id IN (SELECT id FROM x)", true, false},
+		{dialect.TypePostgresql, "WITH x AS (SELECT 1) SELECT * FROM x", false, false},
+		{dialect.TypePostgresql, "SELECT $$ DELETE FROM t $$", false, false},
+		{dialect.TypeMysql, "SELECT * INTO OUTFILE '/tmp/t' FROM t", true, false},
+		{dialect.TypeMysql, "SELECT * FROM t WHERE id IN (SELECT id FROM s)", false, false},
+		{dialect.TypeMysql, "SELECT 'into' FROM t", false, false},
+		{dialect.TypePostgresql, "SELECT * INTO t2 FROM t", true, false},
+		{dialect.TypePostgresql, "WITH x AS (SELECT 1) SELECT * INTO t2 FROM x", true, false},
+		{dialect.TypePostgresql, "SELECT setval('s', 1)", true, false},
+		{dialect.TypePostgresql, "SELECT nextval ('s')", true, false},
+		{dialect.TypePostgresql, "SELECT pg_terminate_backend(pid) FROM pg_stat_activity", true, true},
+		{dialect.TypePostgresql, "WITH x AS (SELECT pg_cancel_backend(1)) SELECT * FROM x", true, false},
+		{dialect.TypePostgresql, "SELECT 'setval(1)'", false, false},
+		{dialect.TypePostgresql, "EXPLAIN SELECT setval('s', 1)", false, false},
+		{dialect.TypePostgresql, "EXPLAIN ANALYZE SELECT setval('s', 1)", true, false},
+		{dialect.TypePostgresql, "UPDATE t SET a = nextval('s') WHERE id = 1", true, false},
+	}
+	for _, one := range list {
+		isWrite, isDanger := classifySql(one.dialectType, one.sql)
+		if isWrite != one.isWrite || isDanger != one.isDanger {
+			t.Errorf("classifySql(%s, %q) = %v, %v, want %v, %v", one.dialectType.Name, one.sql, isWrite, isDanger, one.isWrite, one.isDanger)
+		}
+	}
+}
@@ -0,0 +1,283 @@
+package module_database
+
+import (
+	"errors"
+	"github.com/team-ide/go-dialect/worker"
+	"strings"
+	"teamide/internal/context"
+	"teamide/internal/module/module_id"
+	"time"
+)
+
+// NewSqlService 根据库配置创建SqlService
+func NewSqlService(ServerContext *context.ServerContext) (res *SqlService) {
+
+	idService := module_id.NewIDService(ServerContext)
+
+	res = &SqlService{
+		ServerContext: ServerContext,
+		idService:     idService,
+	}
+	return
+}
+
+// SqlService SQL执行历史、保存的SQL 服务
+type SqlService struct {
+	*context.ServerContext
+	idService *module_id.IDService
+}
+
+// SaveHistory 新增执行历史
+func (this_ *SqlService) SaveHistory(history *SqlHistoryModel) (err error) {
+
+	history.SqlHistoryId, err = this_.idService.GetNextID(module_id.IDTypeDatabaseSqlHistory)
+	if err != nil {
+		return
+	}
+	if history.CreateTime.IsZero() {
+		history.CreateTime = time.Now()
+	}
+
+	sql := `INSERT INTO ` + TableDatabaseSqlHistory +
+		`(sqlHistoryId, toolboxId, workerId, executeId, userId, userName, userAccount, ownerName, sqlContent, useTime
+, rowsAffected, dataSize, errorMsg, createTime)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) `
+
+	_, err = this_.DatabaseWorker.Exec(sql, []interface{}{
+		history.SqlHistoryId,
+		history.ToolboxId,
+		history.WorkerId,
+		history.ExecuteId,
+		history.UserId,
+		history.UserName,
+		history.UserAccount,
+		history.OwnerName,
+		history.SqlContent,
+		history.UseTime,
+		history.RowsAffected,
+		history.DataSize,
+		history.ErrorMsg,
+		history.CreateTime,
+	})
+	if err != nil {
+		return
+	}
+	return
+}
+
+type SqlHistoryPage struct {
+	*worker.Page
+	DataList []*SqlHistoryModel `json:"dataList"`
+}
+
+type SqlHistorySearch struct {
+	ToolboxId int64
+	UserId    int64
+	OwnerName string
+	Keyword   string
+	OnlyError bool
+	StartTime time.Time
+	EndTime   time.Time
+}
+
+// QueryHistoryPage 分页查询执行历史
+func (this_ *SqlService) QueryHistoryPage(search *SqlHistorySearch, page *SqlHistoryPage) (err error) {
+	var sql string
+	var values []interface{}
+
+	sql += "SELECT * FROM " + TableDatabaseSqlHistory + " WHERE toolboxId=?"
+	values = append(values, search.ToolboxId)
+	if search.UserId != 0 {
+		sql += " AND userId=?"
+		values = append(values, search.UserId)
+	}
+	if search.OwnerName != "" {
+		sql += " AND ownerName=?"
+		values = append(values, search.OwnerName)
+	}
+	if search.Keyword != "" {
+		sql += " AND sqlContent LIKE ?"
+		values = append(values, "%"+search.Keyword+"%")
+	}
+	if search.OnlyError {
+		sql += " AND errorMsg IS NOT NULL AND errorMsg<>''"
+	}
+	if !search.StartTime.IsZero() {
+		sql += " AND createTime>=?"
+		values = append(values, search.StartTime)
+	}
+	if !search.EndTime.IsZero() {
+		sql += " AND createTime<=?"
+		values = append(values, search.EndTime)
+	}
+	sql += " ORDER BY createTime DESC"
+	page.DataList = []*SqlHistoryModel{}
+	err = this_.DatabaseWorker.QueryPage(sql, values, &page.DataList, page.Page)
+	if err != nil {
+		return
+	}
+	return
+}
+
+// CleanHistory 清理用户在某个工具下的执行历史
+func (this_ *SqlService) CleanHistory(toolboxId int64, userId int64) (err error) {
+	if toolboxId == 0 || userId == 0 {
+		err = errors.New("清理SQL历史需要工具和用户")
+		return
+	}
+
+	sql := "DELETE FROM " + TableDatabaseSqlHistory + " WHERE toolboxId=? AND userId=? "
+	_, err = this_.DatabaseWorker.Exec(sql, []interface{}{toolboxId, userId})
+	if err != nil {
+		return
+	}
+	return
+}
+
+// formatTags 去除空白和重复的标签
+func formatTags(tags string) string {
+	var list []string
+	for _, one := range strings.Split(tags, ",") {
+		one = strings.TrimSpace(one)
+		if one == "" {
+			continue
+		}
+		var find bool
+		for _, s := range list {
+			if s == one {
+				find = true
+				break
+			}
+		}
+		if !find {
+			list = append(list, one)
+		}
+	}
+	return strings.Join(list, ",")
+}
+
+// GetQuery 查询保存的SQL
+func (this_ *SqlService) GetQuery(sqlQueryId int64) (res *SqlQueryModel, err error) {
+
+	sql := "SELECT * FROM " + TableDatabaseSqlQuery + " WHERE sqlQueryId=? "
+	var list []*SqlQueryModel
+	err = this_.DatabaseWorker.Query(sql, []interface{}{sqlQueryId}, &list)
+	if err != nil {
+		return
+	}
+	if len(list) > 0 {
+		res = list[0]
+	}
+	return
+}
+
+// SaveQuery 新增或更新保存的SQL
+func (this_ *SqlService) SaveQuery(query *SqlQueryModel) (err error) {
+	query.Tags = formatTags(query.Tags)
+
+	if query.SqlQueryId > 0 {
+		query.UpdateTime = time.Now()
+
+		sql := `UPDATE ` + TableDatabaseSqlQuery + " SET name=?,ownerName=?,sqlContent=?,tags=?,comment=?,shared=?,updateTime=? WHERE sqlQueryId=? "
+
+		_, err = this_.DatabaseWorker.Exec(sql, []interface{}{
+			query.Name,
+			query.OwnerName,
+			query.SqlContent,
+			query.Tags,
+			query.Comment,
+			query.Shared,
+			query.UpdateTime,
+			query.SqlQueryId,
+		})
+		if err != nil {
+			return
+		}
+		return
+	}
+	query.SqlQueryId, err = this_.idService.GetNextID(module_id.IDTypeDatabaseSqlQuery)
+	if err != nil {
+		return
+	}
+	if query.CreateTime.IsZero() {
+		query.CreateTime = time.Now()
+	}
+
+	sql := `INSERT INTO ` + TableDatabaseSqlQuery +
+		`(sqlQueryId, toolboxId, userId, userName, name, ownerName, sqlContent, tags, comment, shared, createTime)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) `
+
+	_, err = this_.DatabaseWorker.Exec(sql, []interface{}{
+		query.SqlQueryId,
+		query.ToolboxId,
+		query.UserId,
+		query.UserName,
+		query.Name,
+		query.OwnerName,
+		query.SqlContent,
+		query.Tags,
+		query.Comment,
+		query.Shared,
+		query.CreateTime,
+	})
+	if err != nil {
+		return
+	}
+	return
+}
+
+type SqlQuerySearch struct {
+	ToolboxId     int64
+	UserId        int64
+	IncludeShared bool // 包含其它用户共享的
+	Keyword       string
+	Tag           string
+}
+
+// QueryQueries 查询保存的SQL，标签完全匹配
+func (this_ *SqlService) QueryQueries(search *SqlQuerySearch) (res []*SqlQueryModel, err error) {
+	var sql string
+	var values []interface{}
+
+	sql += "SELECT * FROM " + TableDatabaseSqlQuery + " WHERE toolboxId=?"
+	values = append(values, search.ToolboxId)
+	if search.IncludeShared {
+		sql += " AND (userId=? OR shared=1)"
+	} else {
+		sql += " AND userId=?"
+	}
+	values = append(values, search.UserId)
+	if search.Keyword != "" {
+		sql += " AND (name LIKE ? OR sqlContent LIKE ? OR comment LIKE ?)"
+		values = append(values, "%"+search.Keyword+"%", "%"+search.Keyword+"%", "%"+search.Keyword+"%")
+	}
+	if search.Tag != "" {
+		sql += " AND tags LIKE ?"
+		values = append(values, "%"+search.Tag+"%")
+	}
+	sql += " ORDER BY name ASC, createTime DESC"
+
+	var list []*SqlQueryModel
+	err = this_.DatabaseWorker.Query(sql, values, &list)
+	if err != nil {
+		return
+	}
+	res = []*SqlQueryModel{}
+	for _, one := range list {
+		if search.Tag != "" && !strings.Contains(","+one.Tags+",", ","+search.Tag+",") {
+			continue
+		}
+		res = append(res, one)
+	}
+	return
+}
+
+func (this_ *SqlService) DeleteQuery(sqlQueryId int64) (err error) {
+
+	sql := "DELETE FROM " + TableDatabaseSqlQuery + " WHERE sqlQueryId=? "
+	_, err = this_.DatabaseWorker.Exec(sql, []interface{}{sqlQueryId})
+	if err != nil {
+		return
+	}
+	return
+}
@@ -0,0 +1,433 @@
+package module_database
+
+import (
+	"archive/zip"
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/team-ide/go-dialect/dialect"
+	"github.com/team-ide/go-dialect/worker"
+	"github.com/team-ide/go-tool/db"
+	"github.com/team-ide/go-tool/util"
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"teamide/pkg/background"
+	"time"
+)
+
+const (
+	// backupVersion 2 起 二进制 值 按 base64 写入，恢复 兼容 旧 版本
+	backupVersion          = 2
+	backupDefaultChunkSize = 10000
+	backupManifestFile     = "manifest.json"
+	backupTablesFile       = "schema/tables.json"
+	backupTablesSqlFile    = "schema/tables.sql"
+	backupTimeLayout       = "2006-01-02 15:04:05.999999999"
+	// backupBinaryKey 二进制 值 写为 {"$base64": "..."}，与 字符串 区分
+	backupBinaryKey = "$base64"
+)
+
+// backupObjectTypes 备份 的 对象 类型，序列 在 建 表 前 恢复，其它 在 数据 后 恢复，触发器 不 影响 数据 导入
+var backupObjectTypes = []string{objectSequence, objectView, objectFunction, objectProcedure, objectTrigger, objectSynonym}
+
+// BackupParam 备份 整个 库，数据 按 主键 排序 分块 写入 JSONL
+type BackupParam struct {
+	TableNames []string `json:"tableNames"` // 为 空 备份 所有 表
+	ChunkSize  int      `json:"chunkSize"`  // 每个 数据 文件 行数
+	SkipData   bool     `json:"skipData"`
+	SkipObject bool     `json:"skipObject"`
+}
+
+// BackupManifest 备份 包 描述，恢复 时 按 顺序 回放
+type BackupManifest struct {
+	Version      int             `json:"version"`
+	DatabaseType string          `json:"databaseType"`
+	OwnerName    string          `json:"ownerName"`
+	CreateTime   int64           `json:"createTime"`
+	ChunkSize    int             `json:"chunkSize"`
+	Tables       []*BackupTable  `json:"tables"` // 按 外键 依赖 排序
+	Objects      []*BackupObject `json:"objects"`
+}
+
+type BackupTable struct {
+	TableName string   `json:"tableName"`
+	RowCount  int64    `json:"rowCount"`
+	Files     []string `json:"files"`
+}
+
+type BackupObject struct {
+	ObjectType string `json:"objectType"`
+	ObjectName string `json:"objectName"`
+	File       string `json:"file"`
+}
+
+type BackupResult struct {
+	ToolboxId  int64    `json:"toolboxId"` // 备份 来源 工具，下载 与 恢复 时 校验 权限
+	Path       string   `json:"path"`      // 相对 文件 目录，用于 下载 与 恢复
+	TableCount int      `json:"tableCount"`
+	TableIndex int      `json:"tableIndex"`
+	TableName  string   `json:"tableName"`
+	RowCount   int64    `json:"rowCount"`
+	Objects    int      `json:"objects"`
+	Warnings   []string `json:"warnings"`
+}
+
+func (this_ *BackupResult) Snapshot() interface{} {
+	res := *this_
+	res.Warnings = append([]string{}, this_.Warnings...)
+	return &res
+}
+
+func (this_ *BackupParam) init() {
+	if this_.ChunkSize <= 0 {
+		this_.ChunkSize = backupDefaultChunkSize
+	}
+}
+
+// backupQueryer 快照 事务 或 连接
+type backupQueryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+type backup struct {
+	*BackupParam
+	service   db.IService
+	param     *db.Param
+	ownerName string
+	workDb    *sql.DB
+	filePath  string
+	result    *BackupResult
+	task      *background.Task
+	writer    *zip.Writer
+	manifest  *BackupManifest
+}
+
+func newBackup(service db.IService, param *db.Param, ownerName string, workDb *sql.DB, backupParam *BackupParam, filesDir string, filePath string) *backup {
+	backupParam.init()
+	return &backup{
+		BackupParam: backupParam,
+		service:     service,
+		param:       param,
+		ownerName:   ownerName,
+		workDb:      workDb,
+		filePath:    filepath.Join(filesDir, filePath),
+		result:      &BackupResult{Path: filePath},
+		manifest: &BackupManifest{
+			Version:      backupVersion,
+			DatabaseType: service.GetDialect().DialectType().Name,
+			OwnerName:    ownerName,
+			CreateTime:   util.GetNowMilli(),
+			ChunkSize:    backupParam.ChunkSize,
+		},
+	}
+}
+
+func (this_ *backup) warn(message string) {
+	util.Logger.Warn("database backup warn", zap.Any("message", message))
+	this_.task.Update(func() {
+		this_.result.Warnings = append(this_.result.Warnings, message)
+	})
+}
+
+func (this_ *backup) writeJSON(name string, value interface{}) (err error) {
+	w, err := this_.writer.Create(name)
+	if err != nil {
+		return
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	err = encoder.Encode(value)
+	return
+}
+
+func (this_ *backup) writeText(name string, text string) (err error) {
+	w, err := this_.writer.Create(name)
+	if err != nil {
+		return
+	}
+	_, err = w.Write([]byte(text))
+	return
+}
+
+// snapshotTxOptions 只读 可 重复 读 事务，保证 各 表 数据 来自 同 一 时刻
+func snapshotTxOptions(dia dialect.Dialect) *sql.TxOptions {
+	switch dia.DialectType() {
+	case dialect.TypeMysql, dialect.TypePostgresql, dialect.TypeKingBase, dialect.TypeOpenGauss:
+		return &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true}
+	case dialect.TypeOracle:
+		return &sql.TxOptions{ReadOnly: true}
+	}
+	return nil
+}
+
+func (this_ *backup) do(task *background.Task) (err error) {
+	this_.task = task
+	defer func() { _ = this_.workDb.Close() }()
+
+	if err = os.MkdirAll(filepath.Dir(this_.filePath), 0777); err != nil {
+		return
+	}
+	file, err := os.Create(this_.filePath)
+	if err != nil {
+		return
+	}
+	defer func() {
+		_ = file.Close()
+		// 失败 或 停止 的 不 保留 不 完整 的 备份 包
+		if err != nil || task.IsStopped() {
+			_ = os.Remove(this_.filePath)
+		}
+	}()
+	this_.writer = zip.NewWriter(file)
+
+	ctx := context.Background()
+	tables, err := this_.loadTables(ctx)
+	if err != nil {
+		return
+	}
+	task.Update(func() {
+		this_.result.TableCount = len(tables)
+	})
+	if err = this_.writeJSON(backupTablesFile, tables); err != nil {
+		return
+	}
+	var ddlList []string
+	for _, table := range tables {
+		sqlList, e := this_.service.GetDialect().TableCreateSql(this_.param.ParamModel, this_.ownerName, table)
+		if e != nil {
+			this_.warn("表[" + table.TableName + "]DDL生成失败:" + e.Error())
+			continue
+		}
+		ddlList = append(ddlList, strings.Join(sqlList, ";\n")+";")
+	}
+	if err = this_.writeText(backupTablesSqlFile, strings.Join(ddlList, "\n\n")); err != nil {
+		return
+	}
+
+	if !this_.SkipData {
+		err = this_.backupData(ctx, task, tables)
+		if err != nil {
+			return
+		}
+	} else {
+		for _, table := range tables {
+			this_.manifest.Tables = append(this_.manifest.Tables, &BackupTable{TableName: table.TableName})
+		}
+	}
+	if task.IsStopped() {
+		return
+	}
+	if !this_.SkipObject {
+		this_.backupObjects(task)
+	}
+	if err = this_.writeJSON(backupManifestFile, this_.manifest); err != nil {
+		return
+	}
+	err = this_.writer.Close()
+	return
+}
+
+// loadTables 加载 表 结构 并 按 外键 依赖 排序
+func (this_ *backup) loadTables(ctx context.Context) (tables []*dialect.TableModel, err error) {
+	tableCache, err := loadCompareTables(this_.service, this_.param, this_.ownerName, this_.TableNames)
+	if err != nil {
+		return
+	}
+	var list []*dialect.TableModel
+	var tableNames []string
+	for _, table := range tableCache {
+		list = append(list, table)
+		tableNames = append(tableNames, table.TableName)
+	}
+	foreignKeys, err := loadForeignKeys(ctx, this_.service, this_.param, this_.ownerName, list)
+	if err != nil {
+		this_.warn("外键加载失败，按表名顺序备份:" + err.Error())
+		foreignKeys = nil
+		err = nil
+	}
+	// 先 按 表 名 排序，保证 备份 结果 可 重复
+	sort.Strings(tableNames)
+	for _, tableName := range sortTableNames(tableNames, foreignKeys) {
+		tables = append(tables, tableCache[compareName(tableName)])
+	}
+	return
+}
+
+func (this_ *backup) backupData(ctx context.Context, task *background.Task, tables []*dialect.TableModel) (err error) {
+	conn, err := this_.workDb.Conn(ctx)
+	if err != nil {
+		return
+	}
+	defer func() { _ = conn.Close() }()
+
+	var queryer backupQueryer = conn
+	if options := snapshotTxOptions(this_.service.GetDialect()); options != nil {
+		tx, e := conn.BeginTx(ctx, options)
+		if e != nil {
+			this_.warn("快照事务开启失败，数据可能不一致:" + e.Error())
+		} else {
+			defer func() { _ = tx.Rollback() }()
+			queryer = tx
+		}
+	}
+
+	for index, table := range tables {
+		if task.IsStopped() {
+			return
+		}
+		task.Update(func() {
+			this_.result.TableIndex = index + 1
+			this_.result.TableName = table.TableName
+		})
+		backupTable := &BackupTable{TableName: table.TableName}
+		this_.manifest.Tables = append(this_.manifest.Tables, backupTable)
+		err = this_.backupTableData(ctx, task, queryer, index, table, backupTable)
+		if err != nil {
+			err = errors.New("表[" + table.TableName + "]数据备份失败:" + err.Error())
+			return
+		}
+	}
+	return
+}
+
+// backupTableData 按 主键 排序 分页 读取，每 ChunkSize 行 一个 文件
+func (this_ *backup) backupTableData(ctx context.Context, task *background.Task, queryer backupQueryer, tableIndex int, table *dialect.TableModel, backupTable *BackupTable) (err error) {
+	dia := this_.service.GetDialect()
+	var orders []*dialect.Order
+	for _, column := range table.ColumnList {
+		if column.PrimaryKey {
+			orders = append(orders, &dialect.Order{Name: column.ColumnName, AscDesc: "ASC"})
+		}
+	}
+	if len(orders) == 0 {
+		this_.warn("表[" + table.TableName + "]没有主键，数据顺序不保证可重复")
+	}
+	selectSql, values, err := dia.DataListSelectSql(this_.param.ParamModel, this_.ownerName, table.TableName, table.ColumnList, nil, orders)
+	if err != nil {
+		return
+	}
+	for pageNo := 1; ; pageNo++ {
+		if task.IsStopped() {
+			return
+		}
+		pageSql := dia.PackPageSql(selectSql, this_.ChunkSize, pageNo)
+		var dataList []map[string]interface{}
+		dataList, err = backupQuery(ctx, queryer, pageSql, values)
+		if err != nil {
+			return
+		}
+		if len(dataList) == 0 {
+			break
+		}
+		name := fmt.Sprintf("data/%05d/%05d.jsonl", tableIndex+1, pageNo)
+		if err = this_.writeRows(name, dataList); err != nil {
+			return
+		}
+		backupTable.Files = append(backupTable.Files, name)
+		backupTable.RowCount += int64(len(dataList))
+		task.Update(func() {
+			this_.result.RowCount += int64(len(dataList))
+		})
+		if len(dataList) < this_.ChunkSize {
+			break
+		}
+	}
+	return
+}
+
+func (this_ *backup) writeRows(name string, dataList []map[string]interface{}) (err error) {
+	w, err := this_.writer.Create(name)
+	if err != nil {
+		return
+	}
+	buf := bufio.NewWriter(w)
+	encoder := json.NewEncoder(buf)
+	for _, data := range dataList {
+		if err = encoder.Encode(data); err != nil {
+			return
+		}
+	}
+	err = buf.Flush()
+	return
+}
+
+// backupQuery 时间 保留 纳秒 格式 化，避免 转 毫秒 丢失 精度，二进制 按 base64 写入
+func backupQuery(ctx context.Context, queryer backupQueryer, sqlInfo string, args []interface{}) (dataList []map[string]interface{}, err error) {
+	rows, err := queryer.QueryContext(ctx, sqlInfo, args...)
+	if err != nil {
+		return
+	}
+	defer func() { _ = rows.Close() }()
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return
+	}
+	for rows.Next() {
+		cache := worker.GetSqlValueCache(columnTypes)
+		if err = rows.Scan(cache...); err != nil {
+			return
+		}
+		data := map[string]interface{}{}
+		for index, one := range cache {
+			value := worker.GetSqlValue(columnTypes[index], one)
+			switch tV := value.(type) {
+			case time.Time:
+				if tV.IsZero() {
+					value = nil
+				} else {
+					value = tV.Format(backupTimeLayout)
+				}
+			case []byte:
+				value = map[string]interface{}{backupBinaryKey: base64.StdEncoding.EncodeToString(tV)}
+			}
+			data[columnTypes[index].Name()] = value
+		}
+		dataList = append(dataList, data)
+	}
+	err = rows.Err()
+	return
+}
+
+// backupObjects 对象 DDL 为 源 数据库 方言，不 支持 的 类型 跳过
+func (this_ *backup) backupObjects(task *background.Task) {
+	for _, objectType := range backupObjectTypes {
+		if _, err := objectListSql(this_.service.GetDialect(), this_.ownerName, objectType); err != nil {
+			continue
+		}
+		list, err := objectList(this_.service, this_.ownerName, objectType, "")
+		if err != nil {
+			this_.warn("对象[" + objectType + "]查询失败:" + err.Error())
+			continue
+		}
+		for index, object := range list {
+			if task.IsStopped() {
+				return
+			}
+			ddl, err := objectDdl(this_.service, this_.param, object)
+			if err != nil {
+				this_.warn("对象[" + object.ObjectName + "]DDL查询失败:" + err.Error())
+				continue
+			}
+			name := fmt.Sprintf("objects/%s/%05d.sql", objectType, index+1)
+			if err = this_.writeText(name, ddl); err != nil {
+				this_.warn("对象[" + object.ObjectName + "]写入失败:" + err.Error())
+				continue
+			}
+			this_.manifest.Objects = append(this_.manifest.Objects, &BackupObject{
+				ObjectType: objectType,
+				ObjectName: object.ObjectName,
+				File:       name,
+			})
+			task.Update(func() {
+				this_.result.Objects++
+			})
+		}
+	}
+}
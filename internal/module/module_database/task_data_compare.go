@@ -0,0 +1,545 @@
+package module_database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/team-ide/go-dialect/dialect"
+	"github.com/team-ide/go-dialect/worker"
+	"github.com/team-ide/go-tool/db"
+	"math/big"
+	"strings"
+	"teamide/pkg/background"
+	"time"
+)
+
+const (
+	dataCompareModeCompare = "compare" // 只 对比
+	dataCompareModeSql     = "sql"     // 对比 并 生成 SQL
+	dataCompareModeApply   = "apply"   // 对比 并 在 目标 执行
+
+	dataDiffInsert = "insert" // 目标 缺少，需要 新增
+	dataDiffUpdate = "update" // 两边 不 一致，需要 修改
+	dataDiffDelete = "delete" // 目标 多余，需要 删除
+)
+
+// DataCompareParam 表 数据 对比 参数，源 为 当前 工具，按 主键 对比
+type DataCompareParam struct {
+	TargetToolboxId int64    `json:"targetToolboxId"` // 为 空 使用 当前 工具
+	SourceOwnerName string   `json:"sourceOwnerName"`
+	SourceTableName string   `json:"sourceTableName"`
+	TargetOwnerName string   `json:"targetOwnerName"`
+	TargetTableName string   `json:"targetTableName"`
+	KeyColumns      []string `json:"keyColumns"` // 为 空 使用 源 表 主键
+	Columns         []string `json:"columns"`    // 对比 的 字段，为 空 对比 两边 都有 的 字段
+	ChunkSize       int      `json:"chunkSize"`  // 每批 读取 行数
+	MaxDiffs        int      `json:"maxDiffs"`   // 结果 中 保留 的 差异 行数，超出 只 计数
+	Mode            string   `json:"mode"`       // compare、sql、apply
+}
+
+func (this_ *DataCompareParam) init() (err error) {
+	if this_.SourceTableName == "" {
+		err = errors.New("源表不能为空")
+		return
+	}
+	if this_.TargetOwnerName == "" {
+		this_.TargetOwnerName = this_.SourceOwnerName
+	}
+	if this_.TargetTableName == "" {
+		this_.TargetTableName = this_.SourceTableName
+	}
+	if this_.ChunkSize <= 0 {
+		this_.ChunkSize = 500
+	}
+	// Oracle IN 最多 1000 个 值
+	if this_.ChunkSize > 1000 {
+		this_.ChunkSize = 1000
+	}
+	if this_.MaxDiffs <= 0 {
+		this_.MaxDiffs = 1000
+	}
+	switch this_.Mode {
+	case "":
+		this_.Mode = dataCompareModeCompare
+	case dataCompareModeCompare, dataCompareModeSql, dataCompareModeApply:
+	default:
+		err = errors.New("不支持的对比模式[" + this_.Mode + "]")
+		return
+	}
+	return
+}
+
+type ColumnValueDiff struct {
+	ColumnName string      `json:"columnName"`
+	Source     interface{} `json:"source"`
+	Target     interface{} `json:"target"`
+}
+
+type RowDiff struct {
+	Type    string                 `json:"type"`
+	Key     map[string]interface{} `json:"key"`
+	Columns []*ColumnValueDiff     `json:"columns,omitempty"`
+}
+
+type DataCompareResult struct {
+	SourceCount int        `json:"sourceCount"`
+	TargetCount int        `json:"targetCount"`
+	SameCount   int        `json:"sameCount"`
+	InsertCount int        `json:"insertCount"`
+	UpdateCount int        `json:"updateCount"`
+	DeleteCount int        `json:"deleteCount"`
+	ApplyCount  int        `json:"applyCount"`
+	DiffList    []*RowDiff `json:"diffList"`
+	SqlList     []string   `json:"sqlList"`
+	Truncated   bool       `json:"truncated"` // 差异 超过 maxDiffs，只 保留 部分
+}
+
+func (this_ *DataCompareResult) Snapshot() interface{} {
+	res := *this_
+	res.DiffList = append([]*RowDiff{}, this_.DiffList...)
+	res.SqlList = append([]string{}, this_.SqlList...)
+	return &res
+}
+
+// columnPair 源、目标 对应 的 字段，名称 不 区分 大小写
+type columnPair struct {
+	source *dialect.ColumnModel
+	target *dialect.ColumnModel
+	// isNumber 两边 都是 数字 类型，按 数值 对比
+	isNumber bool
+}
+
+func isNumberColumn(dia dialect.Dialect, column *dialect.ColumnModel) bool {
+	if column.ColumnDataType == "" {
+		return false
+	}
+	// 映射 规则 可能 修改 长度，使用 副本
+	one := *column
+	info, err := dia.GetColumnTypeInfo(&one)
+	return err == nil && info != nil && info.IsNumber
+}
+
+func newColumnPair(sourceDia dialect.Dialect, source *dialect.ColumnModel, targetDia dialect.Dialect, target *dialect.ColumnModel) *columnPair {
+	return &columnPair{
+		source:   source,
+		target:   target,
+		isNumber: isNumberColumn(sourceDia, source) && isNumberColumn(targetDia, target),
+	}
+}
+
+type dataCompareSide struct {
+	service db.IService
+	param   *db.Param
+	db      *sql.DB
+	owner   string
+	table   string
+}
+
+type dataCompare struct {
+	*DataCompareParam
+	task    *background.Task
+	result  *DataCompareResult
+	source  *dataCompareSide
+	target  *dataCompareSide
+	keys    []*columnPair
+	columns []*columnPair
+}
+
+// initColumns 按 源、目标 表 结构 确定 主键 与 对比 字段
+func (this_ *dataCompare) initColumns(sourceDia dialect.Dialect, sourceTable *dialect.TableModel, targetDia dialect.Dialect, targetTable *dialect.TableModel) (err error) {
+	keyColumns := this_.KeyColumns
+	if len(keyColumns) == 0 {
+		keyColumns = sourceTable.PrimaryKeys
+	}
+	if len(keyColumns) == 0 {
+		err = errors.New("表[" + sourceTable.TableName + "]没有主键，请指定对比主键")
+		return
+	}
+	for _, name := range keyColumns {
+		source := findCompareColumn(sourceTable, name)
+		target := findCompareColumn(targetTable, name)
+		if source == nil || target == nil {
+			err = errors.New("主键字段[" + name + "]在源表或目标表中不存在")
+			return
+		}
+		this_.keys = append(this_.keys, newColumnPair(sourceDia, source, targetDia, target))
+	}
+	isKey := func(name string) bool {
+		for _, one := range this_.keys {
+			if compareName(one.source.ColumnName) == compareName(name) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(this_.Columns) > 0 {
+		for _, name := range this_.Columns {
+			if isKey(name) {
+				continue
+			}
+			source := findCompareColumn(sourceTable, name)
+			target := findCompareColumn(targetTable, name)
+			if source == nil || target == nil {
+				err = errors.New("对比字段[" + name + "]在源表或目标表中不存在")
+				return
+			}
+			this_.columns = append(this_.columns, newColumnPair(sourceDia, source, targetDia, target))
+		}
+		return
+	}
+	for _, column := range sourceTable.ColumnList {
+		if isKey(column.ColumnName) {
+			continue
+		}
+		if target := findCompareColumn(targetTable, column.ColumnName); target != nil {
+			this_.columns = append(this_.columns, newColumnPair(sourceDia, column, targetDia, target))
+		}
+	}
+	return
+}
+
+func (this_ *dataCompare) sideColumns(isSource bool) (columnList []*dialect.ColumnModel) {
+	for _, one := range append(append([]*columnPair{}, this_.keys...), this_.columns...) {
+		if isSource {
+			columnList = append(columnList, one.source)
+		} else {
+			columnList = append(columnList, one.target)
+		}
+	}
+	return
+}
+
+// pageSql 按 主键 排序 查询 last 之后 的 一批，按 主键 位置 分页，目标 删除 行 不 影响 后续 分页
+func (this_ *dataCompare) pageSql(side *dataCompareSide, isSource bool, last map[string]interface{}) (sqlInfo string, args []interface{}) {
+	dia := side.service.GetDialect()
+	param := side.param.ParamModel
+	var packs []string
+	for _, column := range this_.sideColumns(isSource) {
+		packs = append(packs, dia.ColumnNamePack(param, column.ColumnName))
+	}
+	var keyNames, orders []string
+	for _, one := range this_.keys {
+		column := one.target
+		if isSource {
+			column = one.source
+		}
+		keyNames = append(keyNames, column.ColumnName)
+		orders = append(orders, dia.ColumnNamePack(param, column.ColumnName)+" ASC")
+	}
+	sqlInfo = "SELECT " + strings.Join(packs, ", ") + " FROM " + dia.OwnerTablePack(param, side.owner, side.table)
+	if last != nil {
+		// 多 主键 展开 为 (a > ?) OR (a = ? AND b > ?)，部分 数据库 不 支持 行 比较
+		var conditions []string
+		for i, name := range keyNames {
+			var ands []string
+			for _, before := range keyNames[:i] {
+				ands = append(ands, dia.ColumnNamePack(param, before)+" = ?")
+				args = append(args, last[before])
+			}
+			ands = append(ands, dia.ColumnNamePack(param, name)+" > ?")
+			args = append(args, last[name])
+			conditions = append(conditions, "("+strings.Join(ands, " AND ")+")")
+		}
+		sqlInfo += " WHERE " + strings.Join(conditions, " OR ")
+	}
+	sqlInfo += " ORDER BY " + strings.Join(orders, ", ")
+	sqlInfo = dia.ReplaceSqlVariable(sqlInfo, args)
+	sqlInfo = dia.PackPageSql(sqlInfo, this_.ChunkSize, 1)
+	return
+}
+
+// selectByKeys 按 另 一边 的 主键 值 查询 行
+func (this_ *dataCompare) selectByKeys(side *dataCompareSide, isSource bool, rows []map[string]interface{}, fromSource bool) (list []map[string]interface{}, err error) {
+	if len(rows) == 0 {
+		return
+	}
+	dia := side.service.GetDialect()
+	param := side.param.ParamModel
+	var packs []string
+	for _, column := range this_.sideColumns(isSource) {
+		packs = append(packs, dia.ColumnNamePack(param, column.ColumnName))
+	}
+	keyName := func(pair *columnPair, source bool) string {
+		if source {
+			return pair.source.ColumnName
+		}
+		return pair.target.ColumnName
+	}
+	var args []interface{}
+	sqlInfo := "SELECT " + strings.Join(packs, ", ") + " FROM " + dia.OwnerTablePack(param, side.owner, side.table) + " WHERE "
+	if len(this_.keys) == 1 {
+		var marks []string
+		for _, row := range rows {
+			marks = append(marks, "?")
+			args = append(args, row[keyName(this_.keys[0], fromSource)])
+		}
+		sqlInfo += dia.ColumnNamePack(param, keyName(this_.keys[0], isSource)) + " IN (" + strings.Join(marks, ", ") + ")"
+	} else {
+		var conditions []string
+		for _, row := range rows {
+			var ands []string
+			for _, pair := range this_.keys {
+				ands = append(ands, dia.ColumnNamePack(param, keyName(pair, isSource))+" = ?")
+				args = append(args, row[keyName(pair, fromSource)])
+			}
+			conditions = append(conditions, "("+strings.Join(ands, " AND ")+")")
+		}
+		sqlInfo += strings.Join(conditions, " OR ")
+	}
+	sqlInfo = dia.ReplaceSqlVariable(sqlInfo, args)
+	list, err = worker.DoQuery(side.db, sqlInfo, args)
+	return
+}
+
+// normalizeValue 统一 不同 数据库 的 值 格式，时间 按 微秒 精度
+// 数字 类型 按 精确 数值，1.50 与 1.5 相同，大 整数 不 丢失 精度，其它 类型 按 原 字符串，007 与 7 不同
+func normalizeValue(v interface{}, isNumber bool) (string, bool) {
+	switch tV := v.(type) {
+	case nil:
+		return "", false
+	case []byte:
+		v = string(tV)
+	case time.Time:
+		return tV.UTC().Format("2006-01-02 15:04:05.000000"), true
+	}
+	s := fmt.Sprint(v)
+	if isNumber {
+		if r, ok := new(big.Rat).SetString(strings.TrimSpace(s)); ok {
+			return r.RatString(), true
+		}
+	}
+	return s, true
+}
+
+func valueEqual(a interface{}, b interface{}, isNumber bool) bool {
+	aS, aOk := normalizeValue(a, isNumber)
+	bS, bOk := normalizeValue(b, isNumber)
+	return aOk == bOk && aS == bS
+}
+
+func (this_ *dataCompare) rowKey(row map[string]interface{}, isSource bool) string {
+	var values []string
+	for _, pair := range this_.keys {
+		name := pair.target.ColumnName
+		if isSource {
+			name = pair.source.ColumnName
+		}
+		s, _ := normalizeValue(row[name], pair.isNumber)
+		values = append(values, s)
+	}
+	return strings.Join(values, "\x00")
+}
+
+func (this_ *dataCompare) keyData(row map[string]interface{}, isSource bool) (key map[string]interface{}) {
+	key = map[string]interface{}{}
+	for _, pair := range this_.keys {
+		if isSource {
+			key[pair.target.ColumnName] = row[pair.source.ColumnName]
+		} else {
+			key[pair.target.ColumnName] = row[pair.target.ColumnName]
+		}
+	}
+	return
+}
+
+func (this_ *dataCompare) addDiff(diff *RowDiff) {
+	this_.task.Update(func() {
+		switch diff.Type {
+		case dataDiffInsert:
+			this_.result.InsertCount++
+		case dataDiffUpdate:
+			this_.result.UpdateCount++
+		case dataDiffDelete:
+			this_.result.DeleteCount++
+		}
+		if len(this_.result.DiffList) < this_.MaxDiffs {
+			this_.result.DiffList = append(this_.result.DiffList, diff)
+		} else {
+			this_.result.Truncated = true
+		}
+	})
+}
+
+// compareSource 按 源 分批 查找 目标 缺少 与 不一致 的 行
+func (this_ *dataCompare) compareSource() (err error) {
+	var last map[string]interface{}
+	for {
+		if this_.task.IsStopped() {
+			return
+		}
+		sqlInfo, args := this_.pageSql(this_.source, true, last)
+		var sourceRows []map[string]interface{}
+		sourceRows, err = worker.DoQuery(this_.source.db, sqlInfo, args)
+		if err != nil {
+			return
+		}
+		if len(sourceRows) == 0 {
+			return
+		}
+		last = sourceRows[len(sourceRows)-1]
+		var targetRows []map[string]interface{}
+		targetRows, err = this_.selectByKeys(this_.target, false, sourceRows, true)
+		if err != nil {
+			return
+		}
+		targetByKey := map[string]map[string]interface{}{}
+		for _, row := range targetRows {
+			targetByKey[this_.rowKey(row, false)] = row
+		}
+
+		var inserts, updates, updateWheres []map[string]interface{}
+		var same int
+		for _, sourceRow := range sourceRows {
+			targetRow := targetByKey[this_.rowKey(sourceRow, true)]
+			if targetRow == nil {
+				insert := this_.keyData(sourceRow, true)
+				for _, pair := range this_.columns {
+					insert[pair.target.ColumnName] = sourceRow[pair.source.ColumnName]
+				}
+				inserts = append(inserts, insert)
+				this_.addDiff(&RowDiff{Type: dataDiffInsert, Key: this_.keyData(sourceRow, true)})
+				continue
+			}
+			var columns []*ColumnValueDiff
+			update := map[string]interface{}{}
+			for _, pair := range this_.columns {
+				sourceValue := sourceRow[pair.source.ColumnName]
+				targetValue := targetRow[pair.target.ColumnName]
+				if valueEqual(sourceValue, targetValue, pair.isNumber) {
+					continue
+				}
+				columns = append(columns, &ColumnValueDiff{
+					ColumnName: pair.target.ColumnName,
+					Source:     sourceValue,
+					Target:     targetValue,
+				})
+				update[pair.target.ColumnName] = sourceValue
+			}
+			if len(columns) == 0 {
+				same++
+				continue
+			}
+			updates = append(updates, update)
+			updateWheres = append(updateWheres, this_.keyData(targetRow, false))
+			this_.addDiff(&RowDiff{Type: dataDiffUpdate, Key: this_.keyData(targetRow, false), Columns: columns})
+		}
+		this_.task.Update(func() {
+			this_.result.SourceCount += len(sourceRows)
+			this_.result.SameCount += same
+		})
+		err = this_.output(inserts, updates, updateWheres, nil)
+		if err != nil {
+			return
+		}
+		if len(sourceRows) < this_.ChunkSize {
+			return
+		}
+	}
+}
+
+// compareTarget 按 目标 分批 查找 源 中 不存在 的 行，每批 的 删除 随 批 输出
+func (this_ *dataCompare) compareTarget() (err error) {
+	var last map[string]interface{}
+	for {
+		if this_.task.IsStopped() {
+			return
+		}
+		sqlInfo, args := this_.pageSql(this_.target, false, last)
+		var targetRows []map[string]interface{}
+		targetRows, err = worker.DoQuery(this_.target.db, sqlInfo, args)
+		if err != nil {
+			return
+		}
+		if len(targetRows) == 0 {
+			return
+		}
+		last = targetRows[len(targetRows)-1]
+		var sourceRows []map[string]interface{}
+		sourceRows, err = this_.selectByKeys(this_.source, true, targetRows, false)
+		if err != nil {
+			return
+		}
+		sourceKeys := map[string]bool{}
+		for _, row := range sourceRows {
+			sourceKeys[this_.rowKey(row, true)] = true
+		}
+		var deletes []map[string]interface{}
+		for _, targetRow := range targetRows {
+			if sourceKeys[this_.rowKey(targetRow, false)] {
+				continue
+			}
+			key := this_.keyData(targetRow, false)
+			deletes = append(deletes, key)
+			this_.addDiff(&RowDiff{Type: dataDiffDelete, Key: key})
+		}
+		this_.task.Update(func() {
+			this_.result.TargetCount += len(targetRows)
+		})
+		err = this_.output(nil, nil, nil, deletes)
+		if err != nil {
+			return
+		}
+		if len(targetRows) < this_.ChunkSize {
+			return
+		}
+	}
+}
+
+// output 按 模式 生成 或 执行 目标 SQL
+func (this_ *dataCompare) output(inserts []map[string]interface{}, updates []map[string]interface{}, updateWheres []map[string]interface{}, deletes []map[string]interface{}) (err error) {
+	if len(inserts) == 0 && len(updates) == 0 && len(deletes) == 0 {
+		return
+	}
+	target := this_.target
+	columnList := this_.sideColumns(false)
+	switch this_.Mode {
+	case dataCompareModeSql:
+		param := &db.Param{}
+		*param = *target.param
+		param.ParamModel = &dialect.ParamModel{}
+		if target.param.ParamModel != nil {
+			*param.ParamModel = *target.param.ParamModel
+		}
+		var sqlList []string
+		sqlList, err = target.service.DataListSql(param, target.owner, target.table, columnList, inserts, updates, updateWheres, deletes)
+		if err != nil {
+			return
+		}
+		this_.task.Update(func() {
+			for _, one := range sqlList {
+				if len(this_.result.SqlList) >= this_.MaxDiffs {
+					this_.result.Truncated = true
+					break
+				}
+				this_.result.SqlList = append(this_.result.SqlList, one)
+			}
+		})
+	case dataCompareModeApply:
+		err = target.service.DataListExec(target.param, target.owner, target.table, columnList, inserts, updates, updateWheres, deletes)
+		if err != nil {
+			return
+		}
+		this_.task.Update(func() {
+			this_.result.ApplyCount += len(inserts) + len(updates) + len(deletes)
+		})
+	}
+	return
+}
+
+func (this_ *dataCompare) do(task *background.Task) (err error) {
+	this_.task = task
+	defer func() {
+		_ = this_.source.db.Close()
+		_ = this_.target.db.Close()
+	}()
+
+	err = this_.compareSource()
+	if err != nil {
+		return
+	}
+	err = this_.compareTarget()
+	if err != nil {
+		return
+	}
+	return
+}
@@ -0,0 +1,459 @@
+package module_database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/team-ide/go-dialect/dialect"
+	"github.com/team-ide/go-dialect/worker"
+	"github.com/team-ide/go-tool/db"
+	"github.com/team-ide/go-tool/javascript"
+	"math"
+	"math/big"
+	"math/rand"
+	"time"
+)
+
+// mockForeignKeySampleSize 每个 外键 从 父表 中 最多 读取 的 行数
+const mockForeignKeySampleSize = 10000
+
+// MockParam 模拟 数据 生成 参数
+type MockParam struct {
+	Tables        []*MockTable `json:"tables"`
+	BatchNumber   int          `json:"batchNumber"`
+	ErrorContinue bool         `json:"errorContinue"`
+	Preview       int          `json:"preview"` // 大于 0 时 只 生成 每个 表 指定 行数 预览，不 插入
+}
+
+type MockTable struct {
+	TableName string      `json:"tableName"`
+	RowCount  int         `json:"rowCount"`
+	Rules     []*MockRule `json:"rules"` // 未 配置 的 字段 按 类型 推断
+}
+
+// mockForeignKeyData 外键 字段 一起 取值，保证 复合 外键 来自 父表 同 一行
+type mockForeignKeyData struct {
+	foreignKey *ForeignKeyModel
+	columns    []*mockColumn
+	values     []map[string]interface{}
+}
+
+// mockTableData 单个 表 的 生成 器，作为 导入 任务 的 数据 源
+type mockTableData struct {
+	*MockTable
+	owner       string
+	dia         dialect.Dialect
+	param       *dialect.ParamModel
+	workDb      *sql.DB
+	columns     []*mockColumn
+	scripts     []*mockColumn
+	foreignKeys []*mockForeignKeyData
+	script      *javascript.Script
+	rand        *rand.Rand
+	isStop      bool
+}
+
+func newMockTableData(table *MockTable, detail *dialect.TableModel, foreignKeys []*ForeignKeyModel) (res *mockTableData, err error) {
+	res = &mockTableData{
+		MockTable: table,
+		rand:      rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	markPrimaryKeys(detail)
+	rules := map[string]*MockRule{}
+	for _, rule := range table.Rules {
+		if findCompareColumn(detail, rule.ColumnName) == nil {
+			err = errors.New("表[" + detail.TableName + "]字段[" + rule.ColumnName + "]不存在")
+			return
+		}
+		rules[compareName(rule.ColumnName)] = rule
+	}
+	foreignKeyColumns := map[string]*mockForeignKeyData{}
+	for _, foreignKey := range foreignKeys {
+		one := &mockForeignKeyData{foreignKey: foreignKey}
+		for _, name := range foreignKey.ColumnNames {
+			rule := rules[compareName(name)]
+			// 配置 了 其它 规则 的 外键 字段 按 配置 生成
+			if rule != nil && rule.Type != mockForeignKey {
+				one = nil
+				break
+			}
+			foreignKeyColumns[compareName(name)] = one
+		}
+		if one != nil {
+			res.foreignKeys = append(res.foreignKeys, one)
+		}
+	}
+	for _, column := range detail.ColumnList {
+		rule := rules[compareName(column.ColumnName)]
+		fk := foreignKeyColumns[compareName(column.ColumnName)]
+		if rule == nil {
+			if fk != nil {
+				rule = &MockRule{ColumnName: column.ColumnName, Type: mockForeignKey}
+			} else {
+				rule = defaultMockRule(column)
+			}
+		}
+		if rule.Type == mockSkip {
+			continue
+		}
+		if rule.Type == mockForeignKey && fk == nil {
+			err = errors.New("表[" + detail.TableName + "]字段[" + column.ColumnName + "]没有外键，不能使用外键规则")
+			return
+		}
+		var mc *mockColumn
+		mc, err = newMockColumn(column, rule)
+		if err != nil {
+			return
+		}
+		switch rule.Type {
+		case mockForeignKey:
+			fk.columns = append(fk.columns, mc)
+		case mockScript:
+			res.scripts = append(res.scripts, mc)
+		default:
+			res.columns = append(res.columns, mc)
+		}
+	}
+	if len(res.scripts) > 0 {
+		res.script, err = javascript.NewScript()
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// columnNames 生成 的 字段，传 给 导入 任务
+func (this_ *mockTableData) columnNames() (names []string) {
+	for _, one := range this_.foreignKeys {
+		for _, column := range one.columns {
+			names = append(names, column.column.ColumnName)
+		}
+	}
+	for _, column := range this_.columns {
+		names = append(names, column.column.ColumnName)
+	}
+	for _, column := range this_.scripts {
+		names = append(names, column.column.ColumnName)
+	}
+	return
+}
+
+func (this_ *mockTableData) query(tableName string, columnNames []string, pageSize int) (list []map[string]interface{}, err error) {
+	var columnList []*dialect.ColumnModel
+	for _, name := range columnNames {
+		columnList = append(columnList, &dialect.ColumnModel{ColumnName: name})
+	}
+	sqlInfo, _, err := this_.dia.DataListSelectSql(this_.param, this_.owner, tableName, columnList, nil, nil)
+	if err != nil {
+		return
+	}
+	sqlInfo = this_.dia.PackPageSql(sqlInfo, pageSize, 1)
+	list, err = worker.DoQuery(this_.workDb, sqlInfo, nil)
+	return
+}
+
+// loadSequence 序列 未 配置 开始 值 时 从 表 中 最大值 + 1 开始
+func (this_ *mockTableData) loadSequence(column *mockColumn) (err error) {
+	sqlInfo := "SELECT MAX(" + this_.dia.ColumnNamePack(this_.param, column.column.ColumnName) + ") FROM " +
+		this_.dia.OwnerTablePack(this_.param, this_.owner, this_.TableName)
+	list, err := worker.DoQuery(this_.workDb, sqlInfo, nil)
+	if err != nil {
+		return
+	}
+	column.sequence = 1
+	if len(list) == 0 {
+		return
+	}
+	for _, v := range list[0] {
+		if v == nil {
+			return
+		}
+		if bs, ok := v.([]byte); ok {
+			v = string(bs)
+		}
+		// 按 高 精度 解析，BIGINT 超过 2^53 的 值（如 雪花 ID）转 float64 会 丢失 精度
+		max, ok := new(big.Float).SetPrec(256).SetString(fmt.Sprint(v))
+		if !ok {
+			err = errors.New("字段[" + column.column.ColumnName + "]最大值[" + fmt.Sprint(v) + "]不是数字，请配置序列开始值")
+			return
+		}
+		n, _ := max.Int(nil)
+		if !n.IsInt64() || n.Int64() == math.MaxInt64 {
+			err = errors.New("字段[" + column.column.ColumnName + "]最大值[" + fmt.Sprint(v) + "]超出范围，请配置序列开始值")
+			return
+		}
+		column.sequence = n.Int64() + 1
+	}
+	return
+}
+
+func (this_ *mockTableData) Stop() {
+	this_.isStop = true
+}
+
+// ReadStart 父表 在 之前 已 导入，此时 读取 外键 取值 范围
+func (this_ *mockTableData) ReadStart() (err error) {
+	for _, column := range this_.columns {
+		if column.rule.Type == mockSequence && column.rule.Start == nil {
+			err = this_.loadSequence(column)
+			if err != nil {
+				return
+			}
+		}
+	}
+	for _, one := range this_.foreignKeys {
+		one.values, err = this_.query(one.foreignKey.ReferencedTableName, one.foreignKey.ReferencedColumnNames, mockForeignKeySampleSize)
+		if err != nil {
+			return
+		}
+		if len(one.values) > 0 || compareName(one.foreignKey.ReferencedTableName) == compareName(this_.TableName) {
+			continue
+		}
+		for _, column := range one.columns {
+			if column.column.ColumnNotNull {
+				err = errors.New("表[" + this_.TableName + "]外键[" + one.foreignKey.ReferencedTableName + "]父表没有数据，请先生成父表数据")
+				return
+			}
+		}
+	}
+	return
+}
+
+func (this_ *mockTableData) ReadEnd() (err error) {
+	return
+}
+
+// row 生成 一行，脚本 字段 最后 生成，可 通过 row 使用 其它 字段 的 值
+func (this_ *mockTableData) row(index int) (row map[string]interface{}, err error) {
+	row = map[string]interface{}{}
+	for _, one := range this_.foreignKeys {
+		var parent map[string]interface{}
+		if len(one.values) > 0 {
+			parent = one.values[this_.rand.Intn(len(one.values))]
+		}
+		for _, column := range one.columns {
+			var v interface{}
+			if parent != nil {
+				for j, name := range one.foreignKey.ColumnNames {
+					if compareName(name) == compareName(column.column.ColumnName) && j < len(one.foreignKey.ReferencedColumnNames) {
+						v = parent[one.foreignKey.ReferencedColumnNames[j]]
+					}
+				}
+			}
+			row[column.column.ColumnName] = v
+		}
+	}
+	for _, column := range this_.columns {
+		row[column.column.ColumnName] = column.value()
+	}
+	if len(this_.scripts) == 0 {
+		return
+	}
+	err = this_.script.Set("index", index)
+	if err != nil {
+		return
+	}
+	err = this_.script.Set("row", row)
+	if err != nil {
+		return
+	}
+	for _, column := range this_.scripts {
+		var v interface{}
+		v, err = this_.script.GetScriptValue(column.rule.Script)
+		if err != nil {
+			err = errors.New("字段[" + column.column.ColumnName + "]脚本执行失败:" + err.Error())
+			return
+		}
+		row[column.column.ColumnName] = column.truncate(v)
+	}
+	return
+}
+
+func (this_ *mockTableData) Read(columnList []*dialect.ColumnModel, onRead func(data *worker.DataSourceData) (err error)) (err error) {
+	for index := 0; index < this_.RowCount; index++ {
+		if this_.isStop {
+			return
+		}
+		var row map[string]interface{}
+		row, err = this_.row(index)
+		if err != nil {
+			return
+		}
+		err = onRead(&worker.DataSourceData{
+			HasData:    true,
+			Data:       row,
+			ColumnList: columnList,
+		})
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (this_ *mockTableData) WriteStart() (err error) {
+	err = errors.New("模拟数据不支持写入")
+	return
+}
+
+func (this_ *mockTableData) Write(data *worker.DataSourceData) (err error) {
+	err = errors.New("模拟数据不支持写入")
+	return
+}
+
+func (this_ *mockTableData) WriteEnd() (err error) {
+	return
+}
+
+func (this_ *mockTableData) WriteHeader(columnList []*dialect.ColumnModel) (err error) {
+	err = errors.New("模拟数据不支持写入")
+	return
+}
+
+// sortMockTables 按 外键 排序，父表 先 生成
+func sortMockTables(tables []*MockTable, foreignKeys map[string][]*ForeignKeyModel) (res []*MockTable) {
+	var tableNames []string
+	cache := map[string]*MockTable{}
+	for _, table := range tables {
+		tableNames = append(tableNames, table.TableName)
+		cache[table.TableName] = table
+	}
+	for _, tableName := range sortTableNames(tableNames, foreignKeys) {
+		res = append(res, cache[tableName])
+	}
+	return
+}
+
+// mockData 按 表 结构 生成 模拟 数据，通过 导入 任务 分批 插入
+type mockData struct {
+	*MockParam
+	service   db.IService
+	param     *db.Param
+	ownerName string
+	workDb    *sql.DB
+	tables    []*mockTableData
+}
+
+func newMockData(service db.IService, param *db.Param, ownerName string, workDb *sql.DB, mockParam *MockParam) (res *mockData, err error) {
+	if len(mockParam.Tables) == 0 {
+		err = errors.New("请选择需要生成数据的表")
+		return
+	}
+	res = &mockData{
+		MockParam: mockParam,
+		service:   service,
+		param:     param,
+		ownerName: ownerName,
+		workDb:    workDb,
+	}
+	var tables []*dialect.TableModel
+	for _, table := range mockParam.Tables {
+		tables = append(tables, &dialect.TableModel{TableName: table.TableName})
+	}
+	foreignKeys, err := loadForeignKeys(context.Background(), service, param, ownerName, tables)
+	if err != nil {
+		return
+	}
+	paramModel := param.ParamModel
+	if paramModel == nil {
+		paramModel = &dialect.ParamModel{}
+	}
+	for _, table := range sortMockTables(mockParam.Tables, foreignKeys) {
+		if table.RowCount <= 0 && mockParam.Preview <= 0 {
+			err = errors.New("表[" + table.TableName + "]生成行数必须大于0")
+			return
+		}
+		var detail *dialect.TableModel
+		detail, err = service.TableDetail(param, ownerName, table.TableName)
+		if err != nil {
+			return
+		}
+		if detail == nil {
+			err = errors.New("表[" + table.TableName + "]不存在")
+			return
+		}
+		var one *mockTableData
+		one, err = newMockTableData(table, detail, foreignKeys[table.TableName])
+		if err != nil {
+			return
+		}
+		one.owner = ownerName
+		one.dia = service.GetDialect()
+		one.param = paramModel
+		one.workDb = workDb
+		res.tables = append(res.tables, one)
+	}
+	return
+}
+
+// preview 生成 少量 数据 预览，外键 只能 取 库 中 已有 数据
+func (this_ *mockData) preview() (res map[string][]map[string]interface{}, err error) {
+	res = map[string][]map[string]interface{}{}
+	for _, table := range this_.tables {
+		err = table.ReadStart()
+		if err != nil {
+			return
+		}
+		var list []map[string]interface{}
+		for index := 0; index < this_.Preview; index++ {
+			var row map[string]interface{}
+			row, err = table.row(index)
+			if err != nil {
+				return
+			}
+			list = append(list, row)
+		}
+		res[table.TableName] = list
+	}
+	return
+}
+
+// start 使用 导入 任务 插入，进度、停止 与 导入 任务 一致
+func (this_ *mockData) start() (task *worker.Task, err error) {
+	tableData := map[string]*mockTableData{}
+	owner := &worker.TaskImportOwner{Name: this_.ownerName}
+	for _, table := range this_.tables {
+		tableData[table.TableName] = table
+		importTable := &worker.TaskImportTable{
+			Name: table.TableName,
+			// 导入 任务 要求 路径 不为 空，模拟 数据 不 读取 文件
+			Path: "mock:" + table.TableName,
+		}
+		for _, name := range table.columnNames() {
+			importTable.Columns = append(importTable.Columns, &worker.TaskImportColumn{Name: name})
+		}
+		owner.Tables = append(owner.Tables, importTable)
+	}
+	importParam := &worker.TaskImportParam{
+		Owners: []*worker.TaskImportOwner{owner},
+		DataSourceType: &worker.DataSourceType{
+			Name: "mock",
+			New: func(param *worker.DataSourceParam) (dataSource worker.DataSource) {
+				return tableData[param.SheetName]
+			},
+		},
+		BatchNumber:   this_.BatchNumber,
+		ErrorContinue: this_.ErrorContinue,
+	}
+	task_ := worker.NewTaskImport(this_.workDb, this_.service.GetDialect(),
+		func(owner *worker.TaskImportOwner) (workDb *sql.DB, err error) {
+			workDb = this_.workDb
+			return
+		},
+		importParam,
+	)
+	task_.Param = this_.param.ParamModel
+
+	go func() {
+		defer func() {
+			_ = this_.workDb.Close()
+		}()
+
+		_ = task_.Start()
+	}()
+	time.Sleep(time.Millisecond * 100)
+	task = task_.Task
+	return
+}
@@ -0,0 +1,383 @@
+package module_database
+
+import (
+	"archive/zip"
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/team-ide/go-dialect/dialect"
+	"github.com/team-ide/go-dialect/worker"
+	"github.com/team-ide/go-tool/db"
+	"github.com/team-ide/go-tool/util"
+	"go.uber.org/zap"
+	"io"
+	"strings"
+	"teamide/pkg/background"
+)
+
+const restoreDefaultBatchNumber = 200
+
+// RestoreParam 将 备份 包 恢复 到 目标 库，表 结构 按 目标 方言 生成
+type RestoreParam struct {
+	BackupTaskId    string   `json:"backupTaskId"` // 当前 用户 已 完成 的 备份 任务
+	TargetToolboxId int64    `json:"targetToolboxId"`
+	TargetOwnerName string   `json:"targetOwnerName"`
+	TableNames      []string `json:"tableNames"` // 为 空 恢复 所有 表
+	SkipCreateTable bool     `json:"skipCreateTable"`
+	SkipData        bool     `json:"skipData"`
+	SkipObject      bool     `json:"skipObject"`
+	BatchNumber     int      `json:"batchNumber"`
+	ErrorContinue   bool     `json:"errorContinue"`
+}
+
+type RestoreResult struct {
+	TableCount int      `json:"tableCount"`
+	TableIndex int      `json:"tableIndex"`
+	TableName  string   `json:"tableName"`
+	RowCount   int64    `json:"rowCount"`
+	Objects    int      `json:"objects"`
+	Errors     []string `json:"errors"`
+	Warnings   []string `json:"warnings"`
+}
+
+func (this_ *RestoreResult) Snapshot() interface{} {
+	res := *this_
+	res.Errors = append([]string{}, this_.Errors...)
+	res.Warnings = append([]string{}, this_.Warnings...)
+	return &res
+}
+
+func (this_ *RestoreParam) init() (err error) {
+	if this_.BackupTaskId == "" {
+		err = errors.New("备份任务不能为空")
+		return
+	}
+	if this_.BatchNumber <= 0 {
+		this_.BatchNumber = restoreDefaultBatchNumber
+	}
+	return
+}
+
+type restore struct {
+	*RestoreParam
+	service  db.IService
+	param    *db.Param
+	workDb   *sql.DB
+	filePath string
+	result   *RestoreResult
+	task     *background.Task
+	reader   *zip.ReadCloser
+	manifest *BackupManifest
+	// sameDialect 同 类型 数据库 才 回放 视图、存储 过程 等 对象 DDL
+	sameDialect bool
+}
+
+func newRestore(service db.IService, param *db.Param, workDb *sql.DB, restoreParam *RestoreParam, filePath string) *restore {
+	return &restore{
+		RestoreParam: restoreParam,
+		service:      service,
+		param:        param,
+		workDb:       workDb,
+		filePath:     filePath,
+		result:       &RestoreResult{},
+	}
+}
+
+func (this_ *restore) warn(message string) {
+	util.Logger.Warn("database restore warn", zap.Any("message", message))
+	this_.task.Update(func() {
+		this_.result.Warnings = append(this_.result.Warnings, message)
+	})
+}
+
+// fail 忽略 错误 时 记录 后 继续，否则 中断 任务
+func (this_ *restore) fail(message string, err error) error {
+	if !this_.ErrorContinue {
+		return errors.New(message + ":" + err.Error())
+	}
+	util.Logger.Error("database restore error", zap.Any("message", message), zap.Error(err))
+	this_.task.Update(func() {
+		this_.result.Errors = append(this_.result.Errors, message+":"+err.Error())
+	})
+	return nil
+}
+
+func (this_ *restore) open(name string) (rc io.ReadCloser, err error) {
+	for _, file := range this_.reader.File {
+		if file.Name == name {
+			return file.Open()
+		}
+	}
+	err = errors.New("备份文件[" + name + "]不存在")
+	return
+}
+
+func (this_ *restore) readJSON(name string, value interface{}) (err error) {
+	rc, err := this_.open(name)
+	if err != nil {
+		return
+	}
+	defer func() { _ = rc.Close() }()
+	err = json.NewDecoder(rc).Decode(value)
+	return
+}
+
+// loadManifest 校验 备份 包 并 读取 描述
+func (this_ *restore) loadManifest() (tables map[string]*dialect.TableModel, err error) {
+	this_.reader, err = zip.OpenReader(this_.filePath)
+	if err != nil {
+		err = errors.New("备份文件打开失败:" + err.Error())
+		return
+	}
+	this_.manifest = &BackupManifest{}
+	if err = this_.readJSON(backupManifestFile, this_.manifest); err != nil {
+		return
+	}
+	if this_.manifest.Version <= 0 || this_.manifest.Version > backupVersion {
+		err = fmt.Errorf("备份文件版本[%d]不支持", this_.manifest.Version)
+		return
+	}
+	var list []*dialect.TableModel
+	if err = this_.readJSON(backupTablesFile, &list); err != nil {
+		return
+	}
+	tables = map[string]*dialect.TableModel{}
+	for _, table := range list {
+		tables[compareName(table.TableName)] = table
+	}
+	this_.sameDialect = strings.EqualFold(this_.manifest.DatabaseType, this_.service.GetDialect().DialectType().Name)
+	return
+}
+
+func (this_ *restore) do(task *background.Task) (err error) {
+	this_.task = task
+	defer func() {
+		_ = this_.workDb.Close()
+		if this_.reader != nil {
+			_ = this_.reader.Close()
+		}
+	}()
+
+	tables, err := this_.loadManifest()
+	if err != nil {
+		return
+	}
+	var filter map[string]bool
+	if len(this_.TableNames) > 0 {
+		filter = map[string]bool{}
+		for _, one := range this_.TableNames {
+			filter[compareName(one)] = true
+		}
+	}
+	var backupTables []*BackupTable
+	for _, one := range this_.manifest.Tables {
+		if filter != nil && !filter[compareName(one.TableName)] {
+			continue
+		}
+		if tables[compareName(one.TableName)] == nil {
+			this_.warn("表[" + one.TableName + "]结构不存在，跳过")
+			continue
+		}
+		backupTables = append(backupTables, one)
+	}
+	task.Update(func() {
+		this_.result.TableCount = len(backupTables)
+	})
+	if !this_.SkipObject && !this_.sameDialect {
+		this_.warn("备份数据库类型[" + this_.manifest.DatabaseType + "]与目标不一致，只恢复表结构与数据")
+	}
+
+	// 序列 可能 被 字段 默认值 引用，先于 表 创建
+	if err = this_.restoreObjects(task, true); err != nil {
+		return
+	}
+	for index, backupTable := range backupTables {
+		if task.IsStopped() {
+			return
+		}
+		table := tables[compareName(backupTable.TableName)]
+		task.Update(func() {
+			this_.result.TableIndex = index + 1
+			this_.result.TableName = table.TableName
+		})
+		if !this_.SkipCreateTable {
+			e := worker.TableCreate(this_.workDb, this_.service.GetDialect(), this_.param.ParamModel, this_.TargetOwnerName, table)
+			if e != nil {
+				if err = this_.fail("表["+table.TableName+"]创建失败", e); err != nil {
+					return
+				}
+				continue
+			}
+		}
+		if this_.SkipData {
+			continue
+		}
+		for _, name := range backupTable.Files {
+			if task.IsStopped() {
+				return
+			}
+			if err = this_.restoreFile(table, name); err != nil {
+				return
+			}
+		}
+	}
+	err = this_.restoreObjects(task, false)
+	return
+}
+
+// restoreFile 按 批次 插入 一个 数据 文件
+func (this_ *restore) restoreFile(table *dialect.TableModel, name string) (err error) {
+	rc, err := this_.open(name)
+	if err != nil {
+		return this_.fail("表["+table.TableName+"]数据读取失败", err)
+	}
+	defer func() { _ = rc.Close() }()
+
+	decoder := json.NewDecoder(bufio.NewReader(rc))
+	decoder.UseNumber()
+	var dataList []map[string]interface{}
+	for {
+		var data map[string]interface{}
+		if e := decoder.Decode(&data); e != nil {
+			if e != io.EOF {
+				return this_.fail("表["+table.TableName+"]数据文件["+name+"]解析失败", e)
+			}
+			break
+		}
+		for _, column := range table.ColumnList {
+			if value, ok := data[column.ColumnName]; ok {
+				data[column.ColumnName] = restoreValue(column, value)
+			}
+		}
+		dataList = append(dataList, data)
+		if len(dataList) >= this_.BatchNumber {
+			if err = this_.insert(table, dataList); err != nil {
+				return
+			}
+			dataList = nil
+		}
+	}
+	err = this_.insert(table, dataList)
+	return
+}
+
+func (this_ *restore) insert(table *dialect.TableModel, dataList []map[string]interface{}) (err error) {
+	if len(dataList) == 0 {
+		return
+	}
+	_, _, batchSqlList, batchValuesList, err := this_.service.GetDialect().DataListInsertSql(this_.param.ParamModel, this_.TargetOwnerName, table.TableName, table.ColumnList, dataList)
+	if err != nil {
+		return this_.fail("表["+table.TableName+"]插入语句生成失败", err)
+	}
+	_, errSql, _, err := worker.DoExecs(this_.workDb, batchSqlList, batchValuesList)
+	if err != nil {
+		if errSql != "" {
+			err = errors.New("sql:" + errSql + " exec error," + err.Error())
+		}
+		return this_.fail("表["+table.TableName+"]数据插入失败", err)
+	}
+	this_.task.Update(func() {
+		this_.result.RowCount += int64(len(dataList))
+	})
+	return
+}
+
+func isBinaryType(dataType string) bool {
+	for _, one := range []string{"blob", "binary", "bytea", "raw", "image", "bit"} {
+		if strings.Contains(dataType, one) {
+			return true
+		}
+	}
+	return false
+}
+
+// restoreValue 数字、时间 按 字段 类型 还原，转换 失败 的 按 字符串 插入
+// base64 的 值 还原 为 字节，部分 驱动 文本 字段 也 返回 字节，非 二进制 字段 按 字符串 插入
+func restoreValue(column *dialect.ColumnModel, value interface{}) interface{} {
+	var str string
+	dataType := strings.ToLower(column.ColumnDataType)
+	switch tV := value.(type) {
+	case json.Number:
+		str = tV.String()
+	case string:
+		str = tV
+	case map[string]interface{}:
+		encoded, ok := tV[backupBinaryKey].(string)
+		if !ok {
+			return value
+		}
+		bs, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return encoded
+		}
+		if isBinaryType(dataType) {
+			return bs
+		}
+		str = string(bs)
+	default:
+		return value
+	}
+	if !isNumberType(dataType) && !strings.Contains(dataType, "date") && !strings.Contains(dataType, "time") {
+		return str
+	}
+	if v, err := typedValue(dataType, str); err == nil && v != nil {
+		return v
+	}
+	return str
+}
+
+// restoreObjects 回放 对象 DDL，beforeTable 为 true 时 只 回放 序列，失败 只 记录 警告
+func (this_ *restore) restoreObjects(task *background.Task, beforeTable bool) (err error) {
+	if this_.SkipObject || !this_.sameDialect {
+		return
+	}
+	dia := this_.service.GetDialect()
+	var replaceOwner func(string) string
+	if this_.manifest.OwnerName != "" && this_.TargetOwnerName != "" && this_.manifest.OwnerName != this_.TargetOwnerName {
+		sourcePack := dia.OwnerNamePack(this_.param.ParamModel, this_.manifest.OwnerName) + "."
+		targetPack := dia.OwnerNamePack(this_.param.ParamModel, this_.TargetOwnerName) + "."
+		replaceOwner = func(ddl string) string {
+			return strings.ReplaceAll(ddl, sourcePack, targetPack)
+		}
+	}
+	ctx := context.Background()
+	for _, object := range this_.manifest.Objects {
+		if task.IsStopped() {
+			return
+		}
+		if (object.ObjectType == objectSequence) != beforeTable {
+			continue
+		}
+		var text []byte
+		rc, e := this_.open(object.File)
+		if e == nil {
+			text, e = io.ReadAll(rc)
+			_ = rc.Close()
+		}
+		if e != nil {
+			this_.warn("对象[" + object.ObjectName + "]读取失败:" + e.Error())
+			continue
+		}
+		ddl := strings.TrimSpace(string(text))
+		// Oracle 的 DDL 以 / 结束
+		ddl = strings.TrimSpace(strings.TrimSuffix(ddl, "/"))
+		if ddl == "" {
+			continue
+		}
+		if replaceOwner != nil {
+			ddl = replaceOwner(ddl)
+		}
+		if _, e = this_.workDb.ExecContext(ctx, ddl); e != nil {
+			this_.warn("对象[" + object.ObjectType + ":" + object.ObjectName + "]恢复失败:" + e.Error())
+			continue
+		}
+		task.Update(func() {
+			this_.result.Objects++
+		})
+	}
+	return
+}
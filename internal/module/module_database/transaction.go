@@ -0,0 +1,274 @@
+package module_database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/team-ide/go-tool/db"
+	"github.com/team-ide/go-tool/util"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+)
+
+// transactionIdleTimeout 事务 默认 空闲 超时，超时 自动 回滚
+const transactionIdleTimeout = 5 * time.Minute
+
+// Transaction 工作 窗口 的 事务 会话，多次 executeSQL 共用 同 一 连接
+type Transaction struct {
+	WorkerId     string `json:"workerId"`
+	ToolboxId    int64  `json:"toolboxId"`
+	UserId       int64  `json:"userId"`
+	OwnerName    string `json:"ownerName"`
+	SessionId    string `json:"sessionId"`
+	StartTime    int64  `json:"startTime"`
+	LastTime     int64  `json:"lastTime"`
+	HoldTime     int64  `json:"holdTime"`    // 已 持有 毫秒
+	IdleTime     int64  `json:"idleTime"`    // 已 空闲 毫秒
+	IdleTimeout  int64  `json:"idleTimeout"` // 空闲 超时 毫秒
+	ExecuteCount int    `json:"executeCount"`
+	IsExecuting  bool   `json:"isExecuting"`
+
+	workDb *sql.DB
+	conn   *sql.Conn
+	tx     *sql.Tx
+	timer  *time.Timer
+	lock   sync.Mutex
+	// execLock 同 一 事务 同时 只 执行 一个 请求
+	execLock sync.Mutex
+}
+
+var transactionCache = map[string]*Transaction{}
+
+// transactionBeginning 正在 开启 事务 的 工作 窗口，连接 与 BEGIN 在 锁 外 执行
+var transactionBeginning = map[string]bool{}
+var transactionCacheLock = &sync.Mutex{}
+
+func getTransaction(workerId string) *Transaction {
+	if workerId == "" {
+		return nil
+	}
+	transactionCacheLock.Lock()
+	defer transactionCacheLock.Unlock()
+	return transactionCache[workerId]
+}
+
+// getToolboxTransactions 获取 用户 在 工具 下 打开 的 事务
+func getToolboxTransactions(toolboxId int64, userId int64) (list []*Transaction) {
+	transactionCacheLock.Lock()
+	defer transactionCacheLock.Unlock()
+	for _, one := range transactionCache {
+		if one.ToolboxId == toolboxId && one.UserId == userId {
+			list = append(list, one)
+		}
+	}
+	return
+}
+
+func removeTransaction(transaction *Transaction) {
+	transactionCacheLock.Lock()
+	defer transactionCacheLock.Unlock()
+	if transactionCache[transaction.WorkerId] == transaction {
+		delete(transactionCache, transaction.WorkerId)
+	}
+}
+
+// beginTransaction 新建 连接 并 开启 事务，工作 窗口 已有 事务 时 报错，readOnly 时 开启 只读 事务
+func beginTransaction(service db.IService, param *db.Param, workerId string, toolboxId int64, userId int64, ownerName string, idleTimeout time.Duration, readOnly bool) (transaction *Transaction, err error) {
+	if workerId == "" {
+		err = errors.New("工作窗口不能为空")
+		return
+	}
+	if idleTimeout <= 0 {
+		idleTimeout = transactionIdleTimeout
+	}
+	transactionCacheLock.Lock()
+	if transactionCache[workerId] != nil || transactionBeginning[workerId] {
+		transactionCacheLock.Unlock()
+		err = errors.New("当前窗口已开启事务，请先提交或回滚")
+		return
+	}
+	transactionBeginning[workerId] = true
+	transactionCacheLock.Unlock()
+	defer func() {
+		transactionCacheLock.Lock()
+		defer transactionCacheLock.Unlock()
+		delete(transactionBeginning, workerId)
+		if err == nil {
+			transactionCache[workerId] = transaction
+		}
+	}()
+
+	workDb, err := newWorkDb(service.GetConfig(), param, ownerName)
+	if err != nil {
+		return
+	}
+	ctx := context.Background()
+	conn, err := workDb.Conn(ctx)
+	if err != nil {
+		_ = workDb.Close()
+		return
+	}
+	transaction = &Transaction{
+		WorkerId:    workerId,
+		ToolboxId:   toolboxId,
+		UserId:      userId,
+		OwnerName:   ownerName,
+		StartTime:   util.GetNowMilli(),
+		IdleTimeout: idleTimeout.Milliseconds(),
+		workDb:      workDb,
+		conn:        conn,
+	}
+	transaction.LastTime = transaction.StartTime
+	if sessionSql := getSessionIdSql(service.GetDialect()); sessionSql != "" {
+		var sessionId interface{}
+		if e := conn.QueryRowContext(ctx, sessionSql).Scan(&sessionId); e == nil {
+			transaction.SessionId = util.GetStringValue(sessionId)
+		}
+	}
+	transaction.tx, err = conn.BeginTx(ctx, &sql.TxOptions{ReadOnly: readOnly})
+	if err != nil {
+		transaction.release()
+		return
+	}
+	transaction.timer = time.AfterFunc(idleTimeout, transaction.onIdle)
+	return
+}
+
+// acquire 占用 事务 执行 SQL，返回 的 函数 用于 释放 并 刷新 空闲 时间
+func (this_ *Transaction) acquire() (release func(), err error) {
+	if !this_.execLock.TryLock() {
+		err = errors.New("当前事务正在执行SQL，请稍后")
+		return
+	}
+	this_.lock.Lock()
+	if this_.tx == nil {
+		this_.lock.Unlock()
+		this_.execLock.Unlock()
+		err = errors.New("事务已结束")
+		return
+	}
+	this_.IsExecuting = true
+	this_.ExecuteCount++
+	this_.lock.Unlock()
+
+	release = func() {
+		this_.lock.Lock()
+		this_.IsExecuting = false
+		this_.LastTime = util.GetNowMilli()
+		this_.lock.Unlock()
+		this_.execLock.Unlock()
+	}
+	return
+}
+
+// end 提交 或 回滚 并 释放 连接
+func (this_ *Transaction) end(commit bool) (err error) {
+	if !this_.execLock.TryLock() {
+		err = errors.New("当前事务正在执行SQL，请先取消执行")
+		return
+	}
+	defer this_.execLock.Unlock()
+	err = this_.finish(commit)
+	return
+}
+
+// finish 调用 方 需 持有 execLock
+func (this_ *Transaction) finish(commit bool) (err error) {
+	this_.lock.Lock()
+	tx := this_.tx
+	this_.tx = nil
+	this_.lock.Unlock()
+	if tx == nil {
+		err = errors.New("事务已结束")
+		return
+	}
+	removeTransaction(this_)
+	if commit {
+		err = tx.Commit()
+	} else {
+		err = tx.Rollback()
+	}
+	this_.release()
+	return
+}
+
+func (this_ *Transaction) release() {
+	if this_.timer != nil {
+		this_.timer.Stop()
+	}
+	if this_.conn != nil {
+		_ = this_.conn.Close()
+	}
+	if this_.workDb != nil {
+		_ = this_.workDb.Close()
+	}
+}
+
+// onIdle 空闲 超时 自动 回滚，执行 中 或 未 到 时间 的 重新 计时
+func (this_ *Transaction) onIdle() {
+	timeout := time.Duration(this_.IdleTimeout) * time.Millisecond
+	if !this_.execLock.TryLock() {
+		this_.timer.Reset(timeout)
+		return
+	}
+	defer this_.execLock.Unlock()
+
+	this_.lock.Lock()
+	if this_.tx == nil {
+		this_.lock.Unlock()
+		return
+	}
+	idle := time.Duration(util.GetNowMilli()-this_.LastTime) * time.Millisecond
+	if idle < timeout {
+		this_.timer.Reset(timeout - idle)
+		this_.lock.Unlock()
+		return
+	}
+	this_.lock.Unlock()
+
+	err := this_.finish(false)
+	if err != nil {
+		util.Logger.Warn("transaction idle rollback error", zap.Any("workerId", this_.WorkerId), zap.Error(err))
+		return
+	}
+	util.Logger.Info("transaction idle rollback", zap.Any("workerId", this_.WorkerId), zap.Any("idleTimeout", timeout))
+}
+
+// info 复制 一份 状态，计算 持有、空闲 时间
+func (this_ *Transaction) info() *Transaction {
+	this_.lock.Lock()
+	defer this_.lock.Unlock()
+	now := util.GetNowMilli()
+	res := &Transaction{
+		WorkerId:     this_.WorkerId,
+		ToolboxId:    this_.ToolboxId,
+		UserId:       this_.UserId,
+		OwnerName:    this_.OwnerName,
+		SessionId:    this_.SessionId,
+		StartTime:    this_.StartTime,
+		LastTime:     this_.LastTime,
+		HoldTime:     now - this_.StartTime,
+		IdleTimeout:  this_.IdleTimeout,
+		ExecuteCount: this_.ExecuteCount,
+		IsExecuting:  this_.IsExecuting,
+	}
+	if !this_.IsExecuting {
+		res.IdleTime = now - this_.LastTime
+	}
+	return res
+}
+
+// closeWorkerTransaction 关闭 工作 窗口 时 回滚 未 结束 的 事务
+func closeWorkerTransaction(workerId string) {
+	transaction := getTransaction(workerId)
+	if transaction == nil {
+		return
+	}
+	// 执行 中 的 SQL 已 取消，等待 结束 后 回滚
+	transaction.execLock.Lock()
+	defer transaction.execLock.Unlock()
+	if err := transaction.finish(false); err != nil {
+		util.Logger.Warn("transaction close rollback error", zap.Any("workerId", workerId), zap.Error(err))
+	}
+}
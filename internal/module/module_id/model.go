@@ -63,4 +63,9 @@ const (
 	IDTypeTerminalLog = 8001
 	// IDTypeTerminalCommand 控制台命令
 	IDTypeTerminalCommand = 8002
+
+	// IDTypeDatabaseSqlHistory 数据库SQL执行历史
+	IDTypeDatabaseSqlHistory = 9001
+	// IDTypeDatabaseSqlQuery 数据库保存的SQL
+	IDTypeDatabaseSqlQuery = 9002
 )
@@ -1,11 +1,14 @@
 package module_kafka
 
 import (
+	"errors"
+	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/team-ide/go-tool/kafka"
 	"github.com/team-ide/go-tool/util"
 	"go.uber.org/zap"
 	"teamide/internal/module/module_toolbox"
+	"teamide/pkg/background"
 	"teamide/pkg/base"
 )
 
@@ -42,6 +45,27 @@ var (
 	groupDeleteOffsets = base.AppendPower(&base.PowerAction{Action: "deleteOffsets", Text: "删除组Offsets", ShouldLogin: true, StandAlone: true, Parent: group})
 	groupDelete        = base.AppendPower(&base.PowerAction{Action: "delete", Text: "删除组", ShouldLogin: true, StandAlone: true, Parent: group})
 
+	searchPower     = base.AppendPower(&base.PowerAction{Action: "search", Text: "Kafka消息搜索", ShouldLogin: true, StandAlone: true, Parent: Power})
+	replayPower     = base.AppendPower(&base.PowerAction{Action: "replay", Text: "Kafka消息回放", ShouldLogin: true, StandAlone: true, Parent: Power})
+	taskStatusPower = base.AppendPower(&base.PowerAction{Action: "taskStatus", Text: "Kafka任务状态", ShouldLogin: true, StandAlone: true, Parent: Power})
+	taskStopPower   = base.AppendPower(&base.PowerAction{Action: "taskStop", Text: "Kafka任务停止", ShouldLogin: true, StandAlone: true, Parent: Power})
+	taskCleanPower  = base.AppendPower(&base.PowerAction{Action: "taskClean", Text: "Kafka任务清理", ShouldLogin: true, StandAlone: true, Parent: Power})
+
+	lagStartPower   = base.AppendPower(&base.PowerAction{Action: "lagStart", Text: "Kafka积压采样启动", ShouldLogin: true, StandAlone: true, Parent: Power})
+	lagStopPower    = base.AppendPower(&base.PowerAction{Action: "lagStop", Text: "Kafka积压采样停止", ShouldLogin: true, StandAlone: true, Parent: Power})
+	lagCleanPower   = base.AppendPower(&base.PowerAction{Action: "lagClean", Text: "Kafka积压采样清理", ShouldLogin: true, StandAlone: true, Parent: Power})
+	lagStatusPower  = base.AppendPower(&base.PowerAction{Action: "lagStatus", Text: "Kafka积压状态", ShouldLogin: true, StandAlone: true, Parent: Power})
+	lagHistoryPower = base.AppendPower(&base.PowerAction{Action: "lagHistory", Text: "Kafka积压历史", ShouldLogin: true, StandAlone: true, Parent: Power})
+
+	tailPower          = base.AppendPower(&base.PowerAction{Action: "tail", Text: "Kafka实时查看", ShouldLogin: true, StandAlone: true, Parent: Power})
+	tailWebsocketPower = base.AppendPower(&base.PowerAction{Action: "websocket", Text: "Kafka实时查看WebSocket", ShouldLogin: true, StandAlone: true, Parent: tailPower})
+	tailPausePower     = base.AppendPower(&base.PowerAction{Action: "pause", Text: "Kafka实时查看暂停", ShouldLogin: true, StandAlone: true, Parent: tailPower})
+	tailResumePower    = base.AppendPower(&base.PowerAction{Action: "resume", Text: "Kafka实时查看恢复", ShouldLogin: true, StandAlone: true, Parent: tailPower})
+	tailMessagesPower  = base.AppendPower(&base.PowerAction{Action: "messages", Text: "Kafka实时查看消息", ShouldLogin: true, StandAlone: true, Parent: tailPower})
+	tailCleanPower     = base.AppendPower(&base.PowerAction{Action: "clean", Text: "Kafka实时查看消息清理", ShouldLogin: true, StandAlone: true, Parent: tailPower})
+	tailStatusPower    = base.AppendPower(&base.PowerAction{Action: "status", Text: "Kafka实时查看状态", ShouldLogin: true, StandAlone: true, Parent: tailPower})
+	tailClosePower     = base.AppendPower(&base.PowerAction{Action: "close", Text: "Kafka实时查看关闭", ShouldLogin: true, StandAlone: true, Parent: tailPower})
+
 	closePower = base.AppendPower(&base.PowerAction{Action: "close", Text: "Kafka关闭", ShouldLogin: true, StandAlone: true, Parent: Power})
 )
 
@@ -66,6 +90,26 @@ func (this_ *api) GetApis() (apis []*base.ApiWorker) {
 	apis = append(apis, &base.ApiWorker{Power: groupDeleteOffsets, Do: this_.groupDeleteOffsets})
 	apis = append(apis, &base.ApiWorker{Power: groupDelete, Do: this_.groupDelete})
 
+	apis = append(apis, &base.ApiWorker{Power: searchPower, Do: this_.search})
+	apis = append(apis, &base.ApiWorker{Power: replayPower, Do: this_.replay})
+	apis = append(apis, &base.ApiWorker{Power: taskStatusPower, Do: this_.taskStatus, NotRecodeLog: true})
+	apis = append(apis, &base.ApiWorker{Power: taskStopPower, Do: this_.taskStop})
+	apis = append(apis, &base.ApiWorker{Power: taskCleanPower, Do: this_.taskClean})
+
+	apis = append(apis, &base.ApiWorker{Power: lagStartPower, Do: this_.lagStart})
+	apis = append(apis, &base.ApiWorker{Power: lagStopPower, Do: this_.lagStop})
+	apis = append(apis, &base.ApiWorker{Power: lagCleanPower, Do: this_.lagClean})
+	apis = append(apis, &base.ApiWorker{Power: lagStatusPower, Do: this_.lagStatus, NotRecodeLog: true})
+	apis = append(apis, &base.ApiWorker{Power: lagHistoryPower, Do: this_.lagHistory, NotRecodeLog: true})
+
+	apis = append(apis, &base.ApiWorker{Power: tailWebsocketPower, Do: this_.tailWebsocket, IsWebSocket: true})
+	apis = append(apis, &base.ApiWorker{Power: tailPausePower, Do: this_.tailPause})
+	apis = append(apis, &base.ApiWorker{Power: tailResumePower, Do: this_.tailResume})
+	apis = append(apis, &base.ApiWorker{Power: tailMessagesPower, Do: this_.tailMessages, NotRecodeLog: true})
+	apis = append(apis, &base.ApiWorker{Power: tailCleanPower, Do: this_.tailClean})
+	apis = append(apis, &base.ApiWorker{Power: tailStatusPower, Do: this_.tailStatus, NotRecodeLog: true})
+	apis = append(apis, &base.ApiWorker{Power: tailClosePower, Do: this_.tailClose})
+
 	apis = append(apis, &base.ApiWorker{Power: closePower, Do: this_.close})
 
 	return
@@ -80,8 +124,32 @@ func (this_ *api) getConfig(requestBean *base.RequestBean, c *gin.Context) (conf
 	return
 }
 
-func getService(kafkaConfig *kafka.Config) (res kafka.IService, err error) {
-	key := "kafka-" + kafkaConfig.Address
+// getConfigById 获取 回放 目标 等 其它 工具 的 配置
+func (this_ *api) getConfigById(requestBean *base.RequestBean, toolboxId int64) (config *kafka.Config, err error) {
+	find, err := this_.toolboxService.Get(toolboxId)
+	if err != nil {
+		return
+	}
+	if find == nil {
+		err = errors.New(fmt.Sprintf("toolbox[%d]不存在", toolboxId))
+		return
+	}
+	if find.ToolboxType != "kafka" {
+		err = errors.New(fmt.Sprintf("toolbox[%d]不是Kafka工具", toolboxId))
+		return
+	}
+	err = this_.toolboxService.CheckToolboxPower(requestBean, find)
+	if err != nil {
+		return
+	}
+	config = &kafka.Config{}
+	_, err = this_.toolboxService.BindConfigByOption(find.Option, config, nil)
+	return
+}
+
+// serviceKey 按 地址 与 认证 信息 区分 连接
+func serviceKey(kafkaConfig *kafka.Config) (key string) {
+	key = "kafka-" + kafkaConfig.Address
 	if kafkaConfig.Username != "" {
 		key += "-" + base.GetMd5String(key+kafkaConfig.Username)
 	}
@@ -91,6 +159,11 @@ func getService(kafkaConfig *kafka.Config) (res kafka.IService, err error) {
 	if kafkaConfig.CertPath != "" {
 		key += "-" + base.GetMd5String(key+kafkaConfig.CertPath)
 	}
+	return
+}
+
+func getService(kafkaConfig *kafka.Config) (res kafka.IService, err error) {
+	key := serviceKey(kafkaConfig)
 	var serviceInfo *base.ServiceInfo
 	serviceInfo, err = base.GetService(key, func() (res *base.ServiceInfo, err error) {
 		var s kafka.IService
@@ -142,6 +215,12 @@ type BaseRequest struct {
 	Count     int32  `json:"count"`
 	KeyType   string `json:"keyType"`
 	ValueType string `json:"valueType"`
+
+	WorkerId  string `json:"workerId"`
+	TaskId    string `json:"taskId"`
+	FromIndex int    `json:"fromIndex"` // 搜索 结果 增量 查询 的 起始 下标
+
+	GrowingPoints int `json:"growingPoints"` // 最近 多少 次 采样 持续 增长 视为 积压，积压 历史 按 Time 增量 查询
 }
 
 func (this_ *api) check(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
@@ -277,6 +356,15 @@ func (this_ *api) pull(requestBean *base.RequestBean, c *gin.Context) (res inter
 		return
 	}
 
+	// schema 类型 需要 原始 字节，不 使用 go-tool 的 拉取
+	if isSchemaType(request.KeyType) || isSchemaType(request.ValueType) {
+		var messageCodec *messageCodec
+		if messageCodec, err = this_.newMessageCodec(requestBean, request.KeyType, request.ValueType); err != nil {
+			return
+		}
+		res, err = pullMessages(service, request.GroupId, request.Topic, request.PullSize, request.PullTimeout, messageCodec)
+		return
+	}
 	res, err = service.Pull(request.GroupId, []string{request.Topic}, request.PullSize, request.PullTimeout, request.KeyType, request.ValueType)
 	if err != nil {
 		return
@@ -298,6 +386,13 @@ func (this_ *api) push(requestBean *base.RequestBean, c *gin.Context) (res inter
 	if !base.RequestJSON(request, c) {
 		return
 	}
+	pushSchema := &PushSchema{}
+	if !base.RequestJSON(pushSchema, c) {
+		return
+	}
+	if err = this_.encodeMessage(requestBean, request, pushSchema); err != nil {
+		return
+	}
 
 	err = service.Push(request)
 	if err != nil {
@@ -535,5 +630,11 @@ func (this_ *api) groupDescribe(requestBean *base.RequestBean, c *gin.Context) (
 
 func (this_ *api) close(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
 
+	var request = &BaseRequest{}
+	if !base.RequestJSON(request, c) {
+		return
+	}
+
+	background.RemoveWorkerTasks(request.WorkerId)
 	return
 }
@@ -0,0 +1,100 @@
+package module_kafka
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"teamide/pkg/base"
+)
+
+// lagStart 启动 消费 积压 采样，关闭 页面 后 继续 采样
+func (this_ *api) lagStart(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	config, err := this_.getConfig(requestBean, c)
+	if err != nil {
+		return
+	}
+	_, err = getService(config)
+	if err != nil {
+		return
+	}
+
+	param := &LagMonitorParam{}
+	if !base.RequestJSON(param, c) {
+		return
+	}
+	if err = param.init(); err != nil {
+		return
+	}
+
+	res, err = startLagMonitor(config, param)
+	return
+}
+
+func (this_ *api) lagStop(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	config, err := this_.getConfig(requestBean, c)
+	if err != nil {
+		return
+	}
+
+	one := getLagMonitor(config)
+	if one != nil {
+		one.stop()
+	}
+	return
+}
+
+func (this_ *api) lagClean(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	config, err := this_.getConfig(requestBean, c)
+	if err != nil {
+		return
+	}
+
+	removeLagMonitor(config)
+	return
+}
+
+// lagStatus 各 组 最新 积压，积压 持续 增长 或 停止 消费 的 组 排 在 前面
+func (this_ *api) lagStatus(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	config, err := this_.getConfig(requestBean, c)
+	if err != nil {
+		return
+	}
+
+	request := &BaseRequest{}
+	if !base.RequestJSON(request, c) {
+		return
+	}
+	growingPoints := request.GrowingPoints
+	if growingPoints <= 0 {
+		growingPoints = lagDefaultGrowingPoints
+	}
+
+	one := getLagMonitor(config)
+	if one != nil {
+		res = one.info(growingPoints)
+	}
+	return
+}
+
+func (this_ *api) lagHistory(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	config, err := this_.getConfig(requestBean, c)
+	if err != nil {
+		return
+	}
+
+	request := &BaseRequest{}
+	if !base.RequestJSON(request, c) {
+		return
+	}
+	if request.GroupId == "" {
+		err = errors.New("组不能为空")
+		return
+	}
+
+	one := getLagMonitor(config)
+	if one == nil {
+		err = errors.New("积压采样未启动")
+		return
+	}
+	res = one.historyOf(request.GroupId, request.Time)
+	return
+}
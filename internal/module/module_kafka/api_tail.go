@@ -0,0 +1,216 @@
+package module_kafka
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/team-ide/go-tool/kafka"
+	"github.com/team-ide/go-tool/util"
+	"go.uber.org/zap"
+	"strconv"
+	"strings"
+	"teamide/pkg/base"
+)
+
+// getWebsocketConfig websocket 请求 无 请求体，从 query 中 获取 toolboxId 并 校验 权限
+func (this_ *api) getWebsocketConfig(requestBean *base.RequestBean, c *gin.Context) (config *kafka.Config, err error) {
+	toolboxId, _ := strconv.ParseInt(c.Query("toolboxId"), 10, 64)
+	if toolboxId == 0 {
+		err = errors.New("toolboxId获取失败")
+		return
+	}
+	if config, err = this_.getConfigById(requestBean, toolboxId); err != nil {
+		return
+	}
+	// schema 解码 从 绑定 的 工具 中 读取 配置
+	find, err := this_.toolboxService.Get(toolboxId)
+	if err != nil {
+		return
+	}
+	requestBean.SetExtend("toolboxModel", find)
+	return
+}
+
+// getTailParam 从 query 中 获取 参数，分区 以 逗号 分隔
+func getTailParam(c *gin.Context) (param *TailParam, err error) {
+	param = &TailParam{
+		Topic:     c.Query("topic"),
+		From:      c.Query("from"),
+		KeyType:   c.Query("keyType"),
+		ValueType: c.Query("valueType"),
+	}
+	if param.Topic == "" {
+		err = errors.New("topic不能为空")
+		return
+	}
+	for _, one := range strings.Split(c.Query("partitions"), ",") {
+		one = strings.TrimSpace(one)
+		if one == "" {
+			continue
+		}
+		var partition int64
+		if partition, err = strconv.ParseInt(one, 10, 32); err != nil {
+			err = errors.New("分区[" + one + "]格式错误")
+			return
+		}
+		param.Partitions = append(param.Partitions, int32(partition))
+	}
+	switch param.From {
+	case "":
+		param.From = tailFromLatest
+	case tailFromLatest, tailFromEarliest:
+	case tailFromTime:
+		if param.Time, _ = strconv.ParseInt(c.Query("time"), 10, 64); param.Time <= 0 {
+			err = errors.New("开始时间不能为空")
+			return
+		}
+	default:
+		err = errors.New("开始位置[" + param.From + "]不支持")
+	}
+	return
+}
+
+// getTailWorker 获取 当前用户 的 实时 查看 会话
+func (this_ *api) getTailWorker(requestBean *base.RequestBean, workerId string) (worker *tailWorker, err error) {
+	worker = getTailWorker(workerId)
+	if worker == nil {
+		err = errors.New("实时查看会话[" + workerId + "]不存在")
+		return
+	}
+	if requestBean.JWT == nil || requestBean.JWT.UserId != worker.userId {
+		worker = nil
+		err = errors.New("实时查看会话[" + workerId + "]不属于当前用户")
+		return
+	}
+	return
+}
+
+func (this_ *api) tailWebsocket(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	if requestBean.JWT == nil || requestBean.JWT.UserId == 0 {
+		err = errors.New("登录用户获取失败")
+		return
+	}
+	workerId := c.Query("workerId")
+	if workerId == "" {
+		err = errors.New("workerId获取失败")
+		return
+	}
+	bufferSize, _ := strconv.Atoi(c.Query("bufferSize"))
+
+	param, err := getTailParam(c)
+	if err != nil {
+		return
+	}
+	config, err := this_.getWebsocketConfig(requestBean, c)
+	if err != nil {
+		return
+	}
+	service, err := getService(config)
+	if err != nil {
+		return
+	}
+	messageCodec, err := this_.newMessageCodec(requestBean, param.KeyType, param.ValueType)
+	if err != nil {
+		return
+	}
+
+	//升级get请求为webSocket协议
+	ws, err := upGrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		return
+	}
+
+	client, err := service.GetClient()
+	if err == nil {
+		err = startTailWorker(client, param, messageCodec, workerId, requestBean.JWT.UserId, bufferSize, ws)
+	}
+	if err != nil {
+		_ = ws.WriteJSON(&TailMessage{Type: "error", Error: "start error:" + err.Error()})
+		util.Logger.Error("kafka tail websocket start error", zap.Error(err))
+		_ = ws.Close()
+		return
+	}
+
+	res = base.HttpNotResponse
+	return
+}
+
+func (this_ *api) tailPause(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	request := &BaseRequest{}
+	if !base.RequestJSON(request, c) {
+		return
+	}
+	worker, err := this_.getTailWorker(requestBean, request.WorkerId)
+	if err != nil {
+		return
+	}
+	worker.pause()
+	res = worker.status()
+	return
+}
+
+func (this_ *api) tailResume(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	request := &BaseRequest{}
+	if !base.RequestJSON(request, c) {
+		return
+	}
+	worker, err := this_.getTailWorker(requestBean, request.WorkerId)
+	if err != nil {
+		return
+	}
+	worker.doResume()
+	res = worker.status()
+	return
+}
+
+func (this_ *api) tailMessages(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	request := &BaseRequest{}
+	if !base.RequestJSON(request, c) {
+		return
+	}
+	worker, err := this_.getTailWorker(requestBean, request.WorkerId)
+	if err != nil {
+		return
+	}
+	res = worker.messages()
+	return
+}
+
+func (this_ *api) tailClean(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	request := &BaseRequest{}
+	if !base.RequestJSON(request, c) {
+		return
+	}
+	worker, err := this_.getTailWorker(requestBean, request.WorkerId)
+	if err != nil {
+		return
+	}
+	worker.clean()
+	res = worker.status()
+	return
+}
+
+func (this_ *api) tailStatus(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	request := &BaseRequest{}
+	if !base.RequestJSON(request, c) {
+		return
+	}
+	worker, err := this_.getTailWorker(requestBean, request.WorkerId)
+	if err != nil {
+		return
+	}
+	res = worker.status()
+	return
+}
+
+func (this_ *api) tailClose(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	request := &BaseRequest{}
+	if !base.RequestJSON(request, c) {
+		return
+	}
+	_, err = this_.getTailWorker(requestBean, request.WorkerId)
+	if err != nil {
+		return
+	}
+	stopTailWorker(request.WorkerId)
+	return
+}
@@ -0,0 +1,180 @@
+package module_kafka
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/team-ide/go-tool/kafka"
+	"teamide/pkg/background"
+	"teamide/pkg/base"
+)
+
+// taskTypes 本 模块 的 任务 类型，taskStatus、taskStop、taskClean 只 处理 当前 用户 的 这些 任务
+var taskTypes = []string{"search", "replay"}
+
+func getRequestUserId(requestBean *base.RequestBean) (userId int64) {
+	if requestBean.JWT != nil {
+		userId = requestBean.JWT.UserId
+	}
+	return
+}
+
+// search 扫描 分区 搜索 消息，结果 通过 taskStatus 增量 获取
+func (this_ *api) search(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	config, err := this_.getConfig(requestBean, c)
+	if err != nil {
+		return
+	}
+	service, err := getService(config)
+	if err != nil {
+		return
+	}
+
+	request := &BaseRequest{}
+	if !base.RequestJSON(request, c) {
+		return
+	}
+	param := &SearchParam{}
+	if !base.RequestJSON(param, c) {
+		return
+	}
+	if err = param.init(); err != nil {
+		return
+	}
+
+	messageCodec, err := this_.newMessageCodec(requestBean, param.KeyType, param.ValueType)
+	if err != nil {
+		return
+	}
+
+	client, err := service.GetClient()
+	if err != nil {
+		return
+	}
+	result := &SearchResult{}
+	task := background.NewTask("search", func(task *background.Task) (err error) {
+		defer func() { _ = client.Close() }()
+		return doSearch(task, client, param, messageCodec, result)
+	})
+	task.Result = result
+	task.UserId = getRequestUserId(requestBean)
+	background.StartTask(task)
+	background.AddWorkerTask(request.WorkerId, task.TaskId)
+
+	res = task.Info()
+	return
+}
+
+// replay 回放 范围 内 的 消息 到 目标 topic，进度 通过 taskStatus 获取
+func (this_ *api) replay(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	config, err := this_.getConfig(requestBean, c)
+	if err != nil {
+		return
+	}
+	service, err := getService(config)
+	if err != nil {
+		return
+	}
+
+	request := &BaseRequest{}
+	if !base.RequestJSON(request, c) {
+		return
+	}
+	param := &ReplayParam{}
+	if !base.RequestJSON(param, c) {
+		return
+	}
+	if err = param.init(); err != nil {
+		return
+	}
+
+	targetService := service
+	if param.TargetToolboxId > 0 {
+		var targetConfig *kafka.Config
+		if targetConfig, err = this_.getConfigById(requestBean, param.TargetToolboxId); err != nil {
+			return
+		}
+		if serviceKey(targetConfig) != serviceKey(config) {
+			if targetService, err = getService(targetConfig); err != nil {
+				return
+			}
+		}
+	}
+	if targetService == service && param.TargetTopic == param.Topic {
+		err = errors.New("同一集群回放时目标topic不能与源topic相同")
+		return
+	}
+
+	replay, err := newReplay(param)
+	if err != nil {
+		return
+	}
+
+	client, err := service.GetClient()
+	if err != nil {
+		return
+	}
+	producer, err := targetService.NewSyncProducer()
+	if err != nil {
+		_ = client.Close()
+		return
+	}
+	result := &ReplayResult{}
+	task := background.NewTask("replay", func(task *background.Task) (err error) {
+		defer func() {
+			_ = producer.Close()
+			_ = client.Close()
+		}()
+		return replay.do(task, client, producer, result)
+	})
+	task.Result = result
+	task.UserId = getRequestUserId(requestBean)
+	background.StartTask(task)
+	background.AddWorkerTask(request.WorkerId, task.TaskId)
+
+	res = task.Info()
+	return
+}
+
+func (this_ *api) taskStatus(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+
+	var request = &BaseRequest{}
+	if !base.RequestJSON(request, c) {
+		return
+	}
+
+	task := background.GetUserTask(request.TaskId, getRequestUserId(requestBean), taskTypes...)
+	if task != nil {
+		info := task.Info()
+		if result, ok := info.Result.(*SearchResult); ok {
+			info.Result = result.since(request.FromIndex)
+		}
+		res = info
+	}
+	return
+}
+
+func (this_ *api) taskStop(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+
+	var request = &BaseRequest{}
+	if !base.RequestJSON(request, c) {
+		return
+	}
+
+	if task := background.GetUserTask(request.TaskId, getRequestUserId(requestBean), taskTypes...); task != nil {
+		task.Stop()
+	}
+	return
+}
+
+func (this_ *api) taskClean(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+
+	var request = &BaseRequest{}
+	if !base.RequestJSON(request, c) {
+		return
+	}
+
+	if task := background.GetUserTask(request.TaskId, getRequestUserId(requestBean), taskTypes...); task != nil {
+		background.ClearTask(task.TaskId)
+	}
+	return
+}
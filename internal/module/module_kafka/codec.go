@@ -0,0 +1,190 @@
+package module_kafka
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/Shopify/sarama"
+	"github.com/team-ide/go-tool/kafka"
+	"strings"
+	"teamide/internal/module/module_toolbox"
+	"teamide/pkg/base"
+	"teamide/pkg/codec"
+)
+
+// KeyType、ValueType 中 使用 schema registry 的 类型，其它 类型 仍 由 go-tool 处理
+const (
+	typeAvro       = "avro"
+	typeProtobuf   = "protobuf"
+	typeJSONSchema = "jsonSchema"
+)
+
+var schemaTypes = map[string]string{
+	typeAvro:       codec.SchemaTypeAvro,
+	typeProtobuf:   codec.SchemaTypeProtobuf,
+	typeJSONSchema: codec.SchemaTypeJSON,
+}
+
+func isSchemaType(t string) bool {
+	_, ok := schemaTypes[t]
+	return ok
+}
+
+// SchemaConfig 工具 配置 中 的 schema 来源，地址 与 目录 都 配置 时 使用 地址
+type SchemaConfig struct {
+	SchemaRegistryUrl      string `json:"schemaRegistryUrl"`
+	SchemaRegistryUsername string `json:"schemaRegistryUsername"`
+	SchemaRegistryPassword string `json:"schemaRegistryPassword"`
+	SchemaDir              string `json:"schemaDir"` // 服务端 目录，文件 名 为 [subject.]id.avsc|proto|json
+}
+
+// Message 在 消息 基础 上 增加 schema 解码 信息，解码 失败 时 保留 原始 内容
+type Message struct {
+	*kafka.Message
+	KeySchemaId   int    `json:"keySchemaId,omitempty"`
+	ValueSchemaId int    `json:"valueSchemaId,omitempty"`
+	KeyError      string `json:"keyError,omitempty"`
+	ValueError    string `json:"valueError,omitempty"`
+}
+
+// PushSchema 推送 时 的 schema，未 指定 id 时 按 TopicNameStrategy 使用 {topic}-key、{topic}-value 的 最新 版本
+type PushSchema struct {
+	KeySchemaId      int    `json:"keySchemaId"`
+	KeySubject       string `json:"keySubject"`
+	KeyMessageType   string `json:"keyMessageType"` // protobuf 消息 全名，为 空 使用 第一 个 消息
+	ValueSchemaId    int    `json:"valueSchemaId"`
+	ValueSubject     string `json:"valueSubject"`
+	ValueMessageType string `json:"valueMessageType"`
+}
+
+// getRegistry 只 在 使用 schema 类型 时 读取 配置
+func (this_ *api) getRegistry(requestBean *base.RequestBean) (registry *codec.SchemaRegistry, err error) {
+	config := &SchemaConfig{}
+	if v := requestBean.GetExtend("toolboxModel"); v != nil {
+		if option := v.(*module_toolbox.ToolboxModel).Option; option != "" {
+			if err = json.Unmarshal([]byte(option), config); err != nil {
+				return
+			}
+		}
+	}
+	if config.SchemaRegistryUrl == "" && config.SchemaDir == "" {
+		err = errors.New("未配置Schema Registry地址或Schema目录")
+		return
+	}
+	registry, err = codec.GetSchemaRegistry(&codec.RegistryConfig{
+		Url:      config.SchemaRegistryUrl,
+		Username: config.SchemaRegistryUsername,
+		Password: this_.toolboxService.DecryptOptionAttr(config.SchemaRegistryPassword),
+		Dir:      config.SchemaDir,
+	})
+	return
+}
+
+// messageCodec 将 消费 到 的 消息 转换 为 页面 消息
+type messageCodec struct {
+	registry  *codec.SchemaRegistry
+	keyType   string
+	valueType string
+}
+
+func (this_ *api) newMessageCodec(requestBean *base.RequestBean, keyType string, valueType string) (res *messageCodec, err error) {
+	res = &messageCodec{
+		keyType:   keyType,
+		valueType: valueType,
+	}
+	if isSchemaType(keyType) || isSchemaType(valueType) {
+		res.registry, err = this_.getRegistry(requestBean)
+	}
+	return
+}
+
+// toMessage 保留 时间戳，schema 类型 的 key、value 解码 为 JSON
+func (this_ *messageCodec) toMessage(consumerMessage *sarama.ConsumerMessage) (msg *Message, err error) {
+	keyType, valueType := this_.keyType, this_.valueType
+	if isSchemaType(keyType) {
+		keyType = ""
+	}
+	if isSchemaType(valueType) {
+		valueType = ""
+	}
+	one, err := kafka.ConsumerMessageToMessage(keyType, valueType, consumerMessage)
+	if err != nil {
+		return
+	}
+	timestamp := consumerMessage.Timestamp
+	one.Timestamp = &timestamp
+	msg = &Message{Message: one}
+	if isSchemaType(this_.keyType) && len(consumerMessage.Key) > 0 {
+		msg.Key, msg.KeySchemaId, msg.KeyError = this_.decode(consumerMessage.Key, msg.Key)
+	}
+	if isSchemaType(this_.valueType) && len(consumerMessage.Value) > 0 {
+		msg.Value, msg.ValueSchemaId, msg.ValueError = this_.decode(consumerMessage.Value, msg.Value)
+	}
+	return
+}
+
+func (this_ *messageCodec) decode(value []byte, raw string) (text string, schemaId int, decodeError string) {
+	bs, schema, err := this_.registry.Decode(value)
+	if schema != nil {
+		schemaId = schema.Id
+	}
+	if err != nil {
+		return raw, schemaId, err.Error()
+	}
+	return string(bs), schemaId, ""
+}
+
+// encodeMessage 将 页面 编辑 的 JSON 按 schema 编码，编码 后 按 原始 字节 推送
+func (this_ *api) encodeMessage(requestBean *base.RequestBean, msg *kafka.Message, pushSchema *PushSchema) (err error) {
+	if !isSchemaType(msg.KeyType) && !isSchemaType(msg.ValueType) {
+		return
+	}
+	registry, err := this_.getRegistry(requestBean)
+	if err != nil {
+		return
+	}
+	if isSchemaType(msg.KeyType) && msg.Key != "" {
+		subject := pushSchema.KeySubject
+		if subject == "" {
+			subject = msg.Topic + "-key"
+		}
+		if msg.Key, err = encodeValue(registry, msg.KeyType, pushSchema.KeySchemaId, subject, pushSchema.KeyMessageType, msg.Key); err != nil {
+			err = errors.New("key编码失败:" + err.Error())
+			return
+		}
+		msg.KeyType = ""
+	}
+	if isSchemaType(msg.ValueType) && msg.Value != "" {
+		subject := pushSchema.ValueSubject
+		if subject == "" {
+			subject = msg.Topic + "-value"
+		}
+		if msg.Value, err = encodeValue(registry, msg.ValueType, pushSchema.ValueSchemaId, subject, pushSchema.ValueMessageType, msg.Value); err != nil {
+			err = errors.New("value编码失败:" + err.Error())
+			return
+		}
+		msg.ValueType = ""
+	}
+	return
+}
+
+func encodeValue(registry *codec.SchemaRegistry, valueType string, schemaId int, subject string, messageType string, value string) (res string, err error) {
+	var schema *codec.Schema
+	if schemaId > 0 {
+		schema, err = registry.GetById(schemaId)
+	} else {
+		schema, err = registry.GetLatest(subject)
+	}
+	if err != nil {
+		return
+	}
+	if !strings.EqualFold(schema.GetSchemaType(), schemaTypes[valueType]) {
+		err = errors.New("schema类型[" + schema.GetSchemaType() + "]与[" + valueType + "]不一致")
+		return
+	}
+	bs, err := registry.Encode(schema, []byte(value), messageType)
+	if err != nil {
+		return
+	}
+	res = string(bs)
+	return
+}
@@ -0,0 +1,107 @@
+package module_kafka
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// jsonPathStep 路径 的 一 段，name 为 * 表示 所有 子 节点
+type jsonPathStep struct {
+	name    string
+	index   int
+	isIndex bool
+}
+
+// parseJSONPath 解析 JSONPath 子集：$.a.b、$['a']、$.list[0]、$.list[*].id
+func parseJSONPath(path string) (steps []*jsonPathStep, err error) {
+	path = strings.TrimSpace(path)
+	if !strings.HasPrefix(path, "$") {
+		err = errors.New("JSONPath[" + path + "]需要以$开头")
+		return
+	}
+	rest := path[1:]
+	for rest != "" {
+		switch {
+		case strings.HasPrefix(rest, "."):
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			if end == 0 {
+				err = errors.New("JSONPath[" + path + "]格式错误")
+				return
+			}
+			steps = append(steps, &jsonPathStep{name: rest[:end]})
+			rest = rest[end:]
+		case strings.HasPrefix(rest, "["):
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				err = errors.New("JSONPath[" + path + "]缺少]")
+				return
+			}
+			inner := strings.TrimSpace(rest[1:end])
+			rest = rest[end+1:]
+			if inner == "*" {
+				steps = append(steps, &jsonPathStep{name: "*"})
+			} else if len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0] {
+				steps = append(steps, &jsonPathStep{name: inner[1 : len(inner)-1]})
+			} else {
+				var index int
+				if index, err = strconv.Atoi(inner); err != nil {
+					err = errors.New("JSONPath[" + path + "]下标[" + inner + "]错误")
+					return
+				}
+				steps = append(steps, &jsonPathStep{index: index, isIndex: true})
+			}
+		default:
+			err = errors.New("JSONPath[" + path + "]格式错误")
+			return
+		}
+	}
+	return
+}
+
+// evalJSONPath 返回 路径 匹配 到 的 所有 值，负数 下标 从 末尾 计算
+func evalJSONPath(steps []*jsonPathStep, data interface{}) (values []interface{}) {
+	values = []interface{}{data}
+	for _, step := range steps {
+		var next []interface{}
+		for _, value := range values {
+			switch tV := value.(type) {
+			case map[string]interface{}:
+				if step.isIndex {
+					continue
+				}
+				if step.name == "*" {
+					for _, one := range tV {
+						next = append(next, one)
+					}
+				} else if one, ok := tV[step.name]; ok {
+					next = append(next, one)
+				}
+			case []interface{}:
+				if step.name == "*" {
+					next = append(next, tV...)
+					continue
+				}
+				if !step.isIndex {
+					continue
+				}
+				index := step.index
+				if index < 0 {
+					index += len(tV)
+				}
+				if index >= 0 && index < len(tV) {
+					next = append(next, tV[index])
+				}
+			}
+		}
+		values = next
+		if len(values) == 0 {
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,87 @@
+package module_kafka
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+// formatSteps 路径 段 格式 为 .name 或 [index]
+func formatSteps(steps []*jsonPathStep) (str string) {
+	for _, step := range steps {
+		if step.isIndex {
+			str += fmt.Sprintf("[%d]", step.index)
+		} else {
+			str += "." + step.name
+		}
+	}
+	return
+}
+
+func TestParseJSONPath(t *testing.T) {
+	list := []struct {
+		path    string
+		want    string
+		wantErr bool
+	}{
+		{"$", "", false},
+		{" $.a.b ", ".a.b", false},
+		{"$['a b'].c", ".a b.c", false},
+		{`$["a.b"]`, ".a.b", false},
+		{"$.list[0].id", ".list[0].id", false},
+		{"$.list[-1]", ".list[-1]", false},
+		{"$.list[*].id", ".list.*.id", false},
+		{"$.*", ".*", false},
+		{"a.b", "", true},
+		{"$..a", "", true},
+		{"$.a.", "", true},
+		{"$.list[0", "", true},
+		{"$.list[x]", "", true},
+		{"$a", "", true},
+	}
+	for _, one := range list {
+		steps, err := parseJSONPath(one.path)
+		if (err != nil) != one.wantErr {
+			t.Errorf("parseJSONPath(%q) error = %v, want error %v", one.path, err, one.wantErr)
+			continue
+		}
+		if err == nil && formatSteps(steps) != one.want {
+			t.Errorf("parseJSONPath(%q) = %q, want %q", one.path, formatSteps(steps), one.want)
+		}
+	}
+}
+
+func TestEvalJSONPath(t *testing.T) {
+	var data interface{}
+	err := json.Unmarshal([]byte(`{"a":{"b":1},"list":[{"id":1},{"id":2},{"name":"x"}],"tags":["x","y"],"one":{"k":"v"}}`), &data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := []struct {
+		path string
+		want string
+	}{
+		{"$.a.b", "[1]"},
+		{"$['a']['b']", "[1]"},
+		{"$.list[0].id", "[1]"},
+		{"$.list[-1].name", "[x]"},
+		{"$.list[*].id", "[1 2]"},
+		{"$.tags[*]", "[x y]"},
+		{"$.one.*", "[v]"},
+		{"$.list[3]", "[]"},
+		{"$.list[-4]", "[]"},
+		{"$.a[0]", "[]"},
+		{"$.tags.x", "[]"},
+		{"$.c.d", "[]"},
+	}
+	for _, one := range list {
+		steps, err := parseJSONPath(one.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := fmt.Sprint(evalJSONPath(steps, data))
+		if got != one.want {
+			t.Errorf("evalJSONPath(%q) = %s, want %s", one.path, got, one.want)
+		}
+	}
+}
@@ -0,0 +1,382 @@
+package module_kafka
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Shopify/sarama"
+	"github.com/team-ide/go-tool/kafka"
+	"github.com/team-ide/go-tool/util"
+	"go.uber.org/zap"
+	"sort"
+	"sync"
+	"teamide/pkg/task"
+)
+
+const (
+	lagDefaultInterval  = 30
+	lagMinInterval      = 5
+	lagDefaultMaxPoints = 720
+	lagMaxPoints        = 10000
+	// lagDefaultGrowingPoints 最近 多少 次 采样 持续 增长 视为 积压
+	lagDefaultGrowingPoints = 5
+)
+
+// LagMonitorParam 消费 积压 采样 配置，每个 连接 只 有 一个 采样 任务
+type LagMonitorParam struct {
+	Groups    []string `json:"groups"`    // 为 空 采集 所有 组
+	Interval  int      `json:"interval"`  // 采样 间隔，秒
+	MaxPoints int      `json:"maxPoints"` // 每个 组 保留 的 采样 数
+}
+
+type LagPartition struct {
+	Topic     string `json:"topic"`
+	Partition int32  `json:"partition"`
+	Committed int64  `json:"committed"`
+	LogEnd    int64  `json:"logEnd"`
+	Lag       int64  `json:"lag"`
+}
+
+// LagPoint 一 次 采样，Lag、Committed 为 所有 分区 之 和
+type LagPoint struct {
+	Time       int64           `json:"time"`
+	Lag        int64           `json:"lag"`
+	Committed  int64           `json:"committed"`
+	Partitions []*LagPartition `json:"partitions"`
+}
+
+type LagGroupStatus struct {
+	GroupId string `json:"groupId"`
+	Lag     int64  `json:"lag"`
+	Time    int64  `json:"time"`
+	Points  int    `json:"points"`
+	// Growing 最近 采样 积压 持续 增长
+	Growing bool `json:"growing"`
+	// Stuck 最近 采样 提交 位置 未 变化 且 有 积压
+	Stuck bool `json:"stuck"`
+}
+
+type LagMonitorInfo struct {
+	Key         string            `json:"key"`
+	Address     string            `json:"address"`
+	Groups      []string          `json:"groups"`
+	Interval    int               `json:"interval"`
+	MaxPoints   int               `json:"maxPoints"`
+	IsRunning   bool              `json:"isRunning"`
+	StartTime   int64             `json:"startTime"`
+	LastTime    int64             `json:"lastTime"`
+	LastError   string            `json:"lastError"`
+	SampleCount int               `json:"sampleCount"`
+	GroupList   []*LagGroupStatus `json:"groupList"`
+}
+
+type lagMonitor struct {
+	key         string
+	config      *kafka.Config
+	groups      []string
+	interval    int
+	maxPoints   int
+	startTime   int64
+	lastTime    int64
+	lastError   string
+	sampleCount int
+	cronTask    *task.CronTask
+	history     map[string][]*LagPoint
+
+	lock sync.Mutex
+}
+
+var (
+	lagMonitorCache     = map[string]*lagMonitor{}
+	lagMonitorCacheLock = &sync.Mutex{}
+)
+
+func (this_ *LagMonitorParam) init() (err error) {
+	if this_.Interval <= 0 {
+		this_.Interval = lagDefaultInterval
+	}
+	if this_.Interval < lagMinInterval {
+		err = fmt.Errorf("采样间隔不能小于%d秒", lagMinInterval)
+		return
+	}
+	if this_.MaxPoints <= 0 {
+		this_.MaxPoints = lagDefaultMaxPoints
+	}
+	if this_.MaxPoints > lagMaxPoints {
+		this_.MaxPoints = lagMaxPoints
+	}
+	return
+}
+
+// startLagMonitor 已有 采样 任务 时 按 新 配置 重启，保留 历史
+func startLagMonitor(config *kafka.Config, param *LagMonitorParam) (info *LagMonitorInfo, err error) {
+	key := serviceKey(config)
+
+	lagMonitorCacheLock.Lock()
+	defer lagMonitorCacheLock.Unlock()
+
+	one := lagMonitorCache[key]
+	if one == nil {
+		one = &lagMonitor{
+			key:     key,
+			history: map[string][]*LagPoint{},
+		}
+	}
+	one.stop()
+
+	one.lock.Lock()
+	one.config = config
+	one.groups = param.Groups
+	one.interval = param.Interval
+	one.maxPoints = param.MaxPoints
+	one.startTime = util.GetNowMilli()
+	one.lastError = ""
+	for groupId, points := range one.history {
+		one.history[groupId] = trimLagPoints(points, one.maxPoints)
+	}
+	one.cronTask = &task.CronTask{
+		Spec: fmt.Sprintf("@every %ds", param.Interval),
+		Task: &task.Task{
+			Key: "lag-monitor-" + key,
+			Do:  one.sample,
+		},
+	}
+	cronTask := one.cronTask
+	one.lock.Unlock()
+
+	if err = task.AddCronTask(cronTask); err != nil {
+		one.lock.Lock()
+		one.cronTask = nil
+		one.lock.Unlock()
+		return
+	}
+	lagMonitorCache[key] = one
+	// 立即 采样 一 次，不用 等 第一 个 间隔
+	go one.sample()
+
+	info = one.info(lagDefaultGrowingPoints)
+	return
+}
+
+func getLagMonitor(config *kafka.Config) *lagMonitor {
+	lagMonitorCacheLock.Lock()
+	defer lagMonitorCacheLock.Unlock()
+
+	return lagMonitorCache[serviceKey(config)]
+}
+
+// removeLagMonitor 停止 采样 并 清理 历史
+func removeLagMonitor(config *kafka.Config) {
+	lagMonitorCacheLock.Lock()
+	defer lagMonitorCacheLock.Unlock()
+
+	key := serviceKey(config)
+	one := lagMonitorCache[key]
+	if one == nil {
+		return
+	}
+	one.stop()
+	delete(lagMonitorCache, key)
+}
+
+// stop 只 停止 采样，历史 保留 到 清理
+func (this_ *lagMonitor) stop() {
+	this_.lock.Lock()
+	cronTask := this_.cronTask
+	this_.cronTask = nil
+	this_.lock.Unlock()
+
+	if cronTask != nil {
+		cronTask.Stop()
+	}
+}
+
+func (this_ *lagMonitor) sample() {
+	this_.lock.Lock()
+	config := this_.config
+	groups := this_.groups
+	this_.lock.Unlock()
+
+	points, err := sampleLag(config, groups)
+	if err != nil {
+		util.Logger.Error("kafka lag sample error", zap.Any("address", config.Address), zap.Error(err))
+	}
+
+	this_.lock.Lock()
+	defer this_.lock.Unlock()
+
+	this_.lastTime = util.GetNowMilli()
+	this_.sampleCount++
+	this_.lastError = ""
+	if err != nil {
+		this_.lastError = err.Error()
+	}
+	for groupId, point := range points {
+		this_.history[groupId] = trimLagPoints(append(this_.history[groupId], point), this_.maxPoints)
+	}
+}
+
+// sampleLag 采集 各 组 的 提交 位置 与 分区 末尾 位置，末尾 位置 在 一 次 采样 内 共用
+func sampleLag(config *kafka.Config, groups []string) (points map[string]*LagPoint, err error) {
+	service, err := getService(config)
+	if err != nil {
+		return
+	}
+	client, err := service.GetClient()
+	if err != nil {
+		return
+	}
+	defer func() { _ = client.Close() }()
+	admin, err := sarama.NewClusterAdminFromClient(client)
+	if err != nil {
+		return
+	}
+
+	if len(groups) == 0 {
+		var groupMap map[string]string
+		if groupMap, err = admin.ListConsumerGroups(); err != nil {
+			return
+		}
+		for groupId := range groupMap {
+			groups = append(groups, groupId)
+		}
+	}
+
+	now := util.GetNowMilli()
+	logEnds := map[string]int64{}
+	points = map[string]*LagPoint{}
+	var errs []string
+	for _, groupId := range groups {
+		offsets, e := admin.ListConsumerGroupOffsets(groupId, nil)
+		if e == nil && offsets.Err != sarama.ErrNoError {
+			e = offsets.Err
+		}
+		if e != nil {
+			errs = append(errs, "组["+groupId+"]:"+e.Error())
+			continue
+		}
+		point := &LagPoint{Time: now}
+		for topic, blocks := range offsets.Blocks {
+			for partition, block := range blocks {
+				// 没有 提交 过 的 分区 返回 -1
+				if block == nil || block.Err != sarama.ErrNoError || block.Offset < 0 {
+					continue
+				}
+				logEndKey := fmt.Sprint(topic, "-", partition)
+				logEnd, find := logEnds[logEndKey]
+				if !find {
+					if logEnd, e = client.GetOffset(topic, partition, sarama.OffsetNewest); e != nil {
+						errs = append(errs, "分区["+logEndKey+"]:"+e.Error())
+						continue
+					}
+					logEnds[logEndKey] = logEnd
+				}
+				lag := logEnd - block.Offset
+				if lag < 0 {
+					lag = 0
+				}
+				point.Lag += lag
+				point.Committed += block.Offset
+				point.Partitions = append(point.Partitions, &LagPartition{
+					Topic:     topic,
+					Partition: partition,
+					Committed: block.Offset,
+					LogEnd:    logEnd,
+					Lag:       lag,
+				})
+			}
+		}
+		sort.Slice(point.Partitions, func(i, j int) bool {
+			if point.Partitions[i].Topic != point.Partitions[j].Topic {
+				return point.Partitions[i].Topic < point.Partitions[j].Topic
+			}
+			return point.Partitions[i].Partition < point.Partitions[j].Partition
+		})
+		points[groupId] = point
+	}
+	if len(errs) > 0 {
+		err = errors.New(fmt.Sprint(errs))
+	}
+	return
+}
+
+func trimLagPoints(points []*LagPoint, maxPoints int) []*LagPoint {
+	if maxPoints > 0 && len(points) > maxPoints {
+		points = append([]*LagPoint{}, points[len(points)-maxPoints:]...)
+	}
+	return points
+}
+
+// lagGroupStatus 判断 最近 growingPoints 次 采样 是否 持续 增长 或 停止 消费
+func lagGroupStatus(groupId string, points []*LagPoint, growingPoints int) *LagGroupStatus {
+	status := &LagGroupStatus{
+		GroupId: groupId,
+		Points:  len(points),
+	}
+	if len(points) == 0 {
+		return status
+	}
+	last := points[len(points)-1]
+	status.Lag = last.Lag
+	status.Time = last.Time
+	if growingPoints < 2 || len(points) < growingPoints {
+		return status
+	}
+	recent := points[len(points)-growingPoints:]
+	status.Growing = true
+	status.Stuck = last.Lag > 0
+	for i := 1; i < len(recent); i++ {
+		if recent[i].Lag <= recent[i-1].Lag {
+			status.Growing = false
+		}
+		if recent[i].Committed != recent[i-1].Committed {
+			status.Stuck = false
+		}
+	}
+	return status
+}
+
+func (this_ *lagMonitor) info(growingPoints int) *LagMonitorInfo {
+	this_.lock.Lock()
+	defer this_.lock.Unlock()
+
+	info := &LagMonitorInfo{
+		Key:         this_.key,
+		Address:     this_.config.Address,
+		Groups:      this_.groups,
+		Interval:    this_.interval,
+		MaxPoints:   this_.maxPoints,
+		IsRunning:   this_.cronTask != nil,
+		StartTime:   this_.startTime,
+		LastTime:    this_.lastTime,
+		LastError:   this_.lastError,
+		SampleCount: this_.sampleCount,
+	}
+	for groupId, points := range this_.history {
+		info.GroupList = append(info.GroupList, lagGroupStatus(groupId, points, growingPoints))
+	}
+	// 积压 增长 的 排 前面
+	sort.Slice(info.GroupList, func(i, j int) bool {
+		a, b := info.GroupList[i], info.GroupList[j]
+		if a.Growing != b.Growing {
+			return a.Growing
+		}
+		if a.Stuck != b.Stuck {
+			return a.Stuck
+		}
+		return a.GroupId < b.GroupId
+	})
+	return info
+}
+
+// historyOf 返回 startTime 之后 的 采样，页面 轮询 时 增量 获取
+func (this_ *lagMonitor) historyOf(groupId string, startTime int64) (points []*LagPoint) {
+	this_.lock.Lock()
+	defer this_.lock.Unlock()
+
+	for _, point := range this_.history[groupId] {
+		if point.Time > startTime {
+			points = append(points, point)
+		}
+	}
+	return
+}
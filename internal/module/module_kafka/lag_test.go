@@ -0,0 +1,40 @@
+package module_kafka
+
+import (
+	"testing"
+)
+
+// lagPoints 按 积压、提交 位置 生成 采样 点
+func lagPoints(values ...[2]int64) (points []*LagPoint) {
+	for i, one := range values {
+		points = append(points, &LagPoint{Time: int64(i + 1), Lag: one[0], Committed: one[1]})
+	}
+	return
+}
+
+func TestLagGroupStatus(t *testing.T) {
+	list := []struct {
+		name          string
+		points        []*LagPoint
+		growingPoints int
+		lag           int64
+		growing       bool
+		stuck         bool
+	}{
+		{"empty", nil, 3, 0, false, false},
+		{"not enough points", lagPoints([2]int64{1, 0}, [2]int64{2, 0}), 3, 2, false, false},
+		{"growing disabled", lagPoints([2]int64{1, 0}, [2]int64{2, 0}, [2]int64{3, 0}), 1, 3, false, false},
+		{"growing and stuck", lagPoints([2]int64{1, 5}, [2]int64{2, 5}, [2]int64{3, 5}), 3, 3, true, true},
+		{"growing and consuming", lagPoints([2]int64{1, 5}, [2]int64{2, 6}, [2]int64{3, 7}), 3, 3, true, false},
+		{"flat and stuck", lagPoints([2]int64{3, 5}, [2]int64{3, 5}, [2]int64{3, 5}), 3, 3, false, true},
+		{"no lag", lagPoints([2]int64{0, 5}, [2]int64{0, 5}, [2]int64{0, 5}), 3, 0, false, false},
+		{"only recent points", lagPoints([2]int64{9, 1}, [2]int64{1, 5}, [2]int64{2, 5}), 2, 2, true, true},
+		{"dropped", lagPoints([2]int64{1, 5}, [2]int64{3, 5}, [2]int64{2, 6}), 3, 2, false, false},
+	}
+	for _, one := range list {
+		status := lagGroupStatus("g", one.points, one.growingPoints)
+		if status.GroupId != "g" || status.Points != len(one.points) || status.Lag != one.lag || status.Growing != one.growing || status.Stuck != one.stuck {
+			t.Errorf("lagGroupStatus %s = %+v, want lag %d, growing %v, stuck %v", one.name, status, one.lag, one.growing, one.stuck)
+		}
+	}
+}
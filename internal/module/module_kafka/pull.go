@@ -0,0 +1,80 @@
+package module_kafka
+
+import (
+	"context"
+	"github.com/Shopify/sarama"
+	"github.com/team-ide/go-tool/kafka"
+	"github.com/team-ide/go-tool/util"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+)
+
+// pullHandler 与 go-tool 的 拉取 一致，不 标记 offset，保留 原始 字节 用于 schema 解码
+type pullHandler struct {
+	messages []*sarama.ConsumerMessage
+	cancel   context.CancelFunc
+	size     int
+	lock     sync.Mutex
+}
+
+func (*pullHandler) Setup(_ sarama.ConsumerGroupSession) error   { return nil }
+func (*pullHandler) Cleanup(_ sarama.ConsumerGroupSession) error { return nil }
+func (this_ *pullHandler) ConsumeClaim(sess sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	if sess == nil || claim == nil {
+		return nil
+	}
+	for msg := range claim.Messages() {
+		this_.lock.Lock()
+		this_.messages = append(this_.messages, msg)
+		full := len(this_.messages) >= this_.size
+		this_.lock.Unlock()
+		if full {
+			this_.cancel()
+			break
+		}
+	}
+	return nil
+}
+
+// pullMessages 使用 消费组 拉取，消息 由 messageCodec 转换
+func pullMessages(service kafka.IService, groupId string, topic string, pullSize int, pullTimeout int, messageCodec *messageCodec) (msgList []*Message, err error) {
+	if pullSize <= 0 {
+		pullSize = 10
+	}
+	if pullTimeout <= 0 {
+		pullTimeout = 1000
+	}
+	client, err := service.GetClient()
+	if err != nil {
+		return
+	}
+	defer func() { _ = client.Close() }()
+	group, err := sarama.NewConsumerGroupFromClient(groupId, client)
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*time.Duration(pullTimeout))
+	defer cancel()
+	handler := &pullHandler{
+		size:   pullSize,
+		cancel: cancel,
+	}
+	if e := group.Consume(ctx, []string{topic}, handler); e != nil {
+		util.Logger.Error("kafka pull consume error", zap.Any("topic", topic), zap.Any("groupId", groupId), zap.Error(e))
+	}
+	if e := group.Close(); e != nil {
+		util.Logger.Error("kafka pull group close error", zap.Error(e))
+	}
+
+	handler.lock.Lock()
+	defer handler.lock.Unlock()
+	for _, one := range handler.messages {
+		var msg *Message
+		if msg, err = messageCodec.toMessage(one); err != nil {
+			return
+		}
+		msgList = append(msgList, msg)
+	}
+	return
+}
@@ -0,0 +1,446 @@
+package module_kafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Shopify/sarama"
+	"github.com/dop251/goja"
+	"github.com/team-ide/go-tool/javascript"
+	"sort"
+	"teamide/pkg/background"
+	"time"
+)
+
+const (
+	replayDefaultBatchSize = 100
+	replayMaxBatchSize     = 1000
+	// replayMaxErrors 忽略 错误 继续 回放 时 保留 的 错误 信息 条数
+	replayMaxErrors = 100
+)
+
+// ReplayParam 将 范围 内 的 消息 过滤、转换 后 写入 目标 topic，用于 死信 重投 或 复制 流量 到 测试 集群
+type ReplayParam struct {
+	TopicRange
+	TargetToolboxId int64  `json:"targetToolboxId"` // 为 0 写入 当前 集群
+	TargetTopic     string `json:"targetTopic"`     // 为 空 与 源 topic 相同
+	// Filter JavaScript 表达式，变量 message 为 {key, value, headers, topic, partition, offset, timestamp}，结果 为 真 时 回放
+	Filter string `json:"filter"`
+	// Transform JavaScript 函数 体，可 直接 修改 message 或 返回 新 对象，返回 null、false 时 跳过
+	Transform     string `json:"transform"`
+	KeepTimestamp bool   `json:"keepTimestamp"` // 使用 message.timestamp 作为 时间戳，否则 使用 发送 时间
+	RateLimit     int    `json:"rateLimit"`     // 每秒 条数，为 0 不 限制
+	MaxMessages   int64  `json:"maxMessages"`   // 最多 发送 条数，为 0 不 限制
+	BatchSize     int    `json:"batchSize"`
+	ErrorContinue bool   `json:"errorContinue"` // 脚本 错误 时 跳过 该 消息
+}
+
+func (this_ *ReplayParam) init() (err error) {
+	if err = this_.TopicRange.init(); err != nil {
+		return
+	}
+	if this_.TargetTopic == "" {
+		this_.TargetTopic = this_.Topic
+	}
+	if this_.BatchSize <= 0 {
+		this_.BatchSize = replayDefaultBatchSize
+	}
+	if this_.BatchSize > replayMaxBatchSize {
+		this_.BatchSize = replayMaxBatchSize
+	}
+	if this_.RateLimit < 0 {
+		this_.RateLimit = 0
+	}
+	return
+}
+
+type ReplayResult struct {
+	Scanned    int64                `json:"scanned"`
+	Filtered   int64                `json:"filtered"` // 被 过滤 或 转换 跳过 的 条数
+	Sent       int64                `json:"sent"`
+	ErrorCount int64                `json:"errorCount"`
+	Errors     []string             `json:"errors"`
+	Partial    bool                 `json:"partial"` // 有 分区 空闲 超时，可能 没有 回放 完整
+	Partitions []*PartitionProgress `json:"partitions"`
+}
+
+func (this_ *ReplayResult) Snapshot() interface{} {
+	res := *this_
+	res.Partitions = nil
+	for _, one := range this_.Partitions {
+		partition := *one
+		res.Partitions = append(res.Partitions, &partition)
+	}
+	res.Errors = append([]string{}, this_.Errors...)
+	return &res
+}
+
+type replay struct {
+	*ReplayParam
+	task     *background.Task
+	result   *ReplayResult
+	consumer sarama.Consumer
+	producer sarama.SyncProducer
+	ctx      context.Context
+	cancel   context.CancelFunc
+
+	// 脚本 运行时 不能 并发，分区 依次 回放
+	runtime   *goja.Runtime
+	filter    goja.Callable
+	transform goja.Callable
+
+	batch     []*sarama.ProducerMessage
+	accepted  int64
+	startTime time.Time
+}
+
+// newReplay 编译 脚本，脚本 错误 在 任务 开始 前 返回
+func newReplay(param *ReplayParam) (res *replay, err error) {
+	res = &replay{ReplayParam: param}
+	if param.Filter == "" && param.Transform == "" {
+		return
+	}
+	res.runtime = goja.New()
+	for key, value := range javascript.NewContext() {
+		if err = res.runtime.Set(key, value); err != nil {
+			return
+		}
+	}
+	if param.Filter != "" {
+		if res.filter, err = res.compile("(function(message) {\nreturn (" + param.Filter + "\n);\n})"); err != nil {
+			err = errors.New("过滤表达式错误:" + err.Error())
+			return
+		}
+	}
+	if param.Transform != "" {
+		if res.transform, err = res.compile("(function(message) {\n" + param.Transform + "\n})"); err != nil {
+			err = errors.New("转换脚本错误:" + err.Error())
+			return
+		}
+	}
+	return
+}
+
+func (this_ *replay) compile(script string) (fn goja.Callable, err error) {
+	v, err := this_.runtime.RunString(script)
+	if err != nil {
+		return
+	}
+	fn, ok := goja.AssertFunction(v)
+	if !ok {
+		err = errors.New("script is not a function")
+	}
+	return
+}
+
+func (this_ *replay) do(task *background.Task, client sarama.Client, producer sarama.SyncProducer, result *ReplayResult) (err error) {
+	this_.task = task
+	this_.result = result
+	this_.producer = producer
+
+	partitions, err := rangeProgress(client, &this_.TopicRange)
+	if err != nil {
+		return
+	}
+	task.Update(func() {
+		result.Partitions = partitions
+	})
+
+	this_.consumer, err = sarama.NewConsumerFromClient(client)
+	if err != nil {
+		return
+	}
+	defer func() { _ = this_.consumer.Close() }()
+
+	this_.ctx, this_.cancel = context.WithCancel(context.Background())
+	defer this_.cancel()
+	go this_.watchStop()
+
+	this_.startTime = time.Now()
+	for _, one := range partitions {
+		if one.Done {
+			continue
+		}
+		err = consumePartition(this_.ctx, task, this_.consumer, this_.Topic, one, func(consumerMessage *sarama.ConsumerMessage) error {
+			return this_.onMessage(one, consumerMessage)
+		})
+		if err != nil {
+			return
+		}
+		if this_.ctx.Err() != nil {
+			break
+		}
+	}
+	task.Update(func() {
+		result.Partial = hasTimedOut(result.Partitions)
+	})
+	// 停止 或 达到 条数 时 已 接受 的 消息 仍然 发送
+	err = this_.flush()
+	return
+}
+
+// watchStop 任务 停止 时 取消 消费 并 中断 正在 执行 的 脚本
+func (this_ *replay) watchStop() {
+	ticker := time.NewTicker(200 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-this_.ctx.Done():
+			return
+		case <-ticker.C:
+			if this_.task.IsStopped() {
+				this_.cancel()
+				if this_.runtime != nil {
+					this_.runtime.Interrupt("task stopped")
+				}
+				return
+			}
+		}
+	}
+}
+
+func (this_ *replay) onMessage(one *PartitionProgress, consumerMessage *sarama.ConsumerMessage) (err error) {
+	this_.task.Update(func() {
+		one.Offset = consumerMessage.Offset + 1
+		one.Scanned++
+		this_.result.Scanned++
+	})
+	if !this_.inTime(consumerMessage.Timestamp.UnixMilli()) {
+		return
+	}
+	msg, err := this_.convert(consumerMessage)
+	if err != nil {
+		if this_.ctx.Err() != nil {
+			err = nil
+			return
+		}
+		err = errors.New(fmt.Sprintf("分区[%d] offset[%d]脚本执行失败:%s", consumerMessage.Partition, consumerMessage.Offset, err.Error()))
+		if !this_.ErrorContinue {
+			return
+		}
+		this_.task.Update(func() {
+			this_.result.ErrorCount++
+			if len(this_.result.Errors) < replayMaxErrors {
+				this_.result.Errors = append(this_.result.Errors, err.Error())
+			}
+		})
+		err = nil
+		return
+	}
+	if msg == nil {
+		this_.task.Update(func() { this_.result.Filtered++ })
+		return
+	}
+
+	if this_.RateLimit > 0 {
+		wait := time.Duration(this_.accepted)*time.Second/time.Duration(this_.RateLimit) - time.Since(this_.startTime)
+		if wait > 0 {
+			if err = this_.flush(); err != nil {
+				return
+			}
+			if !this_.task.SleepInterval(wait) {
+				this_.cancel()
+				return
+			}
+		}
+	}
+	this_.batch = append(this_.batch, msg)
+	this_.accepted++
+	if len(this_.batch) >= this_.BatchSize {
+		if err = this_.flush(); err != nil {
+			return
+		}
+	}
+	if this_.MaxMessages > 0 && this_.accepted >= this_.MaxMessages {
+		this_.cancel()
+	}
+	return
+}
+
+func (this_ *replay) flush() (err error) {
+	if len(this_.batch) == 0 {
+		return
+	}
+	batch := this_.batch
+	this_.batch = nil
+	sent := int64(len(batch))
+	if err = this_.producer.SendMessages(batch); err != nil {
+		if errs, ok := err.(sarama.ProducerErrors); ok && len(errs) > 0 {
+			sent -= int64(len(errs))
+			err = errors.New(fmt.Sprintf("%d条消息发送失败:%s", len(errs), errs[0].Err.Error()))
+		} else {
+			// 其它 错误 无法 确定 发送 了 哪些，按 都 未 发送 计
+			sent = 0
+		}
+	}
+	this_.task.Update(func() { this_.result.Sent += sent })
+	return
+}
+
+// convert 转换 为 发送 的 消息，返回 nil 表示 跳过；未 修改 的 key、value、headers 保留 原始 字节
+func (this_ *replay) convert(consumerMessage *sarama.ConsumerMessage) (msg *sarama.ProducerMessage, err error) {
+	msg = &sarama.ProducerMessage{
+		Topic: this_.TargetTopic,
+	}
+	if this_.KeepTimestamp {
+		msg.Timestamp = consumerMessage.Timestamp
+	}
+	if this_.runtime == nil {
+		if consumerMessage.Key != nil {
+			msg.Key = sarama.ByteEncoder(consumerMessage.Key)
+		}
+		if consumerMessage.Value != nil {
+			msg.Value = sarama.ByteEncoder(consumerMessage.Value)
+		}
+		for _, header := range consumerMessage.Headers {
+			msg.Headers = append(msg.Headers, *header)
+		}
+		return
+	}
+
+	data := map[string]interface{}{
+		"topic":     consumerMessage.Topic,
+		"partition": consumerMessage.Partition,
+		"offset":    consumerMessage.Offset,
+		"timestamp": consumerMessage.Timestamp.UnixMilli(),
+		"key":       nil,
+		"value":     nil,
+		"headers":   headerMap(consumerMessage.Headers),
+	}
+	if consumerMessage.Key != nil {
+		data["key"] = string(consumerMessage.Key)
+	}
+	if consumerMessage.Value != nil {
+		data["value"] = string(consumerMessage.Value)
+	}
+
+	if this_.filter != nil {
+		var v goja.Value
+		if v, err = this_.filter(goja.Undefined(), this_.runtime.ToValue(data)); err != nil {
+			return
+		}
+		if !v.ToBoolean() {
+			msg = nil
+			return
+		}
+	}
+	if this_.transform != nil {
+		var v goja.Value
+		if v, err = this_.transform(goja.Undefined(), this_.runtime.ToValue(data)); err != nil {
+			return
+		}
+		if !goja.IsUndefined(v) {
+			switch tV := v.Export().(type) {
+			case nil:
+				msg = nil
+				return
+			case bool:
+				if !tV {
+					msg = nil
+					return
+				}
+			case map[string]interface{}:
+				data = tV
+			default:
+				err = errors.New("转换脚本需要返回对象、null或false")
+				return
+			}
+		}
+	}
+
+	var bs []byte
+	if bs, err = replayBytes(data["key"], consumerMessage.Key); err != nil {
+		return
+	}
+	if bs != nil {
+		msg.Key = sarama.ByteEncoder(bs)
+	}
+	if bs, err = replayBytes(data["value"], consumerMessage.Value); err != nil {
+		return
+	}
+	if bs != nil {
+		msg.Value = sarama.ByteEncoder(bs)
+	}
+	if msg.Headers, err = replayHeaders(data["headers"], consumerMessage.Headers); err != nil {
+		return
+	}
+	if this_.KeepTimestamp {
+		switch tV := data["timestamp"].(type) {
+		case int64:
+			msg.Timestamp = time.UnixMilli(tV)
+		case float64:
+			msg.Timestamp = time.UnixMilli(int64(tV))
+		}
+	}
+	return
+}
+
+// headerMap 同名 header 保留 最后 一个
+func headerMap(headers []*sarama.RecordHeader) map[string]interface{} {
+	res := map[string]interface{}{}
+	for _, header := range headers {
+		res[string(header.Key)] = string(header.Value)
+	}
+	return res
+}
+
+// replayBytes 字符串 未 修改 时 使用 原始 字节，其它 类型 转为 JSON
+func replayBytes(value interface{}, origin []byte) (bs []byte, err error) {
+	switch tV := value.(type) {
+	case nil:
+		return
+	case string:
+		if tV == string(origin) {
+			bs = origin
+		} else {
+			bs = []byte(tV)
+		}
+		return
+	case []byte:
+		bs = tV
+		return
+	}
+	bs, err = json.Marshal(value)
+	return
+}
+
+// replayHeaders headers 未 修改 时 保留 原始 header（包括 同名 header），否则 按 key 排序 生成
+func replayHeaders(value interface{}, origin []*sarama.RecordHeader) (headers []sarama.RecordHeader, err error) {
+	if value == nil {
+		return
+	}
+	data, ok := value.(map[string]interface{})
+	if !ok {
+		err = errors.New("headers需要是对象")
+		return
+	}
+	originMap := headerMap(origin)
+	changed := len(data) != len(originMap)
+	for key, v := range data {
+		if str, ok := v.(string); !ok || str != originMap[key] {
+			changed = true
+			break
+		}
+	}
+	if !changed {
+		for _, header := range origin {
+			headers = append(headers, *header)
+		}
+		return
+	}
+
+	var keys []string
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		var bs []byte
+		if bs, err = replayBytes(data[key], nil); err != nil {
+			return
+		}
+		headers = append(headers, sarama.RecordHeader{Key: []byte(key), Value: bs})
+	}
+	return
+}
@@ -0,0 +1,484 @@
+package module_kafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Shopify/sarama"
+	"regexp"
+	"strings"
+	"sync"
+	"teamide/pkg/background"
+	"time"
+)
+
+const (
+	searchDefaultMaxMatches = 500
+	searchMaxMatches        = 10000
+	// searchMaxErrors 结果 中 保留 的 解码 错误 信息 条数
+	searchMaxErrors = 100
+	// partitionIdleTimeout 分区 末尾 的 消息 被 压缩 删除 时 等不到 结束 位置，超时 后 停止 并 标记 结果 不 完整
+	partitionIdleTimeout = 5 * time.Second
+)
+
+// SearchMatch 匹配 条件，Field 为 key、value、header、any，Mode 为 contains、regex、jsonPath
+type SearchMatch struct {
+	Field      string `json:"field"`
+	Mode       string `json:"mode"`
+	HeaderKey  string `json:"headerKey"`  // 为 空 匹配 所有 header
+	Expression string `json:"expression"` // 子串、正则 或 JSONPath
+	Value      string `json:"value"`      // JSONPath 取值 需要 等于 的 值，为 空 表示 路径 存在 即可
+	IgnoreCase bool   `json:"ignoreCase"`
+
+	re    *regexp.Regexp
+	steps []*jsonPathStep
+}
+
+// TopicRange 按 时间 或 offset 指定 扫描 范围，不 使用 消费组，不 提交 offset
+type TopicRange struct {
+	Topic       string  `json:"topic"`
+	Partitions  []int32 `json:"partitions"` // 为 空 表示 所有 分区
+	StartTime   int64   `json:"startTime"`  // 毫秒，优先 于 offset
+	EndTime     int64   `json:"endTime"`
+	StartOffset *int64  `json:"startOffset"`
+	EndOffset   *int64  `json:"endOffset"` // 包含
+}
+
+// SearchParam 在 范围 内 搜索 消息
+type SearchParam struct {
+	TopicRange
+	KeyType    string         `json:"keyType"`
+	ValueType  string         `json:"valueType"`
+	Matches    []*SearchMatch `json:"matches"` // 多个 条件 同时 满足，为 空 返回 范围 内 所有 消息
+	MaxMatches int            `json:"maxMatches"`
+}
+
+// PartitionProgress 分区 扫描 进度
+type PartitionProgress struct {
+	Partition   int32 `json:"partition"`
+	StartOffset int64 `json:"startOffset"`
+	EndOffset   int64 `json:"endOffset"` // 不 包含
+	Offset      int64 `json:"offset"`
+	Scanned     int64 `json:"scanned"`
+	Done        bool  `json:"done"`     // 已 到达 结束 位置
+	TimedOut    bool  `json:"timedOut"` // 空闲 超时 未 到达 结束 位置
+}
+
+type SearchResult struct {
+	Scanned    int64                `json:"scanned"`
+	MatchCount int                  `json:"matchCount"`
+	ErrorCount int64                `json:"errorCount"` // 解码 失败 的 条数，不 参与 匹配
+	Errors     []string             `json:"errors"`
+	Partial    bool                 `json:"partial"` // 有 分区 空闲 超时，结果 可能 不 完整
+	Partitions []*PartitionProgress `json:"partitions"`
+	FromIndex  int                  `json:"fromIndex"` // 增量 查询 时 Messages 的 起始 下标
+	Messages   []*Message           `json:"messages"`
+}
+
+func (this_ *SearchResult) Snapshot() interface{} {
+	res := *this_
+	res.Partitions = nil
+	for _, one := range this_.Partitions {
+		partition := *one
+		res.Partitions = append(res.Partitions, &partition)
+	}
+	res.Errors = append([]string{}, this_.Errors...)
+	// 消息 只 追加，复制 切片 即可
+	res.Messages = this_.Messages[:len(this_.Messages):len(this_.Messages)]
+	return &res
+}
+
+// since 只 返回 fromIndex 之后 的 消息，页面 轮询 时 增量 获取
+func (this_ *SearchResult) since(fromIndex int) *SearchResult {
+	if fromIndex < 0 || fromIndex > len(this_.Messages) {
+		fromIndex = len(this_.Messages)
+	}
+	res := *this_
+	res.FromIndex = fromIndex
+	res.Messages = this_.Messages[fromIndex:]
+	return &res
+}
+
+func (this_ *TopicRange) init() (err error) {
+	if this_.Topic == "" {
+		err = errors.New("topic不能为空")
+		return
+	}
+	if this_.StartTime > 0 && this_.EndTime > 0 && this_.StartTime > this_.EndTime {
+		err = errors.New("开始时间不能大于结束时间")
+		return
+	}
+	return
+}
+
+// inTime 分区 内 时间戳 不一定 递增，范围 内 的 消息 需要 再 按 时间 过滤
+func (this_ *TopicRange) inTime(timestamp int64) bool {
+	return (this_.StartTime <= 0 || timestamp >= this_.StartTime) && (this_.EndTime <= 0 || timestamp <= this_.EndTime)
+}
+
+func (this_ *SearchParam) init() (err error) {
+	if err = this_.TopicRange.init(); err != nil {
+		return
+	}
+	if this_.MaxMatches <= 0 {
+		this_.MaxMatches = searchDefaultMaxMatches
+	}
+	if this_.MaxMatches > searchMaxMatches {
+		this_.MaxMatches = searchMaxMatches
+	}
+	for _, one := range this_.Matches {
+		if err = one.init(); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (this_ *SearchMatch) init() (err error) {
+	if this_.Field == "" {
+		this_.Field = "value"
+	}
+	if this_.Mode == "" {
+		this_.Mode = "contains"
+	}
+	switch this_.Field {
+	case "key", "value", "header", "any":
+	default:
+		err = errors.New("匹配字段[" + this_.Field + "]不支持")
+		return
+	}
+	switch this_.Mode {
+	case "contains":
+		if this_.IgnoreCase {
+			this_.Expression = strings.ToLower(this_.Expression)
+		}
+	case "regex":
+		expression := this_.Expression
+		if this_.IgnoreCase {
+			expression = "(?i)" + expression
+		}
+		if this_.re, err = regexp.Compile(expression); err != nil {
+			err = errors.New("正则[" + this_.Expression + "]错误:" + err.Error())
+			return
+		}
+	case "jsonPath":
+		if this_.steps, err = parseJSONPath(this_.Expression); err != nil {
+			return
+		}
+	default:
+		err = errors.New("匹配方式[" + this_.Mode + "]不支持")
+	}
+	return
+}
+
+func (this_ *SearchMatch) matchText(text string) bool {
+	switch this_.Mode {
+	case "contains":
+		if this_.IgnoreCase {
+			text = strings.ToLower(text)
+		}
+		return strings.Contains(text, this_.Expression)
+	case "regex":
+		return this_.re.MatchString(text)
+	case "jsonPath":
+		decoder := json.NewDecoder(strings.NewReader(text))
+		decoder.UseNumber()
+		var data interface{}
+		if decoder.Decode(&data) != nil {
+			return false
+		}
+		values := evalJSONPath(this_.steps, data)
+		if this_.Value == "" {
+			return len(values) > 0
+		}
+		for _, value := range values {
+			str := jsonValueString(value)
+			if str == this_.Value || (this_.IgnoreCase && strings.EqualFold(str, this_.Value)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func jsonValueString(value interface{}) string {
+	switch tV := value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return tV
+	case json.Number:
+		return tV.String()
+	}
+	bs, _ := json.Marshal(value)
+	return string(bs)
+}
+
+func (this_ *SearchMatch) match(msg *Message) bool {
+	if this_.Field == "key" || this_.Field == "any" {
+		if this_.matchText(msg.Key) {
+			return true
+		}
+	}
+	if this_.Field == "value" || this_.Field == "any" {
+		if this_.matchText(msg.Value) {
+			return true
+		}
+	}
+	if this_.Field == "header" || this_.Field == "any" {
+		for _, header := range msg.Headers {
+			if this_.HeaderKey != "" && header.Key != this_.HeaderKey {
+				continue
+			}
+			if this_.matchText(header.Value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (this_ *SearchParam) match(msg *Message) bool {
+	for _, one := range this_.Matches {
+		if !one.match(msg) {
+			return false
+		}
+	}
+	return true
+}
+
+// partitionRange 计算 分区 扫描 范围，end 不 包含
+func partitionRange(client sarama.Client, param *TopicRange, partition int32) (start int64, end int64, err error) {
+	start, err = client.GetOffset(param.Topic, partition, sarama.OffsetOldest)
+	if err != nil {
+		return
+	}
+	end, err = client.GetOffset(param.Topic, partition, sarama.OffsetNewest)
+	if err != nil {
+		return
+	}
+	if param.StartTime > 0 {
+		var offset int64
+		if offset, err = client.GetOffset(param.Topic, partition, param.StartTime); err != nil {
+			return
+		}
+		// 没有 晚于 开始 时间 的 消息
+		if offset < 0 {
+			offset = end
+		}
+		if offset > start {
+			start = offset
+		}
+	} else if param.StartOffset != nil && *param.StartOffset > start {
+		start = *param.StartOffset
+	}
+	if param.EndTime > 0 {
+		var offset int64
+		if offset, err = client.GetOffset(param.Topic, partition, param.EndTime+1); err != nil {
+			return
+		}
+		if offset >= 0 && offset < end {
+			end = offset
+		}
+	}
+	if param.EndOffset != nil && *param.EndOffset+1 < end {
+		end = *param.EndOffset + 1
+	}
+	return
+}
+
+type search struct {
+	*SearchParam
+	messageCodec *messageCodec
+	task         *background.Task
+	result       *SearchResult
+	ctx          context.Context
+	cancel       context.CancelFunc
+}
+
+// rangeProgress 计算 各 分区 范围，作为 任务 进度
+func rangeProgress(client sarama.Client, param *TopicRange) (list []*PartitionProgress, err error) {
+	partitions := param.Partitions
+	if len(partitions) == 0 {
+		if partitions, err = client.Partitions(param.Topic); err != nil {
+			return
+		}
+	}
+	for _, partition := range partitions {
+		one := &PartitionProgress{Partition: partition}
+		if one.StartOffset, one.EndOffset, err = partitionRange(client, param, partition); err != nil {
+			return
+		}
+		one.Offset = one.StartOffset
+		one.Done = one.StartOffset >= one.EndOffset
+		list = append(list, one)
+	}
+	return
+}
+
+// consumePartition 从 开始 位置 消费 到 结束 位置，只有 到达 结束 位置 时 标记 Done
+// 结束 位置 前 的 消息 被 压缩 删除 或 为 事务 标记 时 等不到 结束 位置，空闲 超时 后 标记 TimedOut 并 返回
+func consumePartition(ctx context.Context, task *background.Task, consumer sarama.Consumer, topic string, one *PartitionProgress, onMessage func(consumerMessage *sarama.ConsumerMessage) error) (err error) {
+	pc, err := consumer.ConsumePartition(topic, one.Partition, one.StartOffset)
+	if err != nil {
+		return
+	}
+	defer func() { _ = pc.Close() }()
+
+	idle := time.NewTimer(partitionIdleTimeout)
+	defer idle.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e := <-pc.Errors():
+			if e != nil {
+				err = e
+			}
+			return
+		case <-idle.C:
+			task.Update(func() { one.TimedOut = true })
+			return
+		case consumerMessage := <-pc.Messages():
+			if consumerMessage == nil {
+				return
+			}
+			if consumerMessage.Offset >= one.EndOffset {
+				task.Update(func() { one.Done = true })
+				return
+			}
+			if err = onMessage(consumerMessage); err != nil {
+				return
+			}
+			if consumerMessage.Offset >= one.EndOffset-1 {
+				task.Update(func() { one.Done = true })
+				return
+			}
+			// 处理 消息 的 耗时 不 计入 空闲 时间
+			if !idle.Stop() {
+				<-idle.C
+			}
+			idle.Reset(partitionIdleTimeout)
+		}
+	}
+}
+
+// hasTimedOut 是否 有 分区 空闲 超时
+func hasTimedOut(partitions []*PartitionProgress) bool {
+	for _, one := range partitions {
+		if one.TimedOut {
+			return true
+		}
+	}
+	return false
+}
+
+func doSearch(task *background.Task, client sarama.Client, param *SearchParam, messageCodec *messageCodec, result *SearchResult) (err error) {
+	partitions, err := rangeProgress(client, &param.TopicRange)
+	if err != nil {
+		return
+	}
+	task.Update(func() {
+		result.Partitions = partitions
+	})
+
+	consumer, err := sarama.NewConsumerFromClient(client)
+	if err != nil {
+		return
+	}
+	defer func() { _ = consumer.Close() }()
+
+	this_ := &search{
+		SearchParam:  param,
+		messageCodec: messageCodec,
+		task:         task,
+		result:       result,
+	}
+	this_.ctx, this_.cancel = context.WithCancel(context.Background())
+	defer this_.cancel()
+	go this_.watchStop()
+
+	var wg sync.WaitGroup
+	var errLock sync.Mutex
+	for _, one := range result.Partitions {
+		if one.Done {
+			continue
+		}
+		wg.Add(1)
+		go func(one *PartitionProgress) {
+			defer wg.Done()
+			e := consumePartition(this_.ctx, task, consumer, this_.Topic, one, func(consumerMessage *sarama.ConsumerMessage) error {
+				this_.onMessage(one, consumerMessage)
+				return nil
+			})
+			if e != nil {
+				errLock.Lock()
+				if err == nil {
+					err = e
+				}
+				errLock.Unlock()
+				this_.cancel()
+			}
+		}(one)
+	}
+	wg.Wait()
+	task.Update(func() {
+		result.Partial = hasTimedOut(result.Partitions)
+	})
+	return
+}
+
+// watchStop 任务 停止 时 取消 所有 分区 扫描
+func (this_ *search) watchStop() {
+	ticker := time.NewTicker(200 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-this_.ctx.Done():
+			return
+		case <-ticker.C:
+			if this_.task.IsStopped() {
+				this_.cancel()
+				return
+			}
+		}
+	}
+}
+
+func (this_ *search) onMessage(one *PartitionProgress, consumerMessage *sarama.ConsumerMessage) {
+	this_.task.Update(func() {
+		one.Offset = consumerMessage.Offset + 1
+		one.Scanned++
+		this_.result.Scanned++
+	})
+	if !this_.inTime(consumerMessage.Timestamp.UnixMilli()) {
+		return
+	}
+	msg, err := this_.messageCodec.toMessage(consumerMessage)
+	if err != nil {
+		this_.task.Update(func() {
+			this_.result.ErrorCount++
+			if len(this_.result.Errors) < searchMaxErrors {
+				this_.result.Errors = append(this_.result.Errors, fmt.Sprintf("分区[%d] offset[%d]转换失败:%s", consumerMessage.Partition, consumerMessage.Offset, err.Error()))
+			}
+		})
+		return
+	}
+	if !this_.match(msg) {
+		return
+	}
+	var full bool
+	this_.task.Update(func() {
+		if this_.result.MatchCount >= this_.MaxMatches {
+			full = true
+			return
+		}
+		this_.result.MatchCount++
+		this_.result.Messages = append(this_.result.Messages, msg)
+		full = this_.result.MatchCount >= this_.MaxMatches
+	})
+	if full {
+		this_.cancel()
+	}
+}
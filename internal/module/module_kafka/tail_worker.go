@@ -0,0 +1,428 @@
+package module_kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Shopify/sarama"
+	"github.com/gorilla/websocket"
+	"github.com/team-ide/go-tool/util"
+	"go.uber.org/zap"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+var upGrader = websocket.Upgrader{
+	ReadBufferSize:  32 * 1024,
+	WriteBufferSize: 32 * 1024,
+	CheckOrigin: func(r *http.Request) bool {
+		return true
+	},
+}
+
+// 服务 端 为 每个 会话 缓冲 最近 的 消息，页面 重新 打开 时 通过 tailMessages 恢复
+// 条数 与 字节 同时 限制，超出 时 丢弃 最早 的 消息，单个 会话 最多 占用 约 tailBufferBytesMax 内存
+const (
+	tailBufferSizeDefault = 1000
+	tailBufferSizeMax     = 10000
+	tailBufferBytesMax    = 8 * 1024 * 1024
+
+	tailFromLatest   = "latest"
+	tailFromEarliest = "earliest"
+	tailFromTime     = "time"
+)
+
+// TailParam 从 分区 的 最新、最早 或 指定 时间 位置 开始 实时 查看，不 使用 消费组，不 提交 offset
+type TailParam struct {
+	Topic      string  `json:"topic"`
+	Partitions []int32 `json:"partitions"` // 为 空 查看 所有 分区
+	From       string  `json:"from"`       // latest（空）、earliest、time
+	Time       int64   `json:"time"`       // 毫秒，From 为 time 时 使用
+	KeyType    string  `json:"keyType"`
+	ValueType  string  `json:"valueType"`
+}
+
+type TailMessage struct {
+	Type    string   `json:"type"` // message、error
+	Message *Message `json:"message,omitempty"`
+	Error   string   `json:"error,omitempty"`
+}
+
+type TailPartition struct {
+	Partition     int32 `json:"partition"`
+	Offset        int64 `json:"offset"`        // 下一条 消息 的 offset，-1 表示 还未 收到 消息
+	HighWaterMark int64 `json:"highWaterMark"` // 分区 最新 位置，与 Offset 的 差 为 未 查看 的 条数
+}
+
+type TailStatus struct {
+	WorkerId    string           `json:"workerId"`
+	Topic       string           `json:"topic"`
+	Partitions  []*TailPartition `json:"partitions"`
+	Paused      bool             `json:"paused"`
+	BufferSize  int              `json:"bufferSize"`
+	Buffered    int              `json:"buffered"`
+	BufferBytes int              `json:"bufferBytes"` // 缓冲 消息 的 key、value、header 字节数，不 超过 tailBufferBytesMax
+	Received    int64            `json:"received"`
+	Dropped     int64            `json:"dropped"` // 缓冲 已满 被 丢弃 的 消息数
+}
+
+type tailBuffered struct {
+	message *Message
+	size    int
+}
+
+type tailWorker struct {
+	*TailParam
+	workerId     string
+	userId       int64
+	ws           *websocket.Conn
+	client       sarama.Client
+	consumer     sarama.Consumer
+	messageCodec *messageCodec
+	ctx          context.Context
+	cancel       context.CancelFunc
+
+	partitions map[int32]*TailPartition
+	consumers  map[int32]sarama.PartitionConsumer
+	// resume 暂停 时 不为 空，读取 阻塞 在 此 等待，sarama 缓冲 满 后 停止 拉取
+	resume chan struct{}
+
+	// 按 接收 顺序 缓冲，最多 bufferSize 条 且 不 超过 tailBufferBytesMax 字节
+	buffer      []*tailBuffered
+	bufferSize  int
+	bufferBytes int
+
+	received int64
+	dropped  int64
+
+	lock      sync.Mutex
+	writeLock sync.Mutex
+	isStopped bool
+}
+
+var tailWorkerCache = map[string]*tailWorker{}
+var tailWorkerCacheLock = &sync.Mutex{}
+
+func getTailWorker(workerId string) (worker *tailWorker) {
+	tailWorkerCacheLock.Lock()
+	defer tailWorkerCacheLock.Unlock()
+
+	worker = tailWorkerCache[workerId]
+	return
+}
+
+// startTailWorker client 由 worker 关闭
+func startTailWorker(client sarama.Client, param *TailParam, messageCodec *messageCodec, workerId string, userId int64, bufferSize int, ws *websocket.Conn) (err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = errors.New(fmt.Sprint(e))
+			util.Logger.Error("startTailWorker panic error", zap.Error(err))
+		}
+	}()
+
+	if bufferSize <= 0 {
+		bufferSize = tailBufferSizeDefault
+	}
+	if bufferSize > tailBufferSizeMax {
+		bufferSize = tailBufferSizeMax
+	}
+
+	tailWorkerCacheLock.Lock()
+	defer tailWorkerCacheLock.Unlock()
+
+	if tailWorkerCache[workerId] != nil {
+		err = errors.New("实时查看会话[" + workerId + "]已存在")
+		_ = client.Close()
+		return
+	}
+
+	worker := &tailWorker{
+		TailParam:    param,
+		workerId:     workerId,
+		userId:       userId,
+		ws:           ws,
+		client:       client,
+		messageCodec: messageCodec,
+		partitions:   map[int32]*TailPartition{},
+		consumers:    map[int32]sarama.PartitionConsumer{},
+		bufferSize:   bufferSize,
+	}
+	worker.ctx, worker.cancel = context.WithCancel(context.Background())
+	if err = worker.attach(); err != nil {
+		worker.closeConsumers()
+		return
+	}
+	tailWorkerCache[workerId] = worker
+
+	go worker.startReadWS()
+	for partition, pc := range worker.consumers {
+		go worker.startReadPartition(worker.partitions[partition], pc)
+	}
+	return
+}
+
+func stopTailWorker(workerId string) {
+	tailWorkerCacheLock.Lock()
+	worker := tailWorkerCache[workerId]
+	delete(tailWorkerCache, workerId)
+	tailWorkerCacheLock.Unlock()
+
+	if worker != nil {
+		worker.stop()
+	}
+}
+
+// attach 计算 各 分区 开始 位置 并 开始 消费
+func (this_ *tailWorker) attach() (err error) {
+	partitions := this_.TailParam.Partitions
+	if len(partitions) == 0 {
+		if partitions, err = this_.client.Partitions(this_.Topic); err != nil {
+			return
+		}
+	}
+	if this_.consumer, err = sarama.NewConsumerFromClient(this_.client); err != nil {
+		return
+	}
+	for _, partition := range partitions {
+		offset := sarama.OffsetNewest
+		switch this_.From {
+		case tailFromEarliest:
+			offset = sarama.OffsetOldest
+		case tailFromTime:
+			if offset, err = this_.client.GetOffset(this_.Topic, partition, this_.Time); err != nil {
+				return
+			}
+			// 没有 晚于 该 时间 的 消息
+			if offset < 0 {
+				offset = sarama.OffsetNewest
+			}
+		}
+		var pc sarama.PartitionConsumer
+		if pc, err = this_.consumer.ConsumePartition(this_.Topic, partition, offset); err != nil {
+			err = errors.New(fmt.Sprintf("分区[%d]消费失败:%s", partition, err.Error()))
+			return
+		}
+		this_.consumers[partition] = pc
+		this_.partitions[partition] = &TailPartition{
+			Partition:     partition,
+			Offset:        -1,
+			HighWaterMark: pc.HighWaterMarkOffset(),
+		}
+	}
+	return
+}
+
+func (this_ *tailWorker) closeConsumers() {
+	for _, pc := range this_.consumers {
+		_ = pc.Close()
+	}
+	if this_.consumer != nil {
+		_ = this_.consumer.Close()
+	}
+	_ = this_.client.Close()
+}
+
+func (this_ *tailWorker) stop() {
+	this_.lock.Lock()
+	if this_.isStopped {
+		this_.lock.Unlock()
+		return
+	}
+	this_.isStopped = true
+	this_.lock.Unlock()
+
+	util.Logger.Info("kafka tail worker stop", zap.Any("workerId", this_.workerId))
+	this_.cancel()
+	this_.closeConsumers()
+	_ = this_.ws.Close()
+}
+
+// startReadWS 页面 不通过 ws 发送 指令，只 用于 感知 连接 关闭
+func (this_ *tailWorker) startReadWS() {
+	defer func() {
+		if e := recover(); e != nil {
+			util.Logger.Error("kafka tail startReadWS panic error", zap.Any("error", e))
+		}
+		stopTailWorker(this_.workerId)
+	}()
+
+	for {
+		_, _, err := this_.ws.ReadMessage()
+		if err != nil {
+			break
+		}
+	}
+}
+
+func (this_ *tailWorker) startReadPartition(one *TailPartition, pc sarama.PartitionConsumer) {
+	defer func() {
+		if e := recover(); e != nil {
+			util.Logger.Error("kafka tail startReadPartition panic error", zap.Any("error", e))
+		}
+	}()
+
+	for {
+		if !this_.waitResume() {
+			return
+		}
+		select {
+		case <-this_.ctx.Done():
+			return
+		case e := <-pc.Errors():
+			if e == nil {
+				return
+			}
+			// 分区 消费 错误 由 sarama 重试，只 通知 页面
+			if !this_.write(&TailMessage{Type: "error", Error: fmt.Sprintf("分区[%d]:%s", one.Partition, e.Err.Error())}) {
+				return
+			}
+		case consumerMessage := <-pc.Messages():
+			if consumerMessage == nil {
+				return
+			}
+			// 等待 消息 时 暂停 的，恢复 后 再 推送
+			if !this_.waitResume() {
+				return
+			}
+			message := this_.onMessage(one, pc, consumerMessage)
+			if !this_.write(message) {
+				return
+			}
+		}
+	}
+}
+
+// waitResume 暂停 时 等待 恢复，返回 false 表示 已 停止
+func (this_ *tailWorker) waitResume() bool {
+	this_.lock.Lock()
+	resume := this_.resume
+	this_.lock.Unlock()
+	if resume == nil {
+		return true
+	}
+	select {
+	case <-resume:
+		return true
+	case <-this_.ctx.Done():
+		return false
+	}
+}
+
+// write 多个 分区 共用 连接，写入 需要 加锁，失败 时 停止
+func (this_ *tailWorker) write(message *TailMessage) bool {
+	this_.writeLock.Lock()
+	err := this_.ws.WriteJSON(message)
+	this_.writeLock.Unlock()
+	if err != nil {
+		if this_.ctx.Err() == nil {
+			util.Logger.Error("kafka tail ws write error", zap.Error(err))
+		}
+		stopTailWorker(this_.workerId)
+		return false
+	}
+	return true
+}
+
+// onMessage 解码 并 写入 缓冲，解码 失败 时 保留 原始 内容
+func (this_ *tailWorker) onMessage(one *TailPartition, pc sarama.PartitionConsumer, consumerMessage *sarama.ConsumerMessage) (message *TailMessage) {
+	msg, err := this_.messageCodec.toMessage(consumerMessage)
+	if err != nil {
+		message = &TailMessage{Type: "error", Error: fmt.Sprintf("分区[%d] offset[%d]转换失败:%s", consumerMessage.Partition, consumerMessage.Offset, err.Error())}
+		msg = nil
+	} else {
+		message = &TailMessage{Type: "message", Message: msg}
+	}
+
+	this_.lock.Lock()
+	defer this_.lock.Unlock()
+
+	one.Offset = consumerMessage.Offset + 1
+	one.HighWaterMark = pc.HighWaterMarkOffset()
+	this_.received++
+	if msg == nil {
+		return
+	}
+	size := tailMessageSize(msg)
+	this_.buffer = append(this_.buffer, &tailBuffered{message: msg, size: size})
+	this_.bufferBytes += size
+	// 单条 超过 字节 限制 的 消息 也 保留
+	for len(this_.buffer) > this_.bufferSize || (this_.bufferBytes > tailBufferBytesMax && len(this_.buffer) > 1) {
+		this_.bufferBytes -= this_.buffer[0].size
+		this_.buffer[0] = nil
+		this_.buffer = this_.buffer[1:]
+		this_.dropped++
+	}
+	return
+}
+
+func tailMessageSize(msg *Message) (size int) {
+	size = len(msg.Key) + len(msg.Value) + len(msg.KeyError) + len(msg.ValueError)
+	for _, header := range msg.Headers {
+		size += len(header.Key) + len(header.Value)
+	}
+	return
+}
+
+func (this_ *tailWorker) pause() {
+	this_.lock.Lock()
+	defer this_.lock.Unlock()
+
+	if this_.resume == nil {
+		this_.resume = make(chan struct{})
+	}
+}
+
+func (this_ *tailWorker) doResume() {
+	this_.lock.Lock()
+	defer this_.lock.Unlock()
+
+	if this_.resume != nil {
+		close(this_.resume)
+		this_.resume = nil
+	}
+}
+
+// messages 按 接收 顺序 返回 缓冲 中的 消息，页面 重新 打开 时 恢复
+func (this_ *tailWorker) messages() (list []*Message) {
+	this_.lock.Lock()
+	defer this_.lock.Unlock()
+
+	list = []*Message{}
+	for _, one := range this_.buffer {
+		list = append(list, one.message)
+	}
+	return
+}
+
+func (this_ *tailWorker) clean() {
+	this_.lock.Lock()
+	defer this_.lock.Unlock()
+
+	this_.buffer = nil
+	this_.bufferBytes = 0
+}
+
+func (this_ *tailWorker) status() (status *TailStatus) {
+	this_.lock.Lock()
+	defer this_.lock.Unlock()
+
+	status = &TailStatus{
+		WorkerId:    this_.workerId,
+		Topic:       this_.Topic,
+		Paused:      this_.resume != nil,
+		BufferSize:  this_.bufferSize,
+		Buffered:    len(this_.buffer),
+		BufferBytes: this_.bufferBytes,
+		Received:    this_.received,
+		Dropped:     this_.dropped,
+	}
+	for _, one := range this_.partitions {
+		partition := *one
+		status.Partitions = append(status.Partitions, &partition)
+	}
+	sort.Slice(status.Partitions, func(i, j int) bool {
+		return status.Partitions[i].Partition < status.Partitions[j].Partition
+	})
+	return
+}
@@ -1,8 +1,11 @@
 package module_redis
 
 import (
+	"context"
 	"encoding/base64"
+	"errors"
 	"github.com/gin-gonic/gin"
+	goRedis "github.com/go-redis/redis/v8"
 	"github.com/team-ide/go-tool/redis"
 	"github.com/team-ide/go-tool/util"
 	"go.uber.org/zap"
@@ -10,6 +13,7 @@ import (
 	"sort"
 	"strings"
 	"teamide/internal/module/module_toolbox"
+	"teamide/pkg/background"
 	"teamide/pkg/base"
 	"teamide/pkg/ssh"
 )
@@ -25,27 +29,85 @@ func NewApi(toolboxService *module_toolbox.ToolboxService) *api {
 }
 
 var (
-	Power              = base.AppendPower(&base.PowerAction{Action: "redis", Text: "Redis", ShouldLogin: true, StandAlone: true})
-	check              = base.AppendPower(&base.PowerAction{Action: "check", Text: "Redis测试", ShouldLogin: true, StandAlone: true, Parent: Power})
-	infoPower          = base.AppendPower(&base.PowerAction{Action: "info", Text: "Redis信息", ShouldLogin: true, StandAlone: true, Parent: Power})
-	getPower           = base.AppendPower(&base.PowerAction{Action: "get", Text: "Redis获取Key值", ShouldLogin: true, StandAlone: true, Parent: Power})
-	keysPower          = base.AppendPower(&base.PowerAction{Action: "keys", Text: "Redis查询Keys", ShouldLogin: true, StandAlone: true, Parent: Power})
-	scanPower          = base.AppendPower(&base.PowerAction{Action: "scan", Text: "Redis Scan", ShouldLogin: true, StandAlone: true, Parent: Power})
-	setPower           = base.AppendPower(&base.PowerAction{Action: "set", Text: "Redis设置值", ShouldLogin: true, StandAlone: true, Parent: Power})
-	saddPower          = base.AppendPower(&base.PowerAction{Action: "sadd", Text: "Redis SAdd", ShouldLogin: true, StandAlone: true, Parent: Power})
-	sremPower          = base.AppendPower(&base.PowerAction{Action: "srem", Text: "Redis SRem", ShouldLogin: true, StandAlone: true, Parent: Power})
-	lpushPower         = base.AppendPower(&base.PowerAction{Action: "lpush", Text: "Redis LPush", ShouldLogin: true, StandAlone: true, Parent: Power})
-	rpushPower         = base.AppendPower(&base.PowerAction{Action: "rpush", Text: "Redis RPush", ShouldLogin: true, StandAlone: true, Parent: Power})
-	lsetPower          = base.AppendPower(&base.PowerAction{Action: "lset", Text: "Redis LSet", ShouldLogin: true, StandAlone: true, Parent: Power})
-	lremPower          = base.AppendPower(&base.PowerAction{Action: "lrem", Text: "Redis LRem", ShouldLogin: true, StandAlone: true, Parent: Power})
-	hsetPower          = base.AppendPower(&base.PowerAction{Action: "hset", Text: "Redis HSet", ShouldLogin: true, StandAlone: true, Parent: Power})
-	hdelPower          = base.AppendPower(&base.PowerAction{Action: "hdel", Text: "Redis HDel", ShouldLogin: true, StandAlone: true, Parent: Power})
-	deletePower        = base.AppendPower(&base.PowerAction{Action: "delete", Text: "Redis删除Key", ShouldLogin: true, StandAlone: true, Parent: Power})
-	deletePatternPower = base.AppendPower(&base.PowerAction{Action: "deletePattern", Text: "Redis删除匹配Key", ShouldLogin: true, StandAlone: true, Parent: Power})
-	expirePower        = base.AppendPower(&base.PowerAction{Action: "expire", Text: "Redis设置过期", ShouldLogin: true, StandAlone: true, Parent: Power})
-	ttlPower           = base.AppendPower(&base.PowerAction{Action: "ttl", Text: "Redis过期时间查询", ShouldLogin: true, StandAlone: true, Parent: Power})
-	persistPower       = base.AppendPower(&base.PowerAction{Action: "persist", Text: "Redis移除过期时间", ShouldLogin: true, StandAlone: true, Parent: Power})
-	closePower         = base.AppendPower(&base.PowerAction{Action: "close", Text: "Redis关闭", ShouldLogin: true, StandAlone: true, Parent: Power})
+	Power                  = base.AppendPower(&base.PowerAction{Action: "redis", Text: "Redis", ShouldLogin: true, StandAlone: true})
+	check                  = base.AppendPower(&base.PowerAction{Action: "check", Text: "Redis测试", ShouldLogin: true, StandAlone: true, Parent: Power})
+	infoPower              = base.AppendPower(&base.PowerAction{Action: "info", Text: "Redis信息", ShouldLogin: true, StandAlone: true, Parent: Power})
+	getPower               = base.AppendPower(&base.PowerAction{Action: "get", Text: "Redis获取Key值", ShouldLogin: true, StandAlone: true, Parent: Power})
+	keysPower              = base.AppendPower(&base.PowerAction{Action: "keys", Text: "Redis查询Keys", ShouldLogin: true, StandAlone: true, Parent: Power})
+	scanPower              = base.AppendPower(&base.PowerAction{Action: "scan", Text: "Redis Scan", ShouldLogin: true, StandAlone: true, Parent: Power})
+	setPower               = base.AppendPower(&base.PowerAction{Action: "set", Text: "Redis设置值", ShouldLogin: true, StandAlone: true, Parent: Power})
+	saddPower              = base.AppendPower(&base.PowerAction{Action: "sadd", Text: "Redis SAdd", ShouldLogin: true, StandAlone: true, Parent: Power})
+	sremPower              = base.AppendPower(&base.PowerAction{Action: "srem", Text: "Redis SRem", ShouldLogin: true, StandAlone: true, Parent: Power})
+	lpushPower             = base.AppendPower(&base.PowerAction{Action: "lpush", Text: "Redis LPush", ShouldLogin: true, StandAlone: true, Parent: Power})
+	rpushPower             = base.AppendPower(&base.PowerAction{Action: "rpush", Text: "Redis RPush", ShouldLogin: true, StandAlone: true, Parent: Power})
+	lsetPower              = base.AppendPower(&base.PowerAction{Action: "lset", Text: "Redis LSet", ShouldLogin: true, StandAlone: true, Parent: Power})
+	lremPower              = base.AppendPower(&base.PowerAction{Action: "lrem", Text: "Redis LRem", ShouldLogin: true, StandAlone: true, Parent: Power})
+	hsetPower              = base.AppendPower(&base.PowerAction{Action: "hset", Text: "Redis HSet", ShouldLogin: true, StandAlone: true, Parent: Power})
+	hdelPower              = base.AppendPower(&base.PowerAction{Action: "hdel", Text: "Redis HDel", ShouldLogin: true, StandAlone: true, Parent: Power})
+	zaddPower              = base.AppendPower(&base.PowerAction{Action: "zadd", Text: "Redis ZAdd", ShouldLogin: true, StandAlone: true, Parent: Power})
+	zremPower              = base.AppendPower(&base.PowerAction{Action: "zrem", Text: "Redis ZRem", ShouldLogin: true, StandAlone: true, Parent: Power})
+	zincrbyPower           = base.AppendPower(&base.PowerAction{Action: "zincrby", Text: "Redis ZIncrBy", ShouldLogin: true, StandAlone: true, Parent: Power})
+	zrangePower            = base.AppendPower(&base.PowerAction{Action: "zrange", Text: "Redis ZRange", ShouldLogin: true, StandAlone: true, Parent: Power})
+	xaddPower              = base.AppendPower(&base.PowerAction{Action: "xadd", Text: "Redis XAdd", ShouldLogin: true, StandAlone: true, Parent: Power})
+	xrangePower            = base.AppendPower(&base.PowerAction{Action: "xrange", Text: "Redis XRange", ShouldLogin: true, StandAlone: true, Parent: Power})
+	xdelPower              = base.AppendPower(&base.PowerAction{Action: "xdel", Text: "Redis XDel", ShouldLogin: true, StandAlone: true, Parent: Power})
+	xtrimPower             = base.AppendPower(&base.PowerAction{Action: "xtrim", Text: "Redis XTrim", ShouldLogin: true, StandAlone: true, Parent: Power})
+	xgroupCreatePower      = base.AppendPower(&base.PowerAction{Action: "xgroupCreate", Text: "Redis XGroup创建", ShouldLogin: true, StandAlone: true, Parent: Power})
+	xgroupSetIdPower       = base.AppendPower(&base.PowerAction{Action: "xgroupSetId", Text: "Redis XGroup设置ID", ShouldLogin: true, StandAlone: true, Parent: Power})
+	xgroupDestroyPower     = base.AppendPower(&base.PowerAction{Action: "xgroupDestroy", Text: "Redis XGroup删除", ShouldLogin: true, StandAlone: true, Parent: Power})
+	xgroupDelConsumerPower = base.AppendPower(&base.PowerAction{Action: "xgroupDelConsumer", Text: "Redis XGroup删除消费者", ShouldLogin: true, StandAlone: true, Parent: Power})
+	xinfoStreamPower       = base.AppendPower(&base.PowerAction{Action: "xinfoStream", Text: "Redis XInfo Stream", ShouldLogin: true, StandAlone: true, Parent: Power})
+	xinfoGroupsPower       = base.AppendPower(&base.PowerAction{Action: "xinfoGroups", Text: "Redis XInfo Groups", ShouldLogin: true, StandAlone: true, Parent: Power})
+	xinfoConsumersPower    = base.AppendPower(&base.PowerAction{Action: "xinfoConsumers", Text: "Redis XInfo Consumers", ShouldLogin: true, StandAlone: true, Parent: Power})
+	xpendingPower          = base.AppendPower(&base.PowerAction{Action: "xpending", Text: "Redis XPending", ShouldLogin: true, StandAlone: true, Parent: Power})
+	xackPower              = base.AppendPower(&base.PowerAction{Action: "xack", Text: "Redis XAck", ShouldLogin: true, StandAlone: true, Parent: Power})
+	xclaimPower            = base.AppendPower(&base.PowerAction{Action: "xclaim", Text: "Redis XClaim", ShouldLogin: true, StandAlone: true, Parent: Power})
+	pubSubPower            = base.AppendPower(&base.PowerAction{Action: "pubSub", Text: "Redis订阅", ShouldLogin: true, StandAlone: true, Parent: Power})
+	pubSubWebsocketPower   = base.AppendPower(&base.PowerAction{Action: "websocket", Text: "Redis订阅WebSocket", ShouldLogin: true, StandAlone: true, Parent: pubSubPower})
+	pubSubSubscribePower   = base.AppendPower(&base.PowerAction{Action: "subscribe", Text: "Redis订阅渠道", ShouldLogin: true, StandAlone: true, Parent: pubSubPower})
+	pubSubUnsubscribePower = base.AppendPower(&base.PowerAction{Action: "unsubscribe", Text: "Redis取消订阅渠道", ShouldLogin: true, StandAlone: true, Parent: pubSubPower})
+	pubSubFilterPower      = base.AppendPower(&base.PowerAction{Action: "filter", Text: "Redis订阅过滤", ShouldLogin: true, StandAlone: true, Parent: pubSubPower})
+	pubSubMessagesPower    = base.AppendPower(&base.PowerAction{Action: "messages", Text: "Redis订阅消息", ShouldLogin: true, StandAlone: true, Parent: pubSubPower})
+	pubSubCleanPower       = base.AppendPower(&base.PowerAction{Action: "clean", Text: "Redis订阅消息清理", ShouldLogin: true, StandAlone: true, Parent: pubSubPower})
+	pubSubStatusPower      = base.AppendPower(&base.PowerAction{Action: "status", Text: "Redis订阅状态", ShouldLogin: true, StandAlone: true, Parent: pubSubPower})
+	pubSubClosePower       = base.AppendPower(&base.PowerAction{Action: "close", Text: "Redis订阅关闭", ShouldLogin: true, StandAlone: true, Parent: pubSubPower})
+	publishPower           = base.AppendPower(&base.PowerAction{Action: "publish", Text: "Redis发布消息", ShouldLogin: true, StandAlone: true, Parent: Power})
+	keyspaceNotifyPower    = base.AppendPower(&base.PowerAction{Action: "keyspaceNotify", Text: "Redis键空间通知", ShouldLogin: true, StandAlone: true, Parent: Power})
+	evalPower              = base.AppendPower(&base.PowerAction{Action: "eval", Text: "Redis Eval", ShouldLogin: true, StandAlone: true, Parent: Power})
+	evalShaPower           = base.AppendPower(&base.PowerAction{Action: "evalSha", Text: "Redis EvalSha", ShouldLogin: true, StandAlone: true, Parent: Power})
+	scriptPower            = base.AppendPower(&base.PowerAction{Action: "script", Text: "Redis脚本", ShouldLogin: true, StandAlone: true, Parent: Power})
+	scriptLoadPower        = base.AppendPower(&base.PowerAction{Action: "load", Text: "Redis Script Load", ShouldLogin: true, StandAlone: true, Parent: scriptPower})
+	scriptFlushPower       = base.AppendPower(&base.PowerAction{Action: "flush", Text: "Redis Script Flush", ShouldLogin: true, StandAlone: true, Parent: scriptPower})
+	scriptKillPower        = base.AppendPower(&base.PowerAction{Action: "kill", Text: "Redis Script Kill", ShouldLogin: true, StandAlone: true, Parent: scriptPower})
+	scriptExistsPower      = base.AppendPower(&base.PowerAction{Action: "exists", Text: "Redis Script Exists", ShouldLogin: true, StandAlone: true, Parent: scriptPower})
+	scriptQueryPower       = base.AppendPower(&base.PowerAction{Action: "query", Text: "Redis脚本查询", ShouldLogin: true, StandAlone: true, Parent: scriptPower})
+	scriptSavePower        = base.AppendPower(&base.PowerAction{Action: "save", Text: "Redis脚本保存", ShouldLogin: true, StandAlone: true, Parent: scriptPower})
+	scriptDeletePower      = base.AppendPower(&base.PowerAction{Action: "delete", Text: "Redis脚本删除", ShouldLogin: true, StandAlone: true, Parent: scriptPower})
+	analyzePower           = base.AppendPower(&base.PowerAction{Action: "analyze", Text: "Redis内存分析", ShouldLogin: true, StandAlone: true, Parent: Power})
+	comparePower           = base.AppendPower(&base.PowerAction{Action: "compare", Text: "Redis实例对比", ShouldLogin: true, StandAlone: true, Parent: Power})
+	copyPower              = base.AppendPower(&base.PowerAction{Action: "copy", Text: "Redis Key复制", ShouldLogin: true, StandAlone: true, Parent: Power})
+	taskStatusPower        = base.AppendPower(&base.PowerAction{Action: "taskStatus", Text: "Redis任务状态", ShouldLogin: true, StandAlone: true, Parent: Power})
+	taskStopPower          = base.AppendPower(&base.PowerAction{Action: "taskStop", Text: "Redis任务停止", ShouldLogin: true, StandAlone: true, Parent: Power})
+	taskCleanPower         = base.AppendPower(&base.PowerAction{Action: "taskClean", Text: "Redis任务清理", ShouldLogin: true, StandAlone: true, Parent: Power})
+	slowLogGetPower        = base.AppendPower(&base.PowerAction{Action: "slowLogGet", Text: "Redis慢日志查询", ShouldLogin: true, StandAlone: true, Parent: Power})
+	slowLogResetPower      = base.AppendPower(&base.PowerAction{Action: "slowLogReset", Text: "Redis慢日志重置", ShouldLogin: true, StandAlone: true, Parent: Power})
+	clientListPower        = base.AppendPower(&base.PowerAction{Action: "clientList", Text: "Redis客户端查询", ShouldLogin: true, StandAlone: true, Parent: Power})
+	clientKillPower        = base.AppendPower(&base.PowerAction{Action: "clientKill", Text: "Redis客户端终止", ShouldLogin: true, StandAlone: true, Parent: Power})
+	configGetPower         = base.AppendPower(&base.PowerAction{Action: "configGet", Text: "Redis配置查询", ShouldLogin: true, StandAlone: true, Parent: Power})
+	configSetPower         = base.AppendPower(&base.PowerAction{Action: "configSet", Text: "Redis配置修改", ShouldLogin: true, StandAlone: true, Parent: Power})
+	monitorPower           = base.AppendPower(&base.PowerAction{Action: "monitor", Text: "Redis Monitor", ShouldLogin: true, StandAlone: true, Parent: Power})
+	topologyPower          = base.AppendPower(&base.PowerAction{Action: "topology", Text: "Redis集群拓扑", ShouldLogin: true, StandAlone: true, Parent: Power})
+	codecsPower            = base.AppendPower(&base.PowerAction{Action: "codecs", Text: "Redis值编解码", ShouldLogin: true, StandAlone: true, Parent: Power})
+	codecPower             = base.AppendPower(&base.PowerAction{Action: "codec", Text: "Redis值编解码规则", ShouldLogin: true, StandAlone: true, Parent: Power})
+	codecQueryPower        = base.AppendPower(&base.PowerAction{Action: "query", Text: "Redis值编解码规则查询", ShouldLogin: true, StandAlone: true, Parent: codecPower})
+	codecSavePower         = base.AppendPower(&base.PowerAction{Action: "save", Text: "Redis值编解码规则保存", ShouldLogin: true, StandAlone: true, Parent: codecPower})
+	codecDeletePower       = base.AppendPower(&base.PowerAction{Action: "delete", Text: "Redis值编解码规则删除", ShouldLogin: true, StandAlone: true, Parent: codecPower})
+	deletePower            = base.AppendPower(&base.PowerAction{Action: "delete", Text: "Redis删除Key", ShouldLogin: true, StandAlone: true, Parent: Power})
+	deletePatternPower     = base.AppendPower(&base.PowerAction{Action: "deletePattern", Text: "Redis删除匹配Key", ShouldLogin: true, StandAlone: true, Parent: Power})
+	expirePower            = base.AppendPower(&base.PowerAction{Action: "expire", Text: "Redis设置过期", ShouldLogin: true, StandAlone: true, Parent: Power})
+	ttlPower               = base.AppendPower(&base.PowerAction{Action: "ttl", Text: "Redis过期时间查询", ShouldLogin: true, StandAlone: true, Parent: Power})
+	persistPower           = base.AppendPower(&base.PowerAction{Action: "persist", Text: "Redis移除过期时间", ShouldLogin: true, StandAlone: true, Parent: Power})
+	closePower             = base.AppendPower(&base.PowerAction{Action: "close", Text: "Redis关闭", ShouldLogin: true, StandAlone: true, Parent: Power})
 )
 
 func (this_ *api) GetApis() (apis []*base.ApiWorker) {
@@ -63,6 +125,61 @@ func (this_ *api) GetApis() (apis []*base.ApiWorker) {
 	apis = append(apis, &base.ApiWorker{Power: lremPower, Do: this_.lrem})
 	apis = append(apis, &base.ApiWorker{Power: hsetPower, Do: this_.hset})
 	apis = append(apis, &base.ApiWorker{Power: hdelPower, Do: this_.hdel})
+	apis = append(apis, &base.ApiWorker{Power: zaddPower, Do: this_.zadd})
+	apis = append(apis, &base.ApiWorker{Power: zremPower, Do: this_.zrem})
+	apis = append(apis, &base.ApiWorker{Power: zincrbyPower, Do: this_.zincrby})
+	apis = append(apis, &base.ApiWorker{Power: zrangePower, Do: this_.zrange})
+	apis = append(apis, &base.ApiWorker{Power: xaddPower, Do: this_.xadd})
+	apis = append(apis, &base.ApiWorker{Power: xrangePower, Do: this_.xrange})
+	apis = append(apis, &base.ApiWorker{Power: xdelPower, Do: this_.xdel})
+	apis = append(apis, &base.ApiWorker{Power: xtrimPower, Do: this_.xtrim})
+	apis = append(apis, &base.ApiWorker{Power: xgroupCreatePower, Do: this_.xgroupCreate})
+	apis = append(apis, &base.ApiWorker{Power: xgroupSetIdPower, Do: this_.xgroupSetId})
+	apis = append(apis, &base.ApiWorker{Power: xgroupDestroyPower, Do: this_.xgroupDestroy})
+	apis = append(apis, &base.ApiWorker{Power: xgroupDelConsumerPower, Do: this_.xgroupDelConsumer})
+	apis = append(apis, &base.ApiWorker{Power: xinfoStreamPower, Do: this_.xinfoStream})
+	apis = append(apis, &base.ApiWorker{Power: xinfoGroupsPower, Do: this_.xinfoGroups})
+	apis = append(apis, &base.ApiWorker{Power: xinfoConsumersPower, Do: this_.xinfoConsumers})
+	apis = append(apis, &base.ApiWorker{Power: xpendingPower, Do: this_.xpending})
+	apis = append(apis, &base.ApiWorker{Power: xackPower, Do: this_.xack})
+	apis = append(apis, &base.ApiWorker{Power: xclaimPower, Do: this_.xclaim})
+	apis = append(apis, &base.ApiWorker{Power: pubSubWebsocketPower, Do: this_.pubSubWebsocket, IsWebSocket: true})
+	apis = append(apis, &base.ApiWorker{Power: pubSubSubscribePower, Do: this_.pubSubSubscribe})
+	apis = append(apis, &base.ApiWorker{Power: pubSubUnsubscribePower, Do: this_.pubSubUnsubscribe})
+	apis = append(apis, &base.ApiWorker{Power: pubSubFilterPower, Do: this_.pubSubFilter})
+	apis = append(apis, &base.ApiWorker{Power: pubSubMessagesPower, Do: this_.pubSubMessages, NotRecodeLog: true})
+	apis = append(apis, &base.ApiWorker{Power: pubSubCleanPower, Do: this_.pubSubClean})
+	apis = append(apis, &base.ApiWorker{Power: pubSubStatusPower, Do: this_.pubSubStatus, NotRecodeLog: true})
+	apis = append(apis, &base.ApiWorker{Power: pubSubClosePower, Do: this_.pubSubClose})
+	apis = append(apis, &base.ApiWorker{Power: publishPower, Do: this_.publish})
+	apis = append(apis, &base.ApiWorker{Power: keyspaceNotifyPower, Do: this_.keyspaceNotify})
+	apis = append(apis, &base.ApiWorker{Power: evalPower, Do: this_.eval})
+	apis = append(apis, &base.ApiWorker{Power: evalShaPower, Do: this_.evalSha})
+	apis = append(apis, &base.ApiWorker{Power: scriptLoadPower, Do: this_.scriptLoad})
+	apis = append(apis, &base.ApiWorker{Power: scriptFlushPower, Do: this_.scriptFlush})
+	apis = append(apis, &base.ApiWorker{Power: scriptKillPower, Do: this_.scriptKill})
+	apis = append(apis, &base.ApiWorker{Power: scriptExistsPower, Do: this_.scriptExists})
+	apis = append(apis, &base.ApiWorker{Power: scriptQueryPower, Do: this_.scriptQuery})
+	apis = append(apis, &base.ApiWorker{Power: scriptSavePower, Do: this_.scriptSave})
+	apis = append(apis, &base.ApiWorker{Power: scriptDeletePower, Do: this_.scriptDelete})
+	apis = append(apis, &base.ApiWorker{Power: analyzePower, Do: this_.analyze})
+	apis = append(apis, &base.ApiWorker{Power: comparePower, Do: this_.compare})
+	apis = append(apis, &base.ApiWorker{Power: copyPower, Do: this_.copy})
+	apis = append(apis, &base.ApiWorker{Power: taskStatusPower, Do: this_.taskStatus, NotRecodeLog: true})
+	apis = append(apis, &base.ApiWorker{Power: taskStopPower, Do: this_.taskStop})
+	apis = append(apis, &base.ApiWorker{Power: taskCleanPower, Do: this_.taskClean})
+	apis = append(apis, &base.ApiWorker{Power: slowLogGetPower, Do: this_.slowLogGet, NotRecodeLog: true})
+	apis = append(apis, &base.ApiWorker{Power: slowLogResetPower, Do: this_.slowLogReset})
+	apis = append(apis, &base.ApiWorker{Power: clientListPower, Do: this_.clientList, NotRecodeLog: true})
+	apis = append(apis, &base.ApiWorker{Power: clientKillPower, Do: this_.clientKill})
+	apis = append(apis, &base.ApiWorker{Power: configGetPower, Do: this_.configGet, NotRecodeLog: true})
+	apis = append(apis, &base.ApiWorker{Power: configSetPower, Do: this_.configSet})
+	apis = append(apis, &base.ApiWorker{Power: monitorPower, Do: this_.monitor, IsWebSocket: true})
+	apis = append(apis, &base.ApiWorker{Power: topologyPower, Do: this_.topology})
+	apis = append(apis, &base.ApiWorker{Power: codecsPower, Do: this_.codecs})
+	apis = append(apis, &base.ApiWorker{Power: codecQueryPower, Do: this_.codecQuery})
+	apis = append(apis, &base.ApiWorker{Power: codecSavePower, Do: this_.codecSave})
+	apis = append(apis, &base.ApiWorker{Power: codecDeletePower, Do: this_.codecDelete})
 	apis = append(apis, &base.ApiWorker{Power: deletePower, Do: this_.delete})
 	apis = append(apis, &base.ApiWorker{Power: deletePatternPower, Do: this_.deletePattern})
 	apis = append(apis, &base.ApiWorker{Power: expirePower, Do: this_.expire})
@@ -73,25 +190,41 @@ func (this_ *api) GetApis() (apis []*base.ApiWorker) {
 	return
 }
 
-func (this_ *api) getConfig(requestBean *base.RequestBean, c *gin.Context) (config *redis.Config, sshConfig *ssh.Config, err error) {
-	config = &redis.Config{}
-	sshConfig, err = this_.toolboxService.BindConfig(requestBean, c, config)
+func (this_ *api) getConfig(requestBean *base.RequestBean, c *gin.Context) (config *Config, sshConfig *ssh.Config, err error) {
+	redisConfig := &redis.Config{}
+	sshConfig, err = this_.toolboxService.BindConfig(requestBean, c, redisConfig)
 	if err != nil {
 		return
 	}
+	var toolboxId int64
+	var option string
+	if v := requestBean.GetExtend("toolboxModel"); v != nil {
+		toolboxId = v.(*module_toolbox.ToolboxModel).ToolboxId
+		option = v.(*module_toolbox.ToolboxModel).Option
+	}
+	config, err = this_.newConfig(toolboxId, option, redisConfig)
 	return
 }
 
-func getServiceKey(redisConfig *redis.Config, sshConfig *ssh.Config) (key string) {
-	key = "redis-" + redisConfig.Address
-	if redisConfig.Username != "" {
-		key += "-" + base.GetMd5String(key+redisConfig.Username)
+func getServiceKey(config *Config, sshConfig *ssh.Config) (key string) {
+	key = "redis-" + config.Address
+	if config.Mode != modeAuto {
+		key += "-" + config.Mode
+	}
+	if config.MasterName != "" {
+		key += "-" + config.MasterName
+	}
+	if config.Username != "" {
+		key += "-" + base.GetMd5String(key+config.Username)
 	}
-	if redisConfig.Auth != "" {
-		key += "-" + base.GetMd5String(key+redisConfig.Auth)
+	if config.Auth != "" {
+		key += "-" + base.GetMd5String(key+config.Auth)
 	}
-	if redisConfig.CertPath != "" {
-		key += "-" + base.GetMd5String(key+redisConfig.CertPath)
+	if config.SentinelUsername != "" || config.SentinelPassword != "" {
+		key += "-" + base.GetMd5String(key+config.SentinelUsername+config.SentinelPassword)
+	}
+	if config.CertPath != "" {
+		key += "-" + base.GetMd5String(key+config.CertPath)
 	}
 	if sshConfig != nil {
 		key += "-ssh-" + sshConfig.Address
@@ -100,8 +233,8 @@ func getServiceKey(redisConfig *redis.Config, sshConfig *ssh.Config) (key string
 	return
 }
 
-func getService(redisConfig *redis.Config, sshConfig *ssh.Config) (res redis.IService, err error) {
-	key := getServiceKey(redisConfig, sshConfig)
+func getService(config *Config, sshConfig *ssh.Config) (res redis.IService, err error) {
+	key := getServiceKey(config, sshConfig)
 	var serviceInfo *base.ServiceInfo
 	serviceInfo, err = base.GetService(key, func() (res *base.ServiceInfo, err error) {
 		var s redis.IService
@@ -112,9 +245,9 @@ func getService(redisConfig *redis.Config, sshConfig *ssh.Config) (res redis.ISe
 				util.Logger.Error("getRedisService ssh NewClient error", zap.Any("key", key), zap.Error(err))
 				return
 			}
-			redisConfig.SSHClient = sshClient
+			config.SSHClient = sshClient
 		}
-		s, err = redis.New(redisConfig)
+		s, err = config.newService()
 		if err != nil {
 			util.Logger.Error("getRedisService error", zap.Any("key", key), zap.Error(err))
 			if s != nil {
@@ -148,6 +281,64 @@ func getService(redisConfig *redis.Config, sshConfig *ssh.Config) (res redis.ISe
 	return
 }
 
+// getClient 获取 go-redis 原生客户端，用于 IService 未封装的指令
+func getClient(service redis.IService, database int) (client goRedis.Cmdable, ctx context.Context, err error) {
+	param := &redis.Param{Ctx: context.Background(), Database: database}
+	client, err = service.GetClient(param)
+	if err != nil {
+		return
+	}
+	ctx = param.Ctx
+	return
+}
+
+// doClient go-redis Client 和 ClusterClient 都有，但 Cmdable 未 包含 的 方法
+type doClient interface {
+	goRedis.Cmdable
+	Do(ctx context.Context, args ...interface{}) *goRedis.Cmd
+	SlowLogGet(ctx context.Context, num int64) *goRedis.SlowLogCmd
+}
+
+// getDoClient 获取 支持 任意 指令 的 客户端
+func getDoClient(service redis.IService, database int) (client doClient, ctx context.Context, err error) {
+	c, ctx, err := getClient(service, database)
+	if err != nil {
+		return
+	}
+	client, ok := c.(doClient)
+	if !ok {
+		err = errors.New("redis client not support do command")
+		return
+	}
+	return
+}
+
+// getConnClient 获取 独占 连接 并 切换 库，用于 长时间 执行 的 任务，使用 后 需要 关闭
+func getConnClient(service redis.IService, database int) (client goRedis.Cmdable, closeConn func(), err error) {
+	ctx := context.Background()
+	client, err = service.GetClient(&redis.Param{Ctx: ctx})
+	if err != nil {
+		return
+	}
+	closeConn = func() {}
+	c, ok := client.(*goRedis.Client)
+	if !ok {
+		// 集群 只有 0 库
+		return
+	}
+	conn := c.Conn(ctx)
+	err = conn.Select(ctx, database).Err()
+	if err != nil {
+		_ = conn.Close()
+		return
+	}
+	client = conn
+	closeConn = func() {
+		_ = conn.Close()
+	}
+	return
+}
+
 type BaseRequest struct {
 	Key        string `json:"key"`
 	KeyBase64  string `json:"keyBase64"`
@@ -163,6 +354,53 @@ type BaseRequest struct {
 	Field      string `json:"field"`
 	TaskKey    string `json:"taskKey,omitempty"`
 	Expire     int64  `json:"expire"`
+
+	Score     float64    `json:"score"`
+	Members   []*ZMember `json:"members"`
+	RangeType string     `json:"rangeType"` // zset 范围类型 index、score、lex
+	Min       string     `json:"min"`
+	Max       string     `json:"max"`
+	Rev       bool       `json:"rev"`
+	Nx        bool       `json:"nx"`
+	Xx        bool       `json:"xx"`
+	Id        string     `json:"id"`
+	Ids       []string   `json:"ids"`
+	Fields    []*XField  `json:"fields"`
+	Start     string     `json:"start"`
+	End       string     `json:"end"`
+	MaxLen    int64      `json:"maxLen"`
+	MinId     string     `json:"minId"`
+	Approx    bool       `json:"approx"`
+	MkStream  bool       `json:"mkStream"`
+	Group     string     `json:"group"`
+	Consumer  string     `json:"consumer"`
+	MinIdle   int64      `json:"minIdle"` // 毫秒
+
+	WorkerId string        `json:"workerId"`
+	Channel  string        `json:"channel"`
+	Channels []string      `json:"channels"`
+	Patterns []string      `json:"patterns"`
+	Keyspace bool          `json:"keyspace"` // 订阅 Pattern 匹配的 键空间 通知
+	Filter   *PubSubFilter `json:"filter"`
+
+	Script        string   `json:"script"`
+	Sha           string   `json:"sha"`
+	ShaList       []string `json:"shaList"`
+	Keys          []string `json:"keys"`
+	Args          []string `json:"args"`
+	Timeout       int64    `json:"timeout"`       // 脚本 超时 秒
+	KillOnTimeout bool     `json:"killOnTimeout"` // 超时 后 是否 执行 SCRIPT KILL
+
+	Addr    string        `json:"addr"`
+	TaskId  string        `json:"taskId"`
+	Analyze *AnalyzeParam `json:"analyze"`
+	Compare *CompareParam `json:"compare"`
+	Copy    *CopyParam    `json:"copy"`
+
+	NodeAddress string `json:"nodeAddress"` // 指定 节点，集群 模式 可 为 主节点 或 副本
+
+	Codec       string `json:"codec"` // 值 编解码，多个 使用 “,” 隔开，raw 表示 不 解码
+	MessageType string `json:"messageType"`
 }
 
 func (this_ *BaseRequest) getKey() string {
@@ -198,6 +436,22 @@ func (this_ *api) info(requestBean *base.RequestBean, c *gin.Context) (res inter
 		return
 	}
 
+	request := &BaseRequest{}
+	if !base.RequestJSON(request, c) {
+		return
+	}
+	if request.NodeAddress != "" {
+		var node doClient
+		var ctx context.Context
+		var closeNode func()
+		node, ctx, closeNode, err = getNodeDoClient(service, request.NodeAddress)
+		if err != nil {
+			return
+		}
+		defer closeNode()
+		res, err = node.Info(ctx).Result()
+		return
+	}
 	res, err = service.Info(&redis.Param{})
 	if err != nil {
 		return
@@ -219,11 +473,24 @@ func (this_ *api) get(requestBean *base.RequestBean, c *gin.Context) (res interf
 	if !base.RequestJSON(request, c) {
 		return
 	}
-	res, err = service.GetValueInfo(request.getKey(), redis.NewStartArg(request.ValueStart), redis.NewSizeArg(request.ValueSize), &redis.Param{Database: request.Database})
+	var valueInfo *redis.ValueInfo
+	if request.NodeAddress != "" {
+		var client goRedis.Cmdable
+		var ctx context.Context
+		var closeConn func()
+		client, ctx, closeConn, err = getNodeConn(service, request.NodeAddress, request.Database)
+		if err != nil {
+			return
+		}
+		defer closeConn()
+		valueInfo, err = redis.GetValueInfo(ctx, client, request.Database, request.getKey(), int64(request.ValueStart), request.ValueSize)
+	} else {
+		valueInfo, err = service.GetValueInfo(request.getKey(), redis.NewStartArg(request.ValueStart), redis.NewSizeArg(request.ValueSize), &redis.Param{Database: request.Database})
+	}
 	if err != nil {
 		return
 	}
-
+	res, err = this_.decodeValueInfo(config, request, valueInfo)
 	return
 }
 
@@ -300,7 +567,7 @@ func (this_ *api) scan(requestBean *base.RequestBean, c *gin.Context) (res inter
 	if request.Count > 0 {
 		count = redis.NewCountArg(request.Count)
 	}
-	kR, err := service.Scan(request.Pattern, size, count, &redis.Param{Database: request.Database})
+	kR, err := this_.scanNodes(service, request, size, count)
 	if err != nil {
 		return
 	}
@@ -324,6 +591,36 @@ func (this_ *api) scan(requestBean *base.RequestBean, c *gin.Context) (res inter
 	return
 }
 
+// scanNodes 指定 节点 时 只 扫描 该 节点，集群 模式 逐个 扫描 主节点 并 合并
+func (this_ *api) scanNodes(service redis.IService, request *BaseRequest, size *redis.SizeArg, count *redis.CountArg) (kR *redis.KeysResult, err error) {
+	client, ctx, err := getClient(service, request.Database)
+	if err != nil {
+		return
+	}
+	_, isCluster := client.(*goRedis.ClusterClient)
+	if !isCluster && request.NodeAddress == "" {
+		kR, err = service.Scan(request.Pattern, size, count, &redis.Param{Database: request.Database})
+		return
+	}
+	if request.NodeAddress != "" {
+		var closeConn func()
+		client, ctx, closeConn, err = getNodeConn(service, request.NodeAddress, request.Database)
+		if err != nil {
+			return
+		}
+		defer closeConn()
+	}
+	kR = &redis.KeysResult{
+		Database: request.Database,
+	}
+	kR.KeyList, err = scanMerge(ctx, client, request.Pattern, request.Size, request.Count)
+	if err != nil {
+		return
+	}
+	kR.Count = int64(len(kR.KeyList))
+	return
+}
+
 func (this_ *api) set(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
 	config, sshConfig, err := this_.getConfig(requestBean, c)
 	if err != nil {
@@ -338,6 +635,9 @@ func (this_ *api) set(requestBean *base.RequestBean, c *gin.Context) (res interf
 	if !base.RequestJSON(request, c) {
 		return
 	}
+	if err = encodeRequestValue(config, request); err != nil {
+		return
+	}
 
 	err = service.Set(request.getKey(), request.Value, &redis.Param{Database: request.Database})
 	if err != nil {
@@ -363,6 +663,9 @@ func (this_ *api) sadd(requestBean *base.RequestBean, c *gin.Context) (res inter
 	if !base.RequestJSON(request, c) {
 		return
 	}
+	if err = encodeRequestValue(config, request); err != nil {
+		return
+	}
 
 	err = service.SetAdd(request.getKey(), request.Value, &redis.Param{Database: request.Database})
 	return
@@ -382,6 +685,9 @@ func (this_ *api) srem(requestBean *base.RequestBean, c *gin.Context) (res inter
 	if !base.RequestJSON(request, c) {
 		return
 	}
+	if err = encodeRequestValue(config, request); err != nil {
+		return
+	}
 
 	err = service.SetRem(request.getKey(), request.Value, &redis.Param{Database: request.Database})
 	return
@@ -400,6 +706,9 @@ func (this_ *api) lpush(requestBean *base.RequestBean, c *gin.Context) (res inte
 	if !base.RequestJSON(request, c) {
 		return
 	}
+	if err = encodeRequestValue(config, request); err != nil {
+		return
+	}
 
 	err = service.ListPush(request.getKey(), request.Value, &redis.Param{Database: request.Database})
 	return
@@ -419,6 +728,9 @@ func (this_ *api) rpush(requestBean *base.RequestBean, c *gin.Context) (res inte
 	if !base.RequestJSON(request, c) {
 		return
 	}
+	if err = encodeRequestValue(config, request); err != nil {
+		return
+	}
 
 	err = service.ListRPush(request.getKey(), request.Value, &redis.Param{Database: request.Database})
 	return
@@ -438,6 +750,9 @@ func (this_ *api) lset(requestBean *base.RequestBean, c *gin.Context) (res inter
 	if !base.RequestJSON(request, c) {
 		return
 	}
+	if err = encodeRequestValue(config, request); err != nil {
+		return
+	}
 
 	err = service.ListSet(request.getKey(), request.Index, request.Value, &redis.Param{Database: request.Database})
 	return
@@ -457,6 +772,9 @@ func (this_ *api) lrem(requestBean *base.RequestBean, c *gin.Context) (res inter
 	if !base.RequestJSON(request, c) {
 		return
 	}
+	if err = encodeRequestValue(config, request); err != nil {
+		return
+	}
 
 	err = service.ListRem(request.getKey(), request.Count, request.Value, &redis.Param{Database: request.Database})
 	return
@@ -476,6 +794,9 @@ func (this_ *api) hset(requestBean *base.RequestBean, c *gin.Context) (res inter
 	if !base.RequestJSON(request, c) {
 		return
 	}
+	if err = encodeRequestValue(config, request); err != nil {
+		return
+	}
 
 	err = service.HashSet(request.getKey(), request.Field, request.Value, &redis.Param{Database: request.Database})
 	return
@@ -667,5 +988,11 @@ func (this_ *api) importClean(requestBean *base.RequestBean, c *gin.Context) (re
 
 func (this_ *api) close(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
 
+	var request = &BaseRequest{}
+	if !base.RequestJSON(request, c) {
+		return
+	}
+
+	background.RemoveWorkerTasks(request.WorkerId)
 	return
 }
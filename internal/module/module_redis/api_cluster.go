@@ -0,0 +1,428 @@
+package module_redis
+
+import (
+	"context"
+	"errors"
+	"github.com/gin-gonic/gin"
+	goRedis "github.com/go-redis/redis/v8"
+	"github.com/team-ide/go-tool/redis"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"teamide/pkg/base"
+)
+
+type SlotRange struct {
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+}
+
+type ClusterNode struct {
+	Id        string       `json:"id,omitempty"`
+	Address   string       `json:"address"`
+	Role      string       `json:"role"` // master、replica
+	MasterId  string       `json:"masterId,omitempty"`
+	Master    string       `json:"master,omitempty"` // 副本 对应 的 主节点 地址
+	Flags     []string     `json:"flags"`
+	LinkState string       `json:"linkState,omitempty"`
+	Fail      bool         `json:"fail"`
+	Slots     []*SlotRange `json:"slots"`
+	SlotCount int64        `json:"slotCount"`
+}
+
+type ClusterShard struct {
+	Master    *ClusterNode   `json:"master"`
+	Replicas  []*ClusterNode `json:"replicas"`
+	Slots     []*SlotRange   `json:"slots"`
+	SlotCount int64          `json:"slotCount"`
+}
+
+type Topology struct {
+	Mode       string          `json:"mode"` // standalone、cluster、sentinel
+	MasterName string          `json:"masterName,omitempty"`
+	Sentinels  []string        `json:"sentinels,omitempty"`
+	Nodes      []*ClusterNode  `json:"nodes"`
+	Shards     []*ClusterShard `json:"shards"`
+}
+
+// parseClusterNodes 解析 CLUSTER NODES 输出，如：
+// <id> <ip:port@cport[,hostname]> <flags> <master> <ping-sent> <pong-recv> <config-epoch> <link-state> <slot> <slot> ...
+func parseClusterNodes(text string) (nodes []*ClusterNode) {
+	nodes = []*ClusterNode{}
+	for _, line := range strings.Split(text, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 8 {
+			continue
+		}
+		node := &ClusterNode{
+			Id:        fields[0],
+			Address:   fields[1],
+			Flags:     strings.Split(fields[2], ","),
+			LinkState: fields[7],
+			Slots:     []*SlotRange{},
+		}
+		if index := strings.IndexAny(node.Address, "@,"); index >= 0 {
+			node.Address = node.Address[:index]
+		}
+		if fields[3] != "-" {
+			node.MasterId = fields[3]
+		}
+		node.Role = "master"
+		for _, flag := range node.Flags {
+			switch flag {
+			case "slave":
+				node.Role = "replica"
+			case "fail", "fail?":
+				node.Fail = true
+			}
+		}
+		for _, slot := range fields[8:] {
+			// 迁移 中 的 槽 如 [93-<-id]，不 计入
+			if strings.HasPrefix(slot, "[") {
+				continue
+			}
+			ss := strings.SplitN(slot, "-", 2)
+			start, e := strconv.ParseInt(ss[0], 10, 64)
+			if e != nil {
+				continue
+			}
+			end := start
+			if len(ss) > 1 {
+				end, _ = strconv.ParseInt(ss[1], 10, 64)
+			}
+			node.Slots = append(node.Slots, &SlotRange{Start: start, End: end})
+			node.SlotCount += end - start + 1
+		}
+		nodes = append(nodes, node)
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].Address < nodes[j].Address
+	})
+	return
+}
+
+// groupShards 按 主节点 分组，副本 挂 在 对应 主节点 下
+func groupShards(nodes []*ClusterNode) (shards []*ClusterShard) {
+	shards = []*ClusterShard{}
+	shardCache := map[string]*ClusterShard{}
+	for _, node := range nodes {
+		if node.Role != "master" {
+			continue
+		}
+		shard := &ClusterShard{
+			Master:    node,
+			Replicas:  []*ClusterNode{},
+			Slots:     node.Slots,
+			SlotCount: node.SlotCount,
+		}
+		shardCache[node.Id] = shard
+		shards = append(shards, shard)
+	}
+	for _, node := range nodes {
+		if node.Role == "master" {
+			continue
+		}
+		shard := shardCache[node.MasterId]
+		if shard == nil {
+			continue
+		}
+		node.Master = shard.Master.Address
+		shard.Replicas = append(shard.Replicas, node)
+	}
+	sort.Slice(shards, func(i, j int) bool {
+		if len(shards[i].Slots) == 0 || len(shards[j].Slots) == 0 {
+			return len(shards[i].Slots) > len(shards[j].Slots)
+		}
+		return shards[i].Slots[0].Start < shards[j].Slots[0].Start
+	})
+	return
+}
+
+// parseReplication 解析 INFO replication，获取 单机 节点 的 角色 与 副本
+func parseReplication(address string, text string) (nodes []*ClusterNode) {
+	info := map[string]string{}
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		index := strings.Index(line, ":")
+		if index <= 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		info[line[:index]] = line[index+1:]
+	}
+	self := &ClusterNode{
+		Address: address,
+		Role:    "master",
+		Flags:   []string{"myself"},
+		Slots:   []*SlotRange{},
+	}
+	nodes = append(nodes, self)
+	if info["role"] == "slave" {
+		self.Role = "replica"
+		self.LinkState = info["master_link_status"]
+		if info["master_host"] != "" {
+			self.Master = net.JoinHostPort(info["master_host"], info["master_port"])
+		}
+		return
+	}
+	// slave0:ip=127.0.0.1,port=6380,state=online,offset=1,lag=0
+	for i := 0; ; i++ {
+		value, ok := info["slave"+strconv.Itoa(i)]
+		if !ok {
+			break
+		}
+		attrs := map[string]string{}
+		for _, kv := range strings.Split(value, ",") {
+			ss := strings.SplitN(kv, "=", 2)
+			if len(ss) == 2 {
+				attrs[ss[0]] = ss[1]
+			}
+		}
+		nodes = append(nodes, &ClusterNode{
+			Address:   net.JoinHostPort(attrs["ip"], attrs["port"]),
+			Role:      "replica",
+			Master:    address,
+			Flags:     []string{},
+			LinkState: attrs["state"],
+			Slots:     []*SlotRange{},
+		})
+	}
+	return
+}
+
+// getReplicaAddresses 单机 模式 下 主节点 的 副本 地址
+func getReplicaAddresses(ctx context.Context, client *goRedis.Client, masterAddr string) (addresses []string, err error) {
+	text, err := client.Info(ctx, "replication").Result()
+	if err != nil {
+		return
+	}
+	for _, node := range parseReplication(masterAddr, text) {
+		if node.Role == "replica" && node.Master == masterAddr {
+			addresses = append(addresses, node.Address)
+		}
+	}
+	return
+}
+
+// getMasterAddr 单机 模式 的 主节点 地址，哨兵 模式 从 哨兵 获取
+func getMasterAddr(ctx context.Context, service redis.IService, client *goRedis.Client) (addr string, err error) {
+	if s, ok := service.(*sentinelService); ok {
+		return s.getMasterAddr(ctx)
+	}
+	addr = client.Options().Addr
+	return
+}
+
+// newNodeClient 新建 副本 节点 客户端，不 复制 原 客户端 的 Options，哨兵 模式 的 Dialer 总是 连接 主节点
+func newNodeClient(service redis.IService, client *goRedis.Client, address string) *goRedis.Client {
+	opt := client.Options()
+	options := &goRedis.Options{
+		Addr:         address,
+		Username:     opt.Username,
+		Password:     opt.Password,
+		TLSConfig:    opt.TLSConfig,
+		DialTimeout:  opt.DialTimeout,
+		ReadTimeout:  opt.ReadTimeout,
+		WriteTimeout: opt.WriteTimeout,
+	}
+	switch s := service.(type) {
+	case *sentinelService:
+		options.Dialer = getSSHDialer(s.config.SSHClient)
+	case *redis.V8Service:
+		options.Dialer = getSSHDialer(s.SSHClient)
+	}
+	return goRedis.NewClient(options)
+}
+
+// getNodeClient 获取 单个 节点 客户端
+// 集群 模式 按 地址 匹配 主节点 或 副本，未 指定 时 取 第一个 主节点
+// 单机、哨兵 模式 可 指定 当前 主节点 的 副本，使用 后 需要 调用 closeNode
+func getNodeClient(ctx context.Context, service redis.IService, client goRedis.Cmdable, address string) (node *goRedis.Client, closeNode func(), err error) {
+	closeNode = func() {}
+	if c, ok := client.(*goRedis.Client); ok {
+		if address == "" {
+			node = c
+			return
+		}
+		var masterAddr string
+		masterAddr, err = getMasterAddr(ctx, service, c)
+		if err != nil {
+			return
+		}
+		if address == masterAddr {
+			node = c
+			return
+		}
+		var replicas []string
+		replicas, err = getReplicaAddresses(ctx, c, masterAddr)
+		if err != nil {
+			return
+		}
+		for _, one := range replicas {
+			if one == address {
+				node = newNodeClient(service, c, address)
+				closeNode = func() {
+					_ = node.Close()
+				}
+				return
+			}
+		}
+		err = errors.New("redis node [" + address + "] not found")
+		return
+	}
+	clusterClient, ok := client.(*goRedis.ClusterClient)
+	if !ok {
+		err = errors.New("redis client not support node")
+		return
+	}
+	var nodes []*goRedis.Client
+	var lock sync.Mutex
+	appendNode := func(ctx context.Context, c *goRedis.Client) error {
+		lock.Lock()
+		defer lock.Unlock()
+		nodes = append(nodes, c)
+		return nil
+	}
+	if address == "" {
+		err = clusterClient.ForEachMaster(ctx, appendNode)
+	} else {
+		err = clusterClient.ForEachShard(ctx, appendNode)
+	}
+	if err != nil {
+		return
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].Options().Addr < nodes[j].Options().Addr
+	})
+	for _, one := range nodes {
+		if address == "" || one.Options().Addr == address {
+			node = one
+			return
+		}
+	}
+	err = errors.New("redis node [" + address + "] not found")
+	return
+}
+
+// getNodeConn 获取 指定 节点 的 独占 连接，集群 副本 需要 READONLY 才能 读取，使用 后 需要 关闭
+func getNodeConn(service redis.IService, address string, database int) (client goRedis.Cmdable, ctx context.Context, closeConn func(), err error) {
+	c, ctx, err := getClient(service, 0)
+	if err != nil {
+		return
+	}
+	node, closeNode, err := getNodeClient(ctx, service, c, address)
+	if err != nil {
+		return
+	}
+	conn := node.Conn(ctx)
+	closeConn = func() {
+		_ = conn.Close()
+		closeNode()
+	}
+	if _, ok := c.(*goRedis.ClusterClient); ok {
+		err = conn.ReadOnly(ctx).Err()
+	} else {
+		err = conn.Select(ctx, database).Err()
+	}
+	if err != nil {
+		closeConn()
+		return
+	}
+	client = conn
+	return
+}
+
+// getNodeDoClient 未 指定 节点 时 与 getDoClient 一致，使用 后 需要 调用 closeNode
+func getNodeDoClient(service redis.IService, address string) (client doClient, ctx context.Context, closeNode func(), err error) {
+	closeNode = func() {}
+	if address == "" {
+		client, ctx, err = getDoClient(service, 0)
+		return
+	}
+	c, ctx, err := getClient(service, 0)
+	if err != nil {
+		return
+	}
+	client, closeNode, err = getNodeClient(ctx, service, c, address)
+	return
+}
+
+// scanMerge 扫描 所有 主节点（或 指定 节点）并 合并 去重
+func scanMerge(ctx context.Context, client goRedis.Cmdable, pattern string, size int64, count int64) (keys []string, err error) {
+	if count <= 0 {
+		count = 10000
+	}
+	exists := map[string]bool{}
+	err = scanKeys(ctx, client, pattern, count, func(c goRedis.Cmdable, list []string) (next bool, err error) {
+		for _, key := range list {
+			if exists[key] {
+				continue
+			}
+			exists[key] = true
+			keys = append(keys, key)
+			if size > 0 && int64(len(keys)) >= size {
+				return
+			}
+		}
+		next = true
+		return
+	})
+	return
+}
+
+func (this_ *api) topology(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	config, sshConfig, err := this_.getConfig(requestBean, c)
+	if err != nil {
+		return
+	}
+	service, err := getService(config, sshConfig)
+	if err != nil {
+		return
+	}
+	client, ctx, err := getClient(service, 0)
+	if err != nil {
+		return
+	}
+
+	topology := &Topology{}
+	switch c := client.(type) {
+	case *goRedis.ClusterClient:
+		topology.Mode = modeCluster
+		var text string
+		text, err = c.ClusterNodes(ctx).Result()
+		if err != nil {
+			return
+		}
+		topology.Nodes = parseClusterNodes(text)
+		topology.Shards = groupShards(topology.Nodes)
+	case *goRedis.Client:
+		topology.Mode = modeStandalone
+		if config.Mode == modeSentinel {
+			topology.Mode = modeSentinel
+			topology.MasterName = config.MasterName
+			topology.Sentinels = splitAddress(config.Address)
+		}
+		var masterAddr, text string
+		masterAddr, err = getMasterAddr(ctx, service, c)
+		if err != nil {
+			return
+		}
+		text, err = c.Info(ctx, "replication").Result()
+		if err != nil {
+			return
+		}
+		topology.Nodes = parseReplication(masterAddr, text)
+		topology.Shards = []*ClusterShard{}
+		if topology.Nodes[0].Role == "master" {
+			topology.Shards = append(topology.Shards, &ClusterShard{
+				Master: topology.Nodes[0], Replicas: topology.Nodes[1:], Slots: []*SlotRange{},
+			})
+		}
+	default:
+		err = errors.New("redis client not support topology")
+		return
+	}
+	res = topology
+	return
+}
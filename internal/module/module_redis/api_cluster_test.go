@@ -0,0 +1,70 @@
+package module_redis
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// formatNodes 节点 格式 为 address/role/master/slotCount，失败 的 加 !
+func formatNodes(nodes []*ClusterNode) string {
+	var list []string
+	for _, node := range nodes {
+		str := fmt.Sprintf("%s/%s/%s/%d", node.Address, node.Role, node.Master+node.MasterId, node.SlotCount)
+		if node.Fail {
+			str += "!"
+		}
+		list = append(list, str)
+	}
+	return strings.Join(list, " ")
+}
+
+func TestParseClusterNodes(t *testing.T) {
+	list := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"empty", "", ""},
+		{"short line", "a 127.0.0.1:7000@17000 master - 0 0 1", ""},
+		{
+			"master and replica",
+			"b 127.0.0.1:7001@17001 slave a 0 0 1 connected\n" +
+				"a 127.0.0.1:7000@17000 myself,master - 0 0 1 connected 0-5460 5462\n",
+			"127.0.0.1:7000/master//5462 127.0.0.1:7001/replica/a/0",
+		},
+		{"hostname", "a 127.0.0.1:7000@17000,redis-0 master - 0 0 1 connected 0", "127.0.0.1:7000/master//1"},
+		{"migrating slot", "a 127.0.0.1:7000@17000 master - 0 0 1 connected 0-9 [10->-b] [11-<-b]", "127.0.0.1:7000/master//10"},
+		{"fail", "a 127.0.0.1:7000@17000 master,fail? - 0 0 1 disconnected", "127.0.0.1:7000/master//0!"},
+	}
+	for _, one := range list {
+		got := formatNodes(parseClusterNodes(one.text))
+		if got != one.want {
+			t.Errorf("parseClusterNodes %s = %q, want %q", one.name, got, one.want)
+		}
+	}
+}
+
+func TestParseReplication(t *testing.T) {
+	list := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"standalone", "# Replication\r\nrole:master\r\nconnected_slaves:0\r\n", "127.0.0.1:6379/master//0"},
+		{
+			"master with replicas",
+			"# Replication\r\nrole:master\r\nconnected_slaves:2\r\n" +
+				"slave0:ip=127.0.0.1,port=6380,state=online,offset=1,lag=0\r\n" +
+				"slave1:ip=::1,port=6381,state=wait_bgsave,offset=0,lag=0\r\n",
+			"127.0.0.1:6379/master//0 127.0.0.1:6380/replica/127.0.0.1:6379/0 [::1]:6381/replica/127.0.0.1:6379/0",
+		},
+		{"replica", "# Replication\r\nrole:slave\r\nmaster_host:10.0.0.1\r\nmaster_port:6379\r\nmaster_link_status:up\r\n", "127.0.0.1:6379/replica/10.0.0.1:6379/0"},
+	}
+	for _, one := range list {
+		got := formatNodes(parseReplication("127.0.0.1:6379", one.text))
+		if got != one.want {
+			t.Errorf("parseReplication %s = %q, want %q", one.name, got, one.want)
+		}
+	}
+}
@@ -0,0 +1,387 @@
+package module_redis
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/team-ide/go-tool/redis"
+	"github.com/team-ide/go-tool/util"
+	"go.uber.org/zap"
+	"teamide/internal/module/module_toolbox"
+	"teamide/pkg/base"
+	"teamide/pkg/codec"
+)
+
+const (
+	codecExtendType = "redis-codec"
+
+	// codecRaw 不 使用 编解码，用于 覆盖 已 保存 的 规则
+	codecRaw = "raw"
+)
+
+// CodecRule 按 key 匹配 规则 记录 的 编解码，保存 在 工具 扩展 数据 中
+type CodecRule struct {
+	ExtendId    int64  `json:"extendId,omitempty"`
+	Pattern     string `json:"pattern"`
+	Codec       string `json:"codec"` // 多个 使用 “,” 隔开，按 顺序 解码
+	MessageType string `json:"messageType"`
+	Comment     string `json:"comment"`
+}
+
+type CodecRuleRequest struct {
+	ToolboxId int64 `json:"toolboxId"`
+	CodecRule
+}
+
+type CodecsResult struct {
+	Codecs   []*codec.Info `json:"codecs"`
+	ProtoDir string        `json:"protoDir"`
+	Messages []string      `json:"messages"`
+	ProtoErr string        `json:"protoErr,omitempty"`
+}
+
+// ValueResult 在 值 信息 基础 上 增加 解码 结果
+type ValueResult struct {
+	*redis.ValueInfo
+	Codec        string      `json:"codec,omitempty"`
+	MessageType  string      `json:"messageType,omitempty"`
+	CodecRuleId  int64       `json:"codecRuleId,omitempty"`
+	DecodedValue interface{} `json:"decodedValue,omitempty"`
+	DecodeError  string      `json:"decodeError,omitempty"`
+}
+
+// globMatch 按 redis 的 glob 规则 匹配，支持 * ? [abc] [^a] [a-z] 与 \ 转义
+func globMatch(pattern string, str string) bool {
+	p := []rune(pattern)
+	s := []rune(str)
+	for len(p) > 0 {
+		switch p[0] {
+		case '*':
+			for len(p) > 1 && p[1] == '*' {
+				p = p[1:]
+			}
+			if len(p) == 1 {
+				return true
+			}
+			for i := 0; i <= len(s); i++ {
+				if globMatch(string(p[1:]), string(s[i:])) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+			s = s[1:]
+		case '[':
+			if len(s) == 0 {
+				return false
+			}
+			p = p[1:]
+			not := len(p) > 0 && p[0] == '^'
+			if not {
+				p = p[1:]
+			}
+			match := false
+			for len(p) > 0 && p[0] != ']' {
+				if p[0] == '\\' && len(p) >= 2 {
+					p = p[1:]
+					if p[0] == s[0] {
+						match = true
+					}
+				} else if len(p) >= 3 && p[1] == '-' && p[2] != ']' {
+					start, end := p[0], p[2]
+					if start > end {
+						start, end = end, start
+					}
+					if s[0] >= start && s[0] <= end {
+						match = true
+					}
+					p = p[2:]
+				} else if p[0] == s[0] {
+					match = true
+				}
+				p = p[1:]
+			}
+			if len(p) == 0 {
+				// 未 闭合 的 [ 视为 结尾
+				return false
+			}
+			if match == not {
+				return false
+			}
+			s = s[1:]
+		case '\\':
+			if len(p) >= 2 {
+				p = p[1:]
+			}
+			fallthrough
+		default:
+			if len(s) == 0 || p[0] != s[0] {
+				return false
+			}
+			s = s[1:]
+		}
+		p = p[1:]
+	}
+	return len(s) == 0
+}
+
+func toCodecRule(extend *module_toolbox.ToolboxExtendModel) (rule *CodecRule) {
+	rule = &CodecRule{}
+	if extend.Value != "" {
+		_ = util.JSONDecodeUseNumber([]byte(extend.Value), rule)
+	}
+	rule.ExtendId = extend.ExtendId
+	rule.Pattern = extend.Name
+	return
+}
+
+func (this_ *api) queryCodecRules(toolboxId int64) (list []*CodecRule, err error) {
+	extends, err := this_.toolboxService.QueryExtends(&module_toolbox.ToolboxExtendModel{
+		ToolboxId:  toolboxId,
+		ExtendType: codecExtendType,
+	})
+	if err != nil {
+		return
+	}
+	list = []*CodecRule{}
+	for _, one := range extends {
+		list = append(list, toCodecRule(one))
+	}
+	return
+}
+
+// matchCodecRule 完全 相同 的 优先，其次 取 最长 的 匹配 规则
+func (this_ *api) matchCodecRule(toolboxId int64, key string) (rule *CodecRule, err error) {
+	list, err := this_.queryCodecRules(toolboxId)
+	if err != nil {
+		return
+	}
+	for _, one := range list {
+		if one.Pattern == key {
+			rule = one
+			return
+		}
+		if !globMatch(one.Pattern, key) {
+			continue
+		}
+		if rule == nil || len(one.Pattern) > len(rule.Pattern) {
+			rule = one
+		}
+	}
+	return
+}
+
+// getCodecRuleExtend 获取 编解码 规则，并 校验 属于 当前 工具
+func (this_ *api) getCodecRuleExtend(toolboxId int64, extendId int64) (find *module_toolbox.ToolboxExtendModel, err error) {
+	find, err = this_.toolboxService.GetExtend(extendId)
+	if err != nil {
+		return
+	}
+	if find == nil || find.ToolboxId != toolboxId || find.ExtendType != codecExtendType {
+		find = nil
+		err = errors.New(fmt.Sprintf("codec rule [%d] not found", extendId))
+		return
+	}
+	return
+}
+
+// encodeRequestValue 写入 时 按 请求 中 指定 的 编解码 将 页面 编辑 的 内容 编码，不 自动 套用 规则
+func encodeRequestValue(config *Config, request *BaseRequest) (err error) {
+	if request.Codec == "" || request.Codec == codecRaw {
+		return
+	}
+	bs, err := codec.Encode(request.Codec, request.Value, &codec.Option{
+		MessageType: request.MessageType,
+		ProtoDir:    config.ProtoDir,
+	})
+	if err != nil {
+		err = errors.New("value encode by [" + request.Codec + "] error:" + err.Error())
+		return
+	}
+	request.Value = string(bs)
+	return
+}
+
+// decodeValueInfo 请求 未 指定 编解码 时 按 保存 的 规则 匹配，解码 失败 不 影响 原始 值 返回
+func (this_ *api) decodeValueInfo(config *Config, request *BaseRequest, valueInfo *redis.ValueInfo) (res *ValueResult, err error) {
+	res = &ValueResult{
+		ValueInfo:   valueInfo,
+		Codec:       request.Codec,
+		MessageType: request.MessageType,
+	}
+	if res.Codec == "" {
+		var rule *CodecRule
+		rule, err = this_.matchCodecRule(config.ToolboxId, valueInfo.Key)
+		if err != nil {
+			return
+		}
+		if rule != nil {
+			res.Codec = rule.Codec
+			res.MessageType = rule.MessageType
+			res.CodecRuleId = rule.ExtendId
+		}
+	}
+	if res.Codec == "" || res.Codec == codecRaw {
+		return
+	}
+	option := &codec.Option{
+		MessageType: res.MessageType,
+		ProtoDir:    config.ProtoDir,
+	}
+	decode := func(value string) (text string, ok bool) {
+		text, e := codec.Decode(res.Codec, []byte(value), option)
+		if e != nil {
+			if res.DecodeError == "" {
+				res.DecodeError = e.Error()
+			}
+			return
+		}
+		ok = true
+		return
+	}
+	switch value := valueInfo.Value.(type) {
+	case string:
+		if text, ok := decode(value); ok {
+			res.DecodedValue = text
+		}
+	case []string:
+		var list []string
+		for _, one := range value {
+			text, _ := decode(one)
+			list = append(list, text)
+		}
+		res.DecodedValue = list
+	case map[string]string:
+		var data = map[string]string{}
+		for k, one := range value {
+			data[k], _ = decode(one)
+		}
+		res.DecodedValue = data
+	}
+	return
+}
+
+func (this_ *api) codecs(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	config, _, err := this_.getConfig(requestBean, c)
+	if err != nil {
+		return
+	}
+	result := &CodecsResult{
+		Codecs:   codec.GetInfoList(),
+		ProtoDir: config.ProtoDir,
+		Messages: []string{},
+	}
+	if config.ProtoDir != "" {
+		_, messages, e := codec.LoadProtoDir(config.ProtoDir)
+		if e != nil {
+			result.ProtoErr = e.Error()
+		} else {
+			result.Messages = messages
+		}
+	}
+	res = result
+	return
+}
+
+func (this_ *api) codecQuery(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	config, _, err := this_.getConfig(requestBean, c)
+	if err != nil {
+		return
+	}
+	res, err = this_.queryCodecRules(config.ToolboxId)
+	return
+}
+
+func (this_ *api) codecSave(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	_, _, err = this_.getConfig(requestBean, c)
+	if err != nil {
+		return
+	}
+
+	request := &CodecRuleRequest{}
+	if !base.RequestJSON(request, c) {
+		return
+	}
+	if request.Pattern == "" {
+		err = errors.New("codec rule pattern is empty")
+		return
+	}
+	if request.Codec == "" {
+		err = errors.New("codec is empty")
+		return
+	}
+	if request.Codec != codecRaw {
+		if err = codec.Check(request.Codec); err != nil {
+			return
+		}
+	}
+
+	extend := &module_toolbox.ToolboxExtendModel{
+		ExtendId:   request.ExtendId,
+		ToolboxId:  request.ToolboxId,
+		ExtendType: codecExtendType,
+		Name:       request.Pattern,
+		UserId:     requestBean.JWT.UserId,
+	}
+	if extend.ExtendId == 0 {
+		// 同一 匹配 规则 只 保存 一条
+		var list []*CodecRule
+		list, err = this_.queryCodecRules(request.ToolboxId)
+		if err != nil {
+			return
+		}
+		for _, one := range list {
+			if one.Pattern == request.Pattern {
+				extend.ExtendId = one.ExtendId
+				break
+			}
+		}
+	} else {
+		_, err = this_.getCodecRuleExtend(request.ToolboxId, extend.ExtendId)
+		if err != nil {
+			return
+		}
+	}
+	bs, err := util.ObjToJson(&CodecRule{
+		Pattern:     request.Pattern,
+		Codec:       request.Codec,
+		MessageType: request.MessageType,
+		Comment:     request.Comment,
+	})
+	if err != nil {
+		return
+	}
+	extend.Value = bs
+
+	err = this_.toolboxService.SaveExtend(extend)
+	if err != nil {
+		return
+	}
+	res = toCodecRule(extend)
+	return
+}
+
+func (this_ *api) codecDelete(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	_, _, err = this_.getConfig(requestBean, c)
+	if err != nil {
+		return
+	}
+
+	request := &CodecRuleRequest{}
+	if !base.RequestJSON(request, c) {
+		return
+	}
+	_, err = this_.getCodecRuleExtend(request.ToolboxId, request.ExtendId)
+	if err != nil {
+		return
+	}
+	res, err = this_.toolboxService.DeleteExtend(request.ExtendId)
+	if err != nil {
+		util.Logger.Error("redis codec rule delete error", zap.Any("extendId", request.ExtendId), zap.Error(err))
+		return
+	}
+	return
+}
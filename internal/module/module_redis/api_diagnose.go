@@ -0,0 +1,270 @@
+package module_redis
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/team-ide/go-tool/util"
+	"sort"
+	"strings"
+	"teamide/pkg/base"
+)
+
+type SlowLogInfo struct {
+	Id         int64    `json:"id"`
+	Time       int64    `json:"time"`     // 毫秒
+	Duration   int64    `json:"duration"` // 微秒
+	Args       []string `json:"args"`
+	ClientAddr string   `json:"clientAddr"`
+	ClientName string   `json:"clientName"`
+}
+
+type SlowLogResult struct {
+	Len  int64          `json:"len"`
+	List []*SlowLogInfo `json:"list"`
+}
+
+type ConfigItem struct {
+	Name       string `json:"name"`
+	Value      string `json:"value"`
+	Default    string `json:"default"`
+	HasDefault bool   `json:"hasDefault"`
+	Changed    bool   `json:"changed"` // 与 默认值 不一致
+}
+
+func (this_ *api) slowLogGet(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	config, sshConfig, err := this_.getConfig(requestBean, c)
+	if err != nil {
+		return
+	}
+	service, err := getService(config, sshConfig)
+	if err != nil {
+		return
+	}
+
+	request := &BaseRequest{}
+	if !base.RequestJSON(request, c) {
+		return
+	}
+	client, ctx, closeNode, err := getNodeDoClient(service, request.NodeAddress)
+	if err != nil {
+		return
+	}
+	defer closeNode()
+
+	count := request.Count
+	if count <= 0 {
+		count = 128
+	}
+	result := &SlowLogResult{
+		List: []*SlowLogInfo{},
+	}
+	result.Len, err = client.Do(ctx, "slowlog", "len").Int64()
+	if err != nil {
+		return
+	}
+	list, err := client.SlowLogGet(ctx, count).Result()
+	if err != nil {
+		return
+	}
+	for _, one := range list {
+		result.List = append(result.List, &SlowLogInfo{
+			Id:         one.ID,
+			Time:       util.GetMilliByTime(one.Time),
+			Duration:   one.Duration.Microseconds(),
+			Args:       one.Args,
+			ClientAddr: one.ClientAddr,
+			ClientName: one.ClientName,
+		})
+	}
+	res = result
+	return
+}
+
+func (this_ *api) slowLogReset(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	config, sshConfig, err := this_.getConfig(requestBean, c)
+	if err != nil {
+		return
+	}
+	service, err := getService(config, sshConfig)
+	if err != nil {
+		return
+	}
+
+	request := &BaseRequest{}
+	if !base.RequestJSON(request, c) {
+		return
+	}
+	client, ctx, closeNode, err := getNodeDoClient(service, request.NodeAddress)
+	if err != nil {
+		return
+	}
+	defer closeNode()
+
+	res, err = client.Do(ctx, "slowlog", "reset").Result()
+	return
+}
+
+// parseClientList 解析 CLIENT LIST 输出，每行 为 空格 分隔 的 key=value
+func parseClientList(text string) (list []map[string]string) {
+	list = []map[string]string{}
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		info := map[string]string{}
+		for _, field := range strings.Split(line, " ") {
+			index := strings.Index(field, "=")
+			if index <= 0 {
+				continue
+			}
+			info[field[:index]] = field[index+1:]
+		}
+		list = append(list, info)
+	}
+	return
+}
+
+func (this_ *api) clientList(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	config, sshConfig, err := this_.getConfig(requestBean, c)
+	if err != nil {
+		return
+	}
+	service, err := getService(config, sshConfig)
+	if err != nil {
+		return
+	}
+
+	request := &BaseRequest{}
+	if !base.RequestJSON(request, c) {
+		return
+	}
+	client, ctx, closeNode, err := getNodeDoClient(service, request.NodeAddress)
+	if err != nil {
+		return
+	}
+	defer closeNode()
+
+	text, err := client.ClientList(ctx).Result()
+	if err != nil {
+		return
+	}
+	res = parseClientList(text)
+	return
+}
+
+func (this_ *api) clientKill(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	config, sshConfig, err := this_.getConfig(requestBean, c)
+	if err != nil {
+		return
+	}
+	service, err := getService(config, sshConfig)
+	if err != nil {
+		return
+	}
+
+	request := &BaseRequest{}
+	if !base.RequestJSON(request, c) {
+		return
+	}
+	client, ctx, closeNode, err := getNodeDoClient(service, request.NodeAddress)
+	if err != nil {
+		return
+	}
+	defer closeNode()
+
+	// 优先 按 客户端 ID 终止，其次 按 地址
+	if request.Id != "" {
+		res, err = client.ClientKillByFilter(ctx, "ID", request.Id).Result()
+	} else if request.Addr != "" {
+		res, err = client.ClientKillByFilter(ctx, "ADDR", request.Addr).Result()
+	} else {
+		err = errors.New("client id or addr is empty")
+	}
+	return
+}
+
+func (this_ *api) configGet(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	config, sshConfig, err := this_.getConfig(requestBean, c)
+	if err != nil {
+		return
+	}
+	service, err := getService(config, sshConfig)
+	if err != nil {
+		return
+	}
+
+	request := &BaseRequest{}
+	if !base.RequestJSON(request, c) {
+		return
+	}
+	client, ctx, closeNode, err := getNodeDoClient(service, request.NodeAddress)
+	if err != nil {
+		return
+	}
+	defer closeNode()
+
+	pattern := request.Pattern
+	if pattern == "" {
+		pattern = "*"
+	}
+	values, err := client.ConfigGet(ctx, pattern).Result()
+	if err != nil {
+		return
+	}
+	var list = []*ConfigItem{}
+	for i := 0; i+1 < len(values); i += 2 {
+		item := &ConfigItem{
+			Name:  util.GetStringValue(values[i]),
+			Value: util.GetStringValue(values[i+1]),
+		}
+		item.Default, item.HasDefault = configDefaults[item.Name]
+		if item.HasDefault {
+			item.Changed = !configValueEqual(item.Value, item.Default)
+		}
+		if request.DoType == "changed" && !item.Changed {
+			continue
+		}
+		list = append(list, item)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	res = list
+	return
+}
+
+func (this_ *api) configSet(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	config, sshConfig, err := this_.getConfig(requestBean, c)
+	if err != nil {
+		return
+	}
+	service, err := getService(config, sshConfig)
+	if err != nil {
+		return
+	}
+
+	request := &BaseRequest{}
+	if !base.RequestJSON(request, c) {
+		return
+	}
+	if request.Field == "" {
+		err = errors.New("config name is empty")
+		return
+	}
+	client, ctx, closeNode, err := getNodeDoClient(service, request.NodeAddress)
+	if err != nil {
+		return
+	}
+	defer closeNode()
+
+	res, err = client.ConfigSet(ctx, request.Field, request.Value).Result()
+	if err != nil {
+		return
+	}
+	// 按需 写回 配置 文件
+	if request.DoType == "rewrite" {
+		res, err = client.ConfigRewrite(ctx).Result()
+	}
+	return
+}
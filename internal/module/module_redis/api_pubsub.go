@@ -0,0 +1,258 @@
+package module_redis
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/team-ide/go-tool/util"
+	"go.uber.org/zap"
+	"strconv"
+	"teamide/pkg/base"
+	"teamide/pkg/ssh"
+)
+
+const notifyKeyspaceEvents = "notify-keyspace-events"
+
+// getWebsocketConfig websocket 请求 无 请求体，从 query 中 获取 toolboxId 并 校验 权限
+func (this_ *api) getWebsocketConfig(requestBean *base.RequestBean, c *gin.Context) (config *Config, sshConfig *ssh.Config, err error) {
+	toolboxId, _ := strconv.ParseInt(c.Query("toolboxId"), 10, 64)
+	if toolboxId == 0 {
+		err = errors.New("toolboxId获取失败")
+		return
+	}
+	config, sshConfig, err = this_.getConfigById(requestBean, toolboxId)
+	return
+}
+
+// getPubSubWorker 获取 当前用户 的 订阅 会话
+func (this_ *api) getPubSubWorker(requestBean *base.RequestBean, workerId string) (worker *pubSubWorker, err error) {
+	worker = getPubSubWorker(workerId)
+	if worker == nil {
+		err = errors.New("订阅会话[" + workerId + "]不存在")
+		return
+	}
+	if requestBean.JWT == nil || requestBean.JWT.UserId != worker.userId {
+		worker = nil
+		err = errors.New("订阅会话[" + workerId + "]不属于当前用户")
+		return
+	}
+	return
+}
+
+func (this_ *api) pubSubWebsocket(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	if requestBean.JWT == nil || requestBean.JWT.UserId == 0 {
+		err = errors.New("登录用户获取失败")
+		return
+	}
+	workerId := c.Query("workerId")
+	if workerId == "" {
+		err = errors.New("workerId获取失败")
+		return
+	}
+	bufferSize, _ := strconv.Atoi(c.Query("bufferSize"))
+
+	config, sshConfig, err := this_.getWebsocketConfig(requestBean, c)
+	if err != nil {
+		return
+	}
+	service, err := getService(config, sshConfig)
+	if err != nil {
+		return
+	}
+
+	//升级get请求为webSocket协议
+	ws, err := upGrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		return
+	}
+
+	err = startPubSubWorker(service, workerId, requestBean.JWT.UserId, bufferSize, ws)
+	if err != nil {
+		_ = ws.WriteJSON(&PubSubMessage{Type: "error", Payload: "start error:" + err.Error()})
+		util.Logger.Error("pub sub websocket start error", zap.Error(err))
+		_ = ws.Close()
+		return
+	}
+
+	res = base.HttpNotResponse
+	return
+}
+
+func (this_ *api) pubSubSubscribe(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	request := &BaseRequest{}
+	if !base.RequestJSON(request, c) {
+		return
+	}
+	worker, err := this_.getPubSubWorker(requestBean, request.WorkerId)
+	if err != nil {
+		return
+	}
+	patterns := request.Patterns
+	if request.Keyspace {
+		// 键空间 通知 渠道 格式 __keyspace@<db>__:<key>，消息 为 事件 名称
+		pattern := request.Pattern
+		if pattern == "" {
+			pattern = "*"
+		}
+		patterns = append(patterns, fmt.Sprintf("__keyspace@%d__:%s", request.Database, pattern))
+	}
+	err = worker.subscribe(request.Channels, patterns)
+	if err != nil {
+		return
+	}
+	res = worker.status()
+	return
+}
+
+func (this_ *api) pubSubUnsubscribe(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	request := &BaseRequest{}
+	if !base.RequestJSON(request, c) {
+		return
+	}
+	worker, err := this_.getPubSubWorker(requestBean, request.WorkerId)
+	if err != nil {
+		return
+	}
+	err = worker.unsubscribe(request.Channels, request.Patterns)
+	if err != nil {
+		return
+	}
+	res = worker.status()
+	return
+}
+
+func (this_ *api) pubSubFilter(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	request := &BaseRequest{}
+	if !base.RequestJSON(request, c) {
+		return
+	}
+	worker, err := this_.getPubSubWorker(requestBean, request.WorkerId)
+	if err != nil {
+		return
+	}
+	err = worker.setFilter(request.Filter)
+	if err != nil {
+		return
+	}
+	res = worker.status()
+	return
+}
+
+func (this_ *api) pubSubMessages(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	request := &BaseRequest{}
+	if !base.RequestJSON(request, c) {
+		return
+	}
+	worker, err := this_.getPubSubWorker(requestBean, request.WorkerId)
+	if err != nil {
+		return
+	}
+	res = worker.messages()
+	return
+}
+
+func (this_ *api) pubSubClean(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	request := &BaseRequest{}
+	if !base.RequestJSON(request, c) {
+		return
+	}
+	worker, err := this_.getPubSubWorker(requestBean, request.WorkerId)
+	if err != nil {
+		return
+	}
+	worker.clean()
+	res = worker.status()
+	return
+}
+
+func (this_ *api) pubSubStatus(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	request := &BaseRequest{}
+	if !base.RequestJSON(request, c) {
+		return
+	}
+	worker, err := this_.getPubSubWorker(requestBean, request.WorkerId)
+	if err != nil {
+		return
+	}
+	res = worker.status()
+	return
+}
+
+func (this_ *api) pubSubClose(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	request := &BaseRequest{}
+	if !base.RequestJSON(request, c) {
+		return
+	}
+	_, err = this_.getPubSubWorker(requestBean, request.WorkerId)
+	if err != nil {
+		return
+	}
+	stopPubSubWorker(request.WorkerId)
+	return
+}
+
+func (this_ *api) publish(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	config, sshConfig, err := this_.getConfig(requestBean, c)
+	if err != nil {
+		return
+	}
+	service, err := getService(config, sshConfig)
+	if err != nil {
+		return
+	}
+
+	request := &BaseRequest{}
+	if !base.RequestJSON(request, c) {
+		return
+	}
+	if request.Channel == "" {
+		err = errors.New("channel is empty")
+		return
+	}
+	client, ctx, err := getClient(service, request.Database)
+	if err != nil {
+		return
+	}
+
+	// 返回 接收到 消息 的 订阅者 数量
+	res, err = client.Publish(ctx, request.Channel, request.Value).Result()
+	return
+}
+
+// keyspaceNotify 查询 或 设置 notify-keyspace-events，如 KEA 开启 所有 事件，空 为 关闭
+func (this_ *api) keyspaceNotify(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	config, sshConfig, err := this_.getConfig(requestBean, c)
+	if err != nil {
+		return
+	}
+	service, err := getService(config, sshConfig)
+	if err != nil {
+		return
+	}
+
+	request := &BaseRequest{}
+	if !base.RequestJSON(request, c) {
+		return
+	}
+	client, ctx, err := getClient(service, 0)
+	if err != nil {
+		return
+	}
+
+	if request.DoType == "set" {
+		_, err = client.ConfigSet(ctx, notifyKeyspaceEvents, request.Value).Result()
+		if err != nil {
+			return
+		}
+	}
+	values, err := client.ConfigGet(ctx, notifyKeyspaceEvents).Result()
+	if err != nil {
+		return
+	}
+	var value string
+	if len(values) > 1 {
+		value, _ = values[1].(string)
+	}
+	res = value
+	return
+}
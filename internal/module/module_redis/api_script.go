@@ -0,0 +1,458 @@
+package module_redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	goRedis "github.com/go-redis/redis/v8"
+	"github.com/team-ide/go-tool/util"
+	"go.uber.org/zap"
+	"strings"
+	"teamide/internal/module/module_toolbox"
+	"teamide/pkg/base"
+	"time"
+)
+
+const (
+	scriptExtendType = "redis-script"
+
+	scriptTimeoutDefault = 30
+	// 不超过 客户端 读取 超时 100 秒
+	scriptTimeoutMax = 90
+)
+
+// RespValue 带 RESP 类型 的 结果，便于 页面 区分 nil、错误、嵌套 数组
+type RespValue struct {
+	Type  string       `json:"type"` // nil、integer、string、array、error
+	Value interface{}  `json:"value,omitempty"`
+	List  []*RespValue `json:"list,omitempty"`
+}
+
+type ScriptResult struct {
+	Sha      string     `json:"sha,omitempty"`
+	Result   *RespValue `json:"result"`
+	UseTime  int64      `json:"useTime"` // 毫秒
+	Timeout  bool       `json:"timeout,omitempty"`
+	Killed   bool       `json:"killed,omitempty"`
+	KillInfo string     `json:"killInfo,omitempty"`
+}
+
+type ScriptInfo struct {
+	ExtendId int64    `json:"extendId,omitempty"`
+	Name     string   `json:"name"`
+	Script   string   `json:"script"`
+	Keys     []string `json:"keys"`
+	Args     []string `json:"args"`
+	Comment  string   `json:"comment"`
+}
+
+func toRespValue(value interface{}, err error) (res *RespValue) {
+	if err != nil {
+		if err == goRedis.Nil {
+			return &RespValue{Type: "nil"}
+		}
+		return &RespValue{Type: "error", Value: err.Error()}
+	}
+	switch v := value.(type) {
+	case nil:
+		res = &RespValue{Type: "nil"}
+	case int64:
+		res = &RespValue{Type: "integer", Value: v}
+	case string:
+		res = &RespValue{Type: "string", Value: v}
+	case []interface{}:
+		res = &RespValue{Type: "array", List: []*RespValue{}}
+		for _, one := range v {
+			if e, ok := one.(goRedis.Error); ok {
+				res.List = append(res.List, toRespValue(nil, e))
+			} else {
+				res.List = append(res.List, toRespValue(one, nil))
+			}
+		}
+	case goRedis.Error:
+		res = &RespValue{Type: "error", Value: v.Error()}
+	default:
+		res = &RespValue{Type: "string", Value: util.GetStringValue(v)}
+	}
+	return
+}
+
+// isRedisError 是否是 redis 服务端 返回 的 错误，而非 网络 等 错误
+func isRedisError(err error) bool {
+	if err == goRedis.Nil {
+		return true
+	}
+	_, ok := err.(goRedis.Error)
+	return ok
+}
+
+func (this_ *BaseRequest) getScriptTimeout() time.Duration {
+	timeout := this_.Timeout
+	if timeout <= 0 {
+		timeout = scriptTimeoutDefault
+	}
+	if timeout > scriptTimeoutMax {
+		timeout = scriptTimeoutMax
+	}
+	return time.Duration(timeout) * time.Second
+}
+
+func (this_ *BaseRequest) getScriptArgs() (args []interface{}) {
+	for _, one := range this_.Args {
+		args = append(args, one)
+	}
+	return
+}
+
+// runScript 超时 保护：脚本 超时 后 不再 等待，按需 执行 SCRIPT KILL
+func runScript(client goRedis.Cmdable, request *BaseRequest, do func(ctx context.Context) (interface{}, error)) (result *ScriptResult, err error) {
+	result = &ScriptResult{}
+	startTime := time.Now()
+
+	ctx, cancel := context.WithTimeout(context.Background(), request.getScriptTimeout())
+	defer cancel()
+
+	type doRes struct {
+		value interface{}
+		err   error
+	}
+	resCh := make(chan *doRes, 1)
+	go func() {
+		defer func() {
+			if e := recover(); e != nil {
+				resCh <- &doRes{err: errors.New(fmt.Sprint(e))}
+			}
+		}()
+		value, e := do(ctx)
+		resCh <- &doRes{value: value, err: e}
+	}()
+
+	select {
+	case r := <-resCh:
+		result.UseTime = time.Since(startTime).Milliseconds()
+		if r.err != nil && !isRedisError(r.err) && ctx.Err() == nil {
+			err = r.err
+			return
+		}
+		if ctx.Err() == nil {
+			result.Result = toRespValue(r.value, r.err)
+			return
+		}
+	case <-ctx.Done():
+	}
+
+	result.UseTime = time.Since(startTime).Milliseconds()
+	result.Timeout = true
+	result.Result = &RespValue{Type: "error", Value: "script execute timeout"}
+	if request.KillOnTimeout {
+		// SCRIPT KILL 只能 终止 未 执行 写 操作 的 脚本
+		killErr := client.ScriptKill(context.Background()).Err()
+		if killErr != nil {
+			result.KillInfo = killErr.Error()
+		} else {
+			result.Killed = true
+		}
+	}
+	return
+}
+
+func (this_ *api) eval(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	config, sshConfig, err := this_.getConfig(requestBean, c)
+	if err != nil {
+		return
+	}
+	service, err := getService(config, sshConfig)
+	if err != nil {
+		return
+	}
+
+	request := &BaseRequest{}
+	if !base.RequestJSON(request, c) {
+		return
+	}
+	if strings.TrimSpace(request.Script) == "" {
+		err = errors.New("script is empty")
+		return
+	}
+	client, _, err := getClient(service, request.Database)
+	if err != nil {
+		return
+	}
+
+	res, err = runScript(client, request, func(ctx context.Context) (interface{}, error) {
+		return client.Eval(ctx, request.Script, request.Keys, request.getScriptArgs()...).Result()
+	})
+	return
+}
+
+func (this_ *api) evalSha(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	config, sshConfig, err := this_.getConfig(requestBean, c)
+	if err != nil {
+		return
+	}
+	service, err := getService(config, sshConfig)
+	if err != nil {
+		return
+	}
+
+	request := &BaseRequest{}
+	if !base.RequestJSON(request, c) {
+		return
+	}
+	if request.Sha == "" {
+		err = errors.New("sha is empty")
+		return
+	}
+	client, _, err := getClient(service, request.Database)
+	if err != nil {
+		return
+	}
+
+	result, err := runScript(client, request, func(ctx context.Context) (interface{}, error) {
+		return client.EvalSha(ctx, request.Sha, request.Keys, request.getScriptArgs()...).Result()
+	})
+	if err != nil {
+		return
+	}
+	result.Sha = request.Sha
+	res = result
+	return
+}
+
+func (this_ *api) scriptLoad(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	config, sshConfig, err := this_.getConfig(requestBean, c)
+	if err != nil {
+		return
+	}
+	service, err := getService(config, sshConfig)
+	if err != nil {
+		return
+	}
+
+	request := &BaseRequest{}
+	if !base.RequestJSON(request, c) {
+		return
+	}
+	if strings.TrimSpace(request.Script) == "" {
+		err = errors.New("script is empty")
+		return
+	}
+	client, ctx, err := getClient(service, request.Database)
+	if err != nil {
+		return
+	}
+
+	// 返回 脚本 sha1
+	res, err = client.ScriptLoad(ctx, request.Script).Result()
+	return
+}
+
+func (this_ *api) scriptFlush(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	config, sshConfig, err := this_.getConfig(requestBean, c)
+	if err != nil {
+		return
+	}
+	service, err := getService(config, sshConfig)
+	if err != nil {
+		return
+	}
+
+	request := &BaseRequest{}
+	if !base.RequestJSON(request, c) {
+		return
+	}
+	client, ctx, err := getClient(service, request.Database)
+	if err != nil {
+		return
+	}
+
+	res, err = client.ScriptFlush(ctx).Result()
+	return
+}
+
+func (this_ *api) scriptKill(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	config, sshConfig, err := this_.getConfig(requestBean, c)
+	if err != nil {
+		return
+	}
+	service, err := getService(config, sshConfig)
+	if err != nil {
+		return
+	}
+
+	request := &BaseRequest{}
+	if !base.RequestJSON(request, c) {
+		return
+	}
+	client, ctx, err := getClient(service, request.Database)
+	if err != nil {
+		return
+	}
+
+	res, err = client.ScriptKill(ctx).Result()
+	return
+}
+
+func (this_ *api) scriptExists(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	config, sshConfig, err := this_.getConfig(requestBean, c)
+	if err != nil {
+		return
+	}
+	service, err := getService(config, sshConfig)
+	if err != nil {
+		return
+	}
+
+	request := &BaseRequest{}
+	if !base.RequestJSON(request, c) {
+		return
+	}
+	shaList := request.ShaList
+	if len(shaList) == 0 && request.Sha != "" {
+		shaList = append(shaList, request.Sha)
+	}
+	if len(shaList) == 0 {
+		err = errors.New("sha is empty")
+		return
+	}
+	client, ctx, err := getClient(service, request.Database)
+	if err != nil {
+		return
+	}
+
+	res, err = client.ScriptExists(ctx, shaList...).Result()
+	return
+}
+
+func toScriptInfo(extend *module_toolbox.ToolboxExtendModel) (info *ScriptInfo) {
+	info = &ScriptInfo{
+		ExtendId: extend.ExtendId,
+		Name:     extend.Name,
+	}
+	if extend.Value != "" {
+		_ = util.JSONDecodeUseNumber([]byte(extend.Value), info)
+	}
+	info.ExtendId = extend.ExtendId
+	info.Name = extend.Name
+	return
+}
+
+// getScriptExtend 获取 脚本 记录，并 校验 属于 当前 工具
+func (this_ *api) getScriptExtend(toolboxId int64, extendId int64) (find *module_toolbox.ToolboxExtendModel, err error) {
+	find, err = this_.toolboxService.GetExtend(extendId)
+	if err != nil {
+		return
+	}
+	if find == nil || find.ToolboxId != toolboxId || find.ExtendType != scriptExtendType {
+		find = nil
+		err = errors.New(fmt.Sprintf("script [%d] not found", extendId))
+		return
+	}
+	return
+}
+
+func (this_ *api) scriptQuery(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	_, _, err = this_.getConfig(requestBean, c)
+	if err != nil {
+		return
+	}
+
+	request := &ScriptRequest{}
+	if !base.RequestJSON(request, c) {
+		return
+	}
+
+	extends, err := this_.toolboxService.QueryExtends(&module_toolbox.ToolboxExtendModel{
+		ToolboxId:  request.ToolboxId,
+		ExtendType: scriptExtendType,
+	})
+	if err != nil {
+		return
+	}
+	var list = []*ScriptInfo{}
+	for _, one := range extends {
+		list = append(list, toScriptInfo(one))
+	}
+	res = list
+	return
+}
+
+func (this_ *api) scriptSave(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	_, _, err = this_.getConfig(requestBean, c)
+	if err != nil {
+		return
+	}
+
+	request := &ScriptRequest{}
+	if !base.RequestJSON(request, c) {
+		return
+	}
+	if request.Name == "" {
+		err = errors.New("script name is empty")
+		return
+	}
+	if strings.TrimSpace(request.Script) == "" {
+		err = errors.New("script is empty")
+		return
+	}
+
+	extend := &module_toolbox.ToolboxExtendModel{
+		ExtendId:   request.ExtendId,
+		ToolboxId:  request.ToolboxId,
+		ExtendType: scriptExtendType,
+		Name:       request.Name,
+		UserId:     requestBean.JWT.UserId,
+	}
+	if extend.ExtendId != 0 {
+		_, err = this_.getScriptExtend(request.ToolboxId, extend.ExtendId)
+		if err != nil {
+			return
+		}
+	}
+	bs, err := util.ObjToJson(&ScriptInfo{
+		Name:    request.Name,
+		Script:  request.Script,
+		Keys:    request.Keys,
+		Args:    request.Args,
+		Comment: request.Comment,
+	})
+	if err != nil {
+		return
+	}
+	extend.Value = bs
+
+	err = this_.toolboxService.SaveExtend(extend)
+	if err != nil {
+		return
+	}
+	res = toScriptInfo(extend)
+	return
+}
+
+func (this_ *api) scriptDelete(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	_, _, err = this_.getConfig(requestBean, c)
+	if err != nil {
+		return
+	}
+
+	request := &ScriptRequest{}
+	if !base.RequestJSON(request, c) {
+		return
+	}
+	_, err = this_.getScriptExtend(request.ToolboxId, request.ExtendId)
+	if err != nil {
+		return
+	}
+	res, err = this_.toolboxService.DeleteExtend(request.ExtendId)
+	if err != nil {
+		util.Logger.Error("redis script delete error", zap.Any("extendId", request.ExtendId), zap.Error(err))
+		return
+	}
+	return
+}
+
+type ScriptRequest struct {
+	ToolboxId int64 `json:"toolboxId"`
+	ScriptInfo
+}
@@ -0,0 +1,645 @@
+package module_redis
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	goRedis "github.com/go-redis/redis/v8"
+	"github.com/team-ide/go-tool/util"
+	"sort"
+	"teamide/pkg/base"
+	"time"
+)
+
+type XField struct {
+	Field string `json:"field"`
+	Value string `json:"value"`
+}
+
+type XMessage struct {
+	Id     string    `json:"id"`
+	Fields []*XField `json:"fields"`
+}
+
+type XRangeResult struct {
+	Key    string      `json:"key"`
+	Length int64       `json:"length"`
+	List   []*XMessage `json:"list"`
+}
+
+type XStreamInfo struct {
+	Length          int64     `json:"length"`
+	RadixTreeKeys   int64     `json:"radixTreeKeys"`
+	RadixTreeNodes  int64     `json:"radixTreeNodes"`
+	Groups          int64     `json:"groups"`
+	LastGeneratedId string    `json:"lastGeneratedId"`
+	FirstEntry      *XMessage `json:"firstEntry"`
+	LastEntry       *XMessage `json:"lastEntry"`
+}
+
+type XGroupInfo struct {
+	Name            string `json:"name"`
+	Consumers       int64  `json:"consumers"`
+	Pending         int64  `json:"pending"`
+	LastDeliveredId string `json:"lastDeliveredId"`
+}
+
+type XConsumerInfo struct {
+	Name    string `json:"name"`
+	Pending int64  `json:"pending"`
+	Idle    int64  `json:"idle"` // 毫秒
+}
+
+type XPendingResult struct {
+	Count     int64              `json:"count"`
+	Lower     string             `json:"lower"`
+	Higher    string             `json:"higher"`
+	Consumers map[string]int64   `json:"consumers"`
+	List      []*XPendingMessage `json:"list"`
+}
+
+type XPendingMessage struct {
+	Id         string `json:"id"`
+	Consumer   string `json:"consumer"`
+	Idle       int64  `json:"idle"` // 毫秒
+	RetryCount int64  `json:"retryCount"`
+}
+
+// toXMessage go-redis 将 字段 解析 为 map，丢失 了 顺序，按 字段 名 排序 保证 结果 稳定
+func toXMessage(one goRedis.XMessage) (res *XMessage) {
+	res = &XMessage{
+		Id: one.ID,
+	}
+	var fields []string
+	for field := range one.Values {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	for _, field := range fields {
+		res.Fields = append(res.Fields, &XField{
+			Field: field,
+			Value: util.GetStringValue(one.Values[field]),
+		})
+	}
+	return
+}
+
+// parseXMessages 解析 XRANGE、XCLAIM 的 原始 返回，保持 服务 端 的 字段 顺序
+func parseXMessages(value interface{}) (res []*XMessage, err error) {
+	list, ok := value.([]interface{})
+	if !ok {
+		err = errors.New("stream entries format error")
+		return
+	}
+	for _, item := range list {
+		entry, ok := item.([]interface{})
+		if !ok || len(entry) != 2 {
+			err = errors.New("stream entry format error")
+			return
+		}
+		one := &XMessage{
+			Id: util.GetStringValue(entry[0]),
+		}
+		// XCLAIM 已 删除 的 消息 字段 为 空
+		fields, _ := entry[1].([]interface{})
+		for i := 0; i+1 < len(fields); i += 2 {
+			one.Fields = append(one.Fields, &XField{
+				Field: util.GetStringValue(fields[i]),
+				Value: util.GetStringValue(fields[i+1]),
+			})
+		}
+		res = append(res, one)
+	}
+	return
+}
+
+func (this_ *BaseRequest) getIds() (ids []string) {
+	ids = this_.Ids
+	if len(ids) == 0 && this_.Id != "" {
+		ids = append(ids, this_.Id)
+	}
+	return
+}
+
+func (this_ *api) xadd(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	config, sshConfig, err := this_.getConfig(requestBean, c)
+	if err != nil {
+		return
+	}
+	service, err := getService(config, sshConfig)
+	if err != nil {
+		return
+	}
+
+	request := &BaseRequest{}
+	if !base.RequestJSON(request, c) {
+		return
+	}
+	if len(request.Fields) == 0 {
+		err = errors.New("xadd fields is empty")
+		return
+	}
+	client, ctx, err := getClient(service, request.Database)
+	if err != nil {
+		return
+	}
+
+	// 使用 数组 保证 字段 顺序
+	var values []interface{}
+	for _, one := range request.Fields {
+		values = append(values, one.Field, one.Value)
+	}
+	args := &goRedis.XAddArgs{
+		Stream: request.getKey(),
+		ID:     request.Id,
+		MaxLen: request.MaxLen,
+		MinID:  request.MinId,
+		Approx: request.Approx,
+		Values: values,
+	}
+	if args.ID == "" {
+		args.ID = "*"
+	}
+	res, err = client.XAdd(ctx, args).Result()
+	return
+}
+
+func (this_ *api) xrange(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	config, sshConfig, err := this_.getConfig(requestBean, c)
+	if err != nil {
+		return
+	}
+	service, err := getService(config, sshConfig)
+	if err != nil {
+		return
+	}
+
+	request := &BaseRequest{}
+	if !base.RequestJSON(request, c) {
+		return
+	}
+	client, ctx, err := getDoClient(service, request.Database)
+	if err != nil {
+		return
+	}
+	key := request.getKey()
+
+	result := &XRangeResult{
+		Key: key,
+	}
+	result.Length, err = client.XLen(ctx, key).Result()
+	if err != nil {
+		return
+	}
+	start, end := request.Start, request.End
+	if start == "" {
+		start = "-"
+	}
+	if end == "" {
+		end = "+"
+	}
+	count := request.Count
+	if count <= 0 {
+		count = 50
+	}
+	// 使用 原始 指令 读取，保持 字段 顺序
+	var list interface{}
+	if request.Rev {
+		// XREVRANGE 参数 顺序 为 end start
+		list, err = client.Do(ctx, "xrevrange", key, end, start, "count", count).Result()
+	} else {
+		list, err = client.Do(ctx, "xrange", key, start, end, "count", count).Result()
+	}
+	if err != nil {
+		return
+	}
+	result.List, err = parseXMessages(list)
+	if err != nil {
+		return
+	}
+	res = result
+	return
+}
+
+func (this_ *api) xdel(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	config, sshConfig, err := this_.getConfig(requestBean, c)
+	if err != nil {
+		return
+	}
+	service, err := getService(config, sshConfig)
+	if err != nil {
+		return
+	}
+
+	request := &BaseRequest{}
+	if !base.RequestJSON(request, c) {
+		return
+	}
+	ids := request.getIds()
+	if len(ids) == 0 {
+		err = errors.New("xdel ids is empty")
+		return
+	}
+	client, ctx, err := getClient(service, request.Database)
+	if err != nil {
+		return
+	}
+
+	res, err = client.XDel(ctx, request.getKey(), ids...).Result()
+	return
+}
+
+func (this_ *api) xtrim(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	config, sshConfig, err := this_.getConfig(requestBean, c)
+	if err != nil {
+		return
+	}
+	service, err := getService(config, sshConfig)
+	if err != nil {
+		return
+	}
+
+	request := &BaseRequest{}
+	if !base.RequestJSON(request, c) {
+		return
+	}
+	client, ctx, err := getClient(service, request.Database)
+	if err != nil {
+		return
+	}
+	key := request.getKey()
+
+	if request.MinId != "" {
+		if request.Approx {
+			res, err = client.XTrimMinIDApprox(ctx, key, request.MinId, 0).Result()
+		} else {
+			res, err = client.XTrimMinID(ctx, key, request.MinId).Result()
+		}
+		return
+	}
+	if request.MaxLen < 0 {
+		err = errors.New("xtrim maxLen must be greater than or equal to 0")
+		return
+	}
+	if request.Approx {
+		res, err = client.XTrimMaxLenApprox(ctx, key, request.MaxLen, 0).Result()
+	} else {
+		res, err = client.XTrimMaxLen(ctx, key, request.MaxLen).Result()
+	}
+	return
+}
+
+func (this_ *api) xgroupCreate(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	config, sshConfig, err := this_.getConfig(requestBean, c)
+	if err != nil {
+		return
+	}
+	service, err := getService(config, sshConfig)
+	if err != nil {
+		return
+	}
+
+	request := &BaseRequest{}
+	if !base.RequestJSON(request, c) {
+		return
+	}
+	if request.Group == "" {
+		err = errors.New("group is empty")
+		return
+	}
+	client, ctx, err := getClient(service, request.Database)
+	if err != nil {
+		return
+	}
+
+	start := request.Start
+	if start == "" {
+		start = "$"
+	}
+	if request.MkStream {
+		res, err = client.XGroupCreateMkStream(ctx, request.getKey(), request.Group, start).Result()
+	} else {
+		res, err = client.XGroupCreate(ctx, request.getKey(), request.Group, start).Result()
+	}
+	return
+}
+
+func (this_ *api) xgroupSetId(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	config, sshConfig, err := this_.getConfig(requestBean, c)
+	if err != nil {
+		return
+	}
+	service, err := getService(config, sshConfig)
+	if err != nil {
+		return
+	}
+
+	request := &BaseRequest{}
+	if !base.RequestJSON(request, c) {
+		return
+	}
+	if request.Group == "" {
+		err = errors.New("group is empty")
+		return
+	}
+	client, ctx, err := getClient(service, request.Database)
+	if err != nil {
+		return
+	}
+
+	start := request.Start
+	if start == "" {
+		start = "$"
+	}
+	res, err = client.XGroupSetID(ctx, request.getKey(), request.Group, start).Result()
+	return
+}
+
+func (this_ *api) xgroupDestroy(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	config, sshConfig, err := this_.getConfig(requestBean, c)
+	if err != nil {
+		return
+	}
+	service, err := getService(config, sshConfig)
+	if err != nil {
+		return
+	}
+
+	request := &BaseRequest{}
+	if !base.RequestJSON(request, c) {
+		return
+	}
+	client, ctx, err := getClient(service, request.Database)
+	if err != nil {
+		return
+	}
+
+	res, err = client.XGroupDestroy(ctx, request.getKey(), request.Group).Result()
+	return
+}
+
+func (this_ *api) xgroupDelConsumer(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	config, sshConfig, err := this_.getConfig(requestBean, c)
+	if err != nil {
+		return
+	}
+	service, err := getService(config, sshConfig)
+	if err != nil {
+		return
+	}
+
+	request := &BaseRequest{}
+	if !base.RequestJSON(request, c) {
+		return
+	}
+	client, ctx, err := getClient(service, request.Database)
+	if err != nil {
+		return
+	}
+
+	// 返回 该消费者 被删除时 仍在 pending 的 消息数
+	res, err = client.XGroupDelConsumer(ctx, request.getKey(), request.Group, request.Consumer).Result()
+	return
+}
+
+func (this_ *api) xinfoStream(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	config, sshConfig, err := this_.getConfig(requestBean, c)
+	if err != nil {
+		return
+	}
+	service, err := getService(config, sshConfig)
+	if err != nil {
+		return
+	}
+
+	request := &BaseRequest{}
+	if !base.RequestJSON(request, c) {
+		return
+	}
+	client, ctx, err := getClient(service, request.Database)
+	if err != nil {
+		return
+	}
+
+	info, err := client.XInfoStream(ctx, request.getKey()).Result()
+	if err != nil {
+		return
+	}
+	res = &XStreamInfo{
+		Length:          info.Length,
+		RadixTreeKeys:   info.RadixTreeKeys,
+		RadixTreeNodes:  info.RadixTreeNodes,
+		Groups:          info.Groups,
+		LastGeneratedId: info.LastGeneratedID,
+		FirstEntry:      toXMessage(info.FirstEntry),
+		LastEntry:       toXMessage(info.LastEntry),
+	}
+	return
+}
+
+func (this_ *api) xinfoGroups(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	config, sshConfig, err := this_.getConfig(requestBean, c)
+	if err != nil {
+		return
+	}
+	service, err := getService(config, sshConfig)
+	if err != nil {
+		return
+	}
+
+	request := &BaseRequest{}
+	if !base.RequestJSON(request, c) {
+		return
+	}
+	client, ctx, err := getClient(service, request.Database)
+	if err != nil {
+		return
+	}
+
+	list, err := client.XInfoGroups(ctx, request.getKey()).Result()
+	if err != nil {
+		return
+	}
+	var groups = []*XGroupInfo{}
+	for _, one := range list {
+		groups = append(groups, &XGroupInfo{
+			Name:            one.Name,
+			Consumers:       one.Consumers,
+			Pending:         one.Pending,
+			LastDeliveredId: one.LastDeliveredID,
+		})
+	}
+	res = groups
+	return
+}
+
+func (this_ *api) xinfoConsumers(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	config, sshConfig, err := this_.getConfig(requestBean, c)
+	if err != nil {
+		return
+	}
+	service, err := getService(config, sshConfig)
+	if err != nil {
+		return
+	}
+
+	request := &BaseRequest{}
+	if !base.RequestJSON(request, c) {
+		return
+	}
+	client, ctx, err := getClient(service, request.Database)
+	if err != nil {
+		return
+	}
+
+	list, err := client.XInfoConsumers(ctx, request.getKey(), request.Group).Result()
+	if err != nil {
+		return
+	}
+	var consumers = []*XConsumerInfo{}
+	for _, one := range list {
+		consumers = append(consumers, &XConsumerInfo{
+			Name:    one.Name,
+			Pending: one.Pending,
+			Idle:    one.Idle,
+		})
+	}
+	res = consumers
+	return
+}
+
+func (this_ *api) xpending(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	config, sshConfig, err := this_.getConfig(requestBean, c)
+	if err != nil {
+		return
+	}
+	service, err := getService(config, sshConfig)
+	if err != nil {
+		return
+	}
+
+	request := &BaseRequest{}
+	if !base.RequestJSON(request, c) {
+		return
+	}
+	client, ctx, err := getClient(service, request.Database)
+	if err != nil {
+		return
+	}
+	key := request.getKey()
+
+	summary, err := client.XPending(ctx, key, request.Group).Result()
+	if err != nil {
+		return
+	}
+	result := &XPendingResult{
+		Count:     summary.Count,
+		Lower:     summary.Lower,
+		Higher:    summary.Higher,
+		Consumers: summary.Consumers,
+	}
+	res = result
+	if summary.Count == 0 {
+		return
+	}
+
+	start, end := request.Start, request.End
+	if start == "" {
+		start = "-"
+	}
+	if end == "" {
+		end = "+"
+	}
+	count := request.Count
+	if count <= 0 {
+		count = 50
+	}
+	list, err := client.XPendingExt(ctx, &goRedis.XPendingExtArgs{
+		Stream:   key,
+		Group:    request.Group,
+		Idle:     time.Duration(request.MinIdle) * time.Millisecond,
+		Start:    start,
+		End:      end,
+		Count:    count,
+		Consumer: request.Consumer,
+	}).Result()
+	if err != nil {
+		return
+	}
+	for _, one := range list {
+		result.List = append(result.List, &XPendingMessage{
+			Id:         one.ID,
+			Consumer:   one.Consumer,
+			Idle:       one.Idle.Milliseconds(),
+			RetryCount: one.RetryCount,
+		})
+	}
+	return
+}
+
+func (this_ *api) xack(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	config, sshConfig, err := this_.getConfig(requestBean, c)
+	if err != nil {
+		return
+	}
+	service, err := getService(config, sshConfig)
+	if err != nil {
+		return
+	}
+
+	request := &BaseRequest{}
+	if !base.RequestJSON(request, c) {
+		return
+	}
+	ids := request.getIds()
+	if len(ids) == 0 {
+		err = errors.New("xack ids is empty")
+		return
+	}
+	client, ctx, err := getClient(service, request.Database)
+	if err != nil {
+		return
+	}
+
+	res, err = client.XAck(ctx, request.getKey(), request.Group, ids...).Result()
+	return
+}
+
+func (this_ *api) xclaim(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	config, sshConfig, err := this_.getConfig(requestBean, c)
+	if err != nil {
+		return
+	}
+	service, err := getService(config, sshConfig)
+	if err != nil {
+		return
+	}
+
+	request := &BaseRequest{}
+	if !base.RequestJSON(request, c) {
+		return
+	}
+	ids := request.getIds()
+	if len(ids) == 0 {
+		err = errors.New("xclaim ids is empty")
+		return
+	}
+	if request.Consumer == "" {
+		err = errors.New("consumer is empty")
+		return
+	}
+	client, ctx, err := getDoClient(service, request.Database)
+	if err != nil {
+		return
+	}
+
+	args := []interface{}{"xclaim", request.getKey(), request.Group, request.Consumer, request.MinIdle}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	list, err := client.Do(ctx, args...).Result()
+	if err != nil {
+		return
+	}
+	res, err = parseXMessages(list)
+	return
+}
@@ -0,0 +1,230 @@
+package module_redis
+
+import (
+	"encoding/base64"
+	"errors"
+	"github.com/gin-gonic/gin"
+	goRedis "github.com/go-redis/redis/v8"
+	"teamide/pkg/background"
+	"teamide/pkg/base"
+)
+
+// taskTypes 本 模块 的 任务 类型，taskStatus、taskStop、taskClean 只 处理 当前 用户 的 这些 任务
+var taskTypes = []string{"analyze", "compare", "copy"}
+
+func getRequestUserId(requestBean *base.RequestBean) (userId int64) {
+	if requestBean.JWT != nil {
+		userId = requestBean.JWT.UserId
+	}
+	return
+}
+
+func (this_ *api) analyze(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	config, sshConfig, err := this_.getConfig(requestBean, c)
+	if err != nil {
+		return
+	}
+	service, err := getService(config, sshConfig)
+	if err != nil {
+		return
+	}
+
+	request := &BaseRequest{}
+	if !base.RequestJSON(request, c) {
+		return
+	}
+	param := request.Analyze
+	if param == nil {
+		param = &AnalyzeParam{
+			Database: request.Database,
+			Pattern:  request.Pattern,
+		}
+	}
+	param.init()
+
+	client, closeConn, err := getConnClient(service, param.Database)
+	if err != nil {
+		return
+	}
+	a := newAnalyzer(param)
+	task := background.NewTask("analyze", func(task *background.Task) (err error) {
+		defer closeConn()
+		return doAnalyze(task, client, a)
+	})
+	task.Result = a
+	task.UserId = getRequestUserId(requestBean)
+	background.StartTask(task)
+	background.AddWorkerTask(request.WorkerId, task.TaskId)
+
+	res = task.Info()
+	return
+}
+
+func (this_ *api) taskStatus(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+
+	var request = &BaseRequest{}
+	if !base.RequestJSON(request, c) {
+		return
+	}
+
+	task := background.GetUserTask(request.TaskId, getRequestUserId(requestBean), taskTypes...)
+	if task != nil {
+		res = task.Info()
+	}
+	return
+}
+
+func (this_ *api) taskStop(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+
+	var request = &BaseRequest{}
+	if !base.RequestJSON(request, c) {
+		return
+	}
+
+	if task := background.GetUserTask(request.TaskId, getRequestUserId(requestBean), taskTypes...); task != nil {
+		task.Stop()
+	}
+	return
+}
+
+func (this_ *api) taskClean(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+
+	var request = &BaseRequest{}
+	if !base.RequestJSON(request, c) {
+		return
+	}
+
+	if task := background.GetUserTask(request.TaskId, getRequestUserId(requestBean), taskTypes...); task != nil {
+		background.ClearTask(task.TaskId)
+	}
+	return
+}
+
+// getTargetClient 获取 对比、复制 的 目标 实例 连接
+func (this_ *api) getTargetClient(requestBean *base.RequestBean, targetToolboxId int64, database int) (client goRedis.Cmdable, closeConn func(), err error) {
+	if targetToolboxId == 0 {
+		err = errors.New("target toolbox id is empty")
+		return
+	}
+	config, sshConfig, err := this_.getConfigById(requestBean, targetToolboxId)
+	if err != nil {
+		return
+	}
+	service, err := getService(config, sshConfig)
+	if err != nil {
+		return
+	}
+	client, closeConn, err = getConnClient(service, database)
+	return
+}
+
+func (this_ *api) compare(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	config, sshConfig, err := this_.getConfig(requestBean, c)
+	if err != nil {
+		return
+	}
+	service, err := getService(config, sshConfig)
+	if err != nil {
+		return
+	}
+
+	request := &BaseRequest{}
+	if !base.RequestJSON(request, c) {
+		return
+	}
+	param := request.Compare
+	if param == nil {
+		err = errors.New("compare param is empty")
+		return
+	}
+	param.init()
+
+	target, closeTarget, err := this_.getTargetClient(requestBean, param.TargetToolboxId, param.TargetDatabase)
+	if err != nil {
+		return
+	}
+	client, closeConn, err := getConnClient(service, param.Database)
+	if err != nil {
+		closeTarget()
+		return
+	}
+	result := &CompareResult{
+		Missing:   []*CompareKey{},
+		Extra:     []*CompareKey{},
+		Different: []*CompareKey{},
+		Phase:     "source",
+	}
+	task := background.NewTask("compare", func(task *background.Task) (err error) {
+		defer closeConn()
+		defer closeTarget()
+		return doCompare(task, client, target, param, result)
+	})
+	task.Result = result
+	task.UserId = getRequestUserId(requestBean)
+	background.StartTask(task)
+	background.AddWorkerTask(request.WorkerId, task.TaskId)
+
+	res = task.Info()
+	return
+}
+
+func (this_ *api) copy(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	config, sshConfig, err := this_.getConfig(requestBean, c)
+	if err != nil {
+		return
+	}
+	service, err := getService(config, sshConfig)
+	if err != nil {
+		return
+	}
+
+	request := &BaseRequest{}
+	if !base.RequestJSON(request, c) {
+		return
+	}
+	param := request.Copy
+	if param == nil {
+		err = errors.New("copy param is empty")
+		return
+	}
+	if err = param.init(); err != nil {
+		return
+	}
+	var keys []string
+	for _, one := range param.Keys {
+		key := one.Key
+		if one.KeyBase64 != "" {
+			var bs []byte
+			if bs, err = base64.StdEncoding.DecodeString(one.KeyBase64); err != nil {
+				return
+			}
+			key = string(bs)
+		}
+		keys = append(keys, key)
+	}
+
+	target, closeTarget, err := this_.getTargetClient(requestBean, param.TargetToolboxId, param.TargetDatabase)
+	if err != nil {
+		return
+	}
+	client, closeConn, err := getConnClient(service, param.Database)
+	if err != nil {
+		closeTarget()
+		return
+	}
+	result := &CopyResult{
+		Errors: []*CopyError{},
+	}
+	task := background.NewTask("copy", func(task *background.Task) (err error) {
+		defer closeConn()
+		defer closeTarget()
+		return doCopy(task, client, target, keys, param, result)
+	})
+	task.Result = result
+	task.UserId = getRequestUserId(requestBean)
+	background.StartTask(task)
+	background.AddWorkerTask(request.WorkerId, task.TaskId)
+
+	res = task.Info()
+	return
+}
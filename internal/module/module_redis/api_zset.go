@@ -0,0 +1,288 @@
+package module_redis
+
+import (
+	"context"
+	"errors"
+	"github.com/gin-gonic/gin"
+	goRedis "github.com/go-redis/redis/v8"
+	"github.com/team-ide/go-tool/redis"
+	"github.com/team-ide/go-tool/util"
+	"teamide/pkg/base"
+)
+
+type ZMember struct {
+	Member string  `json:"member"`
+	Score  float64 `json:"score"`
+}
+
+type ZRangeResult struct {
+	Key        string     `json:"key"`
+	RangeType  string     `json:"rangeType"`
+	Total      int64      `json:"total"`      // zset 总数
+	RangeCount int64      `json:"rangeCount"` // 范围内总数
+	ValueStart int64      `json:"valueStart"`
+	ValueSize  int64      `json:"valueSize"`
+	List       []*ZMember `json:"list"`
+}
+
+func toZMembers(list []goRedis.Z) (res []*ZMember) {
+	for _, one := range list {
+		res = append(res, &ZMember{
+			Member: util.GetStringValue(one.Member),
+			Score:  one.Score,
+		})
+	}
+	return
+}
+
+func (this_ *BaseRequest) getZMembers() (members []*ZMember) {
+	members = this_.Members
+	if len(members) == 0 && this_.Value != "" {
+		members = append(members, &ZMember{Member: this_.Value, Score: this_.Score})
+	}
+	return
+}
+
+func (this_ *api) zadd(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	config, sshConfig, err := this_.getConfig(requestBean, c)
+	if err != nil {
+		return
+	}
+	service, err := getService(config, sshConfig)
+	if err != nil {
+		return
+	}
+
+	request := &BaseRequest{}
+	if !base.RequestJSON(request, c) {
+		return
+	}
+	members := request.getZMembers()
+	if len(members) == 0 {
+		err = errors.New("zadd member is empty")
+		return
+	}
+	client, ctx, err := getClient(service, request.Database)
+	if err != nil {
+		return
+	}
+
+	var zList []*goRedis.Z
+	for _, one := range members {
+		zList = append(zList, &goRedis.Z{Score: one.Score, Member: one.Member})
+	}
+	if request.Nx {
+		res, err = client.ZAddNX(ctx, request.getKey(), zList...).Result()
+	} else if request.Xx {
+		res, err = client.ZAddXX(ctx, request.getKey(), zList...).Result()
+	} else {
+		res, err = client.ZAdd(ctx, request.getKey(), zList...).Result()
+	}
+	if err != nil {
+		return
+	}
+	if request.Expire > 0 {
+		_, err = service.Expire(request.getKey(), request.Expire, &redis.Param{Database: request.Database})
+	}
+	return
+}
+
+func (this_ *api) zrem(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	config, sshConfig, err := this_.getConfig(requestBean, c)
+	if err != nil {
+		return
+	}
+	service, err := getService(config, sshConfig)
+	if err != nil {
+		return
+	}
+
+	request := &BaseRequest{}
+	if !base.RequestJSON(request, c) {
+		return
+	}
+	var members []interface{}
+	for _, one := range request.getZMembers() {
+		members = append(members, one.Member)
+	}
+	if len(members) == 0 {
+		err = errors.New("zrem member is empty")
+		return
+	}
+	client, ctx, err := getClient(service, request.Database)
+	if err != nil {
+		return
+	}
+
+	res, err = client.ZRem(ctx, request.getKey(), members...).Result()
+	return
+}
+
+func (this_ *api) zincrby(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	config, sshConfig, err := this_.getConfig(requestBean, c)
+	if err != nil {
+		return
+	}
+	service, err := getService(config, sshConfig)
+	if err != nil {
+		return
+	}
+
+	request := &BaseRequest{}
+	if !base.RequestJSON(request, c) {
+		return
+	}
+	client, ctx, err := getClient(service, request.Database)
+	if err != nil {
+		return
+	}
+
+	// 返回 增加后的 score
+	res, err = client.ZIncrBy(ctx, request.getKey(), request.Score, request.Value).Result()
+	return
+}
+
+func (this_ *api) zrange(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	config, sshConfig, err := this_.getConfig(requestBean, c)
+	if err != nil {
+		return
+	}
+	service, err := getService(config, sshConfig)
+	if err != nil {
+		return
+	}
+
+	request := &BaseRequest{}
+	if !base.RequestJSON(request, c) {
+		return
+	}
+	client, ctx, err := getClient(service, request.Database)
+	if err != nil {
+		return
+	}
+
+	res, err = zRange(ctx, client, request.getKey(), request)
+	return
+}
+
+// zRange 按 索引、分数、字典序 分页查询 zset
+// index：ValueStart、ValueSize 为索引分页
+// score：Min、Max 为分数范围，如 -inf、+inf、(1、5，ValueStart、ValueSize 为范围内分页
+// lex：Min、Max 为字典序范围，如 -、+、[a、(b，ValueStart、ValueSize 为范围内分页
+func zRange(ctx context.Context, client goRedis.Cmdable, key string, request *BaseRequest) (result *ZRangeResult, err error) {
+	result = &ZRangeResult{
+		Key:        key,
+		RangeType:  request.RangeType,
+		ValueStart: int64(request.ValueStart),
+		ValueSize:  request.ValueSize,
+	}
+	if result.RangeType == "" {
+		result.RangeType = "index"
+	}
+	if result.ValueStart < 0 {
+		result.ValueStart = 0
+	}
+	if result.ValueSize <= 0 {
+		result.ValueSize = 50
+	}
+
+	result.Total, err = client.ZCard(ctx, key).Result()
+	if err != nil {
+		return
+	}
+
+	var list []goRedis.Z
+	switch result.RangeType {
+	case "index":
+		result.RangeCount = result.Total
+		start := result.ValueStart
+		stop := result.ValueStart + result.ValueSize - 1
+		if request.Rev {
+			list, err = client.ZRevRangeWithScores(ctx, key, start, stop).Result()
+		} else {
+			list, err = client.ZRangeWithScores(ctx, key, start, stop).Result()
+		}
+		if err != nil {
+			return
+		}
+		break
+	case "score":
+		min, max := request.Min, request.Max
+		if min == "" {
+			min = "-inf"
+		}
+		if max == "" {
+			max = "+inf"
+		}
+		result.RangeCount, err = client.ZCount(ctx, key, min, max).Result()
+		if err != nil {
+			return
+		}
+		if request.Rev {
+			list, err = client.ZRevRangeByScoreWithScores(ctx, key, &goRedis.ZRangeBy{
+				Min: min, Max: max, Offset: result.ValueStart, Count: result.ValueSize,
+			}).Result()
+		} else {
+			list, err = client.ZRangeByScoreWithScores(ctx, key, &goRedis.ZRangeBy{
+				Min: min, Max: max, Offset: result.ValueStart, Count: result.ValueSize,
+			}).Result()
+		}
+		if err != nil {
+			return
+		}
+		break
+	case "lex":
+		min, max := request.Min, request.Max
+		if min == "" {
+			min = "-"
+		}
+		if max == "" {
+			max = "+"
+		}
+		result.RangeCount, err = client.ZLexCount(ctx, key, min, max).Result()
+		if err != nil {
+			return
+		}
+		var members []string
+		if request.Rev {
+			members, err = client.ZRevRangeByLex(ctx, key, &goRedis.ZRangeBy{
+				Min: min, Max: max, Offset: result.ValueStart, Count: result.ValueSize,
+			}).Result()
+		} else {
+			members, err = client.ZRangeByLex(ctx, key, &goRedis.ZRangeBy{
+				Min: min, Max: max, Offset: result.ValueStart, Count: result.ValueSize,
+			}).Result()
+		}
+		if err != nil {
+			return
+		}
+		// 字典序 查询 不返回分数，需要 补充 分数，ZMScore 需要 6.2 以上版本，这里使用 pipeline 批量 查询
+		pipe := client.Pipeline()
+		var scoreCmds []*goRedis.FloatCmd
+		for _, member := range members {
+			scoreCmds = append(scoreCmds, pipe.ZScore(ctx, key, member))
+		}
+		if _, err = pipe.Exec(ctx); err != nil && err != goRedis.Nil {
+			return
+		}
+		err = nil
+		for i, member := range members {
+			score, e := scoreCmds[i].Result()
+			if e == goRedis.Nil {
+				// 查询 后 已 被 删除
+				continue
+			}
+			if e != nil {
+				err = e
+				return
+			}
+			list = append(list, goRedis.Z{Member: member, Score: score})
+		}
+		break
+	default:
+		err = errors.New("zrange type [" + result.RangeType + "] not support")
+		return
+	}
+	result.List = toZMembers(list)
+	return
+}
@@ -0,0 +1,324 @@
+package module_redis
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	goRedis "github.com/go-redis/redis/v8"
+	"github.com/team-ide/go-tool/redis"
+	"github.com/team-ide/go-tool/util"
+	goSSH "golang.org/x/crypto/ssh"
+	"net"
+	"strings"
+	"teamide/pkg/base"
+	"teamide/pkg/ssh"
+	"time"
+)
+
+const (
+	modeAuto       = "auto"
+	modeStandalone = "standalone"
+	modeCluster    = "cluster"
+	modeSentinel   = "sentinel"
+)
+
+// Config redis 工具 配置，在 go-tool 配置 基础上 增加 集群、哨兵 模式
+type Config struct {
+	*redis.Config
+	Mode             string `json:"mode"` // auto（空）按 地址 自动 判断，standalone、cluster、sentinel
+	MasterName       string `json:"masterName"`
+	SentinelUsername string `json:"sentinelUsername"`
+	SentinelPassword string `json:"sentinelPassword"`
+	ProtoDir         string `json:"protoDir"` // protobuf 解码 使用 的 .proto 文件 目录
+
+	ToolboxId int64 `json:"-"`
+}
+
+// newConfig 从 工具 配置 中 读取 模式 相关 字段，redisConfig 已由 BindConfig 解密
+func (this_ *api) newConfig(toolboxId int64, option string, redisConfig *redis.Config) (config *Config, err error) {
+	config = &Config{}
+	if option != "" {
+		err = json.Unmarshal([]byte(option), config)
+		if err != nil {
+			return
+		}
+	}
+	config.Config = redisConfig
+	config.ToolboxId = toolboxId
+	if config.Mode == "" {
+		config.Mode = modeAuto
+	}
+	config.SentinelPassword = this_.toolboxService.DecryptOptionAttr(config.SentinelPassword)
+	return
+}
+
+// getConfigById 按 工具 ID 获取 配置 并 校验 权限，用于 websocket 及 跨 工具 操作
+func (this_ *api) getConfigById(requestBean *base.RequestBean, toolboxId int64) (config *Config, sshConfig *ssh.Config, err error) {
+	find, err := this_.toolboxService.Get(toolboxId)
+	if err != nil {
+		return
+	}
+	if find == nil {
+		err = errors.New(fmt.Sprintf("toolbox[%d]不存在", toolboxId))
+		return
+	}
+	if find.ToolboxType != "redis" {
+		err = errors.New(fmt.Sprintf("toolbox[%d]不是Redis工具", toolboxId))
+		return
+	}
+	err = this_.toolboxService.CheckToolboxPower(requestBean, find)
+	if err != nil {
+		return
+	}
+	redisConfig := &redis.Config{}
+	sshConfig, err = this_.toolboxService.BindConfigByOption(find.Option, redisConfig, nil)
+	if err != nil {
+		return
+	}
+	config, err = this_.newConfig(find.ToolboxId, find.Option, redisConfig)
+	return
+}
+
+func splitAddress(address string) (list []string) {
+	address = strings.ReplaceAll(address, ";", ",")
+	for _, one := range strings.Split(address, ",") {
+		one = strings.TrimSpace(one)
+		if one != "" {
+			list = append(list, one)
+		}
+	}
+	return
+}
+
+// getSSHDialer 哨兵、副本 节点 连接 与 redis 连接 使用 同一个 SSH 隧道，未 使用 SSH 时 为 nil
+func getSSHDialer(sshClient *goSSH.Client) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	if sshClient == nil {
+		return nil
+	}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, e := sshClient.Dial("tcp", addr)
+		return &util.SSHChanConn{Conn: conn}, e
+	}
+}
+
+// sentinelService 哨兵 模式 使用 FailoverClient，主节点 切换 后 跟随 哨兵 重新 连接，其它 方法 与 go-tool 单机 服务 一致
+type sentinelService struct {
+	*redis.CmdService
+	config   *Config
+	client   *goRedis.Client
+	isClosed bool
+}
+
+func (this_ *Config) newSentinelService() (service redis.IService, err error) {
+	if this_.MasterName == "" {
+		err = errors.New("sentinel master name is empty")
+		return
+	}
+	sentinels := splitAddress(this_.Address)
+	if len(sentinels) == 0 {
+		err = errors.New("sentinel address is empty")
+		return
+	}
+	options := &goRedis.FailoverOptions{
+		MasterName:       this_.MasterName,
+		SentinelAddrs:    sentinels,
+		SentinelUsername: this_.SentinelUsername,
+		SentinelPassword: this_.SentinelPassword,
+		Username:         this_.Username,
+		Password:         this_.Auth,
+		Dialer:           getSSHDialer(this_.SSHClient),
+		DialTimeout:      10 * time.Second,
+		ReadTimeout:      100 * time.Second,
+		WriteTimeout:     100 * time.Second,
+	}
+	if this_.CertPath != "" {
+		var pemCerts []byte
+		if pemCerts, err = util.ReadFile(this_.CertPath); err != nil {
+			return
+		}
+		certPool := x509.NewCertPool()
+		if !certPool.AppendCertsFromPEM(pemCerts) {
+			err = errors.New("证书[" + this_.CertPath + "]解析失败")
+			return
+		}
+		options.TLSConfig = &tls.Config{
+			InsecureSkipVerify: true,
+			RootCAs:            certPool,
+		}
+	}
+	s := &sentinelService{
+		CmdService: &redis.CmdService{
+			ThrowNotFoundErr: this_.ThrowNotFoundErr,
+		},
+		config: this_,
+		client: goRedis.NewFailoverClient(options),
+	}
+	s.CmdService.GetClient = s.getClient
+	service = s
+	return
+}
+
+func (this_ *sentinelService) Close() {
+	if this_.isClosed {
+		return
+	}
+	this_.isClosed = true
+	_ = this_.client.Close()
+}
+
+// getMasterAddr 从 哨兵 获取 当前 主节点 地址，FailoverClient 的 Options().Addr 不是 主节点 地址
+func (this_ *sentinelService) getMasterAddr(ctx context.Context) (addr string, err error) {
+	for _, one := range splitAddress(this_.config.Address) {
+		sentinel := goRedis.NewSentinelClient(&goRedis.Options{
+			Addr:        one,
+			Username:    this_.config.SentinelUsername,
+			Password:    this_.config.SentinelPassword,
+			Dialer:      getSSHDialer(this_.config.SSHClient),
+			TLSConfig:   this_.client.Options().TLSConfig,
+			DialTimeout: 10 * time.Second,
+			ReadTimeout: 10 * time.Second,
+		})
+		var ss []string
+		ss, err = sentinel.GetMasterAddrByName(ctx, this_.config.MasterName).Result()
+		_ = sentinel.Close()
+		if err == nil && len(ss) == 2 {
+			addr = net.JoinHostPort(ss[0], ss[1])
+			return
+		}
+	}
+	if err == nil {
+		err = errors.New("sentinel master [" + this_.config.MasterName + "] not found")
+	}
+	return
+}
+
+func (this_ *sentinelService) getClient(param *redis.Param) (client goRedis.Cmdable, err error) {
+	if param == nil {
+		param = redis.NewParam()
+	}
+	if param.Ctx == nil {
+		param.Ctx = context.Background()
+	}
+	if err = this_.client.Do(param.Ctx, "select", param.Database).Err(); err != nil {
+		return
+	}
+	client = this_.client
+	return
+}
+
+// sentinelParam 取出 参数 中 的 库 与 上下文
+func sentinelParam(args []redis.Arg) (param *redis.Param) {
+	for _, arg := range args {
+		if p, ok := arg.(*redis.Param); ok && p != nil {
+			param = p
+		}
+	}
+	if param == nil {
+		param = redis.NewParam()
+	}
+	if param.Ctx == nil {
+		param.Ctx = context.Background()
+	}
+	return
+}
+
+// sentinelSize 取出 参数 中 的 数量，未 指定 时 返回 def
+func sentinelSize(args []redis.Arg, def int64) (size int64) {
+	size = def
+	for _, arg := range args {
+		if a, ok := arg.(*redis.SizeArg); ok && a != nil {
+			size = a.Size
+		}
+	}
+	return
+}
+
+func (this_ *sentinelService) GetClient(args ...redis.Arg) (client goRedis.Cmdable, err error) {
+	return this_.getClient(sentinelParam(args))
+}
+
+func (this_ *sentinelService) Keys(pattern string, args ...redis.Arg) (keysResult *redis.KeysResult, err error) {
+	param := sentinelParam(args)
+	client, err := this_.getClient(param)
+	if err != nil {
+		return
+	}
+	return redis.Keys(param.Ctx, client, param.Database, pattern, sentinelSize(args, -1))
+}
+
+func (this_ *sentinelService) Scan(pattern string, args ...redis.Arg) (keysResult *redis.KeysResult, err error) {
+	param := sentinelParam(args)
+	client, err := this_.getClient(param)
+	if err != nil {
+		return
+	}
+	var count int64 = 10000
+	for _, arg := range args {
+		if a, ok := arg.(*redis.CountArg); ok && a != nil {
+			count = a.Count
+		}
+	}
+	return redis.Scan(param.Ctx, client, param.Database, pattern, sentinelSize(args, -1), count)
+}
+
+func (this_ *sentinelService) ValueType(key string, args ...redis.Arg) (valueType string, err error) {
+	param := sentinelParam(args)
+	client, err := this_.getClient(param)
+	if err != nil {
+		return
+	}
+	return redis.ValueType(param.Ctx, client, key)
+}
+
+func (this_ *sentinelService) GetValueInfo(key string, args ...redis.Arg) (valueInfo *redis.ValueInfo, err error) {
+	param := sentinelParam(args)
+	client, err := this_.getClient(param)
+	if err != nil {
+		return
+	}
+	var valueStart int64 = -1
+	for _, arg := range args {
+		if a, ok := arg.(*redis.StartArg); ok && a != nil {
+			valueStart = int64(a.Start)
+		}
+	}
+	return redis.GetValueInfo(param.Ctx, client, param.Database, key, valueStart, sentinelSize(args, -1))
+}
+
+func (this_ *sentinelService) DelPattern(pattern string, args ...redis.Arg) (count int, err error) {
+	param := sentinelParam(args)
+	client, err := this_.getClient(param)
+	if err != nil {
+		return
+	}
+	keysResult, err := redis.Scan(param.Ctx, client, param.Database, pattern, -1, 1000)
+	if err != nil {
+		return
+	}
+	for _, key := range keysResult.KeyList {
+		if err = client.Del(param.Ctx, key).Err(); err != nil {
+			return
+		}
+		count++
+	}
+	return
+}
+
+// newService 按 模式 创建 服务
+func (this_ *Config) newService() (service redis.IService, err error) {
+	switch this_.Mode {
+	case modeCluster:
+		this_.Servers = splitAddress(this_.Address)
+		service, err = redis.NewClusterService(this_.Config)
+	case modeSentinel:
+		service, err = this_.newSentinelService()
+	case modeStandalone:
+		service, err = redis.NewRedisService(this_.Config)
+	default:
+		service, err = redis.New(this_.Config)
+	}
+	return
+}
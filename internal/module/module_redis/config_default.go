@@ -0,0 +1,70 @@
+package module_redis
+
+import "strings"
+
+// configDefaults 常用 配置 的 默认值，取自 Redis 7 默认 配置
+var configDefaults = map[string]string{
+	"activedefrag":                "no",
+	"activerehashing":             "yes",
+	"active-expire-effort":        "1",
+	"aof-use-rdb-preamble":        "yes",
+	"appendfilename":              "appendonly.aof",
+	"appendfsync":                 "everysec",
+	"appendonly":                  "no",
+	"auto-aof-rewrite-min-size":   "67108864",
+	"auto-aof-rewrite-percentage": "100",
+	"busy-reply-threshold":        "5000",
+	"client-output-buffer-limit":  "normal 0 0 0 slave 268435456 67108864 60 pubsub 33554432 8388608 60",
+	"client-query-buffer-limit":   "1073741824",
+	"databases":                   "16",
+	"dbfilename":                  "dump.rdb",
+	"dynamic-hz":                  "yes",
+	"hash-max-listpack-entries":   "128",
+	"hash-max-listpack-value":     "64",
+	"hash-max-ziplist-entries":    "128",
+	"hash-max-ziplist-value":      "64",
+	"hz":                          "10",
+	"io-threads":                  "1",
+	"latency-monitor-threshold":   "0",
+	"lazyfree-lazy-eviction":      "no",
+	"lazyfree-lazy-expire":        "no",
+	"lazyfree-lazy-server-del":    "no",
+	"lazyfree-lazy-user-del":      "no",
+	"list-compress-depth":         "0",
+	"list-max-listpack-size":      "-2",
+	"list-max-ziplist-size":       "-2",
+	"loglevel":                    "notice",
+	"lua-time-limit":              "5000",
+	"maxclients":                  "10000",
+	"maxmemory":                   "0",
+	"maxmemory-eviction-tenacity": "10",
+	"maxmemory-policy":            "noeviction",
+	"maxmemory-samples":           "5",
+	"min-replicas-to-write":       "0",
+	"notify-keyspace-events":      "",
+	"proto-max-bulk-len":          "536870912",
+	"protected-mode":              "yes",
+	"rdbchecksum":                 "yes",
+	"rdbcompression":              "yes",
+	"repl-backlog-size":           "1048576",
+	"repl-timeout":                "60",
+	"save":                        "3600 1 300 100 60 10000",
+	"set-max-intset-entries":      "512",
+	"slowlog-log-slower-than":     "10000",
+	"slowlog-max-len":             "128",
+	"stop-writes-on-bgsave-error": "yes",
+	"stream-node-max-bytes":       "4096",
+	"stream-node-max-entries":     "100",
+	"tcp-backlog":                 "511",
+	"tcp-keepalive":               "300",
+	"timeout":                     "0",
+	"zset-max-listpack-entries":   "128",
+	"zset-max-listpack-value":     "64",
+	"zset-max-ziplist-entries":    "128",
+	"zset-max-ziplist-value":      "64",
+}
+
+// configValueEqual 忽略 大小写 与 多余 空白 比较 配置值
+func configValueEqual(value string, defaultValue string) bool {
+	return strings.EqualFold(strings.Join(strings.Fields(value), " "), strings.Join(strings.Fields(defaultValue), " "))
+}
@@ -0,0 +1,262 @@
+package module_redis
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	goRedis "github.com/go-redis/redis/v8"
+	"github.com/gorilla/websocket"
+	"github.com/team-ide/go-tool/util"
+	"go.uber.org/zap"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"teamide/pkg/base"
+	"time"
+)
+
+const (
+	monitorSecondsDefault = 10
+	monitorSecondsMax     = 300
+	monitorCountDefault   = 1000
+	monitorCountMax       = 100000
+)
+
+type MonitorMessage struct {
+	Type   string   `json:"type"` // command、end、error
+	Time   int64    `json:"time,omitempty"`
+	Db     string   `json:"db,omitempty"`
+	Addr   string   `json:"addr,omitempty"`
+	Args   []string `json:"args,omitempty"`
+	Count  int64    `json:"count,omitempty"`
+	Reason string   `json:"reason,omitempty"`
+}
+
+func writeRespCommand(conn net.Conn, args ...string) (err error) {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("*%d\r\n", len(args)))
+	for _, arg := range args {
+		sb.WriteString(fmt.Sprintf("$%d\r\n%s\r\n", len(arg), arg))
+	}
+	_, err = conn.Write([]byte(sb.String()))
+	return
+}
+
+// readRespLine 读取 单行 应答，MONITOR 输出 均为 简单 字符串
+func readRespLine(reader *bufio.Reader) (line string, err error) {
+	line, err = reader.ReadString('\n')
+	if err != nil {
+		return
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if strings.HasPrefix(line, "-") {
+		err = errors.New(line[1:])
+		return
+	}
+	if strings.HasPrefix(line, "+") {
+		line = line[1:]
+	}
+	return
+}
+
+// dialMonitor 使用 客户端 的 Dialer 建立 独立 连接 并 进入 MONITOR 模式，复用 SSH 隧道 等 配置
+func dialMonitor(ctx context.Context, node *goRedis.Client) (conn net.Conn, reader *bufio.Reader, err error) {
+	opt := node.Options()
+	conn, err = opt.Dialer(ctx, "tcp", opt.Addr)
+	if err != nil {
+		return
+	}
+	reader = bufio.NewReader(conn)
+	defer func() {
+		if err != nil {
+			_ = conn.Close()
+		}
+	}()
+	if opt.Password != "" {
+		if opt.Username != "" {
+			err = writeRespCommand(conn, "AUTH", opt.Username, opt.Password)
+		} else {
+			err = writeRespCommand(conn, "AUTH", opt.Password)
+		}
+		if err != nil {
+			return
+		}
+		if _, err = readRespLine(reader); err != nil {
+			return
+		}
+	}
+	err = writeRespCommand(conn, "MONITOR")
+	if err != nil {
+		return
+	}
+	_, err = readRespLine(reader)
+	return
+}
+
+// parseMonitorLine 解析 如：1339518083.107412 [0 127.0.0.1:60866] "keys" "*"
+func parseMonitorLine(line string) (message *MonitorMessage) {
+	message = &MonitorMessage{
+		Type: "command",
+	}
+	index := strings.Index(line, " ")
+	if index < 0 {
+		message.Args = []string{line}
+		return
+	}
+	if t, e := strconv.ParseFloat(line[:index], 64); e == nil {
+		message.Time = int64(t * 1000)
+	}
+	line = line[index+1:]
+	if strings.HasPrefix(line, "[") {
+		end := strings.Index(line, "]")
+		if end > 0 {
+			ss := strings.SplitN(line[1:end], " ", 2)
+			message.Db = ss[0]
+			if len(ss) > 1 {
+				message.Addr = ss[1]
+			}
+			line = line[end+1:]
+		}
+	}
+	message.Args = []string{}
+	for {
+		start := strings.Index(line, "\"")
+		if start < 0 {
+			break
+		}
+		end := start + 1
+		for end < len(line) {
+			if line[end] == '\\' {
+				end += 2
+				continue
+			}
+			if line[end] == '"' {
+				break
+			}
+			end++
+		}
+		if end >= len(line) {
+			message.Args = append(message.Args, line[start+1:])
+			break
+		}
+		token := line[start : end+1]
+		// redis 转义 格式 与 go 一致，如 \" \\ \n \xHH
+		if arg, e := strconv.Unquote(token); e == nil {
+			message.Args = append(message.Args, arg)
+		} else {
+			message.Args = append(message.Args, token[1:len(token)-1])
+		}
+		line = line[end+1:]
+	}
+	return
+}
+
+func (this_ *api) monitor(requestBean *base.RequestBean, c *gin.Context) (res interface{}, err error) {
+	if requestBean.JWT == nil || requestBean.JWT.UserId == 0 {
+		err = errors.New("登录用户获取失败")
+		return
+	}
+	seconds, _ := strconv.Atoi(c.Query("seconds"))
+	if seconds <= 0 {
+		seconds = monitorSecondsDefault
+	}
+	if seconds > monitorSecondsMax {
+		seconds = monitorSecondsMax
+	}
+	count, _ := strconv.ParseInt(c.Query("count"), 10, 64)
+	if count <= 0 {
+		count = monitorCountDefault
+	}
+	if count > monitorCountMax {
+		count = monitorCountMax
+	}
+
+	config, sshConfig, err := this_.getWebsocketConfig(requestBean, c)
+	if err != nil {
+		return
+	}
+	service, err := getService(config, sshConfig)
+	if err != nil {
+		return
+	}
+	client, ctx, err := getClient(service, 0)
+	if err != nil {
+		return
+	}
+	node, closeNode, err := getNodeClient(ctx, service, client, c.Query("address"))
+	if err != nil {
+		return
+	}
+
+	//升级get请求为webSocket协议
+	ws, err := upGrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		return
+	}
+
+	conn, reader, err := dialMonitor(ctx, node)
+	// MONITOR 使用 独立 连接，副本 临时 客户端 可以 先 关闭
+	closeNode()
+	if err != nil {
+		_ = ws.WriteJSON(&MonitorMessage{Type: "error", Reason: "monitor start error:" + err.Error()})
+		util.Logger.Error("redis monitor start error", zap.Error(err))
+		_ = ws.Close()
+		return
+	}
+
+	go doMonitor(ws, conn, reader, time.Duration(seconds)*time.Second, count)
+
+	res = base.HttpNotResponse
+	return
+}
+
+// doMonitor 达到 时长、条数 或 页面 关闭 时 结束，关闭 连接 即 退出 MONITOR
+func doMonitor(ws *websocket.Conn, conn net.Conn, reader *bufio.Reader, duration time.Duration, count int64) {
+	var reason string
+	var reasonOnce sync.Once
+	stop := func(r string) {
+		reasonOnce.Do(func() {
+			reason = r
+			_ = conn.Close()
+		})
+	}
+	defer func() {
+		if e := recover(); e != nil {
+			util.Logger.Error("redis monitor panic error", zap.Any("error", e))
+		}
+		_ = ws.Close()
+	}()
+
+	timer := time.AfterFunc(duration, func() {
+		stop("timeout")
+	})
+	defer timer.Stop()
+
+	go func() {
+		for {
+			if _, _, e := ws.ReadMessage(); e != nil {
+				stop("closed")
+				return
+			}
+		}
+	}()
+
+	var n int64
+	for n < count {
+		line, err := readRespLine(reader)
+		if err != nil {
+			stop("error:" + err.Error())
+			break
+		}
+		n++
+		if err = ws.WriteJSON(parseMonitorLine(line)); err != nil {
+			stop("closed")
+			break
+		}
+	}
+	stop("count")
+	_ = ws.WriteJSON(&MonitorMessage{Type: "end", Count: n, Reason: reason})
+}
@@ -0,0 +1,406 @@
+package module_redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	goRedis "github.com/go-redis/redis/v8"
+	"github.com/gorilla/websocket"
+	"github.com/team-ide/go-tool/redis"
+	"github.com/team-ide/go-tool/util"
+	"go.uber.org/zap"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+var upGrader = websocket.Upgrader{
+	ReadBufferSize:  32 * 1024,
+	WriteBufferSize: 32 * 1024,
+	CheckOrigin: func(r *http.Request) bool {
+		return true
+	},
+}
+
+const (
+	pubSubBufferSizeDefault = 1000
+	pubSubBufferSizeMax     = 10000
+)
+
+type PubSubMessage struct {
+	Type    string `json:"type"`
+	Channel string `json:"channel,omitempty"`
+	Pattern string `json:"pattern,omitempty"`
+	Payload string `json:"payload,omitempty"`
+	Time    int64  `json:"time,omitempty"`
+}
+
+type PubSubFilter struct {
+	Channel string `json:"channel"` // 渠道 包含
+	Payload string `json:"payload"` // 消息 包含
+	Regexp  bool   `json:"regexp"`  // 是否 使用 正则 匹配
+
+	channelRegexp *regexp.Regexp
+	payloadRegexp *regexp.Regexp
+}
+
+func (this_ *PubSubFilter) init() (err error) {
+	if !this_.Regexp {
+		return
+	}
+	if this_.Channel != "" {
+		this_.channelRegexp, err = regexp.Compile(this_.Channel)
+		if err != nil {
+			return
+		}
+	}
+	if this_.Payload != "" {
+		this_.payloadRegexp, err = regexp.Compile(this_.Payload)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (this_ *PubSubFilter) match(channel string, payload string) bool {
+	if this_.Regexp {
+		if this_.channelRegexp != nil && !this_.channelRegexp.MatchString(channel) {
+			return false
+		}
+		if this_.payloadRegexp != nil && !this_.payloadRegexp.MatchString(payload) {
+			return false
+		}
+		return true
+	}
+	if this_.Channel != "" && !strings.Contains(channel, this_.Channel) {
+		return false
+	}
+	if this_.Payload != "" && !strings.Contains(payload, this_.Payload) {
+		return false
+	}
+	return true
+}
+
+type PubSubStatus struct {
+	WorkerId   string   `json:"workerId"`
+	Channels   []string `json:"channels"`
+	Patterns   []string `json:"patterns"`
+	BufferSize int      `json:"bufferSize"`
+	Buffered   int      `json:"buffered"`
+	Received   int64    `json:"received"`
+	Dropped    int64    `json:"dropped"`  // 缓冲 已满 被 覆盖 的 消息数
+	Filtered   int64    `json:"filtered"` // 被 过滤 的 消息数
+
+	Filter *PubSubFilter `json:"filter"`
+}
+
+// pubSubClient go-redis Client 和 ClusterClient 都实现 订阅 方法
+type pubSubClient interface {
+	Subscribe(ctx context.Context, channels ...string) *goRedis.PubSub
+}
+
+type pubSubWorker struct {
+	workerId string
+	userId   int64
+	ws       *websocket.Conn
+	pubSub   *goRedis.PubSub
+
+	channels []string
+	patterns []string
+	filter   *PubSubFilter
+
+	// 环形 缓冲，只保留 最近 bufferSize 条 消息
+	buffer     []*PubSubMessage
+	bufferNext int
+	bufferFull bool
+
+	received int64
+	dropped  int64
+	filtered int64
+
+	lock      sync.Mutex
+	isStopped bool
+}
+
+var pubSubWorkerCache = map[string]*pubSubWorker{}
+var pubSubWorkerCacheLock = &sync.Mutex{}
+
+func getPubSubWorker(workerId string) (worker *pubSubWorker) {
+	pubSubWorkerCacheLock.Lock()
+	defer pubSubWorkerCacheLock.Unlock()
+
+	worker = pubSubWorkerCache[workerId]
+	return
+}
+
+func startPubSubWorker(service redis.IService, workerId string, userId int64, bufferSize int, ws *websocket.Conn) (err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = errors.New(fmt.Sprint(e))
+			util.Logger.Error("startPubSubWorker panic error", zap.Error(err))
+		}
+	}()
+
+	if bufferSize <= 0 {
+		bufferSize = pubSubBufferSizeDefault
+	}
+	if bufferSize > pubSubBufferSizeMax {
+		bufferSize = pubSubBufferSizeMax
+	}
+
+	pubSubWorkerCacheLock.Lock()
+	defer pubSubWorkerCacheLock.Unlock()
+
+	if pubSubWorkerCache[workerId] != nil {
+		err = errors.New("订阅会话[" + workerId + "]已存在")
+		return
+	}
+
+	client, ctx, err := getClient(service, 0)
+	if err != nil {
+		return
+	}
+	c, ok := client.(pubSubClient)
+	if !ok {
+		err = errors.New("redis client not support subscribe")
+		return
+	}
+
+	worker := &pubSubWorker{
+		workerId: workerId,
+		userId:   userId,
+		ws:       ws,
+		pubSub:   c.Subscribe(ctx),
+		filter:   &PubSubFilter{},
+		buffer:   make([]*PubSubMessage, bufferSize),
+	}
+	pubSubWorkerCache[workerId] = worker
+
+	// 消息 通道 同样 限制 大小，消费 跟不上 时 由 go-redis 丢弃
+	ch := worker.pubSub.Channel(goRedis.WithChannelSize(bufferSize))
+	go worker.startReadWS()
+	go worker.startReadPubSub(ch)
+	return
+}
+
+func stopPubSubWorker(workerId string) {
+	pubSubWorkerCacheLock.Lock()
+	worker := pubSubWorkerCache[workerId]
+	delete(pubSubWorkerCache, workerId)
+	pubSubWorkerCacheLock.Unlock()
+
+	if worker != nil {
+		worker.stop()
+	}
+}
+
+func (this_ *pubSubWorker) stop() {
+	this_.lock.Lock()
+	defer this_.lock.Unlock()
+	if this_.isStopped {
+		return
+	}
+	this_.isStopped = true
+
+	util.Logger.Info("pub sub worker stop", zap.Any("workerId", this_.workerId))
+	if this_.pubSub != nil {
+		_ = this_.pubSub.Close()
+	}
+	if this_.ws != nil {
+		_ = this_.ws.Close()
+	}
+}
+
+// startReadWS 页面 不通过 ws 发送 指令，只 用于 感知 连接 关闭
+func (this_ *pubSubWorker) startReadWS() {
+	defer func() {
+		if e := recover(); e != nil {
+			util.Logger.Error("pub sub startReadWS panic error", zap.Any("error", e))
+		}
+		stopPubSubWorker(this_.workerId)
+	}()
+
+	for {
+		_, _, err := this_.ws.ReadMessage()
+		if err != nil {
+			break
+		}
+	}
+}
+
+func (this_ *pubSubWorker) startReadPubSub(ch <-chan *goRedis.Message) {
+	defer func() {
+		if e := recover(); e != nil {
+			util.Logger.Error("pub sub startReadPubSub panic error", zap.Any("error", e))
+		}
+		stopPubSubWorker(this_.workerId)
+	}()
+
+	for msg := range ch {
+		message := this_.onMessage(msg)
+		if message == nil {
+			continue
+		}
+		err := this_.ws.WriteJSON(message)
+		if err != nil {
+			this_.lock.Lock()
+			isStopped := this_.isStopped
+			this_.lock.Unlock()
+			if !isStopped {
+				util.Logger.Error("pub sub ws write error", zap.Error(err))
+			}
+			break
+		}
+	}
+}
+
+// onMessage 过滤 并 写入 缓冲，返回 nil 表示 被过滤
+func (this_ *pubSubWorker) onMessage(msg *goRedis.Message) (message *PubSubMessage) {
+	this_.lock.Lock()
+	defer this_.lock.Unlock()
+
+	this_.received++
+	if !this_.filter.match(msg.Channel, msg.Payload) {
+		this_.filtered++
+		return
+	}
+	message = &PubSubMessage{
+		Type:    "message",
+		Channel: msg.Channel,
+		Pattern: msg.Pattern,
+		Payload: msg.Payload,
+		Time:    util.GetNowMilli(),
+	}
+	if this_.bufferFull {
+		this_.dropped++
+	}
+	this_.buffer[this_.bufferNext] = message
+	this_.bufferNext++
+	if this_.bufferNext >= len(this_.buffer) {
+		this_.bufferNext = 0
+		this_.bufferFull = true
+	}
+	return
+}
+
+func (this_ *pubSubWorker) subscribe(channels []string, patterns []string) (err error) {
+	this_.lock.Lock()
+	defer this_.lock.Unlock()
+
+	ctx := context.Background()
+	if len(channels) > 0 {
+		err = this_.pubSub.Subscribe(ctx, channels...)
+		if err != nil {
+			return
+		}
+		this_.channels = appendNotExists(this_.channels, channels)
+	}
+	if len(patterns) > 0 {
+		err = this_.pubSub.PSubscribe(ctx, patterns...)
+		if err != nil {
+			return
+		}
+		this_.patterns = appendNotExists(this_.patterns, patterns)
+	}
+	return
+}
+
+func (this_ *pubSubWorker) unsubscribe(channels []string, patterns []string) (err error) {
+	this_.lock.Lock()
+	defer this_.lock.Unlock()
+
+	ctx := context.Background()
+	if len(channels) > 0 {
+		err = this_.pubSub.Unsubscribe(ctx, channels...)
+		if err != nil {
+			return
+		}
+		this_.channels = removeExists(this_.channels, channels)
+	}
+	if len(patterns) > 0 {
+		err = this_.pubSub.PUnsubscribe(ctx, patterns...)
+		if err != nil {
+			return
+		}
+		this_.patterns = removeExists(this_.patterns, patterns)
+	}
+	return
+}
+
+func (this_ *pubSubWorker) setFilter(filter *PubSubFilter) (err error) {
+	if filter == nil {
+		filter = &PubSubFilter{}
+	}
+	err = filter.init()
+	if err != nil {
+		return
+	}
+	this_.lock.Lock()
+	defer this_.lock.Unlock()
+
+	this_.filter = filter
+	return
+}
+
+// messages 按 接收 顺序 返回 缓冲 中的 消息
+func (this_ *pubSubWorker) messages() (list []*PubSubMessage) {
+	this_.lock.Lock()
+	defer this_.lock.Unlock()
+
+	list = []*PubSubMessage{}
+	if this_.bufferFull {
+		list = append(list, this_.buffer[this_.bufferNext:]...)
+	}
+	list = append(list, this_.buffer[:this_.bufferNext]...)
+	return
+}
+
+func (this_ *pubSubWorker) clean() {
+	this_.lock.Lock()
+	defer this_.lock.Unlock()
+
+	this_.buffer = make([]*PubSubMessage, len(this_.buffer))
+	this_.bufferNext = 0
+	this_.bufferFull = false
+}
+
+func (this_ *pubSubWorker) status() (status *PubSubStatus) {
+	this_.lock.Lock()
+	defer this_.lock.Unlock()
+
+	status = &PubSubStatus{
+		WorkerId:   this_.workerId,
+		Channels:   this_.channels,
+		Patterns:   this_.patterns,
+		BufferSize: len(this_.buffer),
+		Buffered:   this_.bufferNext,
+		Received:   this_.received,
+		Dropped:    this_.dropped,
+		Filtered:   this_.filtered,
+		Filter:     this_.filter,
+	}
+	if this_.bufferFull {
+		status.Buffered = len(this_.buffer)
+	}
+	return
+}
+
+func appendNotExists(list []string, values []string) []string {
+	for _, one := range values {
+		if util.StringIndexOf(list, one) < 0 {
+			list = append(list, one)
+		}
+	}
+	return list
+}
+
+func removeExists(list []string, values []string) (res []string) {
+	for _, one := range list {
+		if util.StringIndexOf(values, one) < 0 {
+			res = append(res, one)
+		}
+	}
+	return
+}
@@ -0,0 +1,411 @@
+package module_redis
+
+import (
+	"context"
+	"errors"
+	goRedis "github.com/go-redis/redis/v8"
+	"sort"
+	"strings"
+	"sync"
+	"teamide/pkg/background"
+	"time"
+)
+
+type AnalyzeParam struct {
+	Database    int    `json:"database"`
+	Pattern     string `json:"pattern"`
+	ScanCount   int64  `json:"scanCount"`   // SCAN COUNT 提示
+	MaxKeys     int64  `json:"maxKeys"`     // 最多 分析 key 数，0 为 不限制
+	Rate        int64  `json:"rate"`        // 每秒 最多 分析 key 数
+	TopN        int    `json:"topN"`        // 最大 key 数量
+	Separator   string `json:"separator"`   // 命名空间 分隔符
+	PrefixDepth int    `json:"prefixDepth"` // 命名空间 层级
+	Samples     int    `json:"samples"`     // MEMORY USAGE SAMPLES
+}
+
+func (this_ *AnalyzeParam) init() {
+	if this_.Pattern == "" {
+		this_.Pattern = "*"
+	}
+	if this_.ScanCount <= 0 {
+		this_.ScanCount = 500
+	}
+	if this_.Rate <= 0 {
+		this_.Rate = 1000
+	}
+	if this_.TopN <= 0 {
+		this_.TopN = 100
+	}
+	if this_.TopN > 1000 {
+		this_.TopN = 1000
+	}
+	if this_.Separator == "" {
+		this_.Separator = ":"
+	}
+	if this_.PrefixDepth <= 0 {
+		this_.PrefixDepth = 1
+	}
+	if this_.Samples <= 0 {
+		this_.Samples = 5
+	}
+}
+
+type AnalyzeKey struct {
+	Key    string `json:"key"`
+	Type   string `json:"type"`
+	Memory int64  `json:"memory"` // 字节，-1 为 不支持 MEMORY USAGE
+	Length int64  `json:"length"` // 元素 数量，string 为 长度
+	TTL    int64  `json:"ttl"`    // 毫秒，-1 为 不过期
+}
+
+type AnalyzeBucket struct {
+	Name     string `json:"name"`
+	KeyCount int64  `json:"keyCount"`
+	Memory   int64  `json:"memory"`
+	Length   int64  `json:"length"`
+}
+
+type AnalyzeResult struct {
+	ScanCount     int64 `json:"scanCount"`
+	KeyCount      int64 `json:"keyCount"`
+	TotalMemory   int64 `json:"totalMemory"`
+	MemoryEnabled bool  `json:"memoryEnabled"`
+
+	TopMemoryKeys []*AnalyzeKey    `json:"topMemoryKeys"`
+	TopLengthKeys []*AnalyzeKey    `json:"topLengthKeys"`
+	Prefixes      []*AnalyzeBucket `json:"prefixes"`
+	Types         []*AnalyzeBucket `json:"types"`
+	TTLs          []*AnalyzeBucket `json:"ttls"`
+}
+
+const analyzePrefixMax = 10000
+const analyzePrefixOther = "(other)"
+
+var analyzeTTLBuckets = []struct {
+	name string
+	max  time.Duration
+}{
+	{name: "1m", max: time.Minute},
+	{name: "1h", max: time.Hour},
+	{name: "1d", max: 24 * time.Hour},
+	{name: "7d", max: 7 * 24 * time.Hour},
+	{name: "30d", max: 30 * 24 * time.Hour},
+}
+
+// analyzer 汇总 分析 数据，只 保留 有限 的 top key 与 命名空间，防止 大 keyspace 占用 过多 内存
+type analyzer struct {
+	param *AnalyzeParam
+
+	scanCount     int64
+	keyCount      int64
+	totalMemory   int64
+	memoryEnabled bool
+
+	topMemoryKeys []*AnalyzeKey
+	topLengthKeys []*AnalyzeKey
+	prefixes      map[string]*AnalyzeBucket
+	types         map[string]*AnalyzeBucket
+	ttls          map[string]*AnalyzeBucket
+}
+
+func newAnalyzer(param *AnalyzeParam) *analyzer {
+	return &analyzer{
+		param:         param,
+		memoryEnabled: true,
+		prefixes:      map[string]*AnalyzeBucket{},
+		types:         map[string]*AnalyzeBucket{},
+		ttls:          map[string]*AnalyzeBucket{},
+	}
+}
+
+func (this_ *analyzer) getPrefix(key string) string {
+	ss := strings.SplitN(key, this_.param.Separator, this_.param.PrefixDepth+1)
+	if len(ss) <= 1 {
+		return ""
+	}
+	if len(ss) > this_.param.PrefixDepth {
+		ss = ss[:this_.param.PrefixDepth]
+	}
+	return strings.Join(ss, this_.param.Separator) + this_.param.Separator
+}
+
+func getTTLBucket(ttl int64) string {
+	if ttl < 0 {
+		return "none"
+	}
+	d := time.Duration(ttl) * time.Millisecond
+	for _, one := range analyzeTTLBuckets {
+		if d < one.max {
+			return "<" + one.name
+		}
+	}
+	return ">=" + analyzeTTLBuckets[len(analyzeTTLBuckets)-1].name
+}
+
+func addBucket(buckets map[string]*AnalyzeBucket, name string, key *AnalyzeKey) {
+	bucket := buckets[name]
+	if bucket == nil {
+		bucket = &AnalyzeBucket{Name: name}
+		buckets[name] = bucket
+	}
+	bucket.KeyCount++
+	if key.Memory > 0 {
+		bucket.Memory += key.Memory
+	}
+	bucket.Length += key.Length
+}
+
+// addTop 维护 降序 的 top 列表
+func addTop(list []*AnalyzeKey, key *AnalyzeKey, topN int, value func(one *AnalyzeKey) int64) []*AnalyzeKey {
+	v := value(key)
+	if len(list) >= topN && value(list[len(list)-1]) >= v {
+		return list
+	}
+	index := sort.Search(len(list), func(i int) bool {
+		return value(list[i]) < v
+	})
+	list = append(list, nil)
+	copy(list[index+1:], list[index:])
+	list[index] = key
+	if len(list) > topN {
+		list = list[:topN]
+	}
+	return list
+}
+
+func (this_ *analyzer) add(key *AnalyzeKey) {
+	this_.keyCount++
+	if key.Memory > 0 {
+		this_.totalMemory += key.Memory
+	}
+	this_.topMemoryKeys = addTop(this_.topMemoryKeys, key, this_.param.TopN, func(one *AnalyzeKey) int64 { return one.Memory })
+	this_.topLengthKeys = addTop(this_.topLengthKeys, key, this_.param.TopN, func(one *AnalyzeKey) int64 { return one.Length })
+
+	prefix := this_.getPrefix(key.Key)
+	if this_.prefixes[prefix] == nil && len(this_.prefixes) >= analyzePrefixMax {
+		prefix = analyzePrefixOther
+	}
+	addBucket(this_.prefixes, prefix, key)
+	addBucket(this_.types, key.Type, key)
+	addBucket(this_.ttls, getTTLBucket(key.TTL), key)
+}
+
+func sortBuckets(buckets map[string]*AnalyzeBucket, limit int) (list []*AnalyzeBucket) {
+	list = []*AnalyzeBucket{}
+	for _, one := range buckets {
+		b := *one
+		list = append(list, &b)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Memory == list[j].Memory {
+			return list[i].KeyCount > list[j].KeyCount
+		}
+		return list[i].Memory > list[j].Memory
+	})
+	if limit > 0 && len(list) > limit {
+		list = list[:limit]
+	}
+	return
+}
+
+// Snapshot 汇总 当前 结果，任务 通过 task.Update 修改 analyzer
+func (this_ *analyzer) Snapshot() interface{} {
+	return this_.result()
+}
+
+func (this_ *analyzer) result() *AnalyzeResult {
+	res := &AnalyzeResult{
+		ScanCount:     this_.scanCount,
+		KeyCount:      this_.keyCount,
+		TotalMemory:   this_.totalMemory,
+		MemoryEnabled: this_.memoryEnabled,
+		TopMemoryKeys: append([]*AnalyzeKey{}, this_.topMemoryKeys...),
+		TopLengthKeys: append([]*AnalyzeKey{}, this_.topLengthKeys...),
+		Prefixes:      sortBuckets(this_.prefixes, this_.param.TopN),
+		Types:         sortBuckets(this_.types, 0),
+	}
+	// TTL 分布 按 区间 顺序
+	res.TTLs = []*AnalyzeBucket{}
+	var names = []string{"none"}
+	for _, one := range analyzeTTLBuckets {
+		names = append(names, "<"+one.name)
+	}
+	names = append(names, ">="+analyzeTTLBuckets[len(analyzeTTLBuckets)-1].name)
+	for _, name := range names {
+		if b := this_.ttls[name]; b != nil {
+			c := *b
+			res.TTLs = append(res.TTLs, &c)
+		}
+	}
+	return res
+}
+
+// loadKeys 使用 pipeline 批量 获取 key 类型、内存、长度、过期时间，memoryEnabled 返回 是否 支持 MEMORY USAGE
+func (this_ *analyzer) loadKeys(ctx context.Context, client goRedis.Cmdable, keys []string) (list []*AnalyzeKey, memoryEnabled bool, err error) {
+	memoryEnabled = this_.memoryEnabled
+	pipe := client.Pipeline()
+	var typeCmds []*goRedis.StatusCmd
+	var ttlCmds []*goRedis.DurationCmd
+	var memoryCmds []*goRedis.IntCmd
+	for _, key := range keys {
+		typeCmds = append(typeCmds, pipe.Type(ctx, key))
+		ttlCmds = append(ttlCmds, pipe.PTTL(ctx, key))
+		if memoryEnabled {
+			memoryCmds = append(memoryCmds, pipe.MemoryUsage(ctx, key, this_.param.Samples))
+		}
+	}
+	_, _ = pipe.Exec(ctx)
+
+	pipe = client.Pipeline()
+	var lengthCmds = make([]*goRedis.IntCmd, len(keys))
+	for i, key := range keys {
+		t, e := typeCmds[i].Result()
+		if e != nil {
+			err = e
+			return
+		}
+		var key_ = &AnalyzeKey{
+			Key:    key,
+			Type:   t,
+			Memory: -1,
+			TTL:    -1,
+		}
+		if t == "none" {
+			// 扫描 后 已 被 删除
+			list = append(list, nil)
+			continue
+		}
+		if ttl, e := ttlCmds[i].Result(); e == nil && ttl > 0 {
+			key_.TTL = ttl.Milliseconds()
+		}
+		if memoryEnabled {
+			memory, e := memoryCmds[i].Result()
+			if e == nil {
+				key_.Memory = memory
+			} else if e != goRedis.Nil && isRedisError(e) && strings.Contains(strings.ToLower(e.Error()), "unknown") {
+				// 低 版本 不支持 MEMORY USAGE
+				memoryEnabled = false
+			}
+		}
+		switch t {
+		case "string":
+			lengthCmds[i] = pipe.StrLen(ctx, key)
+		case "list":
+			lengthCmds[i] = pipe.LLen(ctx, key)
+		case "hash":
+			lengthCmds[i] = pipe.HLen(ctx, key)
+		case "set":
+			lengthCmds[i] = pipe.SCard(ctx, key)
+		case "zset":
+			lengthCmds[i] = pipe.ZCard(ctx, key)
+		case "stream":
+			lengthCmds[i] = pipe.XLen(ctx, key)
+		}
+		list = append(list, key_)
+	}
+	_, _ = pipe.Exec(ctx)
+	for i, one := range list {
+		if one == nil || lengthCmds[i] == nil {
+			continue
+		}
+		one.Length, _ = lengthCmds[i].Result()
+	}
+	return
+}
+
+// scanKeys 遍历 key，集群 模式 下 遍历 所有 主节点
+func scanKeys(ctx context.Context, client goRedis.Cmdable, pattern string, count int64, on func(client goRedis.Cmdable, keys []string) (next bool, err error)) (err error) {
+	scanOne := func(c goRedis.Cmdable) (err error) {
+		var cursor uint64
+		for {
+			var keys []string
+			keys, cursor, err = c.Scan(ctx, cursor, pattern, count).Result()
+			if err != nil {
+				return
+			}
+			if len(keys) > 0 {
+				var next bool
+				next, err = on(c, keys)
+				if err != nil || !next {
+					return
+				}
+			}
+			if cursor == 0 {
+				return
+			}
+		}
+	}
+	if clusterClient, ok := client.(*goRedis.ClusterClient); ok {
+		var masters []*goRedis.Client
+		var lock sync.Mutex
+		err = clusterClient.ForEachMaster(ctx, func(ctx context.Context, c *goRedis.Client) error {
+			lock.Lock()
+			defer lock.Unlock()
+			masters = append(masters, c)
+			return nil
+		})
+		if err != nil {
+			return
+		}
+		// 逐个 节点 扫描，保证 速率 限制
+		for _, c := range masters {
+			err = scanOne(c)
+			if err != nil {
+				return
+			}
+		}
+		return
+	}
+	err = scanOne(client)
+	return
+}
+
+var errAnalyzeStop = errors.New("analyze stopped")
+
+// 结果 只 在 task.Update 内 修改
+func doAnalyze(task *background.Task, client goRedis.Cmdable, a *analyzer) (err error) {
+	ctx := context.Background()
+	param := a.param
+
+	startTime := time.Now()
+	err = scanKeys(ctx, client, param.Pattern, param.ScanCount, func(c goRedis.Cmdable, keys []string) (next bool, err error) {
+		if task.IsStopped() {
+			err = errAnalyzeStop
+			return
+		}
+		if param.MaxKeys > 0 && a.scanCount+int64(len(keys)) > param.MaxKeys {
+			keys = keys[:param.MaxKeys-a.scanCount]
+		}
+		list, memoryEnabled, err := a.loadKeys(ctx, c, keys)
+		if err != nil {
+			return
+		}
+		task.Update(func() {
+			a.scanCount += int64(len(keys))
+			a.memoryEnabled = memoryEnabled
+			for _, one := range list {
+				if one != nil {
+					a.add(one)
+				}
+			}
+		})
+
+		if param.MaxKeys > 0 && a.scanCount >= param.MaxKeys {
+			return
+		}
+		// 速率 限制：按 已 扫描 数量 计算 应 耗时
+		expect := time.Duration(a.scanCount * int64(time.Second) / param.Rate)
+		if wait := expect - time.Since(startTime); wait > 0 {
+			if !task.SleepInterval(wait) {
+				err = errAnalyzeStop
+				return
+			}
+		}
+		next = true
+		return
+	})
+	if err == errAnalyzeStop {
+		err = nil
+	}
+	return
+}
@@ -0,0 +1,596 @@
+package module_redis
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	goRedis "github.com/go-redis/redis/v8"
+	"sort"
+	"strconv"
+	"strings"
+	"teamide/pkg/background"
+	"time"
+)
+
+const (
+	compareListMax = 1000
+
+	overwriteSkip    = "skip"
+	overwriteReplace = "replace"
+	overwriteError   = "error"
+)
+
+type CompareParam struct {
+	TargetToolboxId int64  `json:"targetToolboxId"`
+	Database        int    `json:"database"`
+	TargetDatabase  int    `json:"targetDatabase"`
+	Pattern         string `json:"pattern"`
+	ScanCount       int64  `json:"scanCount"`    // SCAN COUNT 提示
+	MaxKeys         int64  `json:"maxKeys"`      // 每个 实例 最多 比较 key 数，0 为 不限制
+	Rate            int64  `json:"rate"`         // 每秒 最多 比较 key 数
+	SkipValue       bool   `json:"skipValue"`    // 只 比较 类型 与 TTL
+	TtlTolerance    int64  `json:"ttlTolerance"` // TTL 允许 的 误差 秒
+	MaxElements     int64  `json:"maxElements"`  // 集合 元素 超过 该 数量 时 只 比较 长度
+}
+
+func (this_ *CompareParam) init() {
+	if this_.Pattern == "" {
+		this_.Pattern = "*"
+	}
+	if this_.ScanCount <= 0 {
+		this_.ScanCount = 500
+	}
+	if this_.Rate <= 0 {
+		this_.Rate = 1000
+	}
+	if this_.TtlTolerance <= 0 {
+		this_.TtlTolerance = 5
+	}
+	if this_.MaxElements <= 0 {
+		this_.MaxElements = 10000
+	}
+}
+
+type CompareKey struct {
+	Key        string `json:"key"`
+	KeyBase64  string `json:"keyBase64,omitempty"`
+	Type       string `json:"type,omitempty"`
+	TargetType string `json:"targetType,omitempty"`
+	TTL        int64  `json:"ttl"`              // 毫秒，-1 为 不过期
+	TargetTTL  int64  `json:"targetTtl"`        // 毫秒，-1 为 不过期
+	Reason     string `json:"reason,omitempty"` // type、value、ttl、length
+}
+
+type CompareResult struct {
+	SourceScan     int64         `json:"sourceScan"`
+	TargetScan     int64         `json:"targetScan"`
+	SameCount      int64         `json:"sameCount"`
+	MissingCount   int64         `json:"missingCount"`   // 源 存在，目标 不存在
+	ExtraCount     int64         `json:"extraCount"`     // 目标 存在，源 不存在
+	DifferentCount int64         `json:"differentCount"` // 类型、值 或 TTL 不同
+	Missing        []*CompareKey `json:"missing"`
+	Extra          []*CompareKey `json:"extra"`
+	Different      []*CompareKey `json:"different"`
+	Truncated      bool          `json:"truncated"` // 列表 超过 上限 时 只 保留 数量
+	Phase          string        `json:"phase"`     // source、target、end
+}
+
+func newCompareKey(key string) *CompareKey {
+	res := &CompareKey{Key: key}
+	if !isPrintable(key) {
+		res.KeyBase64 = base64.StdEncoding.EncodeToString([]byte(key))
+	}
+	return res
+}
+
+func isPrintable(str string) bool {
+	for _, r := range str {
+		if r == 0xfffd || (r < 0x20 && r != '\t') {
+			return false
+		}
+	}
+	return true
+}
+
+// Snapshot 复制 一份 结果，避免 序列化 时 与 任务 并发 读写
+func (this_ *CompareResult) Snapshot() interface{} {
+	res := *this_
+	res.Missing = append([]*CompareKey{}, this_.Missing...)
+	res.Extra = append([]*CompareKey{}, this_.Extra...)
+	res.Different = append([]*CompareKey{}, this_.Different...)
+	return &res
+}
+
+func appendCompareKey(result *CompareResult, list *[]*CompareKey, one *CompareKey) {
+	if len(*list) >= compareListMax {
+		result.Truncated = true
+		return
+	}
+	*list = append(*list, one)
+}
+
+// keyDigest 计算 值 的 摘要，集合 类型 排序 后 计算，超过 元素 上限 时 只 返回 长度
+func keyDigest(ctx context.Context, client goRedis.Cmdable, key string, keyType string, maxElements int64) (digest string, err error) {
+	h := sha1.New()
+	write := func(list ...string) {
+		for _, one := range list {
+			h.Write([]byte(strconv.Itoa(len(one))))
+			h.Write([]byte{':'})
+			h.Write([]byte(one))
+		}
+	}
+	var size int64
+	switch keyType {
+	case "string":
+		var value string
+		if value, err = client.Get(ctx, key).Result(); err != nil {
+			return
+		}
+		write(value)
+	case "list":
+		if size, err = client.LLen(ctx, key).Result(); err != nil || size > maxElements {
+			break
+		}
+		var list []string
+		if list, err = client.LRange(ctx, key, 0, -1).Result(); err != nil {
+			return
+		}
+		write(list...)
+	case "set":
+		if size, err = client.SCard(ctx, key).Result(); err != nil || size > maxElements {
+			break
+		}
+		var list []string
+		if list, err = client.SMembers(ctx, key).Result(); err != nil {
+			return
+		}
+		sort.Strings(list)
+		write(list...)
+	case "hash":
+		if size, err = client.HLen(ctx, key).Result(); err != nil || size > maxElements {
+			break
+		}
+		var data map[string]string
+		if data, err = client.HGetAll(ctx, key).Result(); err != nil {
+			return
+		}
+		var fields []string
+		for field := range data {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		for _, field := range fields {
+			write(field, data[field])
+		}
+	case "zset":
+		if size, err = client.ZCard(ctx, key).Result(); err != nil || size > maxElements {
+			break
+		}
+		var list []goRedis.Z
+		if list, err = client.ZRangeWithScores(ctx, key, 0, -1).Result(); err != nil {
+			return
+		}
+		for _, one := range list {
+			write(fmt.Sprint(one.Member), strconv.FormatFloat(one.Score, 'g', -1, 64))
+		}
+	case "stream":
+		if size, err = client.XLen(ctx, key).Result(); err != nil || size > maxElements {
+			break
+		}
+		var list []goRedis.XMessage
+		if list, err = client.XRange(ctx, key, "-", "+").Result(); err != nil {
+			return
+		}
+		for _, one := range list {
+			write(one.ID)
+			var fields []string
+			for field := range one.Values {
+				fields = append(fields, field)
+			}
+			sort.Strings(fields)
+			for _, field := range fields {
+				write(field, fmt.Sprint(one.Values[field]))
+			}
+		}
+	default:
+		// 模块 类型 使用 DUMP，去掉 末尾 的 RDB 版本 与 校验 和
+		var value string
+		if value, err = client.Dump(ctx, key).Result(); err != nil {
+			return
+		}
+		if len(value) > 10 {
+			value = value[:len(value)-10]
+		}
+		write(value)
+	}
+	if err != nil {
+		return
+	}
+	if size > maxElements {
+		digest = "length:" + strconv.FormatInt(size, 10)
+		return
+	}
+	digest = hex.EncodeToString(h.Sum(nil))
+	return
+}
+
+type keyMeta struct {
+	keyType string
+	ttl     int64
+}
+
+// loadKeyMeta 批量 获取 类型 与 TTL
+func loadKeyMeta(ctx context.Context, client goRedis.Cmdable, keys []string) (list []*keyMeta, err error) {
+	pipe := client.Pipeline()
+	var typeCmds []*goRedis.StatusCmd
+	var ttlCmds []*goRedis.DurationCmd
+	for _, key := range keys {
+		typeCmds = append(typeCmds, pipe.Type(ctx, key))
+		ttlCmds = append(ttlCmds, pipe.PTTL(ctx, key))
+	}
+	_, err = pipe.Exec(ctx)
+	if err != nil && err != goRedis.Nil {
+		return
+	}
+	err = nil
+	for i := range keys {
+		one := &keyMeta{
+			keyType: typeCmds[i].Val(),
+			ttl:     -1,
+		}
+		if ttl := ttlCmds[i].Val(); ttl > 0 {
+			one.ttl = ttl.Milliseconds()
+		}
+		list = append(list, one)
+	}
+	return
+}
+
+func ttlDifferent(ttl int64, targetTTL int64, tolerance int64) bool {
+	if ttl < 0 || targetTTL < 0 {
+		return (ttl < 0) != (targetTTL < 0)
+	}
+	diff := ttl - targetTTL
+	if diff < 0 {
+		diff = -diff
+	}
+	return diff > tolerance*1000
+}
+
+var errCompareStop = errors.New("compare stopped")
+var errCopyStop = errors.New("copy stopped")
+
+// doCompare 先 扫描 源 实例 比较 缺失 与 不同，再 扫描 目标 实例 查找 多出 的 key
+// 结果 只 在 task.Update 内 修改
+func doCompare(task *background.Task, source goRedis.Cmdable, target goRedis.Cmdable, param *CompareParam, result *CompareResult) (err error) {
+	ctx := context.Background()
+	defer func() {
+		if err == errCompareStop {
+			err = nil
+		}
+	}()
+
+	interval := func(count int) time.Duration {
+		return time.Duration(int64(count) * int64(time.Second) / param.Rate)
+	}
+
+	err = scanKeys(ctx, source, param.Pattern, param.ScanCount, func(c goRedis.Cmdable, keys []string) (next bool, err error) {
+		if task.IsStopped() {
+			err = errCompareStop
+			return
+		}
+		if param.MaxKeys > 0 && result.SourceScan+int64(len(keys)) > param.MaxKeys {
+			keys = keys[:param.MaxKeys-result.SourceScan]
+		}
+		startTime := time.Now()
+		sourceMetas, err := loadKeyMeta(ctx, c, keys)
+		if err != nil {
+			return
+		}
+		targetMetas, err := loadKeyMeta(ctx, target, keys)
+		if err != nil {
+			return
+		}
+		for i, key := range keys {
+			one := newCompareKey(key)
+			one.Type, one.TTL = sourceMetas[i].keyType, sourceMetas[i].ttl
+			one.TargetType, one.TargetTTL = targetMetas[i].keyType, targetMetas[i].ttl
+			if one.Type == "none" {
+				// 扫描 后 被 删除
+				continue
+			}
+			if one.TargetType == "none" {
+				task.Update(func() {
+					result.MissingCount++
+					appendCompareKey(result, &result.Missing, one)
+				})
+				continue
+			}
+			if one.Type != one.TargetType {
+				one.Reason = "type"
+			} else if !param.SkipValue {
+				var digest, targetDigest string
+				if digest, err = keyDigest(ctx, c, key, one.Type, param.MaxElements); err != nil {
+					return
+				}
+				if targetDigest, err = keyDigest(ctx, target, key, one.Type, param.MaxElements); err != nil {
+					return
+				}
+				if digest != targetDigest {
+					one.Reason = "value"
+					if strings.HasPrefix(digest, "length:") || strings.HasPrefix(targetDigest, "length:") {
+						one.Reason = "length"
+					}
+				}
+			}
+			if one.Reason == "" && ttlDifferent(one.TTL, one.TargetTTL, param.TtlTolerance) {
+				one.Reason = "ttl"
+			}
+			task.Update(func() {
+				if one.Reason != "" {
+					result.DifferentCount++
+					appendCompareKey(result, &result.Different, one)
+				} else {
+					result.SameCount++
+				}
+			})
+		}
+		task.Update(func() {
+			result.SourceScan += int64(len(keys))
+		})
+		if param.MaxKeys > 0 && result.SourceScan >= param.MaxKeys {
+			return
+		}
+		if !task.SleepInterval(interval(len(keys)) - time.Since(startTime)) {
+			err = errCompareStop
+			return
+		}
+		next = true
+		return
+	})
+	if err != nil {
+		return
+	}
+
+	task.Update(func() {
+		result.Phase = "target"
+	})
+	err = scanKeys(ctx, target, param.Pattern, param.ScanCount, func(c goRedis.Cmdable, keys []string) (next bool, err error) {
+		if task.IsStopped() {
+			err = errCompareStop
+			return
+		}
+		if param.MaxKeys > 0 && result.TargetScan+int64(len(keys)) > param.MaxKeys {
+			keys = keys[:param.MaxKeys-result.TargetScan]
+		}
+		startTime := time.Now()
+		sourceMetas, err := loadKeyMeta(ctx, source, keys)
+		if err != nil {
+			return
+		}
+		for i, key := range keys {
+			if sourceMetas[i].keyType != "none" {
+				continue
+			}
+			one := newCompareKey(key)
+			one.TTL = -1
+			task.Update(func() {
+				result.ExtraCount++
+				appendCompareKey(result, &result.Extra, one)
+			})
+		}
+		task.Update(func() {
+			result.TargetScan += int64(len(keys))
+		})
+		if param.MaxKeys > 0 && result.TargetScan >= param.MaxKeys {
+			return
+		}
+		if !task.SleepInterval(interval(len(keys)) - time.Since(startTime)) {
+			err = errCompareStop
+			return
+		}
+		next = true
+		return
+	})
+	if err != nil {
+		return
+	}
+	task.Update(func() {
+		result.Phase = "end"
+	})
+	return
+}
+
+type CopyParam struct {
+	TargetToolboxId int64      `json:"targetToolboxId"`
+	Database        int        `json:"database"`
+	TargetDatabase  int        `json:"targetDatabase"`
+	Keys            []*KeyInfo `json:"keys"` // 指定 key，为 空 时 按 pattern 扫描
+	Pattern         string     `json:"pattern"`
+	ScanCount       int64      `json:"scanCount"`
+	MaxKeys         int64      `json:"maxKeys"`   // 按 pattern 复制 时 最多 复制 key 数，0 为 不限制
+	Rate            int64      `json:"rate"`      // 每秒 最多 复制 key 数
+	Overwrite       string     `json:"overwrite"` // skip：跳过 已 存在，replace：覆盖，error：遇到 已 存在 时 停止
+	IgnoreTTL       bool       `json:"ignoreTtl"` // 不 复制 过期 时间
+}
+
+func (this_ *CopyParam) init() (err error) {
+	if this_.Pattern == "" {
+		this_.Pattern = "*"
+	}
+	if this_.ScanCount <= 0 {
+		this_.ScanCount = 500
+	}
+	if this_.Rate <= 0 {
+		this_.Rate = 1000
+	}
+	if this_.Overwrite == "" {
+		this_.Overwrite = overwriteSkip
+	}
+	switch this_.Overwrite {
+	case overwriteSkip, overwriteReplace, overwriteError:
+	default:
+		err = errors.New("overwrite [" + this_.Overwrite + "] not support")
+	}
+	return
+}
+
+type CopyError struct {
+	Key       string `json:"key"`
+	KeyBase64 string `json:"keyBase64,omitempty"`
+	Error     string `json:"error"`
+}
+
+type CopyResult struct {
+	Total    int64        `json:"total"`
+	Copied   int64        `json:"copied"`
+	Skipped  int64        `json:"skipped"` // 目标 已 存在 或 源 已 删除
+	Failed   int64        `json:"failed"`
+	Errors   []*CopyError `json:"errors"`
+	Conflict string       `json:"conflict,omitempty"` // overwrite 为 error 时 冲突 的 key
+}
+
+func (this_ *CopyResult) Snapshot() interface{} {
+	res := *this_
+	res.Errors = append([]*CopyError{}, this_.Errors...)
+	return &res
+}
+
+// merge 合并 一个 批次 的 结果
+func (this_ *CopyResult) merge(one *CopyResult) {
+	this_.Total += one.Total
+	this_.Copied += one.Copied
+	this_.Skipped += one.Skipped
+	this_.Failed += one.Failed
+	for _, e := range one.Errors {
+		if len(this_.Errors) < compareListMax {
+			this_.Errors = append(this_.Errors, e)
+		}
+	}
+	if one.Conflict != "" {
+		this_.Conflict = one.Conflict
+	}
+}
+
+func isBusyKeyError(err error) bool {
+	return err != nil && strings.HasPrefix(err.Error(), "BUSYKEY")
+}
+
+// copyKeys 使用 DUMP / RESTORE 复制，返回 false 表示 需要 停止
+func copyKeys(ctx context.Context, source goRedis.Cmdable, target goRedis.Cmdable, keys []string, param *CopyParam, result *CopyResult) (next bool, err error) {
+	pipe := source.Pipeline()
+	var dumpCmds []*goRedis.StringCmd
+	var ttlCmds []*goRedis.DurationCmd
+	for _, key := range keys {
+		dumpCmds = append(dumpCmds, pipe.Dump(ctx, key))
+		ttlCmds = append(ttlCmds, pipe.PTTL(ctx, key))
+	}
+	_, err = pipe.Exec(ctx)
+	if err != nil && err != goRedis.Nil {
+		return
+	}
+	err = nil
+	for i, key := range keys {
+		result.Total++
+		value, e := dumpCmds[i].Result()
+		if e == goRedis.Nil {
+			result.Skipped++
+			continue
+		}
+		if e == nil {
+			var ttl time.Duration
+			if t := ttlCmds[i].Val(); t > 0 && !param.IgnoreTTL {
+				ttl = t
+			}
+			if param.Overwrite == overwriteReplace {
+				e = target.RestoreReplace(ctx, key, ttl, value).Err()
+			} else {
+				e = target.Restore(ctx, key, ttl, value).Err()
+			}
+		}
+		if isBusyKeyError(e) {
+			if param.Overwrite == overwriteError {
+				result.Conflict = key
+				err = errors.New("key [" + key + "] already exists in target")
+				return
+			}
+			result.Skipped++
+			continue
+		}
+		if e != nil {
+			result.Failed++
+			if len(result.Errors) < compareListMax {
+				one := &CopyError{Key: key, Error: e.Error()}
+				if !isPrintable(key) {
+					one.KeyBase64 = base64.StdEncoding.EncodeToString([]byte(key))
+				}
+				result.Errors = append(result.Errors, one)
+			}
+			continue
+		}
+		result.Copied++
+	}
+	next = true
+	return
+}
+
+func doCopy(task *background.Task, source goRedis.Cmdable, target goRedis.Cmdable, keys []string, param *CopyParam, result *CopyResult) (err error) {
+	ctx := context.Background()
+	defer func() {
+		if err == errCopyStop {
+			err = nil
+		}
+	}()
+
+	batch := func(c goRedis.Cmdable, list []string) (next bool, err error) {
+		if task.IsStopped() {
+			err = errCopyStop
+			return
+		}
+		startTime := time.Now()
+		// 批次 结果 在 task.Update 内 合并
+		batchResult := &CopyResult{}
+		next, err = copyKeys(ctx, c, target, list, param, batchResult)
+		task.Update(func() {
+			result.merge(batchResult)
+		})
+		if err != nil || !next {
+			return
+		}
+		d := time.Duration(int64(len(list)) * int64(time.Second) / param.Rate)
+		if !task.SleepInterval(d - time.Since(startTime)) {
+			err = errCopyStop
+		}
+		return
+	}
+
+	// 指定 key 时 按 批次 复制
+	if len(keys) > 0 {
+		size := int(param.ScanCount)
+		for start := 0; start < len(keys); start += size {
+			end := start + size
+			if end > len(keys) {
+				end = len(keys)
+			}
+			var next bool
+			if next, err = batch(source, keys[start:end]); err != nil || !next {
+				return
+			}
+		}
+		return
+	}
+	err = scanKeys(ctx, source, param.Pattern, param.ScanCount, func(c goRedis.Cmdable, list []string) (next bool, err error) {
+		if param.MaxKeys > 0 && result.Total+int64(len(list)) > param.MaxKeys {
+			list = list[:param.MaxKeys-result.Total]
+		}
+		next, err = batch(c, list)
+		if param.MaxKeys > 0 && result.Total >= param.MaxKeys {
+			next = false
+		}
+		return
+	})
+	return
+}
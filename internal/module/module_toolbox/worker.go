@@ -96,16 +96,18 @@ func (this_ *ToolboxService) FormatOption(toolboxData *ToolboxModel, decrypt boo
 		}
 		break
 	case redisWorker_:
-		if optionMap["auth"] != nil {
-			str, ok := optionMap["auth"].(string)
-			if ok {
-				if decrypt {
-					optionMap["auth"] = this_.DecryptOptionAttr(str)
+		for _, name := range []string{"auth", "sentinelPassword"} {
+			if optionMap[name] != nil {
+				str, ok := optionMap[name].(string)
+				if ok {
+					if decrypt {
+						optionMap[name] = this_.DecryptOptionAttr(str)
+					} else {
+						optionMap[name] = this_.EncryptOptionAttr(str)
+					}
 				} else {
-					optionMap["auth"] = this_.EncryptOptionAttr(str)
+					delete(optionMap, name)
 				}
-			} else {
-				delete(optionMap, "auth")
 			}
 		}
 		break
@@ -138,16 +140,18 @@ func (this_ *ToolboxService) FormatOption(toolboxData *ToolboxModel, decrypt boo
 		}
 		break
 	case kafkaWorker_:
-		if optionMap["password"] != nil {
-			str, ok := optionMap["password"].(string)
-			if ok {
-				if decrypt {
-					optionMap["password"] = this_.DecryptOptionAttr(str)
+		for _, name := range []string{"password", "schemaRegistryPassword"} {
+			if optionMap[name] != nil {
+				str, ok := optionMap[name].(string)
+				if ok {
+					if decrypt {
+						optionMap[name] = this_.DecryptOptionAttr(str)
+					} else {
+						optionMap[name] = this_.EncryptOptionAttr(str)
+					}
 				} else {
-					optionMap["password"] = this_.EncryptOptionAttr(str)
+					delete(optionMap, name)
 				}
-			} else {
-				delete(optionMap, "password")
 			}
 		}
 		break
@@ -566,6 +570,13 @@ func databaseWorker() *ToolboxType {
 				{Label: "TLS RootCert", Name: "tlsRootCert", Type: "file", VIf: `type == 'mysql' && tlsConfig == 'custom'`},
 				{Label: "TLS Client Cert", Name: "tlsClientCert", Type: "file", VIf: `type == 'mysql' && tlsConfig == 'custom'`},
 				{Label: "TLS Client Key", Name: "tlsClientKey", Type: "file", VIf: `type == 'mysql' && tlsConfig == 'custom'`},
+				{Label: "安全级别", Name: "safetyLevel", Type: "select", DefaultValue: "unrestricted",
+					Options: []*form.Option{
+						{Text: "不限制", Value: "unrestricted"},
+						{Text: "危险操作确认（无条件修改、删除，DROP，TRUNCATE）", Value: "confirm"},
+						{Text: "只读", Value: "readonly"},
+					},
+				},
 			},
 		},
 	}
@@ -639,6 +650,10 @@ func kafkaWorker() *ToolboxType {
 				{Label: "用户名", Name: "username", Col: 12},
 				{Label: "密码", Name: "password", Col: 12, ShowPlaintextBtn: true},
 				{Label: "Cert", Name: "certPath", Type: "file", Placeholder: "请上传Cert"},
+				{Label: "Schema Registry地址（http://127.0.0.1:8081）", Name: "schemaRegistryUrl"},
+				{Label: "Schema Registry用户名", Name: "schemaRegistryUsername", Col: 12},
+				{Label: "Schema Registry密码", Name: "schemaRegistryPassword", Type: "password", Col: 12, ShowPlaintextBtn: true},
+				{Label: "Schema目录（服务端目录，文件名为[subject.]id.avsc|proto|json，未配置地址时使用）", Name: "schemaDir"},
 			},
 		},
 		OtherForm: map[string]*form.Form{
@@ -818,15 +833,33 @@ func redisWorker() *ToolboxType {
 					Rules:       []*form.Rule{},
 					Col:         12,
 				},
-				{Label: "连接地址（127.0.0.1:6379）", Name: "address", DefaultValue: "127.0.0.1:6379",
+				{
+					Label: "模式", Name: "mode", Type: "select", DefaultValue: "auto",
+					Options: []*form.Option{
+						{Text: "自动（多个地址为集群）", Value: "auto"},
+						{Text: "单机", Value: "standalone"},
+						{Text: "集群", Value: "cluster"},
+						{Text: "哨兵", Value: "sentinel"},
+					},
+					Col: 12,
+				},
+				{Label: "连接地址（127.0.0.1:6379，多个地址使用“,”隔开）", Name: "address", DefaultValue: "127.0.0.1:6379",
 					Rules: []*form.Rule{
 						{Required: true, Message: "连接地址不能为空"},
 					},
 					Col: 12,
 				},
+				{Label: "主节点名称（mymaster）", Name: "masterName", VIf: `mode == 'sentinel'`,
+					Rules: []*form.Rule{
+						{Required: true, Message: "主节点名称不能为空"},
+					},
+				},
+				{Label: "哨兵用户名", Name: "sentinelUsername", VIf: `mode == 'sentinel'`, Col: 12},
+				{Label: "哨兵密码", Name: "sentinelPassword", Type: "password", VIf: `mode == 'sentinel'`, Col: 12, ShowPlaintextBtn: true},
 				{Label: "用户名", Name: "username", Col: 12},
 				{Label: "密码", Name: "auth", Type: "password", Col: 12, ShowPlaintextBtn: true},
 				{Label: "Cert", Name: "certPath", Type: "file", Placeholder: "请上传Cert"},
+				{Label: "Proto文件目录（服务端目录，用于Protobuf值解码）", Name: "protoDir"},
 			},
 		},
 	}
@@ -0,0 +1,219 @@
+package background
+
+import (
+	"errors"
+	"fmt"
+	"github.com/team-ide/go-tool/util"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+)
+
+// Task 模块 内 的 后台 任务，页面 通过 taskStatus 轮询 状态，taskStop 停止，taskClean 清理
+type Task struct {
+	TaskId    string `json:"taskId"`
+	TaskType  string `json:"taskType"`
+	UserId    int64  `json:"userId,omitempty"` // 创建 任务 的 用户，下载 结果 等 需要 校验 时 设置
+	StartTime int64  `json:"startTime"`
+	EndTime   int64  `json:"endTime"`
+	UseTime   int64  `json:"useTime"`
+	Error     string `json:"error"`
+	IsEnd     bool   `json:"isEnd"`
+	IsStop    bool   `json:"isStop"`
+
+	Result interface{} `json:"result"`
+
+	// Keep 成功 结束 后 窗口 关闭 时 保留，直到 ClearTask，用于 结果 需要 下载 的 任务
+	Keep bool `json:"-"`
+	// OnClear ClearTask 时 调用，用于 删除 结果 文件
+	OnClear func() `json:"-"`
+
+	lock sync.Mutex
+	do   func(task *Task) (err error)
+}
+
+func NewTask(taskType string, do func(task *Task) (err error)) *Task {
+	return &Task{
+		TaskId:   util.GetUUID(),
+		TaskType: taskType,
+		do:       do,
+	}
+}
+
+func (this_ *Task) start() {
+	this_.lock.Lock()
+	this_.StartTime = util.GetNowMilli()
+	this_.lock.Unlock()
+	defer func() {
+		if e := recover(); e != nil {
+			err := errors.New(fmt.Sprint(e))
+			util.Logger.Error("background task panic error", zap.Any("taskType", this_.TaskType), zap.Any("taskId", this_.TaskId), zap.Error(err))
+			this_.setError(err)
+		}
+		this_.lock.Lock()
+		this_.EndTime = util.GetNowMilli()
+		this_.UseTime = this_.EndTime - this_.StartTime
+		this_.IsEnd = true
+		this_.lock.Unlock()
+	}()
+
+	err := this_.do(this_)
+	if err != nil {
+		util.Logger.Error("background task error", zap.Any("taskType", this_.TaskType), zap.Any("taskId", this_.TaskId), zap.Error(err))
+		this_.setError(err)
+	}
+}
+
+func (this_ *Task) setError(err error) {
+	this_.lock.Lock()
+	defer this_.lock.Unlock()
+	this_.Error = err.Error()
+}
+
+// Update 在 锁 内 修改 结果，避免 与 查询 状态 并发 读写
+func (this_ *Task) Update(fn func()) {
+	this_.lock.Lock()
+	defer this_.lock.Unlock()
+	fn()
+}
+
+func (this_ *Task) Stop() {
+	this_.lock.Lock()
+	defer this_.lock.Unlock()
+	this_.IsStop = true
+}
+
+// kept 需要 保留 且 已 成功 结束
+func (this_ *Task) kept() bool {
+	this_.lock.Lock()
+	defer this_.lock.Unlock()
+	return this_.Keep && this_.IsEnd && this_.Error == "" && !this_.IsStop
+}
+
+func (this_ *Task) IsStopped() bool {
+	this_.lock.Lock()
+	defer this_.lock.Unlock()
+	return this_.IsStop
+}
+
+// Info 复制 一份 任务 状态，结果 实现 Snapshot 时 由 Snapshot 复制
+func (this_ *Task) Info() *Task {
+	this_.lock.Lock()
+	defer this_.lock.Unlock()
+	res := &Task{
+		TaskId:    this_.TaskId,
+		TaskType:  this_.TaskType,
+		UserId:    this_.UserId,
+		StartTime: this_.StartTime,
+		EndTime:   this_.EndTime,
+		UseTime:   this_.UseTime,
+		Error:     this_.Error,
+		IsEnd:     this_.IsEnd,
+		IsStop:    this_.IsStop,
+		Result:    this_.Result,
+	}
+	if s, ok := this_.Result.(interface{ Snapshot() interface{} }); ok {
+		res.Result = s.Snapshot()
+	}
+	return res
+}
+
+// SleepInterval 按 速率 限制 等待，返回 false 表示 任务 已 停止
+func (this_ *Task) SleepInterval(d time.Duration) bool {
+	for d > 0 {
+		if this_.IsStopped() {
+			return false
+		}
+		step := d
+		if step > 200*time.Millisecond {
+			step = 200 * time.Millisecond
+		}
+		time.Sleep(step)
+		d -= step
+	}
+	return !this_.IsStopped()
+}
+
+var taskCache = map[string]*Task{}
+var taskCacheLock = &sync.Mutex{}
+
+func StartTask(task *Task) {
+	taskCacheLock.Lock()
+	taskCache[task.TaskId] = task
+	taskCacheLock.Unlock()
+
+	go task.start()
+}
+
+func GetTask(taskId string) *Task {
+	taskCacheLock.Lock()
+	defer taskCacheLock.Unlock()
+	return taskCache[taskId]
+}
+
+// GetUserTask 获取 属于 用户 且 类型 在 taskTypes 中 的 任务，不 满足 时 返回 空
+func GetUserTask(taskId string, userId int64, taskTypes ...string) *Task {
+	task := GetTask(taskId)
+	if task == nil || task.UserId != userId {
+		return nil
+	}
+	for _, taskType := range taskTypes {
+		if task.TaskType == taskType {
+			return task
+		}
+	}
+	return nil
+}
+
+func StopTask(taskId string) {
+	task := GetTask(taskId)
+	if task != nil {
+		task.Stop()
+	}
+}
+
+// ClearTask 移除 并 停止 任务
+func ClearTask(taskId string) {
+	taskCacheLock.Lock()
+	task := taskCache[taskId]
+	delete(taskCache, taskId)
+	taskCacheLock.Unlock()
+
+	if task != nil {
+		task.Stop()
+		if task.OnClear != nil {
+			task.OnClear()
+		}
+	}
+}
+
+var workerTasksCache = map[string][]string{}
+var workerTasksCacheLock = &sync.Mutex{}
+
+// AddWorkerTask 记录 工作 窗口 的 任务，窗口 关闭 时 清理
+func AddWorkerTask(workerId string, taskId string) {
+	if workerId == "" {
+		return
+	}
+	workerTasksCacheLock.Lock()
+	defer workerTasksCacheLock.Unlock()
+	taskIds := workerTasksCache[workerId]
+	if util.StringIndexOf(taskIds, taskId) < 0 {
+		taskIds = append(taskIds, taskId)
+		workerTasksCache[workerId] = taskIds
+	}
+}
+
+// RemoveWorkerTasks 清理 工作 窗口 的 任务，Keep 的 任务 成功 结束 后 保留
+func RemoveWorkerTasks(workerId string) {
+	workerTasksCacheLock.Lock()
+	defer workerTasksCacheLock.Unlock()
+	taskIds := workerTasksCache[workerId]
+	for _, taskId := range taskIds {
+		if task := GetTask(taskId); task != nil && task.kept() {
+			continue
+		}
+		ClearTask(taskId)
+	}
+	delete(workerTasksCache, workerId)
+}
@@ -0,0 +1,139 @@
+package background
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+type testResult struct {
+	Count int
+}
+
+func (this_ *testResult) Snapshot() interface{} {
+	res := *this_
+	return &res
+}
+
+func waitEnd(t *testing.T, task *Task) *Task {
+	for i := 0; i < 100; i++ {
+		if info := task.Info(); info.IsEnd {
+			return info
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("task %s not end", task.TaskId)
+	return nil
+}
+
+func TestTask(t *testing.T) {
+	result := &testResult{}
+	task := NewTask("test", func(task *Task) (err error) {
+		task.Update(func() { result.Count++ })
+		return errors.New("fail")
+	})
+	task.Result = result
+	StartTask(task)
+	AddWorkerTask("worker", task.TaskId)
+
+	info := waitEnd(t, task)
+	if info.Error != "fail" {
+		t.Errorf("error = %q, want fail", info.Error)
+	}
+	// Info 返回 副本，修改 不 影响 任务 结果
+	snapshot := info.Result.(*testResult)
+	if snapshot == result || snapshot.Count != 1 {
+		t.Errorf("result = %+v, want a copy with count 1", snapshot)
+	}
+	if GetTask(task.TaskId) != task {
+		t.Errorf("task %s not cached", task.TaskId)
+	}
+
+	RemoveWorkerTasks("worker")
+	if GetTask(task.TaskId) != nil {
+		t.Errorf("task %s not removed with worker", task.TaskId)
+	}
+	if !task.IsStopped() {
+		t.Errorf("removed task not stopped")
+	}
+}
+
+func TestGetUserTask(t *testing.T) {
+	task := NewTask("test", func(task *Task) (err error) {
+		return
+	})
+	task.UserId = 1
+	StartTask(task)
+	defer ClearTask(task.TaskId)
+
+	if GetUserTask(task.TaskId, 1, "other", "test") != task {
+		t.Errorf("task %s not found for owner", task.TaskId)
+	}
+	if GetUserTask(task.TaskId, 2, "test") != nil {
+		t.Errorf("task %s found for other user", task.TaskId)
+	}
+	if GetUserTask(task.TaskId, 1, "other") != nil {
+		t.Errorf("task %s found for other task type", task.TaskId)
+	}
+}
+
+func TestTaskStop(t *testing.T) {
+	task := NewTask("test", func(task *Task) (err error) {
+		if task.SleepInterval(10 * time.Second) {
+			err = errors.New("sleep not interrupted")
+		}
+		return
+	})
+	StartTask(task)
+	StopTask(task.TaskId)
+
+	info := waitEnd(t, task)
+	if info.Error != "" || !info.IsStop {
+		t.Errorf("info = %+v, want stopped without error", info)
+	}
+	ClearTask(task.TaskId)
+}
+
+func TestTaskKeep(t *testing.T) {
+	var cleared int
+	newTask := func(fail bool) *Task {
+		task := NewTask("test", func(task *Task) (err error) {
+			if fail {
+				err = errors.New("fail")
+			}
+			return
+		})
+		task.Keep = true
+		task.OnClear = func() { cleared++ }
+		StartTask(task)
+		AddWorkerTask("keep", task.TaskId)
+		waitEnd(t, task)
+		return task
+	}
+	kept := newTask(false)
+	failed := newTask(true)
+
+	RemoveWorkerTasks("keep")
+	if GetTask(kept.TaskId) != kept {
+		t.Errorf("finished task %s not kept", kept.TaskId)
+	}
+	if GetTask(failed.TaskId) != nil {
+		t.Errorf("failed task %s kept", failed.TaskId)
+	}
+	ClearTask(kept.TaskId)
+	if cleared != 2 {
+		t.Errorf("cleared = %d, want 2", cleared)
+	}
+}
+
+func TestTaskPanic(t *testing.T) {
+	task := NewTask("test", func(task *Task) (err error) {
+		panic("boom")
+	})
+	StartTask(task)
+	defer ClearTask(task.TaskId)
+
+	if info := waitEnd(t, task); info.Error != "boom" {
+		t.Errorf("error = %q, want boom", info.Error)
+	}
+}
@@ -0,0 +1,743 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// AvroSchema 解析 后 的 Avro 类型，命名 类型 解析 后 共用 同一 个 对象，支持 递归 引用
+type AvroSchema struct {
+	Type     string // null、boolean、int、long、float、double、bytes、string、record、enum、array、map、union、fixed
+	Name     string // 命名 类型 的 全名
+	Fields   []*AvroField
+	Symbols  []string
+	Items    *AvroSchema
+	Values   *AvroSchema
+	Branches []*AvroSchema
+	Size     int
+	// LogicalType 目前 只 处理 bytes、fixed 上 的 decimal，其它 logicalType 按 原 类型 编解码
+	LogicalType string
+	Precision   int
+	Scale       int
+}
+
+type AvroField struct {
+	Name       string
+	Type       *AvroSchema
+	Default    interface{}
+	HasDefault bool
+}
+
+var avroPrimitives = map[string]bool{
+	"null": true, "boolean": true, "int": true, "long": true,
+	"float": true, "double": true, "bytes": true, "string": true,
+}
+
+const avroMaxDepth = 64
+
+type avroParser struct {
+	named map[string]*AvroSchema
+}
+
+// ParseAvroSchema 解析 Avro schema 文本
+func ParseAvroSchema(text string) (schema *AvroSchema, err error) {
+	var data interface{}
+	decoder := json.NewDecoder(strings.NewReader(text))
+	decoder.UseNumber()
+	if err = decoder.Decode(&data); err != nil {
+		err = errors.New("avro schema parse error:" + err.Error())
+		return
+	}
+	parser := &avroParser{named: map[string]*AvroSchema{}}
+	schema, err = parser.parse(data, "")
+	return
+}
+
+// avroFullName 名称 含 “.” 时 即为 全名，否则 拼接 命名 空间
+func avroFullName(name string, namespace string) string {
+	if strings.Contains(name, ".") || namespace == "" {
+		return name
+	}
+	return namespace + "." + name
+}
+
+func avroNamespace(fullName string) string {
+	if index := strings.LastIndex(fullName, "."); index >= 0 {
+		return fullName[:index]
+	}
+	return ""
+}
+
+func (this_ *avroParser) parse(data interface{}, namespace string) (schema *AvroSchema, err error) {
+	switch v := data.(type) {
+	case string:
+		if avroPrimitives[v] {
+			schema = &AvroSchema{Type: v}
+			return
+		}
+		if schema = this_.named[avroFullName(v, namespace)]; schema != nil {
+			return
+		}
+		if schema = this_.named[v]; schema != nil {
+			return
+		}
+		err = errors.New("avro type [" + v + "] not found")
+		return
+	case []interface{}:
+		schema = &AvroSchema{Type: "union"}
+		for _, one := range v {
+			var branch *AvroSchema
+			if branch, err = this_.parse(one, namespace); err != nil {
+				return
+			}
+			schema.Branches = append(schema.Branches, branch)
+		}
+		return
+	case map[string]interface{}:
+		return this_.parseComplex(v, namespace)
+	}
+	err = errors.New(fmt.Sprintf("avro schema [%v] not support", data))
+	return
+}
+
+func (this_ *avroParser) parseComplex(data map[string]interface{}, namespace string) (schema *AvroSchema, err error) {
+	typeName, ok := data["type"].(string)
+	if !ok {
+		// {"type": {"type": "array", ...}}
+		return this_.parse(data["type"], namespace)
+	}
+	switch typeName {
+	case "record", "error", "enum", "fixed":
+		name, _ := data["name"].(string)
+		if name == "" {
+			err = errors.New("avro " + typeName + " name is empty")
+			return
+		}
+		if ns, _ := data["namespace"].(string); ns != "" && !strings.Contains(name, ".") {
+			namespace = ns
+		}
+		schema = &AvroSchema{Type: typeName, Name: avroFullName(name, namespace)}
+		if schema.Type == "error" {
+			schema.Type = "record"
+		}
+		// 先 注册 名称，字段 中 可以 引用 自身
+		this_.named[schema.Name] = schema
+		namespace = avroNamespace(schema.Name)
+	}
+	switch typeName {
+	case "record", "error":
+		fields, _ := data["fields"].([]interface{})
+		for _, one := range fields {
+			fieldData, _ := one.(map[string]interface{})
+			if fieldData == nil {
+				err = errors.New("avro record [" + schema.Name + "] field error")
+				return
+			}
+			field := &AvroField{}
+			field.Name, _ = fieldData["name"].(string)
+			if field.Type, err = this_.parse(fieldData["type"], namespace); err != nil {
+				return
+			}
+			field.Default, field.HasDefault = fieldData["default"]
+			schema.Fields = append(schema.Fields, field)
+		}
+	case "enum":
+		symbols, _ := data["symbols"].([]interface{})
+		for _, one := range symbols {
+			symbol, _ := one.(string)
+			schema.Symbols = append(schema.Symbols, symbol)
+		}
+	case "fixed":
+		size, _ := data["size"].(json.Number)
+		var n int64
+		if n, err = size.Int64(); err != nil || n < 0 {
+			err = errors.New("avro fixed [" + schema.Name + "] size error")
+			return
+		}
+		schema.Size = int(n)
+		schema.setLogicalType(data)
+	case "array":
+		schema = &AvroSchema{Type: typeName}
+		schema.Items, err = this_.parse(data["items"], namespace)
+	case "map":
+		schema = &AvroSchema{Type: typeName}
+		schema.Values, err = this_.parse(data["values"], namespace)
+	default:
+		// 带 logicalType 的 基础 类型 或 命名 类型 引用，命名 类型 共用 对象，不 设置 logicalType
+		if schema, err = this_.parse(typeName, namespace); err == nil && avroPrimitives[typeName] {
+			schema.setLogicalType(data)
+		}
+	}
+	return
+}
+
+// setLogicalType 无效 的 logicalType 按 规范 忽略，使用 原 类型
+func (this_ *AvroSchema) setLogicalType(data map[string]interface{}) {
+	logicalType, _ := data["logicalType"].(string)
+	if logicalType != "decimal" || (this_.Type != "bytes" && this_.Type != "fixed") {
+		return
+	}
+	precision, e := avroInt(data["precision"])
+	if e != nil || precision <= 0 {
+		return
+	}
+	var scale int64
+	if data["scale"] != nil {
+		if scale, e = avroInt(data["scale"]); e != nil {
+			return
+		}
+	}
+	if scale < 0 || scale > precision {
+		return
+	}
+	this_.LogicalType = logicalType
+	this_.Precision = int(precision)
+	this_.Scale = int(scale)
+}
+
+func avroInt(data interface{}) (n int64, err error) {
+	number, ok := data.(json.Number)
+	if !ok {
+		err = errors.New(fmt.Sprintf("avro number [%v] error", data))
+		return
+	}
+	return number.Int64()
+}
+
+// branchName 联合 类型 中 按 {"类型": 值} 指定 分支 时 使用 的 名称
+func (this_ *AvroSchema) branchName() string {
+	if this_.Name != "" {
+		return this_.Name
+	}
+	return this_.Type
+}
+
+type avroReader struct {
+	buf []byte
+	pos int
+}
+
+var errAvroShort = errors.New("avro data is too short")
+
+func (this_ *avroReader) readLong() (v int64, err error) {
+	u, n := binary.Uvarint(this_.buf[this_.pos:])
+	if n <= 0 {
+		err = errAvroShort
+		return
+	}
+	this_.pos += n
+	v = int64(u>>1) ^ -int64(u&1)
+	return
+}
+
+func (this_ *avroReader) readBytes() (bs []byte, err error) {
+	size, err := this_.readLong()
+	if err != nil {
+		return
+	}
+	return this_.readFixed(size)
+}
+
+func (this_ *avroReader) readFixed(size int64) (bs []byte, err error) {
+	if size < 0 || int64(len(this_.buf)-this_.pos) < size {
+		err = errAvroShort
+		return
+	}
+	bs = this_.buf[this_.pos : this_.pos+int(size)]
+	this_.pos += int(size)
+	return
+}
+
+// AvroToJSON 按 schema 将 二进制 解码 为 JSON，字段 保持 schema 顺序，联合 类型 直接 输出 值
+func AvroToJSON(schema *AvroSchema, value []byte) (res []byte, err error) {
+	reader := &avroReader{buf: value}
+	var buf bytes.Buffer
+	if err = avroDecode(schema, reader, &buf, 0); err != nil {
+		return
+	}
+	if reader.pos != len(value) {
+		err = errors.New(fmt.Sprintf("avro data has %d bytes left", len(value)-reader.pos))
+		return
+	}
+	res = buf.Bytes()
+	return
+}
+
+func writeJSONString(buf *bytes.Buffer, str string) {
+	bs, _ := json.Marshal(str)
+	buf.Write(bs)
+}
+
+// avroBytesString bytes 与 fixed 按 Avro JSON 规范 输出，每个 字节 对应 一个 字符
+func avroBytesString(bs []byte) string {
+	runes := make([]rune, len(bs))
+	for i, b := range bs {
+		runes[i] = rune(b)
+	}
+	return string(runes)
+}
+
+// avroDecimalString 大端 补码 的 非 缩放 值 按 scale 输出 十进制 字符串，避免 转 浮点 丢失 精度
+func avroDecimalString(bs []byte, scale int) string {
+	n := new(big.Int).SetBytes(bs)
+	if len(bs) > 0 && bs[0]&0x80 != 0 {
+		n.Sub(n, new(big.Int).Lsh(big.NewInt(1), uint(len(bs)*8)))
+	}
+	digits := new(big.Int).Abs(n).String()
+	if scale > 0 {
+		if len(digits) <= scale {
+			digits = strings.Repeat("0", scale-len(digits)+1) + digits
+		}
+		digits = digits[:len(digits)-scale] + "." + digits[len(digits)-scale:]
+	}
+	if n.Sign() < 0 {
+		digits = "-" + digits
+	}
+	return digits
+}
+
+// avroDecimalBytes 数字 或 数字 字符串 按 scale 转为 大端 补码，fixed 按 Size 符号 扩展
+func avroDecimalBytes(schema *AvroSchema, data interface{}, path string) (bs []byte, err error) {
+	var str string
+	switch v := data.(type) {
+	case json.Number:
+		str = v.String()
+	case string:
+		str = v
+	default:
+		err = avroTypeError(schema, data, path)
+		return
+	}
+	r, ok := new(big.Rat).SetString(strings.TrimSpace(str))
+	if !ok {
+		err = avroTypeError(schema, data, path)
+		return
+	}
+	r.Mul(r, new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(schema.Scale)), nil)))
+	if !r.IsInt() {
+		err = errors.New(fmt.Sprintf("avro value [%s] has more than %d decimal places: %v", path, schema.Scale, data))
+		return
+	}
+	n := r.Num()
+	if len(new(big.Int).Abs(n).String()) > schema.Precision {
+		err = errors.New(fmt.Sprintf("avro value [%s] exceeds precision %d: %v", path, schema.Precision, data))
+		return
+	}
+	// 补码 需要 的 位数：非负数 为 n 的 位数 加 符号位，负数 为 -n-1 的 位数 加 符号位
+	magnitude := n
+	if n.Sign() < 0 {
+		magnitude = new(big.Int).Not(n)
+	}
+	size := (magnitude.BitLen() + 8) / 8
+	if schema.Type == "fixed" {
+		if size > schema.Size {
+			err = errors.New(fmt.Sprintf("avro value [%s] does not fit in fixed %d: %v", path, schema.Size, data))
+			return
+		}
+		size = schema.Size
+	}
+	if n.Sign() < 0 {
+		n = new(big.Int).Add(n, new(big.Int).Lsh(big.NewInt(1), uint(size*8)))
+	}
+	bs = n.FillBytes(make([]byte, size))
+	return
+}
+
+func writeJSONFloat(buf *bytes.Buffer, f float64, bitSize int) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		writeJSONString(buf, strconv.FormatFloat(f, 'g', -1, bitSize))
+		return
+	}
+	buf.WriteString(strconv.FormatFloat(f, 'g', -1, bitSize))
+}
+
+func avroDecode(schema *AvroSchema, reader *avroReader, buf *bytes.Buffer, depth int) (err error) {
+	if depth > avroMaxDepth {
+		return errors.New("avro data is too deep")
+	}
+	switch schema.Type {
+	case "null":
+		buf.WriteString("null")
+	case "boolean":
+		var bs []byte
+		if bs, err = reader.readFixed(1); err != nil {
+			return
+		}
+		buf.WriteString(strconv.FormatBool(bs[0] != 0))
+	case "int", "long":
+		var v int64
+		if v, err = reader.readLong(); err != nil {
+			return
+		}
+		buf.WriteString(strconv.FormatInt(v, 10))
+	case "float":
+		var bs []byte
+		if bs, err = reader.readFixed(4); err != nil {
+			return
+		}
+		writeJSONFloat(buf, float64(math.Float32frombits(binary.LittleEndian.Uint32(bs))), 32)
+	case "double":
+		var bs []byte
+		if bs, err = reader.readFixed(8); err != nil {
+			return
+		}
+		writeJSONFloat(buf, math.Float64frombits(binary.LittleEndian.Uint64(bs)), 64)
+	case "string":
+		var bs []byte
+		if bs, err = reader.readBytes(); err != nil {
+			return
+		}
+		writeJSONString(buf, string(bs))
+	case "bytes", "fixed":
+		var bs []byte
+		if schema.Type == "fixed" {
+			bs, err = reader.readFixed(int64(schema.Size))
+		} else {
+			bs, err = reader.readBytes()
+		}
+		if err != nil {
+			return
+		}
+		if schema.LogicalType == "decimal" {
+			// 输出 字符串，页面 解析 JSON 数字 时 会 丢失 精度
+			writeJSONString(buf, avroDecimalString(bs, schema.Scale))
+		} else {
+			writeJSONString(buf, avroBytesString(bs))
+		}
+	case "enum":
+		var index int64
+		if index, err = reader.readLong(); err != nil {
+			return
+		}
+		if index < 0 || index >= int64(len(schema.Symbols)) {
+			return errors.New(fmt.Sprintf("avro enum [%s] index [%d] out of range", schema.Name, index))
+		}
+		writeJSONString(buf, schema.Symbols[index])
+	case "union":
+		var index int64
+		if index, err = reader.readLong(); err != nil {
+			return
+		}
+		if index < 0 || index >= int64(len(schema.Branches)) {
+			return errors.New(fmt.Sprintf("avro union index [%d] out of range", index))
+		}
+		return avroDecode(schema.Branches[index], reader, buf, depth+1)
+	case "record":
+		buf.WriteByte('{')
+		for i, field := range schema.Fields {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeJSONString(buf, field.Name)
+			buf.WriteByte(':')
+			if err = avroDecode(field.Type, reader, buf, depth+1); err != nil {
+				return
+			}
+		}
+		buf.WriteByte('}')
+	case "array", "map":
+		if schema.Type == "array" {
+			buf.WriteByte('[')
+		} else {
+			buf.WriteByte('{')
+		}
+		var count int
+		for {
+			var size int64
+			if size, err = reader.readLong(); err != nil {
+				return
+			}
+			if size == 0 {
+				break
+			}
+			// 负数 表示 后面 跟 一个 块 字节 数
+			if size < 0 {
+				size = -size
+				if _, err = reader.readLong(); err != nil {
+					return
+				}
+			}
+			for i := int64(0); i < size; i++ {
+				if count > 0 {
+					buf.WriteByte(',')
+				}
+				count++
+				if schema.Type == "map" {
+					var key []byte
+					if key, err = reader.readBytes(); err != nil {
+						return
+					}
+					writeJSONString(buf, string(key))
+					buf.WriteByte(':')
+					err = avroDecode(schema.Values, reader, buf, depth+1)
+				} else {
+					err = avroDecode(schema.Items, reader, buf, depth+1)
+				}
+				if err != nil {
+					return
+				}
+			}
+		}
+		if schema.Type == "array" {
+			buf.WriteByte(']')
+		} else {
+			buf.WriteByte('}')
+		}
+	default:
+		return errors.New("avro type [" + schema.Type + "] not support")
+	}
+	return
+}
+
+// JSONToAvro 按 schema 将 JSON 编码 为 二进制，联合 类型 支持 直接 写 值 或 {"类型": 值}
+func JSONToAvro(schema *AvroSchema, value []byte) (res []byte, err error) {
+	var data interface{}
+	decoder := json.NewDecoder(bytes.NewReader(value))
+	decoder.UseNumber()
+	if err = decoder.Decode(&data); err != nil {
+		return
+	}
+	var buf bytes.Buffer
+	if err = avroEncode(schema, data, &buf, "$", 0); err != nil {
+		return
+	}
+	res = buf.Bytes()
+	return
+}
+
+func writeAvroLong(buf *bytes.Buffer, v int64) {
+	var bs [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(bs[:], uint64((v<<1)^(v>>63)))
+	buf.Write(bs[:n])
+}
+
+func avroTypeError(schema *AvroSchema, data interface{}, path string) error {
+	return errors.New(fmt.Sprintf("avro value [%s] is not %s: %v", path, schema.branchName(), data))
+}
+
+func avroNumber(data interface{}) (number json.Number, ok bool) {
+	number, ok = data.(json.Number)
+	return
+}
+
+func avroBytes(str string) (bs []byte, ok bool) {
+	for _, r := range str {
+		if r > 0xff {
+			return
+		}
+		bs = append(bs, byte(r))
+	}
+	ok = true
+	return
+}
+
+func avroEncode(schema *AvroSchema, data interface{}, buf *bytes.Buffer, path string, depth int) (err error) {
+	if depth > avroMaxDepth {
+		return errors.New("avro data is too deep")
+	}
+	switch schema.Type {
+	case "null":
+		if data != nil {
+			return avroTypeError(schema, data, path)
+		}
+	case "boolean":
+		v, ok := data.(bool)
+		if !ok {
+			return avroTypeError(schema, data, path)
+		}
+		if v {
+			buf.WriteByte(1)
+		} else {
+			buf.WriteByte(0)
+		}
+	case "int", "long":
+		number, ok := avroNumber(data)
+		if !ok {
+			return avroTypeError(schema, data, path)
+		}
+		v, e := number.Int64()
+		if e != nil || (schema.Type == "int" && (v > math.MaxInt32 || v < math.MinInt32)) {
+			return avroTypeError(schema, data, path)
+		}
+		writeAvroLong(buf, v)
+	case "float", "double":
+		var f float64
+		if number, ok := avroNumber(data); ok {
+			if f, err = number.Float64(); err != nil {
+				return avroTypeError(schema, data, path)
+			}
+		} else if str, ok := data.(string); ok && (str == "NaN" || str == "+Inf" || str == "-Inf") {
+			f, _ = strconv.ParseFloat(str, 64)
+		} else {
+			return avroTypeError(schema, data, path)
+		}
+		if schema.Type == "float" {
+			var bs [4]byte
+			binary.LittleEndian.PutUint32(bs[:], math.Float32bits(float32(f)))
+			buf.Write(bs[:])
+		} else {
+			var bs [8]byte
+			binary.LittleEndian.PutUint64(bs[:], math.Float64bits(f))
+			buf.Write(bs[:])
+		}
+	case "string":
+		str, ok := data.(string)
+		if !ok {
+			return avroTypeError(schema, data, path)
+		}
+		writeAvroLong(buf, int64(len(str)))
+		buf.WriteString(str)
+	case "bytes", "fixed":
+		var bs []byte
+		if schema.LogicalType == "decimal" {
+			if bs, err = avroDecimalBytes(schema, data, path); err != nil {
+				return
+			}
+		} else {
+			str, ok := data.(string)
+			if !ok {
+				return avroTypeError(schema, data, path)
+			}
+			if bs, ok = avroBytes(str); !ok {
+				return errors.New("avro value [" + path + "] has char out of byte range")
+			}
+		}
+		if schema.Type == "fixed" {
+			if len(bs) != schema.Size {
+				return errors.New(fmt.Sprintf("avro value [%s] size must be %d", path, schema.Size))
+			}
+		} else {
+			writeAvroLong(buf, int64(len(bs)))
+		}
+		buf.Write(bs)
+	case "enum":
+		str, ok := data.(string)
+		if !ok {
+			return avroTypeError(schema, data, path)
+		}
+		for index, symbol := range schema.Symbols {
+			if symbol == str {
+				writeAvroLong(buf, int64(index))
+				return
+			}
+		}
+		return errors.New("avro value [" + path + "] symbol [" + str + "] not in enum " + schema.Name)
+	case "union":
+		return avroEncodeUnion(schema, data, buf, path, depth)
+	case "record":
+		m, ok := data.(map[string]interface{})
+		if !ok {
+			return avroTypeError(schema, data, path)
+		}
+		for _, field := range schema.Fields {
+			value, find := m[field.Name]
+			if !find {
+				if field.HasDefault {
+					value = field.Default
+				} else if !avroNullable(field.Type) {
+					return errors.New("avro value [" + path + "." + field.Name + "] is required")
+				}
+			}
+			if err = avroEncode(field.Type, value, buf, path+"."+field.Name, depth+1); err != nil {
+				return
+			}
+		}
+	case "array":
+		list, ok := data.([]interface{})
+		if !ok {
+			return avroTypeError(schema, data, path)
+		}
+		if len(list) > 0 {
+			writeAvroLong(buf, int64(len(list)))
+			for i, one := range list {
+				if err = avroEncode(schema.Items, one, buf, fmt.Sprintf("%s[%d]", path, i), depth+1); err != nil {
+					return
+				}
+			}
+		}
+		writeAvroLong(buf, 0)
+	case "map":
+		m, ok := data.(map[string]interface{})
+		if !ok {
+			return avroTypeError(schema, data, path)
+		}
+		if len(m) > 0 {
+			var keys []string
+			for key := range m {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			writeAvroLong(buf, int64(len(keys)))
+			for _, key := range keys {
+				writeAvroLong(buf, int64(len(key)))
+				buf.WriteString(key)
+				if err = avroEncode(schema.Values, m[key], buf, path+"."+key, depth+1); err != nil {
+					return
+				}
+			}
+		}
+		writeAvroLong(buf, 0)
+	default:
+		return errors.New("avro type [" + schema.Type + "] not support")
+	}
+	return
+}
+
+func avroNullable(schema *AvroSchema) bool {
+	if schema.Type == "null" {
+		return true
+	}
+	for _, branch := range schema.Branches {
+		if branch.Type == "null" {
+			return true
+		}
+	}
+	return false
+}
+
+// avroEncodeUnion 优先 按 {"类型": 值} 匹配，否则 使用 第一 个 能 编码 的 分支
+func avroEncodeUnion(schema *AvroSchema, data interface{}, buf *bytes.Buffer, path string, depth int) (err error) {
+	if m, ok := data.(map[string]interface{}); ok && len(m) == 1 {
+		for key, value := range m {
+			for index, branch := range schema.Branches {
+				if branch.branchName() != key && avroShortName(branch.Name) != key {
+					continue
+				}
+				var one bytes.Buffer
+				if avroEncode(branch, value, &one, path, depth+1) == nil {
+					writeAvroLong(buf, int64(index))
+					buf.Write(one.Bytes())
+					return
+				}
+			}
+		}
+	}
+	for index, branch := range schema.Branches {
+		var one bytes.Buffer
+		if avroEncode(branch, data, &one, path, depth+1) == nil {
+			writeAvroLong(buf, int64(index))
+			buf.Write(one.Bytes())
+			return
+		}
+	}
+	var names []string
+	for _, branch := range schema.Branches {
+		names = append(names, branch.branchName())
+	}
+	return errors.New(fmt.Sprintf("avro value [%s] not match union %v: %v", path, names, data))
+}
+
+func avroShortName(name string) string {
+	if index := strings.LastIndex(name, "."); index >= 0 {
+		return name[index+1:]
+	}
+	return name
+}
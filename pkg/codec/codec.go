@@ -0,0 +1,262 @@
+package codec
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/golang/snappy"
+	"github.com/ugorji/go/codec"
+	"io"
+	"reflect"
+	"strings"
+	"unicode/utf8"
+)
+
+// Option 编解码 参数
+type Option struct {
+	MessageType string `json:"messageType,omitempty"` // protobuf 消息 类型，如 package.Message
+	ProtoDir    string `json:"protoDir,omitempty"`    // protobuf .proto 文件 目录
+}
+
+// Codec 值 编解码，Decode 将 存储 的 值 转为 可 阅读 的 内容，Encode 反之
+type Codec interface {
+	Decode(value []byte, option *Option) (res []byte, err error)
+	Encode(value []byte, option *Option) (res []byte, err error)
+}
+
+type Info struct {
+	Name            string `json:"name"`
+	Text            string `json:"text"`
+	CanEncode       bool   `json:"canEncode"`
+	NeedMessageType bool   `json:"needMessageType,omitempty"`
+}
+
+var (
+	codecCache = map[string]Codec{}
+	infoList   []*Info
+
+	errNotSupportEncode = errors.New("codec not support encode")
+)
+
+// Register 注册 编解码，后 注册 的 同名 编解码 覆盖 之前 的
+func Register(info *Info, c Codec) {
+	if _, ok := codecCache[info.Name]; !ok {
+		infoList = append(infoList, info)
+	}
+	codecCache[info.Name] = c
+}
+
+func init() {
+	Register(&Info{Name: "gzip", Text: "Gzip", CanEncode: true}, &gzipCodec{})
+	Register(&Info{Name: "snappy", Text: "Snappy", CanEncode: true}, &snappyCodec{})
+	Register(&Info{Name: "msgpack", Text: "MessagePack", CanEncode: true}, &msgpackCodec{})
+	Register(&Info{Name: "hex", Text: "Hex", CanEncode: true}, &hexCodec{})
+	Register(&Info{Name: "base64", Text: "Base64", CanEncode: true}, &base64Codec{})
+	Register(&Info{Name: "protobuf", Text: "Protobuf", CanEncode: true, NeedMessageType: true}, &protobufCodec{})
+	Register(&Info{Name: "java", Text: "Java序列化"}, &javaCodec{})
+}
+
+// GetInfoList 获取 所有 编解码
+func GetInfoList() []*Info {
+	return infoList
+}
+
+// parseChain 多个 编解码 使用 “,” 隔开，如 gzip,protobuf 表示 先 解压 再 按 protobuf 解码
+func parseChain(name string) (list []Codec, err error) {
+	for _, one := range strings.Split(name, ",") {
+		one = strings.TrimSpace(one)
+		if one == "" {
+			continue
+		}
+		c, ok := codecCache[one]
+		if !ok {
+			err = errors.New("codec [" + one + "] not found")
+			return
+		}
+		list = append(list, c)
+	}
+	if len(list) == 0 {
+		err = errors.New("codec is empty")
+		return
+	}
+	return
+}
+
+// Check 校验 编解码 是否 存在
+func Check(name string) (err error) {
+	_, err = parseChain(name)
+	return
+}
+
+// Decode 按 顺序 依次 解码，结果 必须 为 文本
+func Decode(name string, value []byte, option *Option) (res string, err error) {
+	list, err := parseChain(name)
+	if err != nil {
+		return
+	}
+	if option == nil {
+		option = &Option{}
+	}
+	for _, c := range list {
+		value, err = c.Decode(value, option)
+		if err != nil {
+			return
+		}
+	}
+	if !utf8.Valid(value) {
+		err = errors.New("decode result is not text, append hex or base64 to view")
+		return
+	}
+	res = string(value)
+	return
+}
+
+// Encode 按 相反 顺序 依次 编码
+func Encode(name string, value string, option *Option) (res []byte, err error) {
+	list, err := parseChain(name)
+	if err != nil {
+		return
+	}
+	if option == nil {
+		option = &Option{}
+	}
+	res = []byte(value)
+	for i := len(list) - 1; i >= 0; i-- {
+		res, err = list[i].Encode(res, option)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+type gzipCodec struct {
+}
+
+func (this_ *gzipCodec) Decode(value []byte, option *Option) (res []byte, err error) {
+	reader, err := gzip.NewReader(bytes.NewReader(value))
+	if err != nil {
+		return
+	}
+	defer func() { _ = reader.Close() }()
+	res, err = io.ReadAll(reader)
+	return
+}
+
+func (this_ *gzipCodec) Encode(value []byte, option *Option) (res []byte, err error) {
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	if _, err = writer.Write(value); err != nil {
+		return
+	}
+	if err = writer.Close(); err != nil {
+		return
+	}
+	res = buf.Bytes()
+	return
+}
+
+// snappyStreamHeader snappy 流 格式 的 开头
+var snappyStreamHeader = []byte("\xff\x06\x00\x00sNaPpY")
+
+type snappyCodec struct {
+}
+
+func (this_ *snappyCodec) Decode(value []byte, option *Option) (res []byte, err error) {
+	if bytes.HasPrefix(value, snappyStreamHeader) {
+		res, err = io.ReadAll(snappy.NewReader(bytes.NewReader(value)))
+		return
+	}
+	res, err = snappy.Decode(nil, value)
+	return
+}
+
+func (this_ *snappyCodec) Encode(value []byte, option *Option) (res []byte, err error) {
+	res = snappy.Encode(nil, value)
+	return
+}
+
+type hexCodec struct {
+}
+
+func (this_ *hexCodec) Decode(value []byte, option *Option) (res []byte, err error) {
+	res = []byte(hex.EncodeToString(value))
+	return
+}
+
+func (this_ *hexCodec) Encode(value []byte, option *Option) (res []byte, err error) {
+	text := strings.Join(strings.Fields(string(value)), "")
+	res, err = hex.DecodeString(text)
+	return
+}
+
+type base64Codec struct {
+}
+
+func (this_ *base64Codec) Decode(value []byte, option *Option) (res []byte, err error) {
+	res = []byte(base64.StdEncoding.EncodeToString(value))
+	return
+}
+
+func (this_ *base64Codec) Encode(value []byte, option *Option) (res []byte, err error) {
+	res, err = base64.StdEncoding.DecodeString(strings.TrimSpace(string(value)))
+	return
+}
+
+type msgpackCodec struct {
+}
+
+func newMsgpackHandle() *codec.MsgpackHandle {
+	h := &codec.MsgpackHandle{}
+	h.RawToString = true
+	h.WriteExt = true
+	h.MapType = reflect.TypeOf(map[string]interface{}(nil))
+	return h
+}
+
+// Decode 转为 JSON
+func (this_ *msgpackCodec) Decode(value []byte, option *Option) (res []byte, err error) {
+	var data interface{}
+	err = codec.NewDecoderBytes(value, newMsgpackHandle()).Decode(&data)
+	if err != nil {
+		return
+	}
+	res, err = json.Marshal(data)
+	return
+}
+
+// Encode 从 JSON 编码，数字 尽量 保持 整数
+func (this_ *msgpackCodec) Encode(value []byte, option *Option) (res []byte, err error) {
+	var data interface{}
+	decoder := json.NewDecoder(bytes.NewReader(value))
+	decoder.UseNumber()
+	if err = decoder.Decode(&data); err != nil {
+		return
+	}
+	err = codec.NewEncoderBytes(&res, newMsgpackHandle()).Encode(formatJSONNumber(data))
+	return
+}
+
+// formatJSONNumber 将 json.Number 转为 int64 或 float64
+func formatJSONNumber(data interface{}) interface{} {
+	switch v := data.(type) {
+	case json.Number:
+		if i, e := v.Int64(); e == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]interface{}:
+		for key, one := range v {
+			v[key] = formatJSONNumber(one)
+		}
+	case []interface{}:
+		for i, one := range v {
+			v[i] = formatJSONNumber(one)
+		}
+	}
+	return data
+}
@@ -0,0 +1,296 @@
+package codec
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCodecChain(t *testing.T) {
+	text := `{"id":1,"name":"张三","tags":["a","b"]}`
+	for _, name := range []string{"gzip", "snappy", "msgpack", "gzip,msgpack", "snappy,msgpack"} {
+		bs, err := Encode(name, text, nil)
+		if err != nil {
+			t.Fatal(name, err)
+		}
+		res, err := Decode(name, bs, nil)
+		if err != nil {
+			t.Fatal(name, err)
+		}
+		if res != text {
+			t.Fatal(name, "decode result error:", res)
+		}
+	}
+}
+
+func TestViewer(t *testing.T) {
+	raw := []byte{0x00, 0x01, 0xfe, 0xff}
+	for _, name := range []string{"hex", "base64"} {
+		text, err := Decode(name, raw, nil)
+		if err != nil {
+			t.Fatal(name, err)
+		}
+		bs, err := Encode(name, text, nil)
+		if err != nil {
+			t.Fatal(name, err)
+		}
+		if hex.EncodeToString(bs) != hex.EncodeToString(raw) {
+			t.Fatal(name, "encode result error:", bs)
+		}
+	}
+}
+
+func TestJavaDecode(t *testing.T) {
+	// new A(5)，class A implements Serializable { int x; }
+	bs, _ := hex.DecodeString("aced00057372000141000000000000000102000149000178787000000005")
+	res, err := Decode("java", bs, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != `{"@class":"A","x":5}` {
+		t.Fatal("java decode result error:", res)
+	}
+}
+
+func TestProtobuf(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "user.proto"), []byte(`syntax = "proto3";
+package demo;
+message User {
+  int64 id = 1;
+  string name = 2;
+}
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	option := &Option{ProtoDir: dir, MessageType: "demo.User"}
+	bs, err := Encode("protobuf", `{"id":"7","name":"abc"}`, option)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := Decode("protobuf", bs, option)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != `{"id":"7","name":"abc"}` {
+		t.Fatal("protobuf decode result error:", res)
+	}
+	_, err = Decode("protobuf", bs, &Option{})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConfluentAvro(t *testing.T) {
+	schema := `{"type":"record","name":"Order","namespace":"demo","fields":[
+{"name":"id","type":"long"},
+{"name":"name","type":["null","string"],"default":null},
+{"name":"status","type":{"type":"enum","name":"Status","symbols":["NEW","DONE"]}},
+{"name":"tags","type":{"type":"array","items":"string"}},
+{"name":"attrs","type":{"type":"map","values":"double"}},
+{"name":"next","type":["null","Order"],"default":null}]}`
+	// 模拟 schema registry
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/schemas/ids/7":
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"schema": schema})
+		case "/subjects/orders-value/versions/latest":
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"subject": "orders-value", "version": 1, "id": 7, "schema": schema})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"error_code":40403,"message":"Schema not found"}`))
+		}
+	}))
+	defer server.Close()
+
+	registry, err := GetSchemaRegistry(&RegistryConfig{Url: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	latest, err := registry.GetLatest("orders-value")
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := `{"id":1,"name":"a","status":"DONE","tags":["x","y"],"attrs":{"k":1.5},"next":{"id":2,"status":"NEW","tags":[],"attrs":{}}}`
+	bs, err := registry.Encode(latest, []byte(text), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bs[0] != 0 || bs[4] != 7 {
+		t.Fatal("confluent header error:", bs[:5])
+	}
+	res, _, err := registry.Decode(bs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(res) != `{"id":1,"name":"a","status":"DONE","tags":["x","y"],"attrs":{"k":1.5},"next":{"id":2,"name":null,"status":"NEW","tags":[],"attrs":{},"next":null}}` {
+		t.Fatal("avro decode result error:", string(res))
+	}
+	if _, err = registry.Encode(latest, []byte(`{"id":1,"status":"OTHER","tags":[],"attrs":{}}`), ""); err == nil {
+		t.Fatal("avro encode should fail with unknown enum symbol")
+	}
+	if _, err = registry.GetById(8); err == nil {
+		t.Fatal("schema id 8 should not found")
+	}
+}
+
+func TestConfluentProtobufAndJSON(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"common.proto": `syntax = "proto3";
+package demo;
+message Money {
+  int64 amount = 1;
+}
+`,
+		"orders-value.3.proto": `syntax = "proto3";
+package demo;
+import "common.proto";
+message Order {
+  message Item {
+    string sku = 1;
+    Money price = 2;
+  }
+  string id = 1;
+}
+`,
+		"users-value.4.json": `{"type":"object","required":["id"],"properties":{"id":{"type":"integer"},"role":{"$ref":"#/definitions/Role"}},
+"additionalProperties":false,"definitions":{"Role":{"enum":["admin","guest"]}}}`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	registry, err := GetSchemaRegistry(&RegistryConfig{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	schema, err := registry.GetLatest("orders-value")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs, err := registry.Encode(schema, []byte(`{"sku":"s1","price":{"amount":"5"}}`), "demo.Order.Item")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 嵌套 消息 的 下标 路径 为 [0,0]
+	if hex.EncodeToString(bs[5:8]) != "040000" {
+		t.Fatal("proto message indexes error:", hex.EncodeToString(bs))
+	}
+	res, _, err := registry.Decode(bs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(res) != `{"sku":"s1","price":{"amount":"5"}}` {
+		t.Fatal("protobuf decode result error:", string(res))
+	}
+
+	schema, err = registry.GetLatest("users-value")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs, err = registry.Encode(schema, []byte(`{"id": 1, "role": "admin"}`), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, _, err = registry.Decode(bs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(res) != `{"id":1,"role":"admin"}` {
+		t.Fatal("json schema decode result error:", string(res))
+	}
+	for _, text := range []string{`{"role":"admin"}`, `{"id":1,"role":"root"}`, `{"id":1.5}`, `{"id":1,"other":1}`} {
+		if _, err = registry.Encode(schema, []byte(text), ""); err == nil {
+			t.Fatal("json schema validate should fail:", text)
+		}
+	}
+}
+
+func TestAvroDecimal(t *testing.T) {
+	list := []struct {
+		schema string
+		text   string
+		hex    string
+		want   string
+	}{
+		{`{"type":"bytes","logicalType":"decimal","precision":10,"scale":2}`, `123.45`, "043039", `"123.45"`},
+		{`{"type":"bytes","logicalType":"decimal","precision":10,"scale":2}`, `"-1"`, "029c", `"-1.00"`},
+		{`{"type":"bytes","logicalType":"decimal","precision":10,"scale":2}`, `-0.5`, "02ce", `"-0.50"`},
+		{`{"type":"bytes","logicalType":"decimal","precision":10,"scale":2}`, `1.28`, "040080", `"1.28"`},
+		{`{"type":"bytes","logicalType":"decimal","precision":4}`, `0`, "0200", `"0"`},
+		// 超过 2^53 的 值 不 丢失 精度
+		{`{"type":"bytes","logicalType":"decimal","precision":20,"scale":0}`, `9007199254740993`, "0e20000000000001", `"9007199254740993"`},
+		{`{"type":"fixed","name":"Money","size":4,"logicalType":"decimal","precision":8,"scale":2}`, `-1.00`, "ffffff9c", `"-1.00"`},
+		{`{"type":"fixed","name":"Money","size":4,"logicalType":"decimal","precision":8,"scale":2}`, `"12.34"`, "000004d2", `"12.34"`},
+		// scale 大于 precision 时 logicalType 无效，按 bytes 处理
+		{`{"type":"bytes","logicalType":"decimal","precision":1,"scale":2}`, `"ab"`, "046162", `"ab"`},
+	}
+	for _, one := range list {
+		schema, err := ParseAvroSchema(one.schema)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bs, err := JSONToAvro(schema, []byte(one.text))
+		if err != nil {
+			t.Errorf("JSONToAvro(%s, %s) error: %v", one.schema, one.text, err)
+			continue
+		}
+		if hex.EncodeToString(bs) != one.hex {
+			t.Errorf("JSONToAvro(%s, %s) = %x, want %s", one.schema, one.text, bs, one.hex)
+		}
+		res, err := AvroToJSON(schema, bs)
+		if err != nil {
+			t.Errorf("AvroToJSON(%s, %x) error: %v", one.schema, bs, err)
+			continue
+		}
+		if string(res) != one.want {
+			t.Errorf("AvroToJSON(%s, %x) = %s, want %s", one.schema, bs, res, one.want)
+		}
+	}
+
+	errorList := []struct {
+		schema string
+		text   string
+	}{
+		{`{"type":"bytes","logicalType":"decimal","precision":10,"scale":2}`, `1.234`},
+		{`{"type":"bytes","logicalType":"decimal","precision":4,"scale":2}`, `123.45`},
+		{`{"type":"bytes","logicalType":"decimal","precision":10,"scale":2}`, `"abc"`},
+		{`{"type":"fixed","name":"Small","size":1,"logicalType":"decimal","precision":4,"scale":2}`, `2.00`},
+	}
+	for _, one := range errorList {
+		schema, err := ParseAvroSchema(one.schema)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = JSONToAvro(schema, []byte(one.text)); err == nil {
+			t.Errorf("JSONToAvro(%s, %s) should fail", one.schema, one.text)
+		}
+	}
+
+	// 命名 的 decimal fixed 被 引用 时 保留 logicalType，联合 类型 中 可用
+	schema, err := ParseAvroSchema(`{"type":"record","name":"Order","fields":[
+{"name":"price","type":{"type":"fixed","name":"Money","size":4,"logicalType":"decimal","precision":8,"scale":2}},
+{"name":"discount","type":["null","Money"],"default":null}]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs, err := JSONToAvro(schema, []byte(`{"price":"9.99","discount":"0.5"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := AvroToJSON(schema, bs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(res) != `{"price":"9.99","discount":"0.50"}` {
+		t.Fatal("avro decimal record result error:", string(res))
+	}
+}
@@ -0,0 +1,446 @@
+package codec
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/bufbuild/protocompile"
+	"github.com/bufbuild/protocompile/linker"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"strings"
+)
+
+// confluentMagicByte Confluent 格式：1 字节 0 + 4 字节 大端 schema id + 内容
+const confluentMagicByte = 0
+
+// ParseConfluent 拆分 Confluent 格式 的 schema id 与 内容
+func ParseConfluent(value []byte) (schemaId int, payload []byte, err error) {
+	if len(value) < 5 || value[0] != confluentMagicByte {
+		err = errors.New("value is not confluent schema registry format")
+		return
+	}
+	schemaId = int(binary.BigEndian.Uint32(value[1:5]))
+	payload = value[5:]
+	return
+}
+
+func confluentHeader(schemaId int) []byte {
+	header := make([]byte, 5)
+	header[0] = confluentMagicByte
+	binary.BigEndian.PutUint32(header[1:], uint32(schemaId))
+	return header
+}
+
+type protoSchema struct {
+	file     protoreflect.FileDescriptor
+	resolver linker.Resolver
+}
+
+// compile 解析 schema，结果 缓存 在 schema 上
+func (this_ *SchemaRegistry) compile(schema *Schema) (res interface{}, err error) {
+	schema.lock.Lock()
+	defer schema.lock.Unlock()
+	if schema.compiled != nil {
+		res = schema.compiled
+		return
+	}
+	switch schema.GetSchemaType() {
+	case SchemaTypeAvro:
+		res, err = ParseAvroSchema(schema.Schema)
+	case SchemaTypeProtobuf:
+		res, err = this_.compileProto(schema)
+	case SchemaTypeJSON:
+		var data interface{}
+		decoder := json.NewDecoder(strings.NewReader(schema.Schema))
+		decoder.UseNumber()
+		if err = decoder.Decode(&data); err != nil {
+			err = errors.New("json schema parse error:" + err.Error())
+			return
+		}
+		res = data
+	default:
+		err = errors.New("schema type [" + schema.SchemaType + "] not support")
+	}
+	if err != nil {
+		return
+	}
+	schema.compiled = res
+	return
+}
+
+// compileProto 本地 目录 按 目录 解析 import，仓库 按 references 获取 依赖
+func (this_ *SchemaRegistry) compileProto(schema *Schema) (res *protoSchema, err error) {
+	resolver := &protocompile.SourceResolver{}
+	name := schema.file
+	if name != "" {
+		resolver.ImportPaths = []string{this_.config.Dir}
+	} else {
+		name = fmt.Sprintf("schema-%d.proto", schema.Id)
+		sources := map[string]string{name: schema.Schema}
+		if err = this_.loadReferences(schema.References, sources, 0); err != nil {
+			return
+		}
+		resolver.Accessor = protocompile.SourceAccessorFromMap(sources)
+	}
+	compiler := protocompile.Compiler{
+		Resolver: protocompile.WithStandardImports(resolver),
+	}
+	files, err := compiler.Compile(context.Background(), name)
+	if err != nil {
+		return
+	}
+	res = &protoSchema{
+		file:     files[0],
+		resolver: files.AsResolver(),
+	}
+	return
+}
+
+const registryMaxReferenceDepth = 16
+
+func (this_ *SchemaRegistry) loadReferences(references []*SchemaReference, sources map[string]string, depth int) (err error) {
+	if depth > registryMaxReferenceDepth {
+		return errors.New("schema references are too deep")
+	}
+	for _, reference := range references {
+		if _, ok := sources[reference.Name]; ok {
+			continue
+		}
+		var one *Schema
+		if one, err = this_.getVersion(reference.Subject, reference.Version); err != nil {
+			return
+		}
+		sources[reference.Name] = one.Schema
+		if err = this_.loadReferences(one.References, sources, depth+1); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// Decode 按 内容 中 的 schema id 解码 为 JSON
+func (this_ *SchemaRegistry) Decode(value []byte) (res []byte, schema *Schema, err error) {
+	schemaId, payload, err := ParseConfluent(value)
+	if err != nil {
+		return
+	}
+	schema, err = this_.GetById(schemaId)
+	if err != nil {
+		return
+	}
+	compiled, err := this_.compile(schema)
+	if err != nil {
+		return
+	}
+	switch tV := compiled.(type) {
+	case *AvroSchema:
+		res, err = AvroToJSON(tV, payload)
+	case *protoSchema:
+		var md protoreflect.MessageDescriptor
+		if md, payload, err = readProtoMessageIndexes(tV.file, payload); err != nil {
+			return
+		}
+		res, err = ProtoToJSON(md, tV.resolver, payload)
+	default:
+		var buf bytes.Buffer
+		if err = json.Compact(&buf, payload); err != nil {
+			err = errors.New("json schema value is not json:" + err.Error())
+			return
+		}
+		res = buf.Bytes()
+	}
+	return
+}
+
+// Encode 按 schema 将 JSON 编码 为 Confluent 格式，messageType 为 protobuf 消息 全名，为 空 使用 第一 个 消息
+func (this_ *SchemaRegistry) Encode(schema *Schema, value []byte, messageType string) (res []byte, err error) {
+	compiled, err := this_.compile(schema)
+	if err != nil {
+		return
+	}
+	var payload []byte
+	switch tV := compiled.(type) {
+	case *AvroSchema:
+		payload, err = JSONToAvro(tV, value)
+	case *protoSchema:
+		var md protoreflect.MessageDescriptor
+		if md, err = findProtoMessage(tV, messageType); err != nil {
+			return
+		}
+		if payload, err = JSONToProto(md, tV.resolver, value); err != nil {
+			return
+		}
+		payload = append(protoMessageIndexes(md), payload...)
+	default:
+		var data interface{}
+		decoder := json.NewDecoder(bytes.NewReader(value))
+		decoder.UseNumber()
+		if err = decoder.Decode(&data); err != nil {
+			return
+		}
+		if err = validateJSONSchema(tV, tV, data, "$", 0); err != nil {
+			return
+		}
+		var buf bytes.Buffer
+		if err = json.Compact(&buf, value); err != nil {
+			return
+		}
+		payload = buf.Bytes()
+	}
+	if err != nil {
+		return
+	}
+	res = append(confluentHeader(schema.Id), payload...)
+	return
+}
+
+func findProtoMessage(schema *protoSchema, messageType string) (md protoreflect.MessageDescriptor, err error) {
+	if messageType == "" {
+		if schema.file.Messages().Len() == 0 {
+			err = errors.New("proto schema has no message")
+			return
+		}
+		md = schema.file.Messages().Get(0)
+		return
+	}
+	d, err := schema.resolver.FindDescriptorByName(protoreflect.FullName(strings.TrimPrefix(messageType, ".")))
+	if err != nil {
+		err = errors.New("proto message [" + messageType + "] not found")
+		return
+	}
+	md, ok := d.(protoreflect.MessageDescriptor)
+	if !ok || md.ParentFile().Path() != schema.file.Path() {
+		err = errors.New("proto message [" + messageType + "] not in schema")
+		return
+	}
+	return
+}
+
+// protoMessageIndexes 消息 在 文件 中 的 下标 路径，zigzag varint 编码，[0] 简写 为 0
+func protoMessageIndexes(md protoreflect.MessageDescriptor) (res []byte) {
+	var indexes []int
+	var d protoreflect.Descriptor = md
+	for {
+		if _, ok := d.(protoreflect.MessageDescriptor); !ok {
+			break
+		}
+		indexes = append([]int{d.Index()}, indexes...)
+		d = d.Parent()
+	}
+	if len(indexes) == 1 && indexes[0] == 0 {
+		return []byte{0}
+	}
+	res = protowire.AppendVarint(res, protowire.EncodeZigZag(int64(len(indexes))))
+	for _, index := range indexes {
+		res = protowire.AppendVarint(res, protowire.EncodeZigZag(int64(index)))
+	}
+	return
+}
+
+func readProtoMessageIndexes(file protoreflect.FileDescriptor, payload []byte) (md protoreflect.MessageDescriptor, rest []byte, err error) {
+	readInt := func() (v int64) {
+		u, n := protowire.ConsumeVarint(payload)
+		if n < 0 {
+			err = errors.New("proto message indexes error")
+			return
+		}
+		payload = payload[n:]
+		return protowire.DecodeZigZag(u)
+	}
+	count := readInt()
+	if err != nil {
+		return
+	}
+	indexes := []int64{0}
+	if count > 0 {
+		indexes = nil
+		for i := int64(0); i < count && err == nil; i++ {
+			indexes = append(indexes, readInt())
+		}
+		if err != nil {
+			return
+		}
+	}
+	messages := file.Messages()
+	for _, index := range indexes {
+		if index < 0 || index >= int64(messages.Len()) {
+			err = errors.New(fmt.Sprintf("proto message index %v not found", indexes))
+			return
+		}
+		md = messages.Get(int(index))
+		messages = md.Messages()
+	}
+	rest = payload
+	return
+}
+
+const jsonSchemaMaxDepth = 64
+
+// validateJSONSchema 校验 常用 关键字：type、enum、const、properties、required、additionalProperties、items、allOf、anyOf、oneOf 与 本地 $ref
+func validateJSONSchema(root interface{}, schema interface{}, data interface{}, path string, depth int) (err error) {
+	if depth > jsonSchemaMaxDepth {
+		return errors.New("json schema is too deep")
+	}
+	if b, ok := schema.(bool); ok {
+		if !b {
+			return errors.New("json value [" + path + "] is not allowed")
+		}
+		return
+	}
+	s, ok := schema.(map[string]interface{})
+	if !ok {
+		return
+	}
+	if ref, ok := s["$ref"].(string); ok {
+		var target interface{}
+		if target, err = jsonSchemaRef(root, ref); err != nil {
+			return
+		}
+		return validateJSONSchema(root, target, data, path, depth+1)
+	}
+	if t, find := s["type"]; find && !jsonTypeMatch(t, data) {
+		return errors.New(fmt.Sprintf("json value [%s] type must be %v", path, t))
+	}
+	if list, ok := s["enum"].([]interface{}); ok {
+		match := false
+		for _, one := range list {
+			if jsonEqual(one, data) {
+				match = true
+				break
+			}
+		}
+		if !match {
+			return errors.New(fmt.Sprintf("json value [%s] must be one of %v", path, list))
+		}
+	}
+	if one, find := s["const"]; find && !jsonEqual(one, data) {
+		return errors.New(fmt.Sprintf("json value [%s] must be %v", path, one))
+	}
+	if m, ok := data.(map[string]interface{}); ok {
+		required, _ := s["required"].([]interface{})
+		for _, one := range required {
+			if name, _ := one.(string); name != "" {
+				if _, find := m[name]; !find {
+					return errors.New("json value [" + path + "." + name + "] is required")
+				}
+			}
+		}
+		properties, _ := s["properties"].(map[string]interface{})
+		additional, hasAdditional := s["additionalProperties"]
+		for key, value := range m {
+			if property, find := properties[key]; find {
+				err = validateJSONSchema(root, property, value, path+"."+key, depth+1)
+			} else if hasAdditional {
+				err = validateJSONSchema(root, additional, value, path+"."+key, depth+1)
+			}
+			if err != nil {
+				return
+			}
+		}
+	}
+	if list, ok := data.([]interface{}); ok {
+		if items, find := s["items"]; find {
+			for i, one := range list {
+				if err = validateJSONSchema(root, items, one, fmt.Sprintf("%s[%d]", path, i), depth+1); err != nil {
+					return
+				}
+			}
+		}
+	}
+	if list, ok := s["allOf"].([]interface{}); ok {
+		for _, one := range list {
+			if err = validateJSONSchema(root, one, data, path, depth+1); err != nil {
+				return
+			}
+		}
+	}
+	if list, ok := s["anyOf"].([]interface{}); ok {
+		var match bool
+		for _, one := range list {
+			if validateJSONSchema(root, one, data, path, depth+1) == nil {
+				match = true
+				break
+			}
+		}
+		if !match {
+			return errors.New("json value [" + path + "] not match anyOf")
+		}
+	}
+	if list, ok := s["oneOf"].([]interface{}); ok {
+		var count int
+		for _, one := range list {
+			if validateJSONSchema(root, one, data, path, depth+1) == nil {
+				count++
+			}
+		}
+		if count != 1 {
+			return errors.New(fmt.Sprintf("json value [%s] match %d of oneOf", path, count))
+		}
+	}
+	return
+}
+
+// jsonSchemaRef 只 支持 当前 文档 内 的 引用，如 #/definitions/User、#/$defs/User
+func jsonSchemaRef(root interface{}, ref string) (res interface{}, err error) {
+	if !strings.HasPrefix(ref, "#") {
+		err = errors.New("json schema $ref [" + ref + "] not support")
+		return
+	}
+	res = root
+	for _, name := range strings.Split(strings.TrimPrefix(strings.TrimPrefix(ref, "#"), "/"), "/") {
+		if name == "" {
+			continue
+		}
+		name = strings.ReplaceAll(strings.ReplaceAll(name, "~1", "/"), "~0", "~")
+		m, _ := res.(map[string]interface{})
+		if res = m[name]; res == nil {
+			err = errors.New("json schema $ref [" + ref + "] not found")
+			return
+		}
+	}
+	return
+}
+
+func jsonTypeMatch(t interface{}, data interface{}) bool {
+	if list, ok := t.([]interface{}); ok {
+		for _, one := range list {
+			if jsonTypeMatch(one, data) {
+				return true
+			}
+		}
+		return false
+	}
+	name, _ := t.(string)
+	switch tV := data.(type) {
+	case nil:
+		return name == "null"
+	case bool:
+		return name == "boolean"
+	case string:
+		return name == "string"
+	case json.Number:
+		if name == "number" {
+			return true
+		}
+		if name == "integer" {
+			_, e := tV.Int64()
+			return e == nil
+		}
+		return false
+	case []interface{}:
+		return name == "array"
+	case map[string]interface{}:
+		return name == "object"
+	}
+	return false
+}
+
+func jsonEqual(a interface{}, b interface{}) bool {
+	as, _ := json.Marshal(a)
+	bs, _ := json.Marshal(b)
+	return bytes.Equal(as, bs)
+}
@@ -0,0 +1,616 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"unicode/utf16"
+)
+
+// Java 序列化 协议 常量，见 java.io.ObjectStreamConstants
+const (
+	javaStreamMagic   = 0xaced
+	javaStreamVersion = 5
+	javaBaseHandle    = 0x7e0000
+
+	tcNull           = 0x70
+	tcReference      = 0x71
+	tcClassDesc      = 0x72
+	tcObject         = 0x73
+	tcString         = 0x74
+	tcArray          = 0x75
+	tcClass          = 0x76
+	tcBlockData      = 0x77
+	tcEndBlockData   = 0x78
+	tcReset          = 0x79
+	tcBlockDataLong  = 0x7a
+	tcException      = 0x7b
+	tcLongString     = 0x7c
+	tcProxyClassDesc = 0x7d
+	tcEnum           = 0x7e
+
+	scWriteMethod    = 0x01
+	scSerializable   = 0x02
+	scExternalizable = 0x04
+	scBlockData      = 0x08
+
+	javaMaxDepth = 64
+)
+
+type javaField struct {
+	typeCode  byte
+	name      string
+	className string
+}
+
+type javaClassDesc struct {
+	name       string
+	flags      byte
+	fields     []*javaField
+	superClass *javaClassDesc
+}
+
+// javaObject 引用 未 完成 的 对象 时 只 输出 句柄，避免 循环
+type javaObject struct {
+	value    map[string]interface{}
+	complete bool
+	handle   int
+}
+
+type javaReader struct {
+	reader  *bytes.Reader
+	handles []interface{}
+	depth   int
+}
+
+type javaCodec struct {
+}
+
+// Decode 将 Java 序列化 数据 转为 JSON，只 支持 解码
+func (this_ *javaCodec) Decode(value []byte, option *Option) (res []byte, err error) {
+	data, err := JavaDecode(value)
+	if err != nil {
+		return
+	}
+	res, err = json.Marshal(data)
+	return
+}
+
+func (this_ *javaCodec) Encode(value []byte, option *Option) (res []byte, err error) {
+	err = errNotSupportEncode
+	return
+}
+
+// JavaDecode 解析 ObjectOutputStream 写入 的 内容，多个 对象 时 返回 数组
+func JavaDecode(value []byte) (res interface{}, err error) {
+	r := &javaReader{reader: bytes.NewReader(value)}
+	magic, err := r.readUint16()
+	if err != nil {
+		return
+	}
+	version, err := r.readUint16()
+	if err != nil {
+		return
+	}
+	if magic != javaStreamMagic || version != javaStreamVersion {
+		err = errors.New("not java serialization data")
+		return
+	}
+	var list []interface{}
+	for r.reader.Len() > 0 {
+		var one interface{}
+		one, err = r.readContent()
+		if err != nil {
+			return
+		}
+		list = append(list, r.output(one))
+	}
+	if len(list) == 1 {
+		res = list[0]
+	} else {
+		res = list
+	}
+	return
+}
+
+func (this_ *javaReader) readByte() (res byte, err error) {
+	res, err = this_.reader.ReadByte()
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return
+}
+
+func (this_ *javaReader) readBytes(size int64) (res []byte, err error) {
+	if size < 0 || size > int64(this_.reader.Len()) {
+		err = io.ErrUnexpectedEOF
+		return
+	}
+	res = make([]byte, size)
+	_, err = io.ReadFull(this_.reader, res)
+	return
+}
+
+func (this_ *javaReader) readUint16() (res uint16, err error) {
+	bs, err := this_.readBytes(2)
+	if err != nil {
+		return
+	}
+	res = binary.BigEndian.Uint16(bs)
+	return
+}
+
+func (this_ *javaReader) readInt32() (res int32, err error) {
+	bs, err := this_.readBytes(4)
+	if err != nil {
+		return
+	}
+	res = int32(binary.BigEndian.Uint32(bs))
+	return
+}
+
+func (this_ *javaReader) readInt64() (res int64, err error) {
+	bs, err := this_.readBytes(8)
+	if err != nil {
+		return
+	}
+	res = int64(binary.BigEndian.Uint64(bs))
+	return
+}
+
+// readUTF 读取 modified UTF-8 字符串
+func (this_ *javaReader) readUTF(size int64) (res string, err error) {
+	bs, err := this_.readBytes(size)
+	if err != nil {
+		return
+	}
+	var chars []uint16
+	for i := 0; i < len(bs); {
+		b := bs[i]
+		switch {
+		case b < 0x80:
+			chars = append(chars, uint16(b))
+			i++
+		case b&0xe0 == 0xc0 && i+1 < len(bs):
+			chars = append(chars, uint16(b&0x1f)<<6|uint16(bs[i+1]&0x3f))
+			i += 2
+		case b&0xf0 == 0xe0 && i+2 < len(bs):
+			chars = append(chars, uint16(b&0x0f)<<12|uint16(bs[i+1]&0x3f)<<6|uint16(bs[i+2]&0x3f))
+			i += 3
+		default:
+			err = errors.New("java modified utf-8 error")
+			return
+		}
+	}
+	res = string(utf16.Decode(chars))
+	return
+}
+
+func (this_ *javaReader) readShortUTF() (res string, err error) {
+	size, err := this_.readUint16()
+	if err != nil {
+		return
+	}
+	res, err = this_.readUTF(int64(size))
+	return
+}
+
+func (this_ *javaReader) newHandle(value interface{}) int {
+	this_.handles = append(this_.handles, value)
+	return len(this_.handles) - 1
+}
+
+func (this_ *javaReader) setHandle(handle int, value interface{}) {
+	this_.handles[handle] = value
+}
+
+func (this_ *javaReader) getHandle() (res interface{}, err error) {
+	handle, err := this_.readInt32()
+	if err != nil {
+		return
+	}
+	index := int(handle) - javaBaseHandle
+	if index < 0 || index >= len(this_.handles) {
+		err = errors.New(fmt.Sprintf("java reference handle [0x%x] not found", handle))
+		return
+	}
+	res = this_.handles[index]
+	return
+}
+
+// output 转为 输出 的 值
+func (this_ *javaReader) output(value interface{}) interface{} {
+	switch v := value.(type) {
+	case *javaObject:
+		if !v.complete {
+			return map[string]interface{}{"@ref": fmt.Sprintf("0x%x", javaBaseHandle+v.handle)}
+		}
+		return javaSimplify(v.value)
+	case *javaClassDesc:
+		return map[string]interface{}{"@classDesc": v.name}
+	}
+	return value
+}
+
+// javaSimplify 常用 类型 简化 输出
+func javaSimplify(value map[string]interface{}) interface{} {
+	className, _ := value["@class"].(string)
+	switch className {
+	case "java.lang.Boolean", "java.lang.Byte", "java.lang.Character", "java.lang.Short",
+		"java.lang.Integer", "java.lang.Long", "java.lang.Float", "java.lang.Double":
+		if v, ok := value["value"]; ok {
+			return v
+		}
+	case "java.util.ArrayList", "java.util.LinkedList", "java.util.HashSet", "java.util.LinkedHashSet", "java.util.TreeSet":
+		if annotations, ok := value["@annotations"].([]interface{}); ok {
+			var list = []interface{}{}
+			for _, one := range annotations {
+				if _, isBlock := one.(javaBlockData); isBlock {
+					continue
+				}
+				list = append(list, one)
+			}
+			return list
+		}
+	case "java.util.HashMap", "java.util.LinkedHashMap", "java.util.TreeMap", "java.util.Hashtable", "java.util.concurrent.ConcurrentHashMap":
+		if annotations, ok := value["@annotations"].([]interface{}); ok {
+			var entries []interface{}
+			for _, one := range annotations {
+				if _, isBlock := one.(javaBlockData); isBlock {
+					continue
+				}
+				entries = append(entries, one)
+			}
+			var res = map[string]interface{}{}
+			for i := 0; i+1 < len(entries); i += 2 {
+				res[fmt.Sprint(entries[i])] = entries[i+1]
+			}
+			return res
+		}
+	}
+	return value
+}
+
+// javaBlockData 自定义 写入 的 原始 数据，以 hex 输出
+type javaBlockData string
+
+func (this_ *javaReader) readContent() (res interface{}, err error) {
+	this_.depth++
+	defer func() { this_.depth-- }()
+	if this_.depth > javaMaxDepth {
+		err = errors.New("java object too deep")
+		return
+	}
+	tc, err := this_.readByte()
+	if err != nil {
+		return
+	}
+	switch tc {
+	case tcNull:
+		return
+	case tcReference:
+		res, err = this_.getHandle()
+	case tcClassDesc, tcProxyClassDesc:
+		_ = this_.reader.UnreadByte()
+		res, err = this_.readClassDesc()
+	case tcObject:
+		res, err = this_.readObject()
+	case tcString:
+		var s string
+		if s, err = this_.readShortUTF(); err == nil {
+			this_.newHandle(s)
+			res = s
+		}
+	case tcLongString:
+		var size int64
+		if size, err = this_.readInt64(); err == nil {
+			var s string
+			if s, err = this_.readUTF(size); err == nil {
+				this_.newHandle(s)
+				res = s
+			}
+		}
+	case tcArray:
+		res, err = this_.readArray()
+	case tcClass:
+		var desc *javaClassDesc
+		if desc, err = this_.readClassDesc(); err == nil {
+			res = map[string]interface{}{"@classType": javaClassName(desc)}
+			this_.newHandle(res)
+		}
+	case tcEnum:
+		res, err = this_.readEnum()
+	case tcBlockData:
+		var size byte
+		if size, err = this_.readByte(); err == nil {
+			res, err = this_.readBlockData(int64(size))
+		}
+	case tcBlockDataLong:
+		var size int32
+		if size, err = this_.readInt32(); err == nil {
+			res, err = this_.readBlockData(int64(size))
+		}
+	case tcReset:
+		this_.handles = nil
+		res, err = this_.readContent()
+	case tcException:
+		err = errors.New("java serialization contains exception")
+	default:
+		err = errors.New(fmt.Sprintf("java type code [0x%x] not support", tc))
+	}
+	return
+}
+
+func (this_ *javaReader) readBlockData(size int64) (res interface{}, err error) {
+	bs, err := this_.readBytes(size)
+	if err != nil {
+		return
+	}
+	res = javaBlockData(hex.EncodeToString(bs))
+	return
+}
+
+func javaClassName(desc *javaClassDesc) string {
+	if desc == nil {
+		return ""
+	}
+	return desc.name
+}
+
+// readClassDesc 读取 类 描述，可能 为 null、引用、普通 类、代理 类
+func (this_ *javaReader) readClassDesc() (desc *javaClassDesc, err error) {
+	tc, err := this_.readByte()
+	if err != nil {
+		return
+	}
+	switch tc {
+	case tcNull:
+		return
+	case tcReference:
+		var v interface{}
+		if v, err = this_.getHandle(); err != nil {
+			return
+		}
+		var ok bool
+		if desc, ok = v.(*javaClassDesc); !ok {
+			err = errors.New("java reference is not class desc")
+		}
+		return
+	case tcClassDesc:
+		desc = &javaClassDesc{}
+		if desc.name, err = this_.readShortUTF(); err != nil {
+			return
+		}
+		// serialVersionUID
+		if _, err = this_.readInt64(); err != nil {
+			return
+		}
+		this_.newHandle(desc)
+		if desc.flags, err = this_.readByte(); err != nil {
+			return
+		}
+		var count uint16
+		if count, err = this_.readUint16(); err != nil {
+			return
+		}
+		for i := 0; i < int(count); i++ {
+			field := &javaField{}
+			if field.typeCode, err = this_.readByte(); err != nil {
+				return
+			}
+			if field.name, err = this_.readShortUTF(); err != nil {
+				return
+			}
+			if field.typeCode == 'L' || field.typeCode == '[' {
+				var v interface{}
+				if v, err = this_.readContent(); err != nil {
+					return
+				}
+				field.className, _ = v.(string)
+			}
+			desc.fields = append(desc.fields, field)
+		}
+		if _, err = this_.readAnnotations(); err != nil {
+			return
+		}
+		desc.superClass, err = this_.readClassDesc()
+		return
+	case tcProxyClassDesc:
+		desc = &javaClassDesc{name: "$Proxy"}
+		this_.newHandle(desc)
+		var count int32
+		if count, err = this_.readInt32(); err != nil {
+			return
+		}
+		for i := 0; i < int(count); i++ {
+			if _, err = this_.readShortUTF(); err != nil {
+				return
+			}
+		}
+		if _, err = this_.readAnnotations(); err != nil {
+			return
+		}
+		desc.superClass, err = this_.readClassDesc()
+		return
+	}
+	err = errors.New(fmt.Sprintf("java class desc type code [0x%x] not support", tc))
+	return
+}
+
+// readAnnotations 读取 到 TC_ENDBLOCKDATA 为止
+func (this_ *javaReader) readAnnotations() (list []interface{}, err error) {
+	for {
+		var tc byte
+		if tc, err = this_.readByte(); err != nil {
+			return
+		}
+		if tc == tcEndBlockData {
+			return
+		}
+		_ = this_.reader.UnreadByte()
+		var one interface{}
+		if one, err = this_.readContent(); err != nil {
+			return
+		}
+		list = append(list, this_.output(one))
+	}
+}
+
+func (this_ *javaReader) readObject() (res interface{}, err error) {
+	desc, err := this_.readClassDesc()
+	if err != nil {
+		return
+	}
+	obj := &javaObject{
+		value: map[string]interface{}{"@class": javaClassName(desc)},
+	}
+	obj.handle = this_.newHandle(obj)
+	res = obj
+
+	// 从 父类 到 子类 依次 读取
+	var hierarchy []*javaClassDesc
+	for one := desc; one != nil; one = one.superClass {
+		hierarchy = append([]*javaClassDesc{one}, hierarchy...)
+	}
+	var annotations []interface{}
+	for _, one := range hierarchy {
+		if one.flags&scExternalizable != 0 {
+			if one.flags&scBlockData == 0 {
+				err = errors.New("java externalizable class [" + one.name + "] not support")
+				return
+			}
+			var list []interface{}
+			if list, err = this_.readAnnotations(); err != nil {
+				return
+			}
+			annotations = append(annotations, list...)
+			continue
+		}
+		if one.flags&scSerializable == 0 {
+			continue
+		}
+		for _, field := range one.fields {
+			var v interface{}
+			if v, err = this_.readFieldValue(field.typeCode); err != nil {
+				return
+			}
+			obj.value[field.name] = v
+		}
+		if one.flags&scWriteMethod != 0 {
+			var list []interface{}
+			if list, err = this_.readAnnotations(); err != nil {
+				return
+			}
+			annotations = append(annotations, list...)
+		}
+	}
+	if len(annotations) > 0 {
+		obj.value["@annotations"] = annotations
+	}
+	obj.complete = true
+	return
+}
+
+func (this_ *javaReader) readFieldValue(typeCode byte) (res interface{}, err error) {
+	switch typeCode {
+	case 'B':
+		var b byte
+		b, err = this_.readByte()
+		res = int8(b)
+	case 'C':
+		var v uint16
+		v, err = this_.readUint16()
+		res = string(rune(v))
+	case 'D':
+		var v int64
+		v, err = this_.readInt64()
+		res = math.Float64frombits(uint64(v))
+	case 'F':
+		var v int32
+		v, err = this_.readInt32()
+		res = math.Float32frombits(uint32(v))
+	case 'I':
+		res, err = this_.readInt32()
+	case 'J':
+		res, err = this_.readInt64()
+	case 'S':
+		var v uint16
+		v, err = this_.readUint16()
+		res = int16(v)
+	case 'Z':
+		var b byte
+		b, err = this_.readByte()
+		res = b != 0
+	case 'L', '[':
+		var v interface{}
+		if v, err = this_.readContent(); err != nil {
+			return
+		}
+		res = this_.output(v)
+	default:
+		err = errors.New(fmt.Sprintf("java field type code [%c] not support", typeCode))
+	}
+	return
+}
+
+func (this_ *javaReader) readArray() (res interface{}, err error) {
+	desc, err := this_.readClassDesc()
+	if err != nil {
+		return
+	}
+	handle := this_.newHandle(nil)
+	size, err := this_.readInt32()
+	if err != nil {
+		return
+	}
+	if size < 0 || int(size) > this_.reader.Len() {
+		err = errors.New("java array size error")
+		return
+	}
+	var typeCode byte = 'L'
+	if name := javaClassName(desc); len(name) > 1 {
+		typeCode = name[1]
+	}
+	// byte[] 以 hex 输出
+	if typeCode == 'B' {
+		var bs []byte
+		if bs, err = this_.readBytes(int64(size)); err != nil {
+			return
+		}
+		res = hex.EncodeToString(bs)
+		this_.setHandle(handle, res)
+		return
+	}
+	var list = make([]interface{}, 0, size)
+	for i := 0; i < int(size); i++ {
+		var v interface{}
+		if v, err = this_.readFieldValue(typeCode); err != nil {
+			return
+		}
+		list = append(list, v)
+	}
+	res = list
+	this_.setHandle(handle, res)
+	return
+}
+
+func (this_ *javaReader) readEnum() (res interface{}, err error) {
+	desc, err := this_.readClassDesc()
+	if err != nil {
+		return
+	}
+	handle := this_.newHandle(nil)
+	v, err := this_.readContent()
+	if err != nil {
+		return
+	}
+	name, _ := v.(string)
+	res = map[string]interface{}{"@enum": javaClassName(desc), "value": name}
+	this_.setHandle(handle, res)
+	return
+}
@@ -0,0 +1,279 @@
+package codec
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/bufbuild/protocompile"
+	"github.com/bufbuild/protocompile/linker"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// protoFiles 目录 编译 结果，文件 变更 后 重新 编译
+type protoFiles struct {
+	sign     string
+	resolver linker.Resolver
+	messages []string
+}
+
+var (
+	protoFilesCache = map[string]*protoFiles{}
+	protoFilesLock  = &sync.Mutex{}
+)
+
+// listProtoFiles 获取 目录 下 所有 .proto 文件 的 相对 路径，以及 用于 判断 是否 变更 的 签名
+func listProtoFiles(dir string) (names []string, sign string, err error) {
+	var sb strings.Builder
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(d.Name(), ".proto") {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		name, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		name = filepath.ToSlash(name)
+		names = append(names, name)
+		sb.WriteString(fmt.Sprintf("%s:%d:%d;", name, info.Size(), info.ModTime().UnixNano()))
+		return nil
+	})
+	sort.Strings(names)
+	sign = sb.String()
+	return
+}
+
+// LoadProtoDir 编译 目录 下 所有 .proto 文件，目录 即为 import 路径
+func LoadProtoDir(dir string) (resolver linker.Resolver, messages []string, err error) {
+	if dir == "" {
+		err = errors.New("proto dir is empty")
+		return
+	}
+	if _, err = os.Stat(dir); err != nil {
+		return
+	}
+	names, sign, err := listProtoFiles(dir)
+	if err != nil {
+		return
+	}
+	if len(names) == 0 {
+		err = errors.New("proto dir [" + dir + "] has no .proto file")
+		return
+	}
+
+	protoFilesLock.Lock()
+	defer protoFilesLock.Unlock()
+
+	find := protoFilesCache[dir]
+	if find != nil && find.sign == sign {
+		resolver = find.resolver
+		messages = find.messages
+		return
+	}
+	compiler := protocompile.Compiler{
+		Resolver: protocompile.WithStandardImports(&protocompile.SourceResolver{
+			ImportPaths: []string{dir},
+		}),
+	}
+	files, err := compiler.Compile(context.Background(), names...)
+	if err != nil {
+		return
+	}
+	for _, file := range files {
+		appendMessages(&messages, file.Messages())
+	}
+	sort.Strings(messages)
+	resolver = files.AsResolver()
+	protoFilesCache[dir] = &protoFiles{
+		sign:     sign,
+		resolver: resolver,
+		messages: messages,
+	}
+	return
+}
+
+func appendMessages(messages *[]string, list protoreflect.MessageDescriptors) {
+	for i := 0; i < list.Len(); i++ {
+		one := list.Get(i)
+		if one.IsMapEntry() {
+			continue
+		}
+		*messages = append(*messages, string(one.FullName()))
+		appendMessages(messages, one.Messages())
+	}
+}
+
+// FindMessage 在 目录 中 查找 消息 类型
+func FindMessage(dir string, messageType string) (md protoreflect.MessageDescriptor, resolver linker.Resolver, err error) {
+	resolver, _, err = LoadProtoDir(dir)
+	if err != nil {
+		return
+	}
+	d, err := resolver.FindDescriptorByName(protoreflect.FullName(strings.TrimPrefix(messageType, ".")))
+	if err != nil {
+		err = errors.New("proto message [" + messageType + "] not found")
+		return
+	}
+	md, ok := d.(protoreflect.MessageDescriptor)
+	if !ok {
+		err = errors.New("proto [" + messageType + "] is not message")
+		return
+	}
+	return
+}
+
+// ProtoToJSON 按 消息 描述 解码 为 JSON
+func ProtoToJSON(md protoreflect.MessageDescriptor, resolver linker.Resolver, value []byte) (res []byte, err error) {
+	msg := dynamicpb.NewMessage(md)
+	err = proto.UnmarshalOptions{Resolver: resolver}.Unmarshal(value, msg)
+	if err != nil {
+		return
+	}
+	bs, err := protojson.MarshalOptions{Resolver: resolver, UseProtoNames: true, EmitUnpopulated: true}.Marshal(msg)
+	if err != nil {
+		return
+	}
+	// protojson 输出 的 空白 不固定，统一 压缩
+	var buf bytes.Buffer
+	if err = json.Compact(&buf, bs); err != nil {
+		return
+	}
+	res = buf.Bytes()
+	return
+}
+
+// JSONToProto 按 消息 描述 将 JSON 编码 为 protobuf
+func JSONToProto(md protoreflect.MessageDescriptor, resolver linker.Resolver, value []byte) (res []byte, err error) {
+	msg := dynamicpb.NewMessage(md)
+	err = protojson.UnmarshalOptions{Resolver: resolver}.Unmarshal(value, msg)
+	if err != nil {
+		return
+	}
+	res, err = proto.Marshal(msg)
+	return
+}
+
+type protobufCodec struct {
+}
+
+// Decode 未 指定 消息 类型 时 按 字段 编号 解析 原始 结构
+func (this_ *protobufCodec) Decode(value []byte, option *Option) (res []byte, err error) {
+	if option.MessageType == "" {
+		var fields []*ProtoRawField
+		fields, err = ProtoRawDecode(value, 0)
+		if err != nil {
+			return
+		}
+		res, err = json.Marshal(fields)
+		return
+	}
+	md, resolver, err := FindMessage(option.ProtoDir, option.MessageType)
+	if err != nil {
+		return
+	}
+	res, err = ProtoToJSON(md, resolver, value)
+	return
+}
+
+func (this_ *protobufCodec) Encode(value []byte, option *Option) (res []byte, err error) {
+	if option.MessageType == "" {
+		err = errors.New("protobuf encode need message type")
+		return
+	}
+	md, resolver, err := FindMessage(option.ProtoDir, option.MessageType)
+	if err != nil {
+		return
+	}
+	res, err = JSONToProto(md, resolver, value)
+	return
+}
+
+type ProtoRawField struct {
+	Number  int32            `json:"number"`
+	Type    string           `json:"type"` // varint、fixed32、fixed64、bytes、string、message
+	Value   interface{}      `json:"value,omitempty"`
+	Message []*ProtoRawField `json:"message,omitempty"`
+}
+
+const protoRawMaxDepth = 16
+
+// ProtoRawDecode 无 消息 描述 时 解析 wire 格式，bytes 尝试 按 嵌套 消息、文本 解析
+func ProtoRawDecode(value []byte, depth int) (fields []*ProtoRawField, err error) {
+	fields = []*ProtoRawField{}
+	for len(value) > 0 {
+		number, wireType, n := protowire.ConsumeTag(value)
+		if n < 0 {
+			err = protowire.ParseError(n)
+			return
+		}
+		value = value[n:]
+		field := &ProtoRawField{Number: int32(number)}
+		switch wireType {
+		case protowire.VarintType:
+			var v uint64
+			v, n = protowire.ConsumeVarint(value)
+			field.Type = "varint"
+			field.Value = v
+		case protowire.Fixed32Type:
+			var v uint32
+			v, n = protowire.ConsumeFixed32(value)
+			field.Type = "fixed32"
+			field.Value = v
+		case protowire.Fixed64Type:
+			var v uint64
+			v, n = protowire.ConsumeFixed64(value)
+			field.Type = "fixed64"
+			field.Value = v
+		case protowire.BytesType:
+			var v []byte
+			v, n = protowire.ConsumeBytes(value)
+			if n < 0 {
+				break
+			}
+			if depth < protoRawMaxDepth && len(v) > 0 {
+				if message, e := ProtoRawDecode(v, depth+1); e == nil {
+					field.Type = "message"
+					field.Message = message
+					break
+				}
+			}
+			if utf8.Valid(v) {
+				field.Type = "string"
+				field.Value = string(v)
+			} else {
+				field.Type = "bytes"
+				field.Value = base64.StdEncoding.EncodeToString(v)
+			}
+		default:
+			err = errors.New(fmt.Sprintf("proto wire type [%d] not support", wireType))
+			return
+		}
+		if n < 0 {
+			err = protowire.ParseError(n)
+			return
+		}
+		value = value[n:]
+		fields = append(fields, field)
+	}
+	return
+}
@@ -0,0 +1,307 @@
+package codec
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	SchemaTypeAvro     = "AVRO"
+	SchemaTypeProtobuf = "PROTOBUF"
+	SchemaTypeJSON     = "JSON"
+
+	// registryLatestCacheTime subject 最新 版本 与 本地 目录 的 缓存 时间，仓库 中 schema id 对应 的 内容 不会 变化，一直 缓存
+	registryLatestCacheTime = 60 * time.Second
+	registryTimeout         = 10 * time.Second
+)
+
+// RegistryConfig Url 为 Confluent Schema Registry 地址，Dir 为 本地 schema 目录，优先 使用 Url
+type RegistryConfig struct {
+	Url      string `json:"url,omitempty"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	Dir      string `json:"dir,omitempty"`
+}
+
+type SchemaReference struct {
+	Name    string `json:"name"`
+	Subject string `json:"subject"`
+	Version int    `json:"version"`
+}
+
+type Schema struct {
+	Id         int                `json:"id"`
+	Subject    string             `json:"subject,omitempty"`
+	Version    int                `json:"version,omitempty"`
+	SchemaType string             `json:"schemaType,omitempty"` // 为 空 表示 AVRO
+	Schema     string             `json:"schema"`
+	References []*SchemaReference `json:"references,omitempty"`
+
+	// file 本地 目录 中 的 文件 相对 路径
+	file     string
+	compiled interface{}
+	lock     sync.Mutex
+}
+
+// GetSchemaType 返回 大写 的 schema 类型，为 空 时 为 AVRO
+func (this_ *Schema) GetSchemaType() string {
+	if this_.SchemaType == "" {
+		return SchemaTypeAvro
+	}
+	return strings.ToUpper(this_.SchemaType)
+}
+
+type registryLatest struct {
+	schema *Schema
+	time   time.Time
+}
+
+// SchemaRegistry schema 仓库，同一 配置 共用 缓存
+type SchemaRegistry struct {
+	config   *RegistryConfig
+	client   *http.Client
+	idCache  map[int]*Schema
+	latest   map[string]*registryLatest
+	versions map[string]*Schema
+	// localList 本地 目录 按 缓存 时间 重新 读取，修改 文件 后 生效
+	localList []*Schema
+	localTime time.Time
+	lock      sync.Mutex
+}
+
+var (
+	registryCache     = map[string]*SchemaRegistry{}
+	registryCacheLock = &sync.Mutex{}
+)
+
+// GetSchemaRegistry 按 配置 获取 schema 仓库，配置 变化 时 重新 创建
+func GetSchemaRegistry(config *RegistryConfig) (registry *SchemaRegistry, err error) {
+	if config == nil || (config.Url == "" && config.Dir == "") {
+		err = errors.New("schema registry url and schema dir are both empty")
+		return
+	}
+	key := strings.Join([]string{config.Url, config.Username, config.Password, config.Dir}, "\n")
+
+	registryCacheLock.Lock()
+	defer registryCacheLock.Unlock()
+
+	registry = registryCache[key]
+	if registry == nil {
+		registry = &SchemaRegistry{
+			config:   config,
+			client:   &http.Client{Timeout: registryTimeout},
+			idCache:  map[int]*Schema{},
+			latest:   map[string]*registryLatest{},
+			versions: map[string]*Schema{},
+		}
+		registryCache[key] = registry
+	}
+	return
+}
+
+func (this_ *SchemaRegistry) get(path string, res interface{}) (err error) {
+	request, err := http.NewRequest("GET", strings.TrimRight(this_.config.Url, "/")+path, nil)
+	if err != nil {
+		return
+	}
+	request.Header.Set("Accept", "application/vnd.schemaregistry.v1+json, application/json")
+	if this_.config.Username != "" || this_.config.Password != "" {
+		request.SetBasicAuth(this_.config.Username, this_.config.Password)
+	}
+	response, err := this_.client.Do(request)
+	if err != nil {
+		return
+	}
+	defer func() { _ = response.Body.Close() }()
+	bs, err := io.ReadAll(response.Body)
+	if err != nil {
+		return
+	}
+	if response.StatusCode != http.StatusOK {
+		var registryErr struct {
+			ErrorCode int    `json:"error_code"`
+			Message   string `json:"message"`
+		}
+		_ = json.Unmarshal(bs, &registryErr)
+		if registryErr.Message == "" {
+			registryErr.Message = string(bs)
+		}
+		err = errors.New(fmt.Sprintf("schema registry [%s] error, status:%d, %s", path, response.StatusCode, registryErr.Message))
+		return
+	}
+	err = json.Unmarshal(bs, res)
+	return
+}
+
+// GetById 按 schema id 获取，用于 解码
+func (this_ *SchemaRegistry) GetById(id int) (schema *Schema, err error) {
+	if this_.config.Url == "" {
+		var list []*Schema
+		if list, err = this_.listLocal(); err != nil {
+			return
+		}
+		for _, one := range list {
+			if one.Id == id {
+				schema = one
+				return
+			}
+		}
+		err = errors.New(fmt.Sprintf("schema id [%d] not found in dir [%s]", id, this_.config.Dir))
+		return
+	}
+
+	this_.lock.Lock()
+	schema = this_.idCache[id]
+	this_.lock.Unlock()
+	if schema != nil {
+		return
+	}
+
+	schema = &Schema{}
+	if err = this_.get(fmt.Sprintf("/schemas/ids/%d", id), schema); err != nil {
+		return
+	}
+	schema.Id = id
+
+	this_.lock.Lock()
+	defer this_.lock.Unlock()
+	if find := this_.idCache[id]; find != nil {
+		schema = find
+		return
+	}
+	this_.idCache[id] = schema
+	return
+}
+
+// GetLatest 获取 subject 最新 版本，用于 编码
+func (this_ *SchemaRegistry) GetLatest(subject string) (schema *Schema, err error) {
+	this_.lock.Lock()
+	find := this_.latest[subject]
+	this_.lock.Unlock()
+	if find != nil && time.Since(find.time) < registryLatestCacheTime {
+		schema = find.schema
+		return
+	}
+
+	if this_.config.Url != "" {
+		schema = &Schema{}
+		if err = this_.get("/subjects/"+url.PathEscape(subject)+"/versions/latest", schema); err != nil {
+			return
+		}
+	} else {
+		var list []*Schema
+		if list, err = this_.listLocal(); err != nil {
+			return
+		}
+		for _, one := range list {
+			if one.Subject == subject && (schema == nil || one.Id > schema.Id) {
+				schema = one
+			}
+		}
+		if schema == nil {
+			err = errors.New("schema subject [" + subject + "] not found in dir [" + this_.config.Dir + "]")
+			return
+		}
+	}
+	this_.lock.Lock()
+	defer this_.lock.Unlock()
+	this_.latest[subject] = &registryLatest{schema: schema, time: time.Now()}
+	return
+}
+
+// getVersion 获取 引用 的 schema，只 用于 仓库 地址
+func (this_ *SchemaRegistry) getVersion(subject string, version int) (schema *Schema, err error) {
+	key := fmt.Sprintf("%s:%d", subject, version)
+	this_.lock.Lock()
+	schema = this_.versions[key]
+	this_.lock.Unlock()
+	if schema != nil {
+		return
+	}
+	schema = &Schema{}
+	if err = this_.get(fmt.Sprintf("/subjects/%s/versions/%d", url.PathEscape(subject), version), schema); err != nil {
+		return
+	}
+
+	this_.lock.Lock()
+	defer this_.lock.Unlock()
+	this_.versions[key] = schema
+	return
+}
+
+// listLocal 读取 本地 目录，文件 名 为 [subject.]id.avsc|proto|json，没有 id 的 文件 只 作为 protobuf import 使用
+func (this_ *SchemaRegistry) listLocal() (list []*Schema, err error) {
+	this_.lock.Lock()
+	defer this_.lock.Unlock()
+	if this_.localList != nil && time.Since(this_.localTime) < registryLatestCacheTime {
+		list = this_.localList
+		return
+	}
+
+	dir := this_.config.Dir
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		ext := filepath.Ext(info.Name())
+		var schemaType string
+		switch ext {
+		case ".avsc":
+			schemaType = SchemaTypeAvro
+		case ".proto":
+			schemaType = SchemaTypeProtobuf
+		case ".json":
+			schemaType = SchemaTypeJSON
+		default:
+			return nil
+		}
+		name := strings.TrimSuffix(info.Name(), ext)
+		var subject string
+		if index := strings.LastIndex(name, "."); index >= 0 {
+			subject = name[:index]
+			name = name[index+1:]
+		}
+		id, e := strconv.Atoi(name)
+		if e != nil {
+			return nil
+		}
+		bs, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		file, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		list = append(list, &Schema{
+			Id:         id,
+			Subject:    subject,
+			SchemaType: schemaType,
+			Schema:     string(bs),
+			file:       filepath.ToSlash(file),
+		})
+		return nil
+	})
+	if err != nil {
+		return
+	}
+	if list == nil {
+		list = []*Schema{}
+	}
+	this_.localList = list
+	this_.localTime = time.Now()
+	return
+}